@@ -2,50 +2,114 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"gmaildigest-go/internal/app"
 	"gmaildigest-go/internal/config"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"syscall"
+	"time"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// shutdownTimeout bounds how long a graceful shutdown may take
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	log.SetPrefix("gmaildigest: ")
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+}
+
+// run parses args, then serves until SIGINT or SIGTERM. Errors from flags,
+// configuration or startup are returned so main can exit non-zero.
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("gmaildigest", flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "path to the configuration file")
+	showVersion := flags.Bool("version", false, "print version information and exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *showVersion {
+		fmt.Fprintln(stdout, versionString())
+		return nil
+	}
+
 	// Load configuration
-	cfg, err := config.LoadFromFile("./configs/config.json")
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		return fmt.Errorf("failed to load config: %w", err)
 	}
 
 	// Create a new application instance
 	application, err := app.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create application: %v", err)
+		return fmt.Errorf("failed to create application: %w", err)
 	}
 
-	// Create a context that we can cancel
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Reload the live-safe settings on SIGHUP
+	watcher := config.NewWatcher(*configPath, cfg, application.Logger())
+	watcher.OnReload(application.ApplyConfig)
+	watcher.Start()
+	defer watcher.Stop()
 
-	// Set up signal handling for graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
 	go func() {
-		sigchan := make(chan os.Signal, 1)
-		signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigchan
-		log.Println("Shutdown signal received, initiating graceful shutdown...")
-		if err := application.Stop(ctx); err != nil {
-			log.Printf("Error during graceful shutdown: %v", err)
-		}
-		cancel()
+		errCh <- application.Run()
 	}()
 
-	// Start the application
-	if err := application.Start(ctx); err != nil {
-		log.Fatalf("Application failed to start: %v", err)
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("application failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	application.Logger().Info("Shutdown signal received, initiating graceful shutdown")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := application.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error during graceful shutdown: %w", err)
 	}
 
-	log.Println("Application has stopped.")
-} 
\ No newline at end of file
+	application.Logger().Info("Application has stopped")
+	return nil
+}
+
+// versionString describes the binary using the version and the build info
+// embedded by the Go toolchain
+func versionString() string {
+	s := "gmaildigest " + version
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return s
+	}
+	s += " (" + info.GoVersion
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			s += ", " + setting.Key + "=" + setting.Value
+		}
+	}
+	return s + ")"
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_InvalidConfigPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+	err := run([]string{"-config", path}, io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load config")
+}
+
+func TestRun_UnknownFlag(t *testing.T) {
+	assert.Error(t, run([]string{"-bogus"}, io.Discard))
+}
+
+func TestRun_Version(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, run([]string{"-version"}, &out))
+	assert.Contains(t, out.String(), "gmaildigest "+version)
+}
@@ -3,83 +3,155 @@ package app
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"gmaildigest-go/internal/auth"
 	"gmaildigest-go/internal/config"
+	"gmaildigest-go/internal/metrics"
 	"gmaildigest-go/internal/scheduler"
 	"gmaildigest-go/internal/session"
 	"gmaildigest-go/internal/storage"
 	"gmaildigest-go/internal/telegram"
 	"gmaildigest-go/internal/worker"
 	"gmaildigest-go/internal/summary"
-
-	"github.com/go-co-op/gocron/v2"
 )
 
+// defaultWorkerDrainTimeout bounds how long Shutdown waits for running jobs
+// when its context has no deadline
+const defaultWorkerDrainTimeout = 10 * time.Second
+
 // Application holds the application's dependencies
 type Application struct {
-	logger          *log.Logger
+	logger          *slog.Logger
+	logLevel        *slog.LevelVar
+	configMu        sync.RWMutex
 	config          *config.Config
 	server          *http.Server
-	authService     *auth.AuthService
+	authService     *auth.OAuthManager
+	stateStore      auth.StateStore
+	pkceStore       auth.PKCEStore
+	oauthSweeper    *auth.OAuthStateSweeper
 	sessionStore    session.Store
+	sessionSweeper  *session.Sweeper
 	storage         storage.Storage
 	tokenStore      *storage.TokenStore
-	scheduler       gocron.Scheduler
-	workerPool      *worker.Pool
+	scheduler       *scheduler.Scheduler
+	workerPool      *worker.WorkerPool
 	telegramService *telegram.Service
-	summaryService  *summary.Service
+	telegramLinks   *telegram.LinkSigner
+	webhookSecret   string
+	summaryService  summary.Summarizer
 	digestJob       *scheduler.DigestJob
+	tokenRefresh    *scheduler.TokenRefreshService
+	metricsServer   *http.Server
 }
 
 // New creates a new Application.
 func New(cfg *config.Config) (*Application, error) {
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(parseLevel(cfg.LogLevel))
+	logger := newLogger(os.Stdout, logLevel)
 
-	db, err := storage.NewSQLiteStorage(cfg.DBPath)
+	// OpenDatabase applies the pool settings and busy timeout, then migrates
+	db, err := storage.OpenDatabase(storageConfig(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage: %w", err)
 	}
 
-	if err := db.Migrate(); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	encryptionKey, err := cfg.EncryptionKeyBytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	tokenStore, err := storage.NewTokenStore(db, encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token store: %w", err)
 	}
 
-	tokenStore := storage.NewTokenStore(db, []byte(cfg.EncryptionKey))
-
-	authService, err := auth.New(
-		cfg.Auth.ClientID,
-		cfg.Auth.ClientSecret,
-		fmt.Sprintf("http://localhost:%d/auth/callback", cfg.HTTPPort),
+	var (
+		stateStore   auth.StateStore
+		pkceStore    auth.PKCEStore
+		oauthSweeper *auth.OAuthStateSweeper
 	)
-	if err != nil {
+	if cfg.Auth.PersistOAuthState {
+		ttl := cfg.Auth.OAuthStateTTL.Duration
+		stateStore = auth.NewSQLiteStateStore(db, ttl)
+		pkceStore = auth.NewSQLitePKCEStore(db, ttl)
+		oauthSweeper = auth.NewOAuthStateSweeper(db, ttl, 0, logger)
+	} else {
+		stateStore = auth.NewInMemoryStateStore()
+		pkceStore = auth.NewInMemoryPKCEStore()
+	}
+
+	authService := auth.NewOAuthManager(tokenStore, pkceStore, stateStore)
+	if err := authService.LoadCredentials(cfg.Auth.CredentialsPath); err != nil {
 		return nil, fmt.Errorf("failed to create auth service: %w", err)
 	}
+	authService.SetScopes(cfg.Auth.Scopes)
+	authService.SetUserRegistry(db)
+	authService.SetRedirectURL(fmt.Sprintf("http://localhost:%d/auth/callback", cfg.HTTPPort))
+
+	var (
+		sessionStore   session.Store
+		sessionSweeper *session.Sweeper
+	)
+	maxLifetime := session.DefaultMaxLifetime
+	if cfg.Session.MaxLifetime.Duration > 0 {
+		maxLifetime = cfg.Session.MaxLifetime.Duration
+	}
+	if cfg.Session.Persist {
+		store := session.NewSQLiteSessionStore(db)
+		store.SetMaxLifetime(maxLifetime)
+		sessionStore = store
+		sessionSweeper = session.NewSweeper(db, cfg.Session.CleanupInterval.Duration, logger)
+	} else {
+		store := session.NewInMemoryStore()
+		store.SetMaxLifetime(maxLifetime)
+		sessionStore = store
+	}
 
-	sessionStore := session.NewInMemoryStore()
-	workerPool := worker.NewPool(cfg.NumWorkers)
+	workerPool := worker.NewWorkerPoolWithConfig(cfg.NumWorkers, cfg.WorkerQueueSize)
 
 	telegramService, err := telegram.NewService(cfg.Telegram.BotToken, cfg.HTTPPort, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create telegram service: %w", err)
 	}
+	telegramLinks := telegram.NewLinkSigner(encryptionKey, telegram.DefaultLinkTTL)
+	telegramService.SetLinkSigner(telegramLinks)
 
-	summaryService := summary.NewService(cfg.OpenAI.APIKey)
+	summaryConfig := cfg.Summary
+	if summaryConfig.OpenAIAPIKey == "" {
+		summaryConfig.OpenAIAPIKey = cfg.OpenAI.APIKey
+	}
+	summaryService, err := summary.NewSummarizer(summaryConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create summarizer: %w", err)
+	}
 	digestJob := scheduler.NewDigestJob(logger, db, tokenStore, summaryService, telegramService)
+	digestJob.SetMarkRead(cfg.Gmail.MarkRead)
+	digestJob.SetForwardEmail(cfg.Gmail.ForwardEmail)
+	digestJob.SetMaxBodyChars(cfg.Summary.MaxBodyChars)
 
 	app := &Application{
 		logger:          logger,
+		logLevel:        logLevel,
 		config:          cfg,
 		authService:     authService,
+		stateStore:      stateStore,
+		pkceStore:       pkceStore,
+		oauthSweeper:    oauthSweeper,
 		sessionStore:    sessionStore,
+		sessionSweeper:  sessionSweeper,
 		storage:         db,
 		tokenStore:      tokenStore,
 		workerPool:      workerPool,
 		telegramService: telegramService,
+		telegramLinks:   telegramLinks,
+		webhookSecret:   cfg.Telegram.WebhookSecret,
 		summaryService:  summaryService,
 		digestJob:       digestJob,
 	}
@@ -89,30 +161,211 @@ func New(cfg *config.Config) (*Application, error) {
 		Handler: app.routes(),
 	}
 
-	s, err := scheduler.New(logger, app.workerPool, app.storage)
+	s, err := scheduler.NewScheduler(context.Background(), db.DB(), app.workerPool,
+		scheduler.WithJitter(cfg.Scheduler.Jitter.Duration),
+		scheduler.WithStaleJobThreshold(cfg.Scheduler.StaleJobThreshold.Duration))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create scheduler: %w", err)
 	}
+	s.SetLogger(logger)
+	s.SetDefaultInterval(cfg.Scheduler.DefaultInterval.Duration)
+	if url := cfg.Scheduler.DeadLetterWebhookURL; url != "" {
+		s.SetDeadLetterHook(scheduler.NewDeadLetterWebhook(logger, url).Notify)
+	}
+	s.RegisterDigestHandler(digestJob.HandleDigest)
+	tokenRefresh := scheduler.NewTokenRefreshService(s, tokenStore, authService.Config())
+	tokenRefresh.SetRefreshRecorder(db)
+	tokenRefresh.SetUserLister(db)
+	tokenRefresh.SetRefreshSchedule(cfg.Auth.RefreshSchedule)
+	if window := cfg.Auth.RefreshBeforeExpiry.Duration; window > 0 {
+		tokenRefresh.SetRefreshBeforeExpiry(window)
+	}
+	app.tokenRefresh = tokenRefresh
+	reauthNotifier := scheduler.NewReauthNotifier(logger, db, telegramService,
+		fmt.Sprintf("http://localhost:%d/login", cfg.HTTPPort))
+	s.RegisterHandler(scheduler.ReauthNotificationJobType, reauthNotifier.HandleReauthNotification)
+	maintenanceSchedule, maintenance := maintenanceConfig(cfg)
+	maintenanceJob := scheduler.NewMaintenanceJob(logger, db, maintenance)
+	s.RegisterHandler(scheduler.MaintenanceJobType, maintenanceJob.HandleMaintenance)
+	if err := s.ScheduleMaintenance(context.Background(), maintenanceSchedule); err != nil {
+		return nil, fmt.Errorf("failed to schedule maintenance: %w", err)
+	}
+	backupSchedule, backup := backupConfig(cfg)
+	backupJob := scheduler.NewBackupJob(logger, db, backup)
+	s.RegisterHandler(scheduler.BackupJobType, backupJob.HandleBackup)
+	if err := s.ScheduleBackup(context.Background(), backupSchedule); err != nil {
+		return nil, fmt.Errorf("failed to schedule backups: %w", err)
+	}
 	app.scheduler = s
 
+	if err := metrics.Register(
+		metrics.NewJobStatusCollector(s.CountJobsByStatus),
+		metrics.NewWorkerPoolCollector(workerPool),
+		metrics.NewStorageCollector(db),
+	); err != nil {
+		return nil, fmt.Errorf("failed to register metrics: %w", err)
+	}
+	if cfg.MetricsPort > 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Handler())
+		app.metricsServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.MetricsPort),
+			Handler: metricsMux,
+		}
+	}
+
 	return app, nil
 }
 
+// Logger returns the application logger, whose level follows the
+// configuration
+func (a *Application) Logger() *slog.Logger {
+	return a.logger
+}
+
+// ApplyConfig applies a configuration reloaded by config.Watcher, which has
+// already limited it to settings that can change while running
+func (a *Application) ApplyConfig(cfg *config.Config) {
+	a.configMu.Lock()
+	a.config = cfg
+	a.configMu.Unlock()
+
+	a.logLevel.Set(parseLevel(cfg.LogLevel))
+	a.scheduler.SetDefaultInterval(cfg.Scheduler.DefaultInterval.Duration)
+
+	if size := a.workerPool.Size(); size != cfg.NumWorkers {
+		a.logger.Info("Resizing worker pool", "from", size, "to", cfg.NumWorkers)
+		a.workerPool.Resize(cfg.NumWorkers)
+	}
+}
+
+// storageConfig builds the database pool configuration, using the storage
+// defaults for any setting left unset
+func storageConfig(cfg *config.Config) storage.Config {
+	dbConfig := storage.DefaultConfig()
+	dbConfig.Path = cfg.DBPath
+	if cfg.DB.MaxOpenConns > 0 {
+		dbConfig.MaxOpenConns = cfg.DB.MaxOpenConns
+	}
+	if cfg.DB.MaxIdleConns > 0 {
+		dbConfig.MaxIdleConns = cfg.DB.MaxIdleConns
+	}
+	if dbConfig.MaxIdleConns > dbConfig.MaxOpenConns {
+		dbConfig.MaxIdleConns = dbConfig.MaxOpenConns
+	}
+	if cfg.DB.ConnMaxLifetime.Duration > 0 {
+		dbConfig.ConnMaxLifetime = cfg.DB.ConnMaxLifetime.Duration
+	}
+	if cfg.DB.ConnMaxIdleTime.Duration > 0 {
+		dbConfig.ConnMaxIdleTime = cfg.DB.ConnMaxIdleTime.Duration
+	}
+	if dbConfig.ConnMaxIdleTime > dbConfig.ConnMaxLifetime {
+		dbConfig.ConnMaxIdleTime = dbConfig.ConnMaxLifetime
+	}
+	if cfg.DB.BusyTimeout.Duration > 0 {
+		dbConfig.BusyTimeout = cfg.DB.BusyTimeout.Duration
+	}
+	return dbConfig
+}
+
+// maintenanceConfig returns the maintenance job's cron schedule and
+// retention periods, using the scheduler defaults for any setting left unset
+func maintenanceConfig(cfg *config.Config) (string, scheduler.MaintenanceConfig) {
+	schedule := cfg.Maintenance.Schedule
+	if schedule == "" {
+		schedule = scheduler.DefaultMaintenanceSchedule
+	}
+	maintenance := scheduler.MaintenanceConfig{
+		ProcessedEmailRetention: scheduler.DefaultProcessedEmailRetention,
+		InactiveUserRetention:   cfg.Maintenance.InactiveUserRetention.Duration,
+	}
+	if retention := cfg.Maintenance.ProcessedEmailRetention.Duration; retention > 0 {
+		maintenance.ProcessedEmailRetention = retention
+	}
+	return schedule, maintenance
+}
+
+// backupConfig returns the backup job's cron schedule, directory and
+// retention count, using the scheduler defaults for any setting left unset
+func backupConfig(cfg *config.Config) (string, scheduler.BackupConfig) {
+	schedule := cfg.Backup.Schedule
+	if schedule == "" {
+		schedule = scheduler.DefaultBackupSchedule
+	}
+	backup := scheduler.BackupConfig{
+		Dir:  cfg.Backup.Dir,
+		Keep: scheduler.DefaultBackupRetention,
+	}
+	if backup.Dir == "" {
+		backup.Dir = filepath.Join(filepath.Dir(cfg.DBPath), "backups")
+	}
+	if cfg.Backup.Keep > 0 {
+		backup.Keep = cfg.Backup.Keep
+	}
+	return schedule, backup
+}
+
 // Run starts the application.
 func (a *Application) Run() error {
-	a.logger.Printf("Starting server on %s", a.server.Addr)
-	go a.telegramService.StartPolling()
+	a.logger.Info("Starting server", "addr", a.server.Addr)
+	// Telegram does not hand out updates by polling while a webhook is set
+	if a.webhookSecret == "" {
+		go a.telegramService.StartPolling()
+	}
+	if a.oauthSweeper != nil {
+		a.oauthSweeper.Start()
+	}
+	if a.sessionSweeper != nil {
+		a.sessionSweeper.Start()
+	}
 	a.workerPool.Start()
 	a.scheduler.Start()
+	if n, err := a.tokenRefresh.ScheduleAllTokenRefreshes(context.Background()); err != nil {
+		a.logger.Error("Failed to schedule token refreshes", "error", err)
+	} else {
+		a.logger.Info("Scheduled token refreshes", "users", n)
+	}
+	if a.metricsServer != nil {
+		go func() {
+			a.logger.Info("Serving metrics", "addr", a.metricsServer.Addr)
+			if err := a.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				a.logger.Error("Metrics server failed", "error", err)
+			}
+		}()
+	}
 	return a.server.ListenAndServe()
 }
 
 // Shutdown gracefully shuts down the application.
 func (a *Application) Shutdown(ctx context.Context) error {
-	a.logger.Println("Shutting down server...")
-	a.workerPool.Stop()
-	if err := a.scheduler.Shutdown(); err != nil {
-		a.logger.Printf("Error shutting down scheduler: %v", err)
+	a.logger.Info("Shutting down server")
+	if a.oauthSweeper != nil {
+		a.oauthSweeper.Stop()
+	}
+	if a.sessionSweeper != nil {
+		a.sessionSweeper.Stop()
+	}
+	// Bound the worker drain by the shutdown deadline so a stuck task cannot block exit
+	drainTimeout := func() time.Duration {
+		if deadline, ok := ctx.Deadline(); ok {
+			// A non-positive timeout would wait forever, so an expired deadline
+			// still gets a token bound
+			return max(time.Until(deadline), time.Millisecond)
+		}
+		return defaultWorkerDrainTimeout
+	}
+	// The scheduler stops dispatching and lets running jobs record their
+	// result before the pool they run on is stopped
+	if err := a.scheduler.StopWithTimeout(drainTimeout()); err != nil {
+		a.logger.Error("Failed to stop scheduler", "error", err)
+	}
+	if err := a.workerPool.StopWithTimeout(drainTimeout()); err != nil {
+		a.logger.Error("Failed to stop worker pool", "error", err)
+	}
+	if a.metricsServer != nil {
+		if err := a.metricsServer.Shutdown(ctx); err != nil {
+			a.logger.Error("Failed to shut down metrics server", "error", err)
+		}
 	}
 	return a.server.Shutdown(ctx)
 }
@@ -120,15 +373,30 @@ func (a *Application) Shutdown(ctx context.Context) error {
 func (a *Application) routes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("GET /login", a.handleLogin)
-	mux.HandleFunc("GET /auth/callback", a.handleAuthCallback)
+	// The OAuth flow is rate limited per client to blunt abuse
+	authLimit := RateLimit(authRequestsPerMinute)
+	mux.Handle("GET /login", authLimit(http.HandlerFunc(a.handleLogin)))
+	mux.Handle("GET /auth/callback", authLimit(http.HandlerFunc(a.handleAuthCallback)))
 	mux.HandleFunc("POST /logout", a.handleLogout)
 
+	// Bot updates, authenticated by the secret in the path
+	mux.HandleFunc("POST /telegram/webhook/{secret}", a.handleTelegramWebhook)
+
 	// Authenticated routes
 	mux.Handle("GET /", a.requireAuth(http.HandlerFunc(a.handleDashboard)))
 	mux.Handle("GET /dashboard", a.requireAuth(http.HandlerFunc(a.handleDashboard)))
+	mux.Handle("GET /telegram/link", a.requireAuth(http.HandlerFunc(a.handleTelegramLink)))
 	mux.Handle("GET /telegram/connect", a.requireAuth(http.HandlerFunc(a.handleTelegramConnect)))
 	mux.Handle("GET /digest/now", a.requireAuth(http.HandlerFunc(a.handleDigestNow)))
+	mux.Handle("POST /settings/gmail-query", a.requireAuth(http.HandlerFunc(a.handleSetGmailQuery)))
+	mux.Handle("POST /settings/digest-interval", a.requireAuth(http.HandlerFunc(a.handleSetDigestInterval)))
+
+	// Job API, limited to the signed-in user's own jobs
+	mux.Handle("GET /api/jobs", a.requireAuth(http.HandlerFunc(a.handleListJobs)))
+	mux.Handle("GET /api/jobs/{id}", a.requireAuth(http.HandlerFunc(a.handleGetJob)))
+	mux.Handle("DELETE /api/jobs/{id}", a.requireAuth(http.HandlerFunc(a.handleDeleteJob)))
+	mux.Handle("POST /api/jobs/{id}/run", a.requireAuth(http.HandlerFunc(a.handleRunJob)))
+	mux.Handle("GET /api/handlers", a.requireAuth(http.HandlerFunc(a.handleListHandlers)))
 
 	return mux
 } 
\ No newline at end of file
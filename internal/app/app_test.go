@@ -3,6 +3,8 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
@@ -14,8 +16,14 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestNewApplication(t *testing.T) {
-	// Setup: Create a temporary config file for the test
+// loadTestConfig loads the example config with its files pointed into a
+// temporary directory. New authorizes the Telegram bot, so the test is
+// skipped unless TELEGRAM_BOT_TOKEN holds a real bot token.
+func loadTestConfig(t *testing.T) *config.Config {
+	if os.Getenv("TELEGRAM_BOT_TOKEN") == "" {
+		t.Skip("TELEGRAM_BOT_TOKEN is not set")
+	}
+
 	tempDir := t.TempDir()
 	credsFile := filepath.Join(tempDir, "credentials.json")
 	err := os.WriteFile(credsFile, []byte(`{"web": {"client_id": "test", "client_secret": "test", "redirect_uris": ["test"]}}`), 0644)
@@ -32,9 +40,10 @@ func TestNewApplication(t *testing.T) {
 	authMap := cfgMap["auth"].(map[string]interface{})
 	authMap["credentials_path"] = credsFile
 	cfgMap["auth"] = authMap
-	dbMap := cfgMap["db"].(map[string]interface{})
-	dbMap["file_path"] = filepath.Join(tempDir, "test.db")
-	cfgMap["db"] = dbMap
+	cfgMap["db_path"] = filepath.Join(tempDir, "test.db")
+	backupMap := cfgMap["backup"].(map[string]interface{})
+	backupMap["dir"] = filepath.Join(tempDir, "backups")
+	cfgMap["backup"] = backupMap
 
 	// Write the new config to a temporary file
 	tempCfgPath := filepath.Join(tempDir, "config.json")
@@ -43,68 +52,41 @@ func TestNewApplication(t *testing.T) {
 	err = os.WriteFile(tempCfgPath, newCfgBytes, 0644)
 	require.NoError(t, err)
 
-	cfg, err := config.LoadFromFile(tempCfgPath)
+	cfg, err := config.Load(tempCfgPath)
 	require.NoError(t, err, "Failed to load test config")
 
+	// Listen on any free port and leave the metrics server off
+	cfg.HTTPPort = 0
+	cfg.MetricsPort = 0
+	return cfg
+}
+
+func TestNewApplication(t *testing.T) {
+	cfg := loadTestConfig(t)
+
 	app, err := New(cfg)
 	require.NoError(t, err, "Failed to create app for test")
 	require.NotNil(t, app)
-
-	// Teardown: Clean up resources
-	err = app.DB.Close()
-	assert.NoError(t, err, "Failed to close database connection")
+	assert.NotNil(t, app.authService)
+	assert.NotNil(t, app.scheduler)
 }
 
-func TestApplication_StartStop(t *testing.T) {
-	// Setup: Create a temporary config file for the test
-	tempDir := t.TempDir()
-	credsFile := filepath.Join(tempDir, "credentials.json")
-	err := os.WriteFile(credsFile, []byte(`{"web": {"client_id": "test", "client_secret": "test", "redirect_uris": ["test"]}}`), 0644)
-	require.NoError(t, err)
-
-	exampleCfg, err := os.ReadFile("../../configs/config.example.json")
-	require.NoError(t, err)
-
-	var cfgMap map[string]interface{}
-	err = json.Unmarshal(exampleCfg, &cfgMap)
-	require.NoError(t, err)
-
-	// Update paths to point to our dummy files
-	authMap := cfgMap["auth"].(map[string]interface{})
-	authMap["credentials_path"] = credsFile
-	cfgMap["auth"] = authMap
-	dbMap := cfgMap["db"].(map[string]interface{})
-	dbMap["file_path"] = filepath.Join(tempDir, "test.db")
-	cfgMap["db"] = dbMap
-
-	// Write the new config to a temporary file
-	tempCfgPath := filepath.Join(tempDir, "config.json")
-	newCfgBytes, err := json.Marshal(cfgMap)
-	require.NoError(t, err)
-	err = os.WriteFile(tempCfgPath, newCfgBytes, 0644)
-	require.NoError(t, err)
-
-	cfg, err := config.LoadFromFile(tempCfgPath)
-	require.NoError(t, err, "Failed to load test config")
-
-	// Override with test-specific values after validation
-	cfg.Server.Port = 0
-	cfg.Server.MetricsPort = 0
+func TestApplication_RunShutdown(t *testing.T) {
+	cfg := loadTestConfig(t)
 
 	app, err := New(cfg)
 	require.NoError(t, err)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Test: Start the application
-	err = app.Start(ctx)
-	require.NoError(t, err)
+	runErr := make(chan error, 1)
+	go func() { runErr <- app.Run() }()
 
 	// Allow some time for the server to start
 	time.Sleep(100 * time.Millisecond)
 
-	// Test: Stop the application
-	err = app.Stop(ctx)
-	assert.NoError(t, err)
-} 
\ No newline at end of file
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, app.Shutdown(ctx))
+
+	err = <-runErr
+	assert.True(t, errors.Is(err, http.ErrServerClosed), "Run returned %v", err)
+}
@@ -1,36 +1,96 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"gmaildigest-go/internal/scheduler"
+	"gmaildigest-go/internal/storage"
+	"gmaildigest-go/internal/telegram"
+
+	"github.com/google/uuid"
 )
 
 //
 // Authentication Handlers
 //
 
+// loginCookieName holds the ID of the short-lived session that remembers who
+// is logging in between handleLogin and handleAuthCallback.
+const loginCookieName = "oauth_login"
+
+// loginTTL bounds how long the user has to complete the Google consent page.
+const loginTTL = 10 * time.Minute
+
+// sessionTTL is how long a session lasts without activity. Each authenticated
+// request slides it forward, up to the session store's maximum lifetime.
+const sessionTTL = 24 * time.Hour
+
 // handleLogin initiates the OAuth2 flow by redirecting the user to the Google consent page.
 func (a *Application) handleLogin(w http.ResponseWriter, r *http.Request) {
-	// For now, we'll use a hardcoded user ID.
-	// This will be replaced with session management later.
-	userID := "user-123"
+	// The login is keyed by the signed-in user, or a fresh ID for anyone else.
+	// The account itself is identified by its Gmail address in the callback.
+	loginUser := a.sessionUserID(r)
+	if loginUser == "" {
+		loginUser = uuid.New().String()
+	}
 
-	authURL, _, err := a.Auth.GetAuthURL(userID)
+	authURL, _, err := a.authService.GetAuthURL(loginUser)
 	if err != nil {
 		http.Error(w, "Failed to generate auth URL", http.StatusInternalServerError)
 		return
 	}
 
+	// The cookie only carries an opaque session ID, so the callback cannot be
+	// made to complete someone else's login.
+	loginID, err := a.sessionStore.Create(r.Context(), loginUser, loginTTL)
+	if err != nil {
+		a.logger.Error("Failed to create login session", "error", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    loginID,
+		MaxAge:   int(loginTTL.Seconds()),
+		HttpOnly: true,
+		// Lax so the cookie is sent on the redirect back from Google
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+
 	http.Redirect(w, r, authURL, http.StatusSeeOther)
 }
 
 // handleAuthCallback handles the redirect from Google after user consent.
-// It exchanges the authorization code for a token and stores it.
+// It exchanges the authorization code for a token, which is stored under the
+// user's Gmail address, and signs the user in under that address.
 func (a *Application) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
-	// TODO: Replace hardcoded userID with real session management
-	userID := "user-123"
+	cookie, err := r.Cookie(loginCookieName)
+	if err != nil {
+		http.Error(w, "Invalid request: no login in progress", http.StatusBadRequest)
+		return
+	}
+	loginUser, err := a.sessionStore.Get(r.Context(), cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid request: login expired", http.StatusBadRequest)
+		return
+	}
+	// The login session is single use
+	_ = a.sessionStore.Delete(r.Context(), cookie.Value)
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
 
 	code := r.URL.Query().Get("code")
 	state := r.URL.Query().Get("state")
@@ -40,33 +100,27 @@ func (a *Application) handleAuthCallback(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := a.Auth.HandleCallback(r.Context(), code, state, userID)
+	userID, err := a.authService.HandleCallback(r.Context(), code, state, loginUser)
 	if err != nil {
-		a.Logger.Printf("Auth callback error: %v", err)
+		a.logger.Error("Auth callback failed", "error", err)
 		http.Error(w, "Authentication failed", http.StatusInternalServerError)
 		return
 	}
 
-	sessionID, err := a.SessionStore.Create(r.Context(), userID, 24*time.Hour)
+	sessionID, err := a.sessionStore.Create(r.Context(), userID, sessionTTL)
 	if err != nil {
-		a.Logger.Printf("Failed to create session: %v", err)
+		a.logger.Error("Failed to create session", "error", err)
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		Path:     "/",
-	})
+	setSessionCookie(w, sessionID)
 
 	// On success, redirect to the home page.
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// handleLogout clears the user's session and token data.
+// handleLogout clears the user's session. With ?revoke=true it also revokes
+// the user's Google grant and deletes the stored token.
 func (a *Application) handleLogout(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
@@ -76,8 +130,17 @@ func (a *Application) handleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 	sessionID := cookie.Value
 
+	// Optionally revoke the Google grant and delete the stored token.
+	if revoke, _ := strconv.ParseBool(r.URL.Query().Get("revoke")); revoke {
+		if userID, err := a.sessionStore.Get(r.Context(), sessionID); err == nil {
+			if err := a.authService.RevokeToken(r.Context(), userID); err != nil {
+				a.logger.Error("Failed to revoke token", "user", userID, "error", err)
+			}
+		}
+	}
+
 	// Delete the session from the store. We ignore errors here.
-	_ = a.SessionStore.Delete(r.Context(), sessionID)
+	_ = a.sessionStore.Delete(r.Context(), sessionID)
 
 	// Clear the cookie by setting its max-age to -1.
 	http.SetCookie(w, &http.Cookie{
@@ -92,6 +155,31 @@ func (a *Application) handleLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
+// setSessionCookie sends the session cookie, valid for sessionTTL from now.
+func setSessionCookie(w http.ResponseWriter, sessionID string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    sessionID,
+		Expires:  time.Now().Add(sessionTTL),
+		HttpOnly: true,
+		Path:     "/",
+	})
+}
+
+// sessionUserID returns the user ID of the request's session, or "" if the
+// request is not signed in.
+func (a *Application) sessionUserID(r *http.Request) string {
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		return ""
+	}
+	userID, err := a.sessionStore.Get(r.Context(), cookie.Value)
+	if err != nil {
+		return ""
+	}
+	return userID
+}
+
 //
 // Application Handlers
 //
@@ -109,32 +197,54 @@ func (a *Application) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Welcome, %s!", userID)
 }
 
+// handleTelegramLink sends the signed-in user to the bot through a deep link
+// carrying a short-lived start token tied to them
+func (a *Application) handleTelegramLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Could not identify user", http.StatusInternalServerError)
+		return
+	}
+
+	token := a.telegramLinks.StartToken(userID)
+	http.Redirect(w, r, telegram.DeepLink(a.telegramService.BotName(), token), http.StatusSeeOther)
+}
+
+// handleTelegramConnect links the Telegram chat named in the connect URL the
+// bot answered /start with to the signed-in user. The URL's signature and the
+// start token's expiry are checked, and the token must have been issued to
+// this user.
 func (a *Application) handleTelegramConnect(w http.ResponseWriter, r *http.Request) {
-	tokenStr := r.URL.Query().Get("token")
-	if tokenStr == "" {
+	if r.URL.Query().Get("token") == "" {
 		http.Error(w, "Missing token", http.StatusBadRequest)
 		return
 	}
 
-	telegramUserID, err := strconv.ParseInt(tokenStr, 10, 64)
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Could not identify user", http.StatusInternalServerError)
+		return
+	}
+
+	telegramUserID, telegramChatID, err := a.telegramLinks.VerifyConnect(r.URL.Query(), userID)
+	if errors.Is(err, telegram.ErrLinkTokenExpired) {
+		http.Error(w, "This link has expired. Please connect again from the app.", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
+		a.logger.Warn("Rejected telegram connect link", "user", userID, "error", err)
 		http.Error(w, "Invalid token", http.StatusBadRequest)
 		return
 	}
 
-	// The Telegram Chat ID is the same as the User ID for private chats.
-	telegramChatID := telegramUserID
-
-	userID := a.getUserIDFromContext(r)
-
 	err = a.storage.UpdateUserTelegramDetails(r.Context(), userID, telegramUserID, telegramChatID)
 	if err != nil {
-		a.logger.Printf("Failed to update telegram details for user %s: %v", userID, err)
+		a.logger.Error("Failed to update telegram details", "user", userID, "error", err)
 		http.Error(w, "Failed to connect account. Please try again.", http.StatusInternalServerError)
 		return
 	}
 
-	a.logger.Printf("User %s successfully connected telegram account with user ID %d", userID, telegramUserID)
+	a.logger.Info("User connected telegram account", "user", userID, "telegram_user", telegramUserID)
 
 	// Respond with a simple success message
 	w.WriteHeader(http.StatusOK)
@@ -142,8 +252,8 @@ func (a *Application) handleTelegramConnect(w http.ResponseWriter, r *http.Reque
 }
 
 func (a *Application) handleDigestNow(w http.ResponseWriter, r *http.Request) {
-	userID := a.getUserIDFromContext(r)
-	if userID == "" {
+	userID, ok := getUserIDFromContext(r)
+	if !ok || userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -151,10 +261,229 @@ func (a *Application) handleDigestNow(w http.ResponseWriter, r *http.Request) {
 	go func() {
 		err := a.digestJob.Run(userID)
 		if err != nil {
-			a.logger.Printf("Error running digest job for user %s: %v", userID, err)
+			a.logger.Error("Failed to run digest job", "user", userID, "error", err)
 		}
 	}()
 
 	w.WriteHeader(http.StatusAccepted)
 	w.Write([]byte("Digest creation initiated. You will receive a message on Telegram shortly."))
-} 
\ No newline at end of file
+}
+
+//
+// Job Admin API
+//
+// Users only see and act on their own jobs. Jobs of other users, and system
+// jobs such as maintenance, are reported as not found.
+//
+
+// handleListJobs returns the caller's jobs matching the status and type
+// query parameters, paged with limit and offset.
+func (a *Application) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Could not identify user", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := &scheduler.ListJobsOptions{
+		Status: scheduler.JobStatus(query.Get("status")),
+		Type:   query.Get("type"),
+		UserID: userID,
+	}
+	for name, dst := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("Invalid %s", name), http.StatusBadRequest)
+			return
+		}
+		*dst = n
+	}
+
+	jobs, err := a.scheduler.ListJobs(r.Context(), opts)
+	if err != nil {
+		a.logger.Error("Failed to list jobs", "error", err)
+		http.Error(w, "Failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+	if jobs == nil {
+		jobs = []*scheduler.Job{}
+	}
+	a.writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleGetJob returns a single job.
+func (a *Application) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.callerJob(r, r.PathValue("id"))
+	if err != nil {
+		a.writeJobError(w, "get", err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, job)
+}
+
+// handleDeleteJob removes a job, cancelling it if it is running.
+func (a *Application) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.callerJob(r, r.PathValue("id"))
+	if err != nil {
+		a.writeJobError(w, "delete", err)
+		return
+	}
+	if err := a.scheduler.DeleteJob(r.Context(), job.ID); err != nil {
+		a.writeJobError(w, "delete", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRunJob makes a job due now so the scheduler dispatches it right away.
+func (a *Application) handleRunJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.callerJob(r, r.PathValue("id"))
+	if err != nil {
+		a.writeJobError(w, "run", err)
+		return
+	}
+	job, err = a.scheduler.RunJobNow(r.Context(), job.ID)
+	if err != nil {
+		a.writeJobError(w, "run", err)
+		return
+	}
+	a.writeJSON(w, http.StatusAccepted, job)
+}
+
+// handleListHandlers returns the job types the scheduler has handlers for.
+func (a *Application) handleListHandlers(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, http.StatusOK, a.scheduler.RegisteredTypes())
+}
+
+// callerJob returns the job with the given ID if it belongs to the signed-in
+// user, and scheduler.ErrJobNotFound otherwise, so other users' job IDs
+// cannot be probed.
+func (a *Application) callerJob(r *http.Request, id string) (*scheduler.Job, error) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok || userID == "" {
+		return nil, scheduler.ErrJobNotFound
+	}
+	job, err := a.scheduler.GetJob(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, scheduler.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// writeJobError maps scheduler errors to HTTP status codes.
+func (a *Application) writeJobError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+	case errors.Is(err, scheduler.ErrJobRunning):
+		http.Error(w, "Job is already running", http.StatusConflict)
+	default:
+		a.logger.Error("Failed to change job", "action", action, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to %s job", action), http.StatusInternalServerError)
+	}
+}
+
+// writeJSON writes v as the JSON response body.
+func (a *Application) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Error("Failed to write response", "error", err)
+	}
+}
+
+//
+// Settings
+//
+
+// handleSetGmailQuery saves the Gmail search query, such as
+// "label:newsletters", that selects the emails in the user's digests.
+// An empty query restores the default of unread emails.
+func (a *Application) handleSetGmailQuery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Could not identify user", http.StatusInternalServerError)
+		return
+	}
+
+	query := strings.TrimSpace(r.FormValue("query"))
+	if strings.ContainsAny(query, "\r\n") {
+		http.Error(w, "Query must be a single line", http.StatusBadRequest)
+		return
+	}
+
+	err := a.storage.UpdateGmailQuery(r.Context(), userID, query)
+	switch {
+	case errors.Is(err, storage.ErrInvalidInput):
+		http.Error(w, fmt.Sprintf("Query must be at most %d characters", storage.MaxGmailQueryLength), http.StatusBadRequest)
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case err != nil:
+		a.logger.Error("Failed to update gmail query", "user", userID, "error", err)
+		http.Error(w, "Failed to save query. Please try again.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if query == "" {
+		w.Write([]byte("Digests will include your unread emails."))
+		return
+	}
+	fmt.Fprintf(w, "Digests will include emails matching %q.", query)
+}
+
+// handleSetDigestInterval changes how often the signed-in user's digests
+// are sent, taking effect from the next run.
+func (a *Application) handleSetDigestInterval(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Could not identify user", http.StatusInternalServerError)
+		return
+	}
+
+	interval, err := time.ParseDuration(strings.TrimSpace(r.FormValue("interval")))
+	if err != nil {
+		http.Error(w, "Interval must be a duration such as 30m or 2h", http.StatusBadRequest)
+		return
+	}
+
+	err = a.setDigestInterval(r.Context(), userID, interval)
+	switch {
+	case errors.Is(err, storage.ErrInvalidInput):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case err != nil:
+		a.logger.Error("Failed to update digest interval", "user", userID, "error", err)
+		http.Error(w, "Failed to save interval. Please try again.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Digests will be sent every %s.", interval)
+}
+
+// setDigestInterval saves a user's digest interval and moves their digest
+// job to it, so the change does not wait for the job's next run. An
+// interval the scheduler cannot express is rejected with ErrInvalidInput.
+func (a *Application) setDigestInterval(ctx context.Context, userID string, interval time.Duration) error {
+	if _, err := scheduler.DigestSchedule(interval); err != nil {
+		return fmt.Errorf("%w: %v", storage.ErrInvalidInput, err)
+	}
+	if err := a.storage.UpdateDigestInterval(ctx, userID, interval); err != nil {
+		return err
+	}
+	return a.scheduler.RescheduleDigest(ctx, userID, interval)
+}
@@ -2,17 +2,29 @@ package app
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"gmaildigest-go/internal/auth"
+	"gmaildigest-go/internal/config"
+	"gmaildigest-go/internal/scheduler"
 	"gmaildigest-go/internal/session"
+	"gmaildigest-go/internal/storage"
+	"gmaildigest-go/internal/telegram"
+	"gmaildigest-go/internal/worker"
 
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
@@ -21,11 +33,13 @@ import (
 // MockStorage is a mock implementation of the auth.Storage interface for testing.
 type MockStorage struct {
 	token     *oauth2.Token
+	userID    string
 	isDeleted bool
 }
 
 func (m *MockStorage) StoreToken(ctx context.Context, userID string, token *oauth2.Token) error {
 	m.token = token
+	m.userID = userID
 	return nil
 }
 
@@ -68,7 +82,11 @@ func TestHandlers_Login(t *testing.T) {
 	// Manually set the redirect URL for the test config
 	oauthManager.SetRedirectURL("http://localhost/auth/callback")
 
-	app := &Application{Auth: oauthManager}
+	app := &Application{
+		authService:  oauthManager,
+		sessionStore: session.NewInMemoryStore(),
+		logger:       slog.New(slog.DiscardHandler),
+	}
 
 	req, err := http.NewRequest("GET", "/login", nil)
 	require.NoError(t, err)
@@ -84,6 +102,12 @@ func TestHandlers_Login(t *testing.T) {
 	location, err := rr.Result().Location()
 	require.NoError(t, err, "handler did not return a location header")
 	assert.NotEmpty(t, location.String(), "redirect URL should not be empty")
+
+	// Assert: Check that the login in progress is remembered
+	loginCookie := findCookie(rr.Result().Cookies(), loginCookieName)
+	require.NotNil(t, loginCookie, "login cookie was not set")
+	assert.NotEmpty(t, loginCookie.Value)
+	assert.True(t, loginCookie.HttpOnly)
 }
 
 func TestHandlers_AuthCallback(t *testing.T) {
@@ -99,6 +123,7 @@ func TestHandlers_AuthCallback(t *testing.T) {
 	// We still need to load credentials for the config to be non-nil
 	err := oauthManager.LoadCredentials("../../test/fixtures/dummy_credentials.json")
 	require.NoError(t, err)
+	oauthManager.SetHTTPClient(profileClient("User@Example.com"))
 
 	userID := "user-123"
 	state := "test-state"
@@ -107,16 +132,22 @@ func TestHandlers_AuthCallback(t *testing.T) {
 	stateStore.StoreState(userID, state)
 	pkceStore.StoreVerifier(state, verifier)
 
+	sessionStore := session.NewInMemoryStore()
 	app := &Application{
-		Auth:         oauthManager,
-		SessionStore: session.NewInMemoryStore(),
-		Logger:       log.New(io.Discard, "", 0),
+		authService:  oauthManager,
+		sessionStore: sessionStore,
+		logger:       slog.New(slog.DiscardHandler),
 	}
 
+	// handleLogin records who is logging in under the login cookie
+	loginID, err := sessionStore.Create(context.Background(), userID, time.Minute)
+	require.NoError(t, err)
+
 	// Create a request with the necessary query parameters
 	reqURL := fmt.Sprintf("/auth/callback?code=test-code&state=%s", state)
 	req, err := http.NewRequest("GET", reqURL, nil)
 	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: loginCookieName, Value: loginID})
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(app.handleAuthCallback)
@@ -128,16 +159,150 @@ func TestHandlers_AuthCallback(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "/", location.Path, "handler redirected to wrong path")
 
-	// Assert: Check that a token was stored
+	// Assert: Check that a token was stored under the Gmail address
 	assert.True(t, mockStorage.TokenWasStored(), "token was not stored")
+	assert.Equal(t, "user@example.com", mockStorage.userID)
 
-	// Assert: Check that a session cookie was set
+	// Assert: Check that a session cookie was set for the user
 	cookies := rr.Result().Cookies()
-	assert.Len(t, cookies, 1, "expected exactly one cookie to be set")
-	sessionCookie := cookies[0]
-	assert.Equal(t, "session_id", sessionCookie.Name)
+	sessionCookie := findCookie(cookies, "session_id")
+	require.NotNil(t, sessionCookie, "session cookie was not set")
 	assert.NotEmpty(t, sessionCookie.Value)
 	assert.True(t, sessionCookie.HttpOnly)
+	sessionUser, err := sessionStore.Get(context.Background(), sessionCookie.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", sessionUser)
+
+	// Assert: Check that the login session was used up
+	loginCookie := findCookie(cookies, loginCookieName)
+	require.NotNil(t, loginCookie, "login cookie was not cleared")
+	assert.True(t, loginCookie.MaxAge < 0)
+	_, err = sessionStore.Get(context.Background(), loginID)
+	assert.Error(t, err)
+
+	// Assert: Check that a callback without a login in progress is rejected
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", reqURL, nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// findCookie returns the cookie with the given name, or nil
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// tokenMap is an auth.Storage that keeps a token per user
+type tokenMap struct {
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+}
+
+func (m *tokenMap) StoreToken(ctx context.Context, userID string, token *oauth2.Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[userID] = token
+	return nil
+}
+
+func (m *tokenMap) GetToken(ctx context.Context, userID string) (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[userID], nil
+}
+
+func (m *tokenMap) DeleteToken(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, userID)
+	return nil
+}
+
+func TestHandlers_LoginGivesEachAccountItsOwnUser(t *testing.T) {
+	tokens := &tokenMap{tokens: make(map[string]*oauth2.Token)}
+	oauthManager := auth.NewOAuthManager(tokens, auth.NewInMemoryPKCEStore(), auth.NewInMemoryStateStore())
+	oauthManager.SetTokenSource(&MockTokenSource{})
+	require.NoError(t, oauthManager.LoadCredentials("../../test/fixtures/dummy_credentials.json"))
+	oauthManager.SetHTTPClient(profileClient("first@example.com", "second@example.com", "first@example.com"))
+
+	sessionStore := session.NewInMemoryStore()
+	app := &Application{
+		authService:  oauthManager,
+		sessionStore: sessionStore,
+		logger:       slog.New(slog.DiscardHandler),
+	}
+
+	// login runs the OAuth flow from a browser holding the given cookies and
+	// returns the resulting session cookie
+	login := func(cookies ...*http.Cookie) *http.Cookie {
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.handleLogin).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusSeeOther, rr.Code)
+
+		location, err := rr.Result().Location()
+		require.NoError(t, err)
+		loginCookie := findCookie(rr.Result().Cookies(), loginCookieName)
+		require.NotNil(t, loginCookie)
+
+		req = httptest.NewRequest(http.MethodGet,
+			"/auth/callback?code=test-code&state="+location.Query().Get("state"), nil)
+		req.AddCookie(loginCookie)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(app.handleAuthCallback).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusSeeOther, rr.Code)
+
+		sessionCookie := findCookie(rr.Result().Cookies(), "session_id")
+		require.NotNil(t, sessionCookie)
+		return sessionCookie
+	}
+	userOf := func(cookie *http.Cookie) string {
+		userID, err := sessionStore.Get(context.Background(), cookie.Value)
+		require.NoError(t, err)
+		return userID
+	}
+
+	first := login()
+	second := login()
+	firstUser, secondUser := userOf(first), userOf(second)
+	assert.Equal(t, "first@example.com", firstUser)
+	assert.Equal(t, "second@example.com", secondUser)
+	assert.Len(t, tokens.tokens, 2)
+	assert.Contains(t, tokens.tokens, firstUser)
+	assert.Contains(t, tokens.tokens, secondUser)
+
+	// Signing in to the same account again keeps the same user
+	again := login(second)
+	assert.Equal(t, firstUser, userOf(again))
+	assert.Len(t, tokens.tokens, 2)
+}
+
+// profileClient answers Gmail profile requests with each of emails in turn
+func profileClient(emails ...string) *http.Client {
+	var mu sync.Mutex
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != auth.GmailProfileURL {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}
+		mu.Lock()
+		email := emails[0]
+		if len(emails) > 1 {
+			emails = emails[1:]
+		}
+		mu.Unlock()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"emailAddress": "` + email + `"}`)),
+		}, nil
+	})}
 }
 
 func TestHandlers_Logout(t *testing.T) {
@@ -151,8 +316,8 @@ func TestHandlers_Logout(t *testing.T) {
 	require.NoError(t, err)
 
 	app := &Application{
-		Logger:       log.New(io.Discard, "", 0),
-		SessionStore: store,
+		logger:       slog.New(slog.DiscardHandler),
+		sessionStore: store,
 	}
 
 	// Create a request with the session cookie
@@ -186,4 +351,374 @@ func TestHandlers_Logout(t *testing.T) {
 	// Assert: Check that the session was deleted from the store
 	_, err = store.Get(ctx, sessionID)
 	assert.Error(t, err, "session should have been deleted from the store")
-} 
\ No newline at end of file
+}
+
+// roundTripFunc lets a function act as an http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHandlers_LogoutRevokesToken(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	userID := "user-to-logout"
+
+	sessionID, err := store.Create(ctx, userID, time.Hour)
+	require.NoError(t, err)
+
+	mockStorage := &MockStorage{token: &oauth2.Token{RefreshToken: "test-refresh-token"}}
+	oauthManager := auth.NewOAuthManager(mockStorage, auth.NewInMemoryPKCEStore(), auth.NewInMemoryStateStore())
+	revoked := false
+	oauthManager.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		revoked = req.URL.String() == auth.GoogleRevokeURL
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+		}, nil
+	})})
+
+	app := &Application{
+		authService:  oauthManager,
+		logger:       slog.New(slog.DiscardHandler),
+		sessionStore: store,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/logout?revoke=true", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.handleLogout).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.True(t, revoked, "revocation endpoint should have been called")
+	assert.True(t, mockStorage.isDeleted, "token should have been deleted")
+
+	_, err = store.Get(ctx, sessionID)
+	assert.Error(t, err, "session should have been deleted from the store")
+}
+
+// newJobsTestApp returns an Application backed by a scheduler on an in-memory database
+func newJobsTestApp(t *testing.T) (*Application, *scheduler.Scheduler) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	sched, err := scheduler.NewScheduler(context.Background(), db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	t.Cleanup(sched.Stop)
+
+	return &Application{scheduler: sched, logger: slog.New(slog.DiscardHandler)}, sched
+}
+
+func TestHandlers_ListJobs(t *testing.T) {
+	app, sched := newJobsTestApp(t)
+
+	_, err := sched.ScheduleJob("user1", "digest", "0 8 * * *", nil)
+	require.NoError(t, err)
+	_, err = sched.ScheduleJob("user1", "token_refresh", "*/30 * * * *", nil)
+	require.NoError(t, err)
+	_, err = sched.ScheduleJob("user2", "digest", "0 8 * * *", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantCount int
+	}{
+		{"own jobs", "", http.StatusOK, 2},
+		{"other user's jobs are not listed", "?user=user2", http.StatusOK, 2},
+		{"by type", "?type=digest", http.StatusOK, 1},
+		{"by status", "?status=pending", http.StatusOK, 2},
+		{"no match", "?status=dead", http.StatusOK, 0},
+		{"paged", "?limit=1&offset=1", http.StatusOK, 1},
+		{"bad limit", "?limit=-1", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUserID(httptest.NewRequest(http.MethodGet, "/api/jobs"+tt.query, nil), "user1")
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.handleListJobs).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			var jobs []scheduler.Job
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jobs))
+			assert.NotNil(t, jobs, "an empty result should be [] rather than null")
+			assert.Len(t, jobs, tt.wantCount)
+			for _, job := range jobs {
+				assert.Equal(t, "user1", job.UserID)
+			}
+		})
+	}
+}
+
+func TestHandlers_DeleteJob(t *testing.T) {
+	app, sched := newJobsTestApp(t)
+	ctx := context.Background()
+
+	job, err := sched.ScheduleJob("user1", "digest", "0 8 * * *", nil)
+	require.NoError(t, err)
+
+	doAs := func(userID, method, id string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req := withUserID(httptest.NewRequest(method, "/api/jobs/"+id, nil), userID)
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	do := func(method, id string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		return doAs("user1", method, id, handler)
+	}
+
+	// Another user cannot see, run or delete the job
+	assert.Equal(t, http.StatusNotFound, doAs("user2", http.MethodGet, job.ID, app.handleGetJob).Code)
+	assert.Equal(t, http.StatusNotFound, doAs("user2", http.MethodPost, job.ID, app.handleRunJob).Code)
+	assert.Equal(t, http.StatusNotFound, doAs("user2", http.MethodDelete, job.ID, app.handleDeleteJob).Code)
+	_, err = sched.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+
+	rr := do(http.MethodPost, job.ID, app.handleRunJob)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	rr = do(http.MethodGet, job.ID, app.handleGetJob)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got scheduler.Job
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, job.ID, got.ID)
+
+	rr = do(http.MethodDelete, job.ID, app.handleDeleteJob)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	_, err = sched.GetJob(ctx, job.ID)
+	assert.ErrorIs(t, err, scheduler.ErrJobNotFound)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, job.ID, app.handleDeleteJob).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, job.ID, app.handleGetJob).Code)
+}
+
+func TestHandlers_ListHandlers(t *testing.T) {
+	app, sched := newJobsTestApp(t)
+
+	list := func() []string {
+		req := httptest.NewRequest(http.MethodGet, "/api/handlers", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.handleListHandlers).ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		var types []string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &types))
+		return types
+	}
+
+	assert.Equal(t, []string{}, list(), "no handlers should be [] rather than null")
+
+	noop := func(ctx context.Context, job *scheduler.Job) error { return nil }
+	sched.RegisterHandler(scheduler.MaintenanceJobType, noop)
+	sched.RegisterHandler(scheduler.BackupJobType, noop)
+	assert.Equal(t, []string{"backup", "maintenance"}, list())
+}
+
+// queryStorage records saved Gmail queries, failing with err when it is set
+type queryStorage struct {
+	storage.Storage
+	queries map[string]string
+	err     error
+}
+
+func (s *queryStorage) UpdateGmailQuery(ctx context.Context, userID, query string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.queries[userID] = query
+	return nil
+}
+
+func TestHandlers_SetGmailQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		err       error
+		wantCode  int
+		wantSaved bool
+		wantQuery string
+	}{
+		{"custom query", "  label:newsletters ", nil, http.StatusOK, true, "label:newsletters"},
+		{"back to default", "", nil, http.StatusOK, true, ""},
+		{"multi-line query", "label:a\nlabel:b", nil, http.StatusBadRequest, false, ""},
+		{"rejected by storage", "is:starred", storage.ErrInvalidInput, http.StatusBadRequest, false, ""},
+		{"unknown user", "is:starred", storage.ErrNotFound, http.StatusNotFound, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &queryStorage{queries: make(map[string]string), err: tt.err}
+			app := &Application{storage: store, logger: slog.New(slog.DiscardHandler)}
+
+			form := strings.NewReader("query=" + url.QueryEscape(tt.query))
+			req := httptest.NewRequest("POST", "/settings/gmail-query", form)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = withUserID(req, "user1")
+			rr := httptest.NewRecorder()
+
+			app.handleSetGmailQuery(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			query, saved := store.queries["user1"]
+			assert.Equal(t, tt.wantSaved, saved)
+			assert.Equal(t, tt.wantQuery, query)
+		})
+	}
+}
+
+// intervalStorage records saved digest intervals
+type intervalStorage struct {
+	storage.Storage
+	intervals map[string]time.Duration
+}
+
+func (s *intervalStorage) UpdateDigestInterval(ctx context.Context, userID string, interval time.Duration) error {
+	s.intervals[userID] = interval
+	return nil
+}
+
+func TestHandlers_SetDigestInterval(t *testing.T) {
+	app, sched := newJobsTestApp(t)
+	store := &intervalStorage{intervals: make(map[string]time.Duration)}
+	app.storage = store
+
+	post := func(interval string) *httptest.ResponseRecorder {
+		form := strings.NewReader("interval=" + url.QueryEscape(interval))
+		req := httptest.NewRequest("POST", "/settings/digest-interval", form)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		app.handleSetDigestInterval(rr, withUserID(req, "user1"))
+		return rr
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("soon").Code)
+	assert.Equal(t, http.StatusBadRequest, post("90s").Code, "intervals must be whole minutes")
+	assert.Empty(t, store.intervals)
+
+	rr := post("30m")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 30*time.Minute, store.intervals["user1"])
+	jobs, err := sched.ListJobs(context.Background(), &scheduler.ListJobsOptions{UserID: "user1", Type: "digest"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "@every 30m0s", jobs[0].Schedule)
+}
+
+// telegramStorage records the Telegram details saved for each user
+type telegramStorage struct {
+	storage.Storage
+	chats map[string][2]int64
+}
+
+func (s *telegramStorage) UpdateUserTelegramDetails(ctx context.Context, userID string, telegramUserID, telegramChatID int64) error {
+	s.chats[userID] = [2]int64{telegramUserID, telegramChatID}
+	return nil
+}
+
+func TestHandlers_TelegramConnect(t *testing.T) {
+	issued := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	links := telegram.NewLinkSigner([]byte("0123456789abcdef0123456789abcdef"), 15*time.Minute)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		query    func() url.Values
+		wantCode int
+		wantLink bool
+	}{
+		{
+			name:     "valid token",
+			now:      issued.Add(14 * time.Minute),
+			query:    func() url.Values { return links.ConnectQuery(links.StartToken("user1"), 42, 4242) },
+			wantCode: http.StatusOK,
+			wantLink: true,
+		},
+		{
+			name:     "expired token",
+			now:      issued.Add(15 * time.Minute),
+			query:    func() url.Values { return links.ConnectQuery(links.StartToken("user1"), 42, 4242) },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "tampered chat",
+			now:  issued,
+			query: func() url.Values {
+				q := links.ConnectQuery(links.StartToken("user1"), 42, 4242)
+				q.Set("chat", "666")
+				return q
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "tampered start token",
+			now:  issued.Add(time.Hour),
+			query: func() url.Values {
+				// Push the expiry out, keeping the signature
+				_, mac, _ := strings.Cut(links.StartToken("user1"), "_")
+				expiry := strconv.FormatInt(issued.Add(2*time.Hour).Unix(), 36)
+				return links.ConnectQuery(expiry+"_"+mac, 42, 4242)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "token issued to another user",
+			now:      issued,
+			query:    func() url.Values { return links.ConnectQuery(links.StartToken("user2"), 42, 4242) },
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &telegramStorage{chats: make(map[string][2]int64)}
+			app := &Application{storage: store, telegramLinks: links, logger: slog.New(slog.DiscardHandler)}
+
+			links.SetNow(func() time.Time { return issued })
+			query := tt.query()
+			links.SetNow(func() time.Time { return tt.now })
+
+			req := httptest.NewRequest("GET", "/telegram/connect?"+query.Encode(), nil)
+			rr := httptest.NewRecorder()
+			app.handleTelegramConnect(rr, withUserID(req, "user1"))
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			chat, linked := store.chats["user1"]
+			assert.Equal(t, tt.wantLink, linked)
+			if tt.wantLink {
+				assert.Equal(t, [2]int64{42, 4242}, chat)
+			}
+		})
+	}
+}
+
+func TestApplication_ApplyConfig(t *testing.T) {
+	app, sched := newJobsTestApp(t)
+	var logs strings.Builder
+	app.logLevel = new(slog.LevelVar)
+	app.logger = newLogger(&logs, app.logLevel)
+	app.workerPool = worker.NewWorkerPool(1)
+	app.config = &config.Config{}
+
+	cfg := &config.Config{LogLevel: "error", NumWorkers: 1}
+	cfg.Scheduler.DefaultInterval = config.Duration{Duration: 2 * time.Hour}
+	app.ApplyConfig(cfg)
+
+	assert.Same(t, cfg, app.config)
+	assert.Equal(t, 2*time.Hour, sched.DefaultInterval())
+	app.logger.Info("Starting server")
+	assert.Empty(t, logs.String(), "info messages are dropped at the error level")
+	app.logger.Error("Failed to stop scheduler")
+	assert.Contains(t, logs.String(), "level=ERROR")
+}
@@ -0,0 +1,22 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+)
+
+// parseLevel returns the slog level of a configured log level: "debug",
+// "info", "warn" or "error". Anything else is treated as info.
+func parseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// newLogger creates the application logger, writing to out the messages at
+// or above level. Setting level changes it while the application runs.
+func newLogger(out io.Writer, level *slog.LevelVar) *slog.Logger {
+	return slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: level}))
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, parseLevel("debug"))
+	assert.Equal(t, slog.LevelInfo, parseLevel("info"))
+	assert.Equal(t, slog.LevelWarn, parseLevel("warn"))
+	assert.Equal(t, slog.LevelError, parseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, parseLevel(""))
+}
+
+func TestNewLogger(t *testing.T) {
+	var out bytes.Buffer
+	level := new(slog.LevelVar)
+	logger := newLogger(&out, level)
+
+	logger.Info("Starting server", "addr", ":8080")
+	logger.Error("Failed to send digest", "error", "timeout")
+	assert.Contains(t, out.String(), `level=INFO msg="Starting server" addr=:8080`)
+	assert.Contains(t, out.String(), `level=ERROR msg="Failed to send digest" error=timeout`)
+
+	// Messages are filtered by their level, not their text
+	out.Reset()
+	level.Set(slog.LevelError)
+	logger.Info("Failed to look like an error")
+	logger.Warn("Skipped emails that could not be fetched")
+	logger.Error("Failed to stop scheduler")
+	assert.NotContains(t, out.String(), "Failed to look like an error")
+	assert.NotContains(t, out.String(), "Skipped emails")
+	assert.Contains(t, out.String(), "Failed to stop scheduler")
+
+	out.Reset()
+	level.Set(slog.LevelDebug)
+	logger.Debug("Checking due jobs")
+	assert.Contains(t, out.String(), "level=DEBUG")
+}
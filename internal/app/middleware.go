@@ -13,6 +13,7 @@ const userContextKey = contextKey("userID")
 
 // requireAuth is a middleware that ensures a user is authenticated.
 // If the user is not authenticated, it redirects them to the login page.
+// Otherwise the session's expiry is renewed.
 func (a *Application) requireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("session_id")
@@ -22,9 +23,9 @@ func (a *Application) requireAuth(next http.Handler) http.Handler {
 		}
 
 		sessionID := cookie.Value
-		userID, err := a.SessionStore.Get(r.Context(), sessionID)
+		userID, err := a.sessionStore.Get(r.Context(), sessionID)
 		if err != nil {
-			a.Logger.Printf("middleware: failed to get session %q: %v", sessionID, err)
+			a.logger.Error("Failed to get session", "session", sessionID, "error", err)
 			// Clear the invalid cookie
 			http.SetCookie(w, &http.Cookie{
 				Name:   "session_id",
@@ -36,6 +37,13 @@ func (a *Application) requireAuth(next http.Handler) http.Handler {
 			return
 		}
 
+		// Slide the session forward so active users stay signed in
+		if err := a.sessionStore.Touch(r.Context(), sessionID, sessionTTL); err != nil {
+			a.logger.Error("Failed to renew session", "session", sessionID, "error", err)
+		} else {
+			setSessionCookie(w, sessionID)
+		}
+
 		// Add the user ID to the request context
 		reqWithUser := withUserID(r, userID)
 
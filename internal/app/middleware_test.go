@@ -3,7 +3,7 @@ package app
 import (
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -29,8 +29,8 @@ func TestRequireAuthMiddleware(t *testing.T) {
 	// Setup
 	store := session.NewInMemoryStore()
 	app := &Application{
-		SessionStore: store,
-		Logger:       log.New(io.Discard, "", 0),
+		sessionStore: store,
+		logger:       slog.New(slog.DiscardHandler),
 	}
 	userID := "user-123"
 
@@ -86,4 +86,44 @@ func TestRequireAuthMiddleware(t *testing.T) {
 		assert.Equal(t, "session_id", cookies[0].Name)
 		assert.Equal(t, "", cookies[0].Value)
 	})
-} 
\ No newline at end of file
+
+	t.Run("with expired session", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/protected", nil)
+		sessionID, err := store.Create(req.Context(), userID, -time.Minute)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+		rr := httptest.NewRecorder()
+
+		dummyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("next handler should not be called")
+		})
+
+		app.requireAuth(dummyHandler).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, "/login", rr.Header().Get("Location"))
+	})
+
+	t.Run("slides the session expiry", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/protected", nil)
+		sessionID, err := store.Create(req.Context(), userID, 50*time.Millisecond)
+		require.NoError(t, err)
+
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+		rr := httptest.NewRecorder()
+		app.requireAuth(nextHandler(t, userID)).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// The cookie is reissued with a fresh expiry
+		cookies := rr.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, sessionID, cookies[0].Value)
+		assert.WithinDuration(t, time.Now().Add(sessionTTL), cookies[0].Expires, time.Minute)
+
+		// The session outlives its original duration
+		time.Sleep(100 * time.Millisecond)
+		got, err := store.Get(req.Context(), sessionID)
+		require.NoError(t, err)
+		assert.Equal(t, userID, got)
+	})
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	const perMinute = 3
+	limiter := newRateLimiter(perMinute)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	handler := limiter.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/login", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < perMinute; i++ {
+		assert.Equal(t, http.StatusOK, request("192.0.2.1:1234").Code, "request %d", i+1)
+	}
+
+	rr := request("192.0.2.1:5678")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "20", rr.Header().Get("Retry-After"))
+
+	// Other clients have their own bucket
+	assert.Equal(t, http.StatusOK, request("198.51.100.7:1234").Code)
+
+	// Once a token has been refilled the client may continue
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, http.StatusOK, request("192.0.2.1:1234").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("192.0.2.1:1234").Code)
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gmaildigest-go/internal/scheduler"
+	"gmaildigest-go/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// webhookReply answers a Telegram update in the webhook response, which
+// Telegram runs as a Bot API call, so no request of our own is needed
+type webhookReply struct {
+	Method string `json:"method"`
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+// notConnectedReply answers commands from a chat not linked to any user
+const notConnectedReply = "This chat is not connected to an account yet. Send /start to connect it."
+
+// handleTelegramWebhook receives the updates Telegram posts to
+// /telegram/webhook/{secret}. The secret path token is the only
+// authentication, so a wrong one is answered like an unknown route. Commands
+// are answered in the response; anything else is acknowledged and ignored.
+func (a *Application) handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := r.PathValue("secret")
+	if a.webhookSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(a.webhookSecret)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid update", http.StatusBadRequest)
+		return
+	}
+
+	message := update.Message
+	if message == nil || message.From == nil || message.Chat == nil || !message.IsCommand() {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, webhookReply{
+		Method: "sendMessage",
+		ChatID: message.Chat.ID,
+		Text:   a.telegramCommand(r.Context(), message),
+	})
+}
+
+// telegramCommand runs a bot command and returns the reply. Failures are
+// logged and reported to the user, as Telegram only retries on an HTTP error.
+func (a *Application) telegramCommand(ctx context.Context, message *tgbotapi.Message) string {
+	command := message.Command()
+	if command == "start" {
+		return a.telegramService.StartReply(message)
+	}
+
+	user, err := a.storage.GetUserByTelegramID(ctx, message.From.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return notConnectedReply
+	}
+	if err != nil {
+		a.logger.Error("Failed to look up telegram user", "telegram_user", message.From.ID, "error", err)
+		return "Something went wrong. Please try again later."
+	}
+
+	switch command {
+	case "interval":
+		return a.telegramInterval(ctx, user, message.CommandArguments())
+	case "stop":
+		return a.telegramStop(ctx, user)
+	case "status":
+		return a.telegramStatus(ctx, user, message.From.ID)
+	default:
+		return "Unknown command. Try /interval 2h, /status or /stop."
+	}
+}
+
+// telegramInterval answers /interval <duration>
+func (a *Application) telegramInterval(ctx context.Context, user *storage.User, arg string) string {
+	interval, err := time.ParseDuration(strings.TrimSpace(arg))
+	if err != nil {
+		return "Usage: /interval <duration>, such as /interval 30m or /interval 2h"
+	}
+
+	err = a.setDigestInterval(ctx, user.ID, interval)
+	if errors.Is(err, storage.ErrInvalidInput) {
+		return fmt.Sprintf("Cannot use that interval: %v", err)
+	}
+	if err != nil {
+		a.logger.Error("Failed to update digest interval", "user", user.ID, "error", err)
+		return "Failed to save the interval. Please try again later."
+	}
+	return fmt.Sprintf("Digests will be sent every %s.", interval)
+}
+
+// telegramStop answers /stop by soft deleting the user and removing their
+// digest jobs. Signing in again restores the account.
+func (a *Application) telegramStop(ctx context.Context, user *storage.User) string {
+	if err := a.storage.SoftDeleteUser(ctx, user.ID); err != nil {
+		a.logger.Error("Failed to delete user", "user", user.ID, "error", err)
+		return "Failed to stop your digests. Please try again later."
+	}
+
+	jobs, err := a.scheduler.ListJobs(ctx, &scheduler.ListJobsOptions{UserID: user.ID, Type: "digest"})
+	if err != nil {
+		a.logger.Error("Failed to list digest jobs", "user", user.ID, "error", err)
+	}
+	for _, job := range jobs {
+		if err := a.scheduler.DeleteJob(ctx, job.ID); err != nil {
+			a.logger.Error("Failed to delete digest job", "job", job.ID, "user", user.ID, "error", err)
+		}
+	}
+
+	a.logger.Info("User stopped their digests from telegram", "user", user.ID)
+	return "Your digests are stopped. Sign in again to start them."
+}
+
+// telegramStatus answers /status with the user's metrics
+func (a *Application) telegramStatus(ctx context.Context, user *storage.User, telegramUserID int64) string {
+	metrics, err := a.storage.GetUserMetrics(ctx, telegramUserID)
+	if err != nil {
+		a.logger.Error("Failed to get metrics", "user", user.ID, "error", err)
+		return "Failed to get your status. Please try again later."
+	}
+
+	lastDigest := "never"
+	if user.LastDigestSent != nil {
+		lastDigest = metrics.TimeSinceLastDigest.Round(time.Minute).String() + " ago"
+	}
+	gmail := "connected"
+	if !metrics.HasValidToken {
+		gmail = "needs you to sign in again"
+	}
+	return fmt.Sprintf("Digests every %s, last sent %s.\nEmails processed: %d in the last 24 hours, %d in the last 7 days, %d in total.\nGmail access: %s.",
+		user.DigestInterval, lastDigest, metrics.EmailsLast24h, metrics.EmailsLast7d, metrics.ProcessedEmails, gmail)
+}
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gmaildigest-go/internal/scheduler"
+	"gmaildigest-go/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "0123456789abcdef"
+
+// webhookStorage holds users by Telegram ID and records the commands'
+// storage calls
+type webhookStorage struct {
+	storage.Storage
+	users     map[int64]*storage.User
+	intervals map[string]time.Duration
+	deleted   []string
+	metrics   *storage.UserMetrics
+}
+
+func (s *webhookStorage) GetUserByTelegramID(ctx context.Context, telegramUserID int64) (*storage.User, error) {
+	user, ok := s.users[telegramUserID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *webhookStorage) UpdateDigestInterval(ctx context.Context, userID string, interval time.Duration) error {
+	s.intervals[userID] = interval
+	return nil
+}
+
+func (s *webhookStorage) SoftDeleteUser(ctx context.Context, userID string) error {
+	s.deleted = append(s.deleted, userID)
+	return nil
+}
+
+func (s *webhookStorage) GetUserMetrics(ctx context.Context, telegramID int64) (*storage.UserMetrics, error) {
+	return s.metrics, nil
+}
+
+// newWebhookTestApp returns an app with the webhook enabled and user1 linked
+// to Telegram user 42
+func newWebhookTestApp(t *testing.T) (*Application, *scheduler.Scheduler, *webhookStorage) {
+	app, sched := newJobsTestApp(t)
+	app.webhookSecret = testWebhookSecret
+	store := &webhookStorage{
+		users: map[int64]*storage.User{
+			42: {ID: "user1", DigestInterval: time.Hour},
+		},
+		intervals: make(map[string]time.Duration),
+	}
+	app.storage = store
+	return app, sched, store
+}
+
+// commandUpdate returns the JSON of a Telegram update carrying a command
+// message sent by the given user in their private chat
+func commandUpdate(telegramUserID int64, text string) string {
+	command, _, _ := strings.Cut(text, " ")
+	return fmt.Sprintf(`{
+		"update_id": 1000,
+		"message": {
+			"message_id": 1,
+			"date": 1709287200,
+			"from": {"id": %d, "is_bot": false, "first_name": "Test"},
+			"chat": {"id": %d, "type": "private"},
+			"text": %q,
+			"entities": [{"type": "bot_command", "offset": 0, "length": %d}]
+		}
+	}`, telegramUserID, telegramUserID, text, len(command))
+}
+
+// postUpdate posts a Telegram update to the webhook under secret
+func postUpdate(app *Application, secret, update string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/telegram/webhook/"+secret, strings.NewReader(update))
+	req.SetPathValue("secret", secret)
+	rr := httptest.NewRecorder()
+	app.handleTelegramWebhook(rr, req)
+	return rr
+}
+
+// decodeReply decodes the sendMessage call a webhook response makes
+func decodeReply(t *testing.T, rr *httptest.ResponseRecorder) webhookReply {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rr.Code)
+	var reply webhookReply
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&reply))
+	assert.Equal(t, "sendMessage", reply.Method)
+	return reply
+}
+
+func TestHandlers_TelegramWebhookSecret(t *testing.T) {
+	app, _, store := newWebhookTestApp(t)
+
+	rr := postUpdate(app, "wrong-secret-value", commandUpdate(42, "/stop"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Empty(t, store.deleted)
+
+	app.webhookSecret = ""
+	rr = postUpdate(app, "", commandUpdate(42, "/stop"))
+	assert.Equal(t, http.StatusNotFound, rr.Code, "the webhook is off without a secret")
+	assert.Empty(t, store.deleted)
+
+	app.webhookSecret = testWebhookSecret
+	rr = postUpdate(app, testWebhookSecret, "{not json")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Messages that are not commands are acknowledged without a reply
+	rr = postUpdate(app, testWebhookSecret, `{"update_id": 1, "message": {"message_id": 1, "from": {"id": 42}, "chat": {"id": 42}, "text": "hello"}}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String())
+}
+
+func TestHandlers_TelegramWebhookInterval(t *testing.T) {
+	app, sched, store := newWebhookTestApp(t)
+
+	reply := decodeReply(t, postUpdate(app, testWebhookSecret, commandUpdate(42, "/interval 2h")))
+	assert.Equal(t, int64(42), reply.ChatID)
+	assert.Equal(t, "Digests will be sent every 2h0m0s.", reply.Text)
+	assert.Equal(t, 2*time.Hour, store.intervals["user1"])
+	jobs, err := sched.ListJobs(context.Background(), &scheduler.ListJobsOptions{UserID: "user1", Type: "digest"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "@every 2h0m0s", jobs[0].Schedule)
+
+	reply = decodeReply(t, postUpdate(app, testWebhookSecret, commandUpdate(42, "/interval soon")))
+	assert.Contains(t, reply.Text, "Usage: /interval")
+	reply = decodeReply(t, postUpdate(app, testWebhookSecret, commandUpdate(42, "/interval 90s")))
+	assert.Contains(t, reply.Text, "whole number of minutes")
+	assert.Len(t, store.intervals, 1)
+}
+
+func TestHandlers_TelegramWebhookStop(t *testing.T) {
+	app, sched, store := newWebhookTestApp(t)
+	ctx := context.Background()
+	require.NoError(t, sched.ScheduleDigest(ctx, "user1", "@every 1h0m0s"))
+
+	reply := decodeReply(t, postUpdate(app, testWebhookSecret, commandUpdate(42, "/stop")))
+	assert.Equal(t, int64(42), reply.ChatID)
+	assert.Contains(t, reply.Text, "stopped")
+	assert.Equal(t, []string{"user1"}, store.deleted)
+
+	jobs, err := sched.ListJobs(ctx, &scheduler.ListJobsOptions{UserID: "user1", Type: "digest"})
+	require.NoError(t, err)
+	assert.Empty(t, jobs, "the digest job should be removed")
+}
+
+func TestHandlers_TelegramWebhookStatus(t *testing.T) {
+	app, _, store := newWebhookTestApp(t)
+	sent := time.Now().Add(-3 * time.Hour)
+	store.users[42].LastDigestSent = &sent
+	store.metrics = &storage.UserMetrics{
+		TelegramID:          42,
+		GmailUserID:         "user1",
+		ProcessedEmails:     120,
+		EmailsLast24h:       7,
+		EmailsLast7d:        40,
+		HasValidToken:       true,
+		TimeSinceLastDigest: 3 * time.Hour,
+	}
+
+	reply := decodeReply(t, postUpdate(app, testWebhookSecret, commandUpdate(42, "/status")))
+	assert.Equal(t, int64(42), reply.ChatID)
+	assert.Equal(t, "Digests every 1h0m0s, last sent 3h0m0s ago.\n"+
+		"Emails processed: 7 in the last 24 hours, 40 in the last 7 days, 120 in total.\n"+
+		"Gmail access: connected.", reply.Text)
+}
+
+func TestHandlers_TelegramWebhookUnknownChat(t *testing.T) {
+	app, _, store := newWebhookTestApp(t)
+
+	reply := decodeReply(t, postUpdate(app, testWebhookSecret, commandUpdate(7, "/stop")))
+	assert.Equal(t, int64(7), reply.ChatID)
+	assert.Equal(t, notConnectedReply, reply.Text)
+	assert.Empty(t, store.deleted)
+}
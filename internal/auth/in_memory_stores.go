@@ -1,9 +1,6 @@
 package auth
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
 	"sync"
 )
@@ -82,25 +79,15 @@ func (s *InMemoryPKCEStore) GetVerifier(state string) (string, error) {
 
 // GenerateCodeVerifier creates a new code verifier.
 func (s *InMemoryPKCEStore) GenerateCodeVerifier(length int) (string, error) {
-	if length < 43 || length > 128 {
-		return "", fmt.Errorf("code verifier length must be between 43 and 128 characters")
-	}
-	p := make([]byte, length)
-	if _, err := rand.Read(p); err != nil {
-		return "", err
-	}
-	return base64.RawURLEncoding.EncodeToString(p), nil
+	return generateCodeVerifier(length)
 }
 
 // GenerateCodeChallenge creates a code challenge from a verifier.
 func (s *InMemoryPKCEStore) GenerateCodeChallenge(verifier string) (string, error) {
-	h := sha256.New()
-	h.Write([]byte(verifier))
-	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+	return codeChallenge(verifier)
 }
 
 // ValidateChallenge validates a code challenge against a verifier.
 func (s *InMemoryPKCEStore) ValidateChallenge(challenge, verifier string) bool {
-	calculatedChallenge, _ := s.GenerateCodeChallenge(verifier)
-	return challenge == calculatedChallenge
-} 
\ No newline at end of file
+	return challenge == generateCodeChallenge(verifier)
+}
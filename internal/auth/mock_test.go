@@ -3,37 +3,44 @@ package auth
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
 )
 
-// Mock Storage
+// Mock Storage keeping tokens in a map
 type mockStorage struct {
-	tokens map[string][]byte
-	nonces map[string][]byte
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
 }
 
 func newMockStorage() *mockStorage {
-	return &mockStorage{
-		tokens: make(map[string][]byte),
-		nonces: make(map[string][]byte),
-	}
+	return &mockStorage{tokens: make(map[string]*oauth2.Token)}
 }
 
-func (m *mockStorage) StoreToken(ctx context.Context, userID string, token []byte, nonce []byte) error {
+func (m *mockStorage) StoreToken(ctx context.Context, userID string, token *oauth2.Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.tokens[userID] = token
-	m.nonces[userID] = nonce
 	return nil
 }
 
-func (m *mockStorage) GetToken(ctx context.Context, userID string) ([]byte, []byte, error) {
+func (m *mockStorage) GetToken(ctx context.Context, userID string) (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	token, ok := m.tokens[userID]
 	if !ok {
-		return nil, nil, fmt.Errorf("token not found")
+		return nil, fmt.Errorf("token not found")
 	}
-	nonce := m.nonces[userID]
-	return token, nonce, nil
+	return token, nil
+}
+
+func (m *mockStorage) DeleteToken(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, userID)
+	return nil
 }
 
 // Mock PKCE Store
@@ -47,6 +54,14 @@ func (m *mockPKCEStore) GenerateCodeChallenge(verifier string) (string, error) {
 	return "test-challenge", nil
 }
 
+func (m *mockPKCEStore) StoreVerifier(state, verifier string) error {
+	return nil
+}
+
+func (m *mockPKCEStore) GetVerifier(state string) (string, error) {
+	return "test-verifier", nil
+}
+
 func (m *mockPKCEStore) ValidateChallenge(challenge, verifier string) bool {
 	return true
 }
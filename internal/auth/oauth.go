@@ -2,14 +2,40 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
+// GoogleRevokeURL is Google's OAuth2 token revocation endpoint
+const GoogleRevokeURL = "https://oauth2.googleapis.com/revoke"
+
+// GmailProfileURL is the Gmail API endpoint returning the signed-in user's
+// address, which HandleCallback stores tokens under
+const GmailProfileURL = "https://gmail.googleapis.com/gmail/v1/users/me/profile"
+
+// Gmail scopes an application may request
+const (
+	GmailReadonlyScope = "https://www.googleapis.com/auth/gmail.readonly"
+	GmailModifyScope   = "https://www.googleapis.com/auth/gmail.modify"
+	GmailSendScope     = "https://www.googleapis.com/auth/gmail.send"
+)
+
+// DefaultScopes are requested when no scopes are configured: reading emails
+// and marking them as read
+var DefaultScopes = []string{GmailReadonlyScope, GmailModifyScope}
+
+// stateEntropyBytes is the number of random bytes in an OAuth state parameter
+const stateEntropyBytes = 32
+
 // OAuthManager handles OAuth2 authentication flow with Google
 type OAuthManager struct {
 	config      *oauth2.Config
@@ -17,15 +43,25 @@ type OAuthManager struct {
 	pkceStore   PKCEStore
 	stateStore  StateStore
 	tokenSource oauth2.TokenSource // For testing purposes
+	httpClient  *http.Client
+	scopes      []string // empty means DefaultScopes
+	users       UserRegistry
 }
 
-// Storage interface for token persistence
+// Storage interface for token persistence, implemented by storage.TokenStore
 type Storage interface {
 	StoreToken(ctx context.Context, userID string, token *oauth2.Token) error
 	GetToken(ctx context.Context, userID string) (*oauth2.Token, error)
 	DeleteToken(ctx context.Context, userID string) error
 }
 
+// UserRegistry creates the user a token is stored for, so the token has a
+// user to belong to. It is implemented by storage.SQLiteStorage.
+type UserRegistry interface {
+	// EnsureUser creates the user with the given ID and email unless it exists
+	EnsureUser(ctx context.Context, id, email string) error
+}
+
 // StateStore manages OAuth state parameter
 type StateStore interface {
 	StoreState(userID, state string) error
@@ -33,6 +69,14 @@ type StateStore interface {
 	DeleteState(userID string)
 }
 
+// clientCredentials is the client section of a Google credentials JSON file,
+// shared by the "web" and "installed" (desktop app) shapes
+type clientCredentials struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
 // NewOAuthManager creates a new OAuthManager instance
 func NewOAuthManager(storage Storage, pkceStore PKCEStore, stateStore StateStore) *OAuthManager {
 	return &OAuthManager{
@@ -54,33 +98,83 @@ func (m *OAuthManager) LoadCredentials(credPath string) error {
 	}
 
 	var credConfig struct {
-		Web struct {
-			ClientID     string   `json:"client_id"`
-			ClientSecret string   `json:"client_secret"`
-			RedirectURIs []string `json:"redirect_uris"`
-		} `json:"web"`
+		Web       *clientCredentials `json:"web"`
+		Installed *clientCredentials `json:"installed"`
 	}
 
 	if err := json.Unmarshal(data, &credConfig); err != nil {
 		return fmt.Errorf("failed to parse credentials: %w", err)
 	}
 
+	// Web application credentials take precedence over installed (desktop) ones
+	creds := credConfig.Web
+	if creds == nil {
+		creds = credConfig.Installed
+	}
+	if creds == nil {
+		return fmt.Errorf("credentials file must contain a \"web\" or \"installed\" client")
+	}
+	if len(creds.RedirectURIs) == 0 {
+		return fmt.Errorf("credentials file has no redirect_uris")
+	}
+
 	m.config = &oauth2.Config{
-		ClientID:     credConfig.Web.ClientID,
-		ClientSecret: credConfig.Web.ClientSecret,
-		RedirectURL:  credConfig.Web.RedirectURIs[0],
-		Scopes: []string{
-			"https://www.googleapis.com/auth/gmail.readonly",
-			"https://www.googleapis.com/auth/gmail.modify",
-		},
-		Endpoint: google.Endpoint,
+		ClientID:     creds.ClientID,
+		ClientSecret: creds.ClientSecret,
+		RedirectURL:  creds.RedirectURIs[0],
+		Scopes:       m.requestedScopes(),
+		Endpoint:     google.Endpoint,
 	}
 
 	return nil
 }
 
+// Config returns the OAuth2 configuration loaded by LoadCredentials, or nil
+// before credentials are loaded
+func (m *OAuthManager) Config() *oauth2.Config {
+	return m.config
+}
+
+// SetScopes sets the OAuth scopes requested from users, replacing
+// DefaultScopes. An empty list restores the defaults.
+func (m *OAuthManager) SetScopes(scopes []string) {
+	m.scopes = scopes
+	if m.config != nil {
+		m.config.Scopes = m.requestedScopes()
+	}
+}
+
+// requestedScopes returns the configured scopes, or DefaultScopes
+func (m *OAuthManager) requestedScopes() []string {
+	if len(m.scopes) == 0 {
+		return append([]string(nil), DefaultScopes...)
+	}
+	return append([]string(nil), m.scopes...)
+}
+
 // GetAuthURL generates the OAuth authorization URL with PKCE
 func (m *OAuthManager) GetAuthURL(userID string) (string, string, error) {
+	return m.authURL(userID, m.config)
+}
+
+// GetIncrementalAuthURL generates an authorization URL that asks a user who
+// already signed in for additional scopes, such as GmailSendScope. Google
+// adds them to the scopes granted before, and consent is requested again so
+// the callback receives a refresh token covering all of them.
+func (m *OAuthManager) GetIncrementalAuthURL(userID string, scopes ...string) (string, string, error) {
+	if len(scopes) == 0 {
+		return "", "", fmt.Errorf("at least one scope is required")
+	}
+	if m.config == nil {
+		return "", "", fmt.Errorf("credentials not loaded")
+	}
+	config := *m.config
+	config.Scopes = scopes
+	return m.authURL(userID, &config, oauth2.ApprovalForce)
+}
+
+// authURL generates an authorization URL for config's scopes with PKCE
+func (m *OAuthManager) authURL(userID string, config *oauth2.Config, extra ...oauth2.AuthCodeOption) (string, string, error) {
 	if userID == "" {
 		return "", "", fmt.Errorf("user ID cannot be empty")
 	}
@@ -97,18 +191,28 @@ func (m *OAuthManager) GetAuthURL(userID string) (string, string, error) {
 	}
 
 	// Generate and store state
-	state := generateRandomState()
+	state, err := generateRandomState()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate state: %w", err)
+	}
 	if err := m.stateStore.StoreState(userID, state); err != nil {
 		return "", "", fmt.Errorf("failed to store state: %w", err)
 	}
+	// HandleCallback looks the verifier up by state to complete the exchange
+	if err := m.pkceStore.StoreVerifier(state, verifier); err != nil {
+		return "", "", fmt.Errorf("failed to store code verifier: %w", err)
+	}
 
 	opts := []oauth2.AuthCodeOption{
 		oauth2.AccessTypeOffline,
 		oauth2.SetAuthURLParam("code_challenge", challenge),
 		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		// Keep the scopes granted before, so new scopes can be asked for later
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"),
 	}
+	opts = append(opts, extra...)
 
-	authURL := m.config.AuthCodeURL(state, opts...)
+	authURL := config.AuthCodeURL(state, opts...)
 	return authURL, state, nil
 }
 
@@ -143,7 +247,9 @@ func (m *OAuthManager) RefreshToken(ctx context.Context, userID string) error {
 	if m.tokenSource != nil {
 		tokenSource = m.tokenSource
 	} else {
-		tokenSource = m.config.TokenSource(ctx, token)
+		// Only the refresh token is passed, so a token that is still valid
+		// is refreshed rather than handed back unchanged
+		tokenSource = m.config.TokenSource(m.clientContext(ctx), &oauth2.Token{RefreshToken: token.RefreshToken})
 	}
 
 	newToken, err := tokenSource.Token()
@@ -168,10 +274,13 @@ func (m *OAuthManager) getToken(ctx context.Context, userID string) (*oauth2.Tok
 	return m.storage.GetToken(ctx, userID)
 }
 
-// generateRandomState generates a random state parameter for OAuth flow
-func generateRandomState() string {
-	// Implementation will be added in a separate PR
-	return "temporary-state"
+// generateRandomState generates a random, URL-safe state parameter for OAuth flow
+func generateRandomState() (string, error) {
+	b := make([]byte, stateEntropyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
 // SetTokenSource sets a custom TokenSource for testing
@@ -179,26 +288,38 @@ func (m *OAuthManager) SetTokenSource(ts oauth2.TokenSource) {
 	m.tokenSource = ts
 }
 
-// HandleCallback processes the OAuth callback and stores the token
-func (m *OAuthManager) HandleCallback(ctx context.Context, code, state, userID string) error {
+// SetUserRegistry sets where HandleCallback creates the user it stores a
+// token for. No user is created when it is nil.
+func (m *OAuthManager) SetUserRegistry(users UserRegistry) {
+	m.users = users
+}
+
+// HandleCallback processes the OAuth callback of the login started for
+// loginID by GetAuthURL. It exchanges the code for a token, looks up the
+// Gmail address the user signed in with and stores the token under that
+// address, which it returns as the user's ID.
+func (m *OAuthManager) HandleCallback(ctx context.Context, code, state, loginID string) (string, error) {
 	if code == "" {
-		return fmt.Errorf("authorization code cannot be empty")
+		return "", fmt.Errorf("authorization code cannot be empty")
 	}
 	if state == "" {
-		return fmt.Errorf("state parameter cannot be empty")
+		return "", fmt.Errorf("state parameter cannot be empty")
 	}
-	if userID == "" {
-		return fmt.Errorf("user ID cannot be empty")
+	if loginID == "" {
+		return "", fmt.Errorf("user ID cannot be empty")
 	}
 
-	if !m.stateStore.ValidateState(userID, state) {
-		return fmt.Errorf("invalid state parameter")
+	// The state must be the one issued to this login by GetAuthURL, which
+	// stops a forged callback from attaching another account's code
+	if !m.stateStore.ValidateState(loginID, state) {
+		return "", fmt.Errorf("invalid state parameter")
 	}
-	defer m.stateStore.DeleteState(userID)
+	defer m.stateStore.DeleteState(loginID)
 
+	// Without the verifier Google rejects the code, so fail before exchanging
 	verifier, err := m.pkceStore.GetVerifier(state)
 	if err != nil {
-		return fmt.Errorf("failed to get pkce verifier: %w", err)
+		return "", fmt.Errorf("failed to get pkce verifier: %w", err)
 	}
 
 	opts := []oauth2.AuthCodeOption{
@@ -209,23 +330,133 @@ func (m *OAuthManager) HandleCallback(ctx context.Context, code, state, userID s
 	if m.tokenSource != nil {
 		token, err = m.tokenSource.Token()
 	} else {
-		token, err = m.config.Exchange(ctx, code, opts...)
+		token, err = m.config.Exchange(m.clientContext(ctx), code, opts...)
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to exchange code for token: %w", err)
+		return "", fmt.Errorf("failed to exchange code for token: %w", err)
 	}
 
-	if err := m.storage.StoreToken(ctx, userID, token); err != nil {
-		return fmt.Errorf("failed to store token: %w", err)
+	email, err := m.profileEmail(ctx, token)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	if m.users != nil {
+		if err := m.users.EnsureUser(ctx, email, email); err != nil {
+			return "", fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+	if err := m.storage.StoreToken(ctx, email, token); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return email, nil
+}
+
+// profileEmail asks the Gmail API for the address token belongs to
+func (m *OAuthManager) profileEmail(ctx context.Context, token *oauth2.Token) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, GmailProfileURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create profile request: %w", err)
+	}
+	client := oauth2.NewClient(m.clientContext(ctx), oauth2.StaticTokenSource(token))
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get gmail profile: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gmail profile request failed with status %d", resp.StatusCode)
+	}
+	var profile struct {
+		EmailAddress string `json:"emailAddress"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return "", fmt.Errorf("failed to decode gmail profile: %w", err)
+	}
+	if profile.EmailAddress == "" {
+		return "", fmt.Errorf("gmail profile has no email address")
+	}
+	return strings.ToLower(profile.EmailAddress), nil
+}
+
+// SetHTTPClient sets the HTTP client used for calls to Google such as the
+// token exchange and revocation
+func (m *OAuthManager) SetHTTPClient(client *http.Client) {
+	m.httpClient = client
 }
 
-// RevokeToken deletes a user's token from storage.
+// clientContext makes the oauth2 package use the configured HTTP client
+func (m *OAuthManager) clientContext(ctx context.Context) context.Context {
+	if m.httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, m.httpClient)
+}
+
+// RevokeToken revokes a user's grant at Google and then deletes the token from storage.
+// The refresh token is revoked when present, which also invalidates its access tokens.
 func (m *OAuthManager) RevokeToken(ctx context.Context, userID string) error {
-	return m.storage.DeleteToken(ctx, userID)
+	if userID == "" {
+		return fmt.Errorf("user ID cannot be empty")
+	}
+
+	token, err := m.getToken(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+	if token == nil {
+		return fmt.Errorf("no token found for user")
+	}
+
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+
+	form := url.Values{"token": {value}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, GoogleRevokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revocation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := m.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call revocation endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && !alreadyRevoked(resp) {
+		return fmt.Errorf("token revocation failed with status %d", resp.StatusCode)
+	}
+
+	if err := m.storage.DeleteToken(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	return nil
+}
+
+// alreadyRevoked reports whether a failed revocation response is Google's
+// 400 invalid_token, which it returns for a token that was already revoked
+// or has expired. Either way the grant is gone, so the revocation succeeded.
+func alreadyRevoked(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false
+	}
+	return body.Error == "invalid_token"
 }
 
 // SetRedirectURL sets a custom redirect URL for testing purposes.
@@ -2,9 +2,14 @@ package auth
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,7 +53,7 @@ func TestOAuthConfig_LoadCredentials(t *testing.T) {
 		},
 		{
 			name:        "invalid path",
-			credPath:    "/nonexistent/path",
+			credPath:    filepath.Join(tmpDir, "missing.json"),
 			wantErr:     true,
 			errContains: "no such file",
 		},
@@ -58,6 +63,28 @@ func TestOAuthConfig_LoadCredentials(t *testing.T) {
 			wantErr:     true,
 			errContains: "credentials path cannot be empty",
 		},
+		{
+			name:     "web credentials fixture",
+			credPath: filepath.Join("..", "..", "test", "fixtures", "dummy_credentials.json"),
+			wantErr:  false,
+		},
+		{
+			name:     "installed app credentials",
+			credPath: filepath.Join("..", "..", "test", "fixtures", "installed_credentials.json"),
+			wantErr:  false,
+		},
+		{
+			name:        "empty redirect uris",
+			credPath:    filepath.Join("..", "..", "test", "fixtures", "empty_redirect_credentials.json"),
+			wantErr:     true,
+			errContains: "no redirect_uris",
+		},
+		{
+			name:        "unknown credentials type",
+			credPath:    filepath.Join("..", "..", "test", "fixtures", "unknown_credentials.json"),
+			wantErr:     true,
+			errContains: "\"web\" or \"installed\"",
+		},
 	}
 
 	for _, tt := range tests {
@@ -137,6 +164,77 @@ func TestOAuthManager_GetAuthURL(t *testing.T) {
 	}
 }
 
+func TestOAuthManager_Scopes(t *testing.T) {
+	authQuery := func(t *testing.T, manager *OAuthManager, scopes ...string) url.Values {
+		var authURL string
+		var err error
+		if len(scopes) > 0 {
+			authURL, _, err = manager.GetIncrementalAuthURL("user1", scopes...)
+		} else {
+			authURL, _, err = manager.GetAuthURL("user1")
+		}
+		require.NoError(t, err)
+		parsed, err := url.Parse(authURL)
+		require.NoError(t, err)
+		return parsed.Query()
+	}
+
+	newManager := func(t *testing.T) *OAuthManager {
+		manager := NewOAuthManager(&revokeTestStorage{}, NewInMemoryPKCEStore(), NewInMemoryStateStore())
+		require.NoError(t, manager.LoadCredentials("../../test/fixtures/dummy_credentials.json"))
+		return manager
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		query := authQuery(t, newManager(t))
+		assert.Equal(t, GmailReadonlyScope+" "+GmailModifyScope, query.Get("scope"))
+		assert.Equal(t, "true", query.Get("include_granted_scopes"))
+		assert.Empty(t, query.Get("prompt"))
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		manager := newManager(t)
+		manager.SetScopes([]string{GmailReadonlyScope})
+		assert.Equal(t, GmailReadonlyScope, authQuery(t, manager).Get("scope"))
+
+		manager.SetScopes(nil)
+		assert.Equal(t, GmailReadonlyScope+" "+GmailModifyScope, authQuery(t, manager).Get("scope"))
+	})
+
+	t.Run("incremental", func(t *testing.T) {
+		manager := newManager(t)
+		query := authQuery(t, manager, GmailSendScope)
+		assert.Equal(t, GmailSendScope, query.Get("scope"))
+		assert.Equal(t, "true", query.Get("include_granted_scopes"))
+		assert.Equal(t, "consent", query.Get("prompt"))
+
+		// The scopes of ordinary sign-ins are unchanged
+		assert.Equal(t, GmailReadonlyScope+" "+GmailModifyScope, authQuery(t, manager).Get("scope"))
+
+		_, _, err := manager.GetIncrementalAuthURL("user1")
+		assert.Error(t, err)
+
+		// Without credentials there is no client to ask for scopes
+		unloaded := NewOAuthManager(&revokeTestStorage{}, NewInMemoryPKCEStore(), NewInMemoryStateStore())
+		_, _, err = unloaded.GetIncrementalAuthURL("user1", GmailSendScope)
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateRandomState(t *testing.T) {
+	first, err := generateRandomState()
+	require.NoError(t, err)
+	second, err := generateRandomState()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	for _, state := range []string{first, second} {
+		decoded, err := base64.RawURLEncoding.DecodeString(state)
+		require.NoError(t, err)
+		assert.Len(t, decoded, stateEntropyBytes)
+	}
+}
+
 func TestOAuthManager_ValidateToken(t *testing.T) {
 	manager := &OAuthManager{}
 
@@ -178,4 +276,298 @@ func TestOAuthManager_ValidateToken(t *testing.T) {
 			assert.Equal(t, tt.wantValid, valid)
 		})
 	}
-} 
\ No newline at end of file
+} 
+// roundTripFunc lets a function act as an http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// revokeTestStorage is a minimal Storage holding a single token
+type revokeTestStorage struct {
+	token   *oauth2.Token
+	deleted bool
+}
+
+func (s *revokeTestStorage) StoreToken(ctx context.Context, userID string, token *oauth2.Token) error {
+	s.token = token
+	return nil
+}
+
+func (s *revokeTestStorage) GetToken(ctx context.Context, userID string) (*oauth2.Token, error) {
+	return s.token, nil
+}
+
+func (s *revokeTestStorage) DeleteToken(ctx context.Context, userID string) error {
+	s.deleted = true
+	s.token = nil
+	return nil
+}
+
+func TestOAuthManager_RevokeToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantErr     bool
+		wantDeleted bool
+	}{
+		{
+			name:        "revocation succeeds",
+			status:      http.StatusOK,
+			wantDeleted: true,
+		},
+		{
+			name:    "revocation rejected",
+			status:  http.StatusBadRequest,
+			body:    `{"error": "invalid_request"}`,
+			wantErr: true,
+		},
+		{
+			// Google reports a token that is already revoked as invalid
+			name:        "already revoked",
+			status:      http.StatusBadRequest,
+			body:        `{"error": "invalid_token", "error_description": "Token expired or revoked"}`,
+			wantDeleted: true,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    `{"error": "invalid_token"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &revokeTestStorage{token: &oauth2.Token{
+				AccessToken:  "access-token",
+				RefreshToken: "refresh-token",
+			}}
+			manager := NewOAuthManager(storage, nil, nil)
+
+			var gotReq *http.Request
+			var gotBody string
+			manager.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				gotReq = req
+				body, _ := io.ReadAll(req.Body)
+				gotBody = string(body)
+				return &http.Response{
+					StatusCode: tt.status,
+					Body:       io.NopCloser(strings.NewReader(tt.body)),
+					Header:     make(http.Header),
+				}, nil
+			})})
+
+			err := manager.RevokeToken(context.Background(), "user1")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantDeleted, storage.deleted)
+
+			require.NotNil(t, gotReq)
+			assert.Equal(t, http.MethodPost, gotReq.Method)
+			assert.Equal(t, GoogleRevokeURL, gotReq.URL.String())
+			assert.Equal(t, "token=refresh-token", gotBody)
+		})
+	}
+}
+
+func TestOAuthManager_HandleCallback_PKCEAndState(t *testing.T) {
+	tests := []struct {
+		name string
+		// tamper runs between GetAuthURL and HandleCallback and returns the
+		// state and user ID to call back with
+		tamper       func(m *OAuthManager, pkce PKCEStore, state string) (string, string)
+		wantErr      bool
+		wantExchange bool
+	}{
+		{
+			name: "valid state and verifier",
+			tamper: func(m *OAuthManager, pkce PKCEStore, state string) (string, string) {
+				return state, "user1"
+			},
+			wantExchange: true,
+		},
+		{
+			name: "missing verifier",
+			tamper: func(m *OAuthManager, pkce PKCEStore, state string) (string, string) {
+				_, err := pkce.GetVerifier(state)
+				require.NoError(t, err)
+				return state, "user1"
+			},
+			wantErr: true,
+		},
+		{
+			name: "forged state",
+			tamper: func(m *OAuthManager, pkce PKCEStore, state string) (string, string) {
+				forged, err := generateRandomState()
+				require.NoError(t, err)
+				return forged, "user1"
+			},
+			wantErr: true,
+		},
+		{
+			name: "state issued to another user",
+			tamper: func(m *OAuthManager, pkce PKCEStore, state string) (string, string) {
+				_, _, err := m.GetAuthURL("user2")
+				require.NoError(t, err)
+				return state, "user2"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &revokeTestStorage{}
+			pkce := NewInMemoryPKCEStore()
+			manager := NewOAuthManager(storage, pkce, NewInMemoryStateStore())
+			require.NoError(t, manager.LoadCredentials("../../test/fixtures/dummy_credentials.json"))
+
+			var exchanges int
+			var gotVerifier string
+			manager.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.URL.String() == GmailProfileURL {
+					return profileResponse("user1@example.com"), nil
+				}
+				exchanges++
+				require.NoError(t, req.ParseForm())
+				gotVerifier = req.PostForm.Get("code_verifier")
+				header := make(http.Header)
+				header.Set("Content-Type", "application/json")
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: io.NopCloser(strings.NewReader(
+						`{"access_token":"access-token","token_type":"Bearer","refresh_token":"refresh-token","expires_in":3600}`)),
+					Header: header,
+				}, nil
+			})})
+
+			authURL, state, err := manager.GetAuthURL("user1")
+			require.NoError(t, err)
+			parsed, err := url.Parse(authURL)
+			require.NoError(t, err)
+			challenge := parsed.Query().Get("code_challenge")
+
+			callbackState, userID := tt.tamper(manager, pkce, state)
+			_, err = manager.HandleCallback(context.Background(), "auth-code", callbackState, userID)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, storage.token)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, storage.token)
+				assert.Equal(t, "access-token", storage.token.AccessToken)
+			}
+
+			if !tt.wantExchange {
+				assert.Zero(t, exchanges, "code must not be exchanged")
+				return
+			}
+			assert.Equal(t, 1, exchanges)
+			assert.Equal(t, challenge, generateCodeChallenge(gotVerifier))
+
+			// The state is single use, so replaying the callback fails
+			_, err = manager.HandleCallback(context.Background(), "auth-code", state, "user1")
+			assert.Error(t, err)
+			assert.Equal(t, 1, exchanges)
+		})
+	}
+}
+
+// profileResponse is a Gmail profile response for email
+func profileResponse(email string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"emailAddress": "` + email + `", "messagesTotal": 10}`)),
+	}
+}
+
+// callbackTestStorage records the user ID each token is stored under
+type callbackTestStorage struct {
+	tokens map[string]*oauth2.Token
+}
+
+func (s *callbackTestStorage) StoreToken(ctx context.Context, userID string, token *oauth2.Token) error {
+	s.tokens[userID] = token
+	return nil
+}
+
+func (s *callbackTestStorage) GetToken(ctx context.Context, userID string) (*oauth2.Token, error) {
+	return s.tokens[userID], nil
+}
+
+func (s *callbackTestStorage) DeleteToken(ctx context.Context, userID string) error {
+	delete(s.tokens, userID)
+	return nil
+}
+
+// userRegistryFunc lets a function act as a UserRegistry
+type userRegistryFunc func(ctx context.Context, id, email string) error
+
+func (f userRegistryFunc) EnsureUser(ctx context.Context, id, email string) error {
+	return f(ctx, id, email)
+}
+
+func TestOAuthManager_HandleCallback_StoresTokenUnderProfileEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		email     string
+		wantEmail string
+		wantErr   bool
+	}{
+		{name: "profile email", status: http.StatusOK, email: "Someone@Gmail.com", wantEmail: "someone@gmail.com"},
+		{name: "profile without email", status: http.StatusOK, email: "", wantErr: true},
+		{name: "profile request fails", status: http.StatusUnauthorized, email: "someone@gmail.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &callbackTestStorage{tokens: make(map[string]*oauth2.Token)}
+			manager := NewOAuthManager(storage, NewInMemoryPKCEStore(), NewInMemoryStateStore())
+			require.NoError(t, manager.LoadCredentials("../../test/fixtures/dummy_credentials.json"))
+			manager.SetTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "access-token"}))
+
+			var registered []string
+			manager.SetUserRegistry(userRegistryFunc(func(ctx context.Context, id, email string) error {
+				registered = append(registered, id+" "+email)
+				return nil
+			}))
+
+			var authHeader string
+			manager.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				require.Equal(t, GmailProfileURL, req.URL.String())
+				authHeader = req.Header.Get("Authorization")
+				resp := profileResponse(tt.email)
+				resp.StatusCode = tt.status
+				return resp, nil
+			})})
+
+			_, state, err := manager.GetAuthURL("login-1")
+			require.NoError(t, err)
+
+			email, err := manager.HandleCallback(context.Background(), "auth-code", state, "login-1")
+			assert.Equal(t, "Bearer access-token", authHeader)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, storage.tokens)
+				assert.Empty(t, registered)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEmail, email)
+			assert.Equal(t, []string{tt.wantEmail + " " + tt.wantEmail}, registered)
+			require.Contains(t, storage.tokens, tt.wantEmail)
+			assert.Equal(t, "access-token", storage.tokens[tt.wantEmail].AccessToken)
+			assert.NotContains(t, storage.tokens, "login-1")
+		})
+	}
+}
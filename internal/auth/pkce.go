@@ -1,5 +1,12 @@
 package auth
 
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
 // PKCEStore defines the interface for storing and retrieving PKCE code verifiers.
 type PKCEStore interface {
 	GenerateCodeVerifier(length int) (string, error)
@@ -7,4 +14,32 @@ type PKCEStore interface {
 	StoreVerifier(state, verifier string) error
 	GetVerifier(state string) (string, error)
 	ValidateChallenge(challenge, verifier string) bool
-} 
\ No newline at end of file
+}
+
+// generateCodeVerifier creates a random PKCE code verifier of length
+// characters, which RFC 7636 allows to be from 43 to 128.
+func generateCodeVerifier(length int) (string, error) {
+	if length < 43 || length > 128 {
+		return "", fmt.Errorf("code verifier length must be between 43 and 128 characters")
+	}
+	// length random bytes encode to more than length characters
+	p := make([]byte, length)
+	if _, err := rand.Read(p); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p)[:length], nil
+}
+
+// generateCodeChallenge derives the S256 code challenge for a verifier.
+func generateCodeChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// codeChallenge returns the code challenge for a verifier, which must not be empty
+func codeChallenge(verifier string) (string, error) {
+	if verifier == "" {
+		return "", fmt.Errorf("code verifier cannot be empty")
+	}
+	return generateCodeChallenge(verifier), nil
+}
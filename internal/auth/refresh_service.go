@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"gmaildigest-go/internal/scheduler"
+	"sync"
 	"time"
 )
 
@@ -13,27 +14,69 @@ type TokenRefreshJob struct {
 	UserID string `json:"user_id"`
 }
 
+// DefaultRefreshConcurrency is the default number of users RefreshTokens
+// refreshes at once
+const DefaultRefreshConcurrency = 4
+
 // TokenRefreshService handles automatic token refresh for users
 type TokenRefreshService struct {
-	manager *OAuthManager
+	manager             *OAuthManager
+	now                 func() time.Time
+	refreshBeforeExpiry time.Duration // tokens expiring within this window are refreshed
+	concurrency         int
 }
 
 // NewTokenRefreshService creates a new TokenRefreshService
 func NewTokenRefreshService(manager *OAuthManager) *TokenRefreshService {
 	return &TokenRefreshService{
-		manager: manager,
+		manager:             manager,
+		now:                 time.Now,
+		refreshBeforeExpiry: scheduler.DefaultRefreshBeforeExpiry,
+		concurrency:         DefaultRefreshConcurrency,
 	}
 }
 
-// RefreshTokens refreshes tokens for all users that need refreshing
-func (s *TokenRefreshService) RefreshTokens(ctx context.Context, userIDs []string) error {
+// SetConcurrency sets how many users RefreshTokens refreshes in parallel.
+// Values below 1 refresh one user at a time.
+func (s *TokenRefreshService) SetConcurrency(n int) {
+	s.concurrency = n
+}
+
+// SetRefreshBeforeExpiry sets how long before its expiry a token is
+// refreshed. A window of 0 refreshes only tokens that have expired.
+func (s *TokenRefreshService) SetRefreshBeforeExpiry(window time.Duration) {
+	s.refreshBeforeExpiry = window
+}
+
+// RefreshTokens refreshes the tokens of the given users that need refreshing,
+// several users at a time. A failure for one user does not stop the others:
+// the result maps every user ID to the error refreshing it, or nil if its
+// token was refreshed or did not need to be.
+func (s *TokenRefreshService) RefreshTokens(ctx context.Context, userIDs []string) map[string]error {
+	results := make(map[string]error, len(userIDs))
+	seen := make(map[string]bool, len(userIDs))
+	var mu sync.Mutex
+	sem := make(chan struct{}, max(s.concurrency, 1))
+	var wg sync.WaitGroup
 	for _, userID := range userIDs {
-		if err := s.refreshUserToken(ctx, userID); err != nil {
-			// Log error but continue with other users
-			fmt.Printf("Error refreshing token for user %s: %v\n", userID, err)
+		if seen[userID] {
+			continue
 		}
+		seen[userID] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := s.refreshUserToken(ctx, userID)
+			mu.Lock()
+			results[userID] = err
+			mu.Unlock()
+		}()
 	}
-	return nil
+	wg.Wait()
+	return results
 }
 
 // refreshUserToken refreshes the token for a single user
@@ -43,8 +86,8 @@ func (s *TokenRefreshService) refreshUserToken(ctx context.Context, userID strin
 		return fmt.Errorf("failed to get token: %w", err)
 	}
 
-	// Check if token needs refresh (refresh 5 minutes before expiry)
-	if token.Expiry.After(time.Now().Add(5 * time.Minute)) {
+	// Tokens are refreshed once they expire within the refresh window
+	if !scheduler.NeedsRefresh(token, s.now(), s.refreshBeforeExpiry) {
 		return nil // Token is still valid
 	}
 
@@ -3,9 +3,13 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"gmaildigest-go/internal/scheduler"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
@@ -87,7 +91,7 @@ func TestTokenRefreshService_RefreshTokens(t *testing.T) {
 			name:     "user with storage error",
 			userIDs:  []string{"error-user"},
 			tokens:   map[string]*oauth2.Token{},
-			wantErr:  false, // Should not return error as we continue with other users
+			wantErr:  true, // Reported for the user rather than returned
 			setupErr: assert.AnError,
 		},
 	}
@@ -96,43 +100,34 @@ func TestTokenRefreshService_RefreshTokens(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Setup tokens in storage
 			for userID, token := range tt.tokens {
-				tokenBytes, err := json.Marshal(token)
-				require.NoError(t, err)
-				err = storage.StoreToken(ctx, userID, tokenBytes, []byte("test-nonce"))
-				require.NoError(t, err)
+				require.NoError(t, storage.StoreToken(ctx, userID, token))
 			}
 
 			// Set up mock token source
-			manager.SetTokenSource(&mockTokenSource{
-				token: &oauth2.Token{
-					AccessToken:  "refreshed-token",
-					TokenType:    "Bearer",
-					Expiry:      time.Now().Add(time.Hour),
-					RefreshToken: "refresh-token",
-				},
-			})
+			manager.SetTokenSource(&mockTokenSource{token: &oauth2.Token{RefreshToken: "refresh-token"}})
 
-			err := service.RefreshTokens(ctx, tt.userIDs)
+			results := service.RefreshTokens(ctx, tt.userIDs)
+			assert.Len(t, results, len(tt.userIDs))
 
 			if tt.wantErr {
-				assert.Error(t, err)
+				for _, userID := range tt.userIDs {
+					assert.Error(t, results[userID])
+				}
 				return
 			}
 
-			assert.NoError(t, err)
+			for _, userID := range tt.userIDs {
+				assert.NoError(t, results[userID])
+			}
 
 			// Verify token states
 			for userID, originalToken := range tt.tokens {
-				tokenBytes, _, err := storage.GetToken(ctx, userID)
-				require.NoError(t, err)
-
-				var token oauth2.Token
-				err = json.Unmarshal(tokenBytes, &token)
+				token, err := storage.GetToken(ctx, userID)
 				require.NoError(t, err)
 
 				if originalToken.Expiry.Before(time.Now().Add(5 * time.Minute)) {
 					// Token should have been refreshed
-					assert.Equal(t, "refreshed-token", token.AccessToken)
+					assert.Equal(t, "new-token", token.AccessToken)
 					assert.True(t, token.Expiry.After(time.Now()))
 				} else {
 					// Token should not have been refreshed
@@ -196,21 +191,11 @@ func TestTokenRefreshService_HandleRefreshJob(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.token != nil {
-				tokenBytes, err := json.Marshal(tt.token)
-				require.NoError(t, err)
-				err = storage.StoreToken(ctx, tt.userID, tokenBytes, []byte("test-nonce"))
-				require.NoError(t, err)
+				require.NoError(t, storage.StoreToken(ctx, tt.userID, tt.token))
 			}
 
 			// Set up mock token source
-			manager.SetTokenSource(&mockTokenSource{
-				token: &oauth2.Token{
-					AccessToken:  "refreshed-token",
-					TokenType:    "Bearer",
-					Expiry:      time.Now().Add(time.Hour),
-					RefreshToken: "refresh-token",
-				},
-			})
+			manager.SetTokenSource(&mockTokenSource{token: &oauth2.Token{RefreshToken: "refresh-token"}})
 
 			// Create job payload
 			job := TokenRefreshJob{
@@ -219,7 +204,7 @@ func TestTokenRefreshService_HandleRefreshJob(t *testing.T) {
 			payload, err := json.Marshal(job)
 			require.NoError(t, err)
 
-			err = service.HandleRefreshJob(ctx, payload)
+			err = service.HandleTokenRefreshJob(ctx, &scheduler.Job{Payload: payload})
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -229,16 +214,12 @@ func TestTokenRefreshService_HandleRefreshJob(t *testing.T) {
 			assert.NoError(t, err)
 
 			if tt.token != nil {
-				tokenBytes, _, err := storage.GetToken(ctx, tt.userID)
-				require.NoError(t, err)
-
-				var token oauth2.Token
-				err = json.Unmarshal(tokenBytes, &token)
+				token, err := storage.GetToken(ctx, tt.userID)
 				require.NoError(t, err)
 
 				if tt.token.Expiry.Before(time.Now().Add(5 * time.Minute)) {
 					// Token should have been refreshed
-					assert.Equal(t, "refreshed-token", token.AccessToken)
+					assert.Equal(t, "new-token", token.AccessToken)
 					assert.True(t, token.Expiry.After(time.Now()))
 				} else {
 					// Token should not have been refreshed
@@ -295,4 +276,114 @@ func TestTokenRefreshService_GetRefreshSchedule(t *testing.T) {
 
 	schedule := service.GetRefreshSchedule()
 	assert.Equal(t, "0 * * * *", schedule)
-} 
\ No newline at end of file
+} 
+func TestTokenRefreshService_RefreshBuffer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	storage := newMockStorage()
+	manager := &OAuthManager{storage: storage}
+	manager.SetTokenSource(&mockTokenSource{token: &oauth2.Token{RefreshToken: "refresh-token"}})
+
+	service := NewTokenRefreshService(manager)
+	service.now = func() time.Time { return now }
+	service.SetRefreshBeforeExpiry(10 * time.Minute)
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		refreshed bool
+	}{
+		{name: "inside the buffer", expiresIn: 9 * time.Minute, refreshed: true},
+		{name: "at the buffer", expiresIn: 10 * time.Minute, refreshed: true},
+		{name: "just past the buffer", expiresIn: 10*time.Minute + time.Second, refreshed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, storage.StoreToken(ctx, "user", &oauth2.Token{
+				AccessToken:  "old-token",
+				RefreshToken: "refresh-token",
+				Expiry:       now.Add(tt.expiresIn),
+			}))
+
+			require.NoError(t, service.refreshUserToken(ctx, "user"))
+
+			token, err := storage.GetToken(ctx, "user")
+			require.NoError(t, err)
+			if tt.refreshed {
+				assert.Equal(t, "new-token", token.AccessToken)
+			} else {
+				assert.Equal(t, "old-token", token.AccessToken)
+			}
+		})
+	}
+}
+
+// countingTokenSource hands out new tokens, tracking how many requests are
+// in flight at once
+type countingTokenSource struct {
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (c *countingTokenSource) Token() (*oauth2.Token, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		peak := c.maxInFlight.Load()
+		if n <= peak || c.maxInFlight.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return &oauth2.Token{AccessToken: "new-token", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestTokenRefreshService_RefreshTokensConcurrently(t *testing.T) {
+	ctx := context.Background()
+	storage := newMockStorage()
+	source := &countingTokenSource{}
+	manager := &OAuthManager{storage: storage}
+	manager.SetTokenSource(source)
+
+	service := NewTokenRefreshService(manager)
+	service.SetConcurrency(2)
+
+	var userIDs []string
+	for i := 0; i < 6; i++ {
+		userID := fmt.Sprintf("expired-%d", i)
+		userIDs = append(userIDs, userID)
+		require.NoError(t, storage.StoreToken(ctx, userID, &oauth2.Token{
+			AccessToken:  "old-token",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(-time.Hour),
+		}))
+	}
+	require.NoError(t, storage.StoreToken(ctx, "valid", &oauth2.Token{
+		AccessToken:  "valid-token",
+		RefreshToken: "refresh-token",
+		Expiry:       time.Now().Add(time.Hour),
+	}))
+	require.NoError(t, storage.StoreToken(ctx, "no-refresh-token", &oauth2.Token{
+		AccessToken: "old-token",
+		Expiry:      time.Now().Add(-time.Hour),
+	}))
+	userIDs = append(userIDs, "valid", "no-refresh-token", "missing", "valid")
+
+	results := service.RefreshTokens(ctx, userIDs)
+
+	assert.Len(t, results, 9)
+	for i := 0; i < 6; i++ {
+		userID := fmt.Sprintf("expired-%d", i)
+		assert.NoError(t, results[userID], userID)
+		token, err := storage.GetToken(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, "new-token", token.AccessToken)
+	}
+	assert.NoError(t, results["valid"])
+	assert.ErrorContains(t, results["no-refresh-token"], "no refresh token available")
+	assert.ErrorContains(t, results["missing"], "failed to get token")
+
+	assert.LessOrEqual(t, source.maxInFlight.Load(), int32(2))
+	assert.Equal(t, int32(2), source.maxInFlight.Load(), "refreshes should overlap up to the limit")
+}
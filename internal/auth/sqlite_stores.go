@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultOAuthStateTTL is how long a pending OAuth state or PKCE verifier stays valid
+	DefaultOAuthStateTTL = 10 * time.Minute
+	// defaultSweepInterval is how often expired OAuth state rows are deleted
+	defaultSweepInterval = time.Minute
+)
+
+// OAuthStateStorage is the persistence required by the SQLite-backed state and PKCE stores.
+// It is implemented by storage.SQLiteStorage.
+type OAuthStateStorage interface {
+	StoreOAuthState(ctx context.Context, userID, state string) error
+	GetOAuthState(ctx context.Context, userID string) (string, time.Time, error)
+	DeleteOAuthState(ctx context.Context, userID string) error
+	StorePKCEVerifier(ctx context.Context, state, verifier string) error
+	GetPKCEVerifier(ctx context.Context, state string) (string, time.Time, error)
+	DeletePKCEVerifier(ctx context.Context, state string) error
+	CleanupExpiredOAuthState(ctx context.Context, ttl time.Duration) (int64, error)
+}
+
+// SQLiteStateStore is a StateStore persisted in the database, so OAuth flows
+// survive restarts and work across multiple instances.
+type SQLiteStateStore struct {
+	db  OAuthStateStorage
+	ttl time.Duration
+}
+
+// NewSQLiteStateStore creates a new SQLiteStateStore. A non-positive ttl uses DefaultOAuthStateTTL.
+func NewSQLiteStateStore(db OAuthStateStorage, ttl time.Duration) *SQLiteStateStore {
+	if ttl <= 0 {
+		ttl = DefaultOAuthStateTTL
+	}
+	return &SQLiteStateStore{db: db, ttl: ttl}
+}
+
+// StoreState stores the state for a given user ID.
+func (s *SQLiteStateStore) StoreState(userID, state string) error {
+	return s.db.StoreOAuthState(context.Background(), userID, state)
+}
+
+// ValidateState validates and then deletes the state for a given user ID.
+// Expired states are rejected.
+func (s *SQLiteStateStore) ValidateState(userID, state string) bool {
+	ctx := context.Background()
+	storedState, createdAt, err := s.db.GetOAuthState(ctx, userID)
+	if err != nil {
+		return false
+	}
+	if time.Since(createdAt) > s.ttl {
+		s.db.DeleteOAuthState(ctx, userID)
+		return false
+	}
+	if storedState != state {
+		return false
+	}
+	s.db.DeleteOAuthState(ctx, userID)
+	return true
+}
+
+// DeleteState removes the state for a given user ID.
+func (s *SQLiteStateStore) DeleteState(userID string) {
+	s.db.DeleteOAuthState(context.Background(), userID)
+}
+
+// SQLitePKCEStore is a PKCEStore whose code verifiers are persisted in the database.
+type SQLitePKCEStore struct {
+	db  OAuthStateStorage
+	ttl time.Duration
+}
+
+// NewSQLitePKCEStore creates a new SQLitePKCEStore. A non-positive ttl uses DefaultOAuthStateTTL.
+func NewSQLitePKCEStore(db OAuthStateStorage, ttl time.Duration) *SQLitePKCEStore {
+	if ttl <= 0 {
+		ttl = DefaultOAuthStateTTL
+	}
+	return &SQLitePKCEStore{db: db, ttl: ttl}
+}
+
+// StoreVerifier stores the code verifier for a given state.
+func (s *SQLitePKCEStore) StoreVerifier(state, verifier string) error {
+	return s.db.StorePKCEVerifier(context.Background(), state, verifier)
+}
+
+// GetVerifier retrieves and deletes the code verifier for a given state.
+func (s *SQLitePKCEStore) GetVerifier(state string) (string, error) {
+	ctx := context.Background()
+	verifier, createdAt, err := s.db.GetPKCEVerifier(ctx, state)
+	if err != nil {
+		return "", fmt.Errorf("no verifier found for state: %s", state)
+	}
+	s.db.DeletePKCEVerifier(ctx, state)
+	if time.Since(createdAt) > s.ttl {
+		return "", fmt.Errorf("verifier expired for state: %s", state)
+	}
+	return verifier, nil
+}
+
+// GenerateCodeVerifier creates a new code verifier.
+func (s *SQLitePKCEStore) GenerateCodeVerifier(length int) (string, error) {
+	return generateCodeVerifier(length)
+}
+
+// GenerateCodeChallenge creates a code challenge from a verifier.
+func (s *SQLitePKCEStore) GenerateCodeChallenge(verifier string) (string, error) {
+	return codeChallenge(verifier)
+}
+
+// ValidateChallenge validates a code challenge against a verifier.
+func (s *SQLitePKCEStore) ValidateChallenge(challenge, verifier string) bool {
+	return challenge == generateCodeChallenge(verifier)
+}
+
+// OAuthStateSweeper periodically deletes expired OAuth state and PKCE verifier rows.
+type OAuthStateSweeper struct {
+	db       OAuthStateStorage
+	ttl      time.Duration
+	interval time.Duration
+	logger   *slog.Logger
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewOAuthStateSweeper creates a sweeper for rows older than ttl.
+// Non-positive values use DefaultOAuthStateTTL and a one minute interval.
+func NewOAuthStateSweeper(db OAuthStateStorage, ttl, interval time.Duration, logger *slog.Logger) *OAuthStateSweeper {
+	if ttl <= 0 {
+		ttl = DefaultOAuthStateTTL
+	}
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	return &OAuthStateSweeper{db: db, ttl: ttl, interval: interval, logger: logger}
+}
+
+// Start begins sweeping in the background until Stop is called.
+func (s *OAuthStateSweeper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweep(ctx)
+			}
+		}
+	}()
+}
+
+// Stop halts the background sweep and waits for it to exit.
+func (s *OAuthStateSweeper) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// sweep deletes expired rows once
+func (s *OAuthStateSweeper) sweep(ctx context.Context) {
+	if _, err := s.db.CleanupExpiredOAuthState(ctx, s.ttl); err != nil && s.logger != nil {
+		s.logger.Error("Failed to sweep expired OAuth state", "error", err)
+	}
+}
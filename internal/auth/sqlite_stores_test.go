@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timedValue struct {
+	value     string
+	createdAt time.Time
+}
+
+// fakeOAuthStateStorage is an in-memory OAuthStateStorage with controllable timestamps
+type fakeOAuthStateStorage struct {
+	mu        sync.Mutex
+	states    map[string]timedValue
+	verifiers map[string]timedValue
+	cleanups  int
+}
+
+func newFakeOAuthStateStorage() *fakeOAuthStateStorage {
+	return &fakeOAuthStateStorage{
+		states:    make(map[string]timedValue),
+		verifiers: make(map[string]timedValue),
+	}
+}
+
+func (f *fakeOAuthStateStorage) StoreOAuthState(ctx context.Context, userID, state string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[userID] = timedValue{state, time.Now()}
+	return nil
+}
+
+func (f *fakeOAuthStateStorage) GetOAuthState(ctx context.Context, userID string) (string, time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.states[userID]
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("not found")
+	}
+	return v.value, v.createdAt, nil
+}
+
+func (f *fakeOAuthStateStorage) DeleteOAuthState(ctx context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.states, userID)
+	return nil
+}
+
+func (f *fakeOAuthStateStorage) StorePKCEVerifier(ctx context.Context, state, verifier string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.verifiers[state] = timedValue{verifier, time.Now()}
+	return nil
+}
+
+func (f *fakeOAuthStateStorage) GetPKCEVerifier(ctx context.Context, state string) (string, time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.verifiers[state]
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("not found")
+	}
+	return v.value, v.createdAt, nil
+}
+
+func (f *fakeOAuthStateStorage) DeletePKCEVerifier(ctx context.Context, state string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.verifiers, state)
+	return nil
+}
+
+func (f *fakeOAuthStateStorage) CleanupExpiredOAuthState(ctx context.Context, ttl time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cleanups++
+	return 0, nil
+}
+
+// age moves an entry's creation time into the past
+func (f *fakeOAuthStateStorage) age(entries map[string]timedValue, key string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v := entries[key]
+	v.createdAt = v.createdAt.Add(-d)
+	entries[key] = v
+}
+
+func TestSQLiteStateStore(t *testing.T) {
+	db := newFakeOAuthStateStorage()
+	store := NewSQLiteStateStore(db, time.Minute)
+
+	require.NoError(t, store.StoreState("user1", "state-1"))
+	assert.False(t, store.ValidateState("user1", "wrong-state"))
+	assert.True(t, store.ValidateState("user1", "state-1"))
+
+	// States are single use
+	assert.False(t, store.ValidateState("user1", "state-1"))
+
+	require.NoError(t, store.StoreState("user1", "state-2"))
+	store.DeleteState("user1")
+	assert.False(t, store.ValidateState("user1", "state-2"))
+}
+
+func TestSQLiteStateStore_Expired(t *testing.T) {
+	db := newFakeOAuthStateStorage()
+	store := NewSQLiteStateStore(db, time.Minute)
+
+	require.NoError(t, store.StoreState("user1", "state-1"))
+	db.age(db.states, "user1", 2*time.Minute)
+	assert.False(t, store.ValidateState("user1", "state-1"))
+}
+
+func TestSQLitePKCEStore(t *testing.T) {
+	db := newFakeOAuthStateStorage()
+	store := NewSQLitePKCEStore(db, time.Minute)
+
+	require.NoError(t, store.StoreVerifier("state-1", "verifier-1"))
+	verifier, err := store.GetVerifier("state-1")
+	require.NoError(t, err)
+	assert.Equal(t, "verifier-1", verifier)
+
+	_, err = store.GetVerifier("state-1")
+	assert.Error(t, err)
+
+	require.NoError(t, store.StoreVerifier("state-2", "verifier-2"))
+	db.age(db.verifiers, "state-2", 2*time.Minute)
+	_, err = store.GetVerifier("state-2")
+	assert.Error(t, err)
+
+	generated, err := store.GenerateCodeVerifier(43)
+	require.NoError(t, err)
+	challenge, err := store.GenerateCodeChallenge(generated)
+	require.NoError(t, err)
+	assert.True(t, store.ValidateChallenge(challenge, generated))
+}
+
+func TestNewSQLiteStores_DefaultTTL(t *testing.T) {
+	db := newFakeOAuthStateStorage()
+	assert.Equal(t, DefaultOAuthStateTTL, NewSQLiteStateStore(db, 0).ttl)
+	assert.Equal(t, DefaultOAuthStateTTL, NewSQLitePKCEStore(db, 0).ttl)
+}
+
+func TestOAuthStateSweeper(t *testing.T) {
+	db := newFakeOAuthStateStorage()
+	sweeper := NewOAuthStateSweeper(db, time.Minute, 10*time.Millisecond, nil)
+	sweeper.Start()
+
+	assert.Eventually(t, func() bool {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return db.cleanups >= 2
+	}, time.Second, 5*time.Millisecond)
+
+	sweeper.Stop()
+}
@@ -2,10 +2,12 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -18,25 +20,131 @@ type Config struct {
 	LogLevel      string `json:"log_level" validate:"oneof=debug info warn error"`
 	NumWorkers    int    `json:"num_workers" validate:"min=1"`
 	DBPath        string `json:"db_path" validate:"required"`
-	EncryptionKey string `json:"encryption_key" validate:"required,min=32"`
+	EncryptionKey string `json:"encryption_key" validate:"required,aes256key"`
+
+	// WorkerQueueSize is how many tasks may wait for a worker; 0 means twice NumWorkers
+	WorkerQueueSize int `json:"worker_queue_size" validate:"gte=0"`
 
 	Auth struct {
-		ClientID       string `json:"client_id" validate:"required"`
-		ClientSecret   string `json:"client_secret" validate:"required"`
+		ClientID        string `json:"client_id" validate:"required"`
+		ClientSecret    string `json:"client_secret" validate:"required"`
 		CredentialsPath string `json:"credentials_path" validate:"required,file"`
+		// PersistOAuthState keeps OAuth state and PKCE verifiers in the database instead of memory
+		PersistOAuthState bool     `json:"persist_oauth_state"`
+		OAuthStateTTL     Duration `json:"oauth_state_ttl"`
+		// RefreshBeforeExpiry is how long before its expiry a token is
+		// refreshed, so it is renewed before requests start failing. Zero
+		// uses the default of five minutes. The scheduled check raises it to
+		// the longest wait between runs of RefreshSchedule.
+		RefreshBeforeExpiry Duration `json:"refresh_before_expiry" validate:"gte=0"`
+		// RefreshSchedule is the cron schedule tokens are checked for refresh
+		// on. Empty checks every hour.
+		RefreshSchedule string `json:"refresh_schedule"`
+		// Scopes are the OAuth scopes requested from users; empty requests
+		// gmail.readonly and gmail.modify. Add gmail.send to forward digests.
+		Scopes []string `json:"scopes" validate:"dive,required"`
 	} `json:"auth"`
 
 	Telegram struct {
 		BotToken string `json:"bot_token" validate:"required"`
+		// WebhookSecret is the path token of the webhook Telegram posts
+		// updates to, /telegram/webhook/<secret>, which must be registered
+		// with the bot's setWebhook. Empty polls for updates instead.
+		WebhookSecret string `json:"webhook_secret" validate:"omitempty,min=16"`
 	} `json:"telegram"`
 
+	// OpenAI is deprecated in favour of Summary.OpenAIAPIKey
 	OpenAI struct {
-		APIKey string `json:"api_key" validate:"required"`
+		APIKey string `json:"api_key"`
 	} `json:"openai"`
 
 	Scheduler struct {
 		DefaultInterval Duration `json:"default_interval" validate:"min=1m"`
+		// StaleJobThreshold is how long a job in a shared job store may stay
+		// running before it is treated as orphaned and rerun. Jobs in the
+		// SQLite store are all rerun at startup. Zero uses the scheduler
+		// default.
+		StaleJobThreshold Duration `json:"stale_job_threshold"`
+		// DeadLetterWebhookURL receives a POST with the job JSON whenever a
+		// job exhausts its retries. Empty disables the webhook.
+		DeadLetterWebhookURL string `json:"dead_letter_webhook_url" validate:"omitempty,url"`
+		// Jitter offsets each recurring job's runs by up to this much either
+		// way, so jobs sharing a schedule do not all start at once. Zero
+		// disables it.
+		Jitter Duration `json:"jitter"`
 	} `json:"scheduler"`
+
+	Summary Summary `json:"summary"`
+
+	DB DB `json:"db"`
+
+	Session Session `json:"session"`
+
+	Gmail Gmail `json:"gmail"`
+
+	Maintenance Maintenance `json:"maintenance"`
+
+	Backup Backup `json:"backup"`
+}
+
+// Backup configures the scheduled backups of the database.
+type Backup struct {
+	// Schedule is the cron schedule of the backup job; empty uses the default
+	Schedule string `json:"schedule"`
+	// Dir is where backup files are written; empty uses a backups directory next to the database
+	Dir string `json:"dir"`
+	// Keep is how many of the most recent backups are kept; zero uses the default
+	Keep int `json:"keep" validate:"gte=0"`
+}
+
+// Maintenance configures the scheduled cleanup and vacuum of the database.
+type Maintenance struct {
+	// Schedule is the cron schedule of the maintenance job; empty uses the default
+	Schedule string `json:"schedule"`
+	// ProcessedEmailRetention is how long processed email records are kept; zero uses the default
+	ProcessedEmailRetention Duration `json:"processed_email_retention"`
+	// InactiveUserRetention is how long an inactive user is kept before being
+	// deleted; zero keeps inactive users
+	InactiveUserRetention Duration `json:"inactive_user_retention"`
+}
+
+// Gmail configures how the user's mailbox is read.
+type Gmail struct {
+	// MarkRead marks emails read in Gmail once a digest containing them has been sent
+	MarkRead bool `json:"mark_read"`
+	// ForwardEmail, when set, also receives each digest by email. Sending
+	// needs the gmail.send scope in Auth.Scopes.
+	ForwardEmail string `json:"forward_email" validate:"omitempty,email"`
+}
+
+// Session configures login session storage.
+type Session struct {
+	// Persist keeps sessions in the database so users stay signed in across restarts
+	Persist bool `json:"persist"`
+	// CleanupInterval is how often expired persisted sessions are deleted; zero uses the default
+	CleanupInterval Duration `json:"cleanup_interval"`
+	// MaxLifetime caps how long activity can keep a session alive; zero uses the default
+	MaxLifetime Duration `json:"max_lifetime"`
+}
+
+// DB configures the SQLite connection pool. Zero values fall back to the storage defaults.
+type DB struct {
+	MaxOpenConns    int      `json:"max_open_conns" validate:"gte=0"`
+	MaxIdleConns    int      `json:"max_idle_conns" validate:"gte=0"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+	BusyTimeout     Duration `json:"busy_timeout"`
+}
+
+// Summary configures the email summarization backend. Anthropic is used when
+// AnthropicAPIKey is set, otherwise OpenAI.
+type Summary struct {
+	AnthropicAPIKey string `json:"anthropic_api_key"`
+	OpenAIAPIKey    string `json:"openai_api_key"`
+	// Timeout bounds each summary request; zero uses the summarizer default
+	Timeout Duration `json:"timeout" validate:"omitempty,min=5s"`
+	// MaxBodyChars is how much of each email body is summarized; zero uses the default
+	MaxBodyChars int `json:"max_body_chars" validate:"gte=0"`
 }
 
 // Duration is a wrapper around time.Duration that implements JSON marshaling/unmarshaling
@@ -100,6 +208,9 @@ func (c *Config) applyEnvOverrides() error {
 	if v := os.Getenv("TELEGRAM_BOT_TOKEN"); v != "" {
 		c.Telegram.BotToken = v
 	}
+	if v := os.Getenv("TELEGRAM_WEBHOOK_SECRET"); v != "" {
+		c.Telegram.WebhookSecret = v
+	}
 
 	// Auth overrides
 	if v := os.Getenv("AUTH_CLIENT_ID"); v != "" {
@@ -108,6 +219,14 @@ func (c *Config) applyEnvOverrides() error {
 	if v := os.Getenv("AUTH_CLIENT_SECRET"); v != "" {
 		c.Auth.ClientSecret = v
 	}
+	if v := os.Getenv("AUTH_SCOPES"); v != "" {
+		c.Auth.Scopes = nil
+		for _, scope := range strings.Split(v, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				c.Auth.Scopes = append(c.Auth.Scopes, scope)
+			}
+		}
+	}
 
 	// HTTPPort overrides
 	if v := os.Getenv("HTTP_PORT"); v != "" {
@@ -137,6 +256,22 @@ func (c *Config) applyEnvOverrides() error {
 		c.DBPath = v
 	}
 
+	// DB pool overrides
+	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		var err error
+		c.DB.MaxOpenConns, err = parseInt(v)
+		if err != nil {
+			return fmt.Errorf("parsing DB_MAX_OPEN_CONNS: %w", err)
+		}
+	}
+	if v := os.Getenv("DB_BUSY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("parsing DB_BUSY_TIMEOUT: %w", err)
+		}
+		c.DB.BusyTimeout = Duration{d}
+	}
+
 	// EncryptionKey overrides
 	if v := os.Getenv("ENCRYPTION_KEY"); v != "" {
 		c.EncryptionKey = v
@@ -150,11 +285,70 @@ func (c *Config) applyEnvOverrides() error {
 		}
 		c.Scheduler.DefaultInterval = Duration{d}
 	}
+	if v := os.Getenv("SCHEDULER_STALE_JOB_THRESHOLD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("parsing SCHEDULER_STALE_JOB_THRESHOLD: %w", err)
+		}
+		c.Scheduler.StaleJobThreshold = Duration{d}
+	}
+	if v := os.Getenv("SCHEDULER_DEAD_LETTER_WEBHOOK_URL"); v != "" {
+		c.Scheduler.DeadLetterWebhookURL = v
+	}
+
+	// Session overrides
+	if v := os.Getenv("SESSION_PERSIST"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("parsing SESSION_PERSIST: %w", err)
+		}
+		c.Session.Persist = b
+	}
+
+	// Gmail overrides
+	if v := os.Getenv("GMAIL_MARK_READ"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("parsing GMAIL_MARK_READ: %w", err)
+		}
+		c.Gmail.MarkRead = b
+	}
+	if v := os.Getenv("GMAIL_FORWARD_EMAIL"); v != "" {
+		c.Gmail.ForwardEmail = v
+	}
+
+	// Maintenance overrides
+	if v := os.Getenv("MAINTENANCE_SCHEDULE"); v != "" {
+		c.Maintenance.Schedule = v
+	}
+
+	// Backup overrides
+	if v := os.Getenv("BACKUP_SCHEDULE"); v != "" {
+		c.Backup.Schedule = v
+	}
+	if v := os.Getenv("BACKUP_DIR"); v != "" {
+		c.Backup.Dir = v
+	}
 
 	if v := os.Getenv("OPENAI_API_KEY"); v != "" {
 		c.OpenAI.APIKey = v
 	}
 
+	// Summary overrides
+	if v := os.Getenv("SUMMARY_ANTHROPIC_API_KEY"); v != "" {
+		c.Summary.AnthropicAPIKey = v
+	}
+	if v := os.Getenv("SUMMARY_OPENAI_API_KEY"); v != "" {
+		c.Summary.OpenAIAPIKey = v
+	}
+	if v := os.Getenv("SUMMARY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("parsing SUMMARY_TIMEOUT: %w", err)
+		}
+		c.Summary.Timeout = Duration{d}
+	}
+
 	return nil
 }
 
@@ -170,7 +364,21 @@ func (c *Config) validate() error {
 		return nil
 	}, Duration{})
 
+	if err := validate.RegisterValidation(encryptionKeyTag, validateEncryptionKey); err != nil {
+		return fmt.Errorf("registering encryption key validation: %w", err)
+	}
+
 	if err := validate.Struct(c); err != nil {
+		// Report a bad encryption key with the reason rather than the tag name
+		var fieldErrs validator.ValidationErrors
+		if errors.As(err, &fieldErrs) {
+			for _, fe := range fieldErrs {
+				if fe.Tag() == encryptionKeyTag {
+					_, keyErr := c.EncryptionKeyBytes()
+					return fmt.Errorf("validation failed: invalid encryption_key: %w", keyErr)
+				}
+			}
+		}
 		return fmt.Errorf("validation failed: %w", err)
 	}
 
@@ -184,4 +392,4 @@ func (c *Config) validate() error {
 
 func parseInt(s string) (int, error) {
 	return strconv.Atoi(s)
-} 
\ No newline at end of file
+}
@@ -10,152 +10,153 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestConfig_LoadFromFile(t *testing.T) {
-	// Create a temporary config file
+// writeCredentials creates a dummy credentials file in dir and returns its path
+func writeCredentials(t *testing.T, dir string) string {
+	t.Helper()
+	credentialsPath := filepath.Join(dir, "credentials.json")
+	require.NoError(t, os.WriteFile(credentialsPath, []byte("{}"), 0644))
+	return credentialsPath
+}
+
+// validConfig returns a config that passes validation
+func validConfig(credentialsPath string) Config {
+	var cfg Config
+	cfg.LogLevel = "info"
+	cfg.NumWorkers = 1
+	cfg.DBPath = "app.db"
+	cfg.EncryptionKey = "0123456789abcdef0123456789abcdef"
+	cfg.Auth.ClientID = "client-id"
+	cfg.Auth.ClientSecret = "client-secret"
+	cfg.Auth.CredentialsPath = credentialsPath
+	cfg.Telegram.BotToken = "test-token"
+	cfg.Scheduler.DefaultInterval = Duration{time.Hour}
+	cfg.Summary.Timeout = Duration{10 * time.Second}
+	return cfg
+}
+
+func TestConfig_Load(t *testing.T) {
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, "config.json")
-	credentialsPath := filepath.Join(tmpDir, "credentials.json")
-
-	// Create dummy credentials file
-	err := os.WriteFile(credentialsPath, []byte("{}"), 0644)
-	require.NoError(t, err)
+	credentialsPath := writeCredentials(t, tmpDir)
 
-	// Create valid config file
 	configJSON := `{
-		"telegram": {
-			"bot_token": "test-token",
-			"default_digest_interval": "2h"
-		},
+		"log_level": "info",
+		"num_workers": 2,
+		"db_path": "app.db",
+		"encryption_key": "0123456789abcdef0123456789abcdef",
 		"auth": {
-			"credentials_path": "` + credentialsPath + `",
-			"token_db_path": "/path/to/tokens.db",
-			"token_encryption_key": "0123456789abcdef0123456789abcdef"
-		},
-		"gmail": {
-			"forward_email": "test@example.com",
-			"batch_size": 50
+			"client_id": "client-id",
+			"client_secret": "client-secret",
+			"credentials_path": "` + credentialsPath + `"
 		},
+		"telegram": {"bot_token": "test-token"},
+		"scheduler": {"default_interval": "2h"},
+		"gmail": {"forward_email": "test@example.com"},
 		"summary": {
 			"anthropic_api_key": "test-key",
 			"timeout": "10s"
 		}
 	}`
-	err = os.WriteFile(configPath, []byte(configJSON), 0644)
-	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(configPath, []byte(configJSON), 0644))
 
-	// Test loading valid config
-	cfg, err := LoadFromFile(configPath)
+	cfg, err := Load(configPath)
 	require.NoError(t, err)
 	assert.Equal(t, "test-token", cfg.Telegram.BotToken)
-	assert.Equal(t, 2*time.Hour, cfg.Telegram.DefaultDigestInterval.Duration)
+	assert.Equal(t, 2*time.Hour, cfg.Scheduler.DefaultInterval.Duration)
 	assert.Equal(t, credentialsPath, cfg.Auth.CredentialsPath)
 	assert.Equal(t, "test@example.com", cfg.Gmail.ForwardEmail)
-	assert.Equal(t, 50, cfg.Gmail.BatchSize)
 	assert.Equal(t, "test-key", cfg.Summary.AnthropicAPIKey)
 	assert.Equal(t, 10*time.Second, cfg.Summary.Timeout.Duration)
 
 	// Test loading non-existent file
-	_, err = LoadFromFile("non-existent.json")
+	_, err = Load(filepath.Join(tmpDir, "non-existent.json"))
 	assert.Error(t, err)
 
 	// Test loading invalid JSON
 	invalidPath := filepath.Join(tmpDir, "invalid.json")
-	err = os.WriteFile(invalidPath, []byte("{invalid json}"), 0644)
-	require.NoError(t, err)
-	_, err = LoadFromFile(invalidPath)
+	require.NoError(t, os.WriteFile(invalidPath, []byte("{invalid json}"), 0644))
+	_, err = Load(invalidPath)
 	assert.Error(t, err)
 }
 
-func TestConfig_Validation(t *testing.T) {
+func TestConfig_LoadWithoutSummary(t *testing.T) {
 	tmpDir := t.TempDir()
-	credentialsPath := filepath.Join(tmpDir, "credentials.json")
-	err := os.WriteFile(credentialsPath, []byte("{}"), 0644)
+	configPath := filepath.Join(tmpDir, "config.json")
+	credentialsPath := writeCredentials(t, tmpDir)
+
+	configJSON := `{
+		"log_level": "info",
+		"num_workers": 1,
+		"db_path": "app.db",
+		"encryption_key": "0123456789abcdef0123456789abcdef",
+		"auth": {
+			"client_id": "client-id",
+			"client_secret": "client-secret",
+			"credentials_path": "` + credentialsPath + `"
+		},
+		"telegram": {"bot_token": "test-token"},
+		"scheduler": {"default_interval": "1h"}
+	}`
+	require.NoError(t, os.WriteFile(configPath, []byte(configJSON), 0644))
+
+	cfg, err := Load(configPath)
 	require.NoError(t, err)
+	assert.Zero(t, cfg.Summary.Timeout.Duration)
+}
+
+func TestConfig_Validation(t *testing.T) {
+	credentialsPath := writeCredentials(t, t.TempDir())
 
 	tests := []struct {
 		name        string
-		config      Config
+		modify      func(cfg *Config)
 		shouldError bool
 	}{
 		{
-			name: "valid config",
-			config: Config{
-				Telegram: struct {
-					BotToken              string   `json:"bot_token" validate:"required" env:"TELEGRAM_BOT_TOKEN"`
-					DefaultDigestInterval Duration `json:"default_digest_interval" validate:"min=1h" env:"TELEGRAM_DEFAULT_DIGEST_INTERVAL"`
-				}{
-					BotToken:              "test-token",
-					DefaultDigestInterval: Duration{2 * time.Hour},
-				},
-				Auth: struct {
-					CredentialsPath    string `json:"credentials_path" validate:"required,file" env:"AUTH_CREDENTIALS_PATH"`
-					TokenDBPath        string `json:"token_db_path" validate:"required" env:"AUTH_TOKEN_DB_PATH"`
-					TokenEncryptionKey string `json:"token_encryption_key" validate:"required,min=32" env:"AUTH_TOKEN_ENCRYPTION_KEY"`
-				}{
-					CredentialsPath:    credentialsPath,
-					TokenDBPath:        "/path/to/tokens.db",
-					TokenEncryptionKey: "0123456789abcdef0123456789abcdef",
-				},
-				Gmail: struct {
-					ForwardEmail string `json:"forward_email" validate:"email" env:"GMAIL_FORWARD_EMAIL"`
-					BatchSize    int    `json:"batch_size" validate:"min=1,max=100" env:"GMAIL_BATCH_SIZE"`
-				}{
-					ForwardEmail: "test@example.com",
-					BatchSize:    50,
-				},
-				Summary: struct {
-					AnthropicAPIKey string   `json:"anthropic_api_key" env:"SUMMARY_ANTHROPIC_API_KEY"`
-					OpenAIAPIKey    string   `json:"openai_api_key" env:"SUMMARY_OPENAI_API_KEY"`
-					Timeout         Duration `json:"timeout" validate:"required,min=5s" env:"SUMMARY_TIMEOUT"`
-				}{
-					Timeout: Duration{10 * time.Second},
-				},
-			},
-			shouldError: false,
+			name:   "valid config",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name:   "no summary timeout",
+			modify: func(cfg *Config) { cfg.Summary.Timeout = Duration{} },
+		},
+		{
+			name:        "summary timeout too short",
+			modify:      func(cfg *Config) { cfg.Summary.Timeout = Duration{time.Second} },
+			shouldError: true,
+		},
+		{
+			name:        "missing bot token",
+			modify:      func(cfg *Config) { cfg.Telegram.BotToken = "" },
+			shouldError: true,
+		},
+		{
+			name:        "short webhook secret",
+			modify:      func(cfg *Config) { cfg.Telegram.WebhookSecret = "secret" },
+			shouldError: true,
 		},
 		{
-			name: "missing bot token",
-			config: Config{
-				Telegram: struct {
-					BotToken              string   `json:"bot_token" validate:"required" env:"TELEGRAM_BOT_TOKEN"`
-					DefaultDigestInterval Duration `json:"default_digest_interval" validate:"min=1h" env:"TELEGRAM_DEFAULT_DIGEST_INTERVAL"`
-				}{
-					DefaultDigestInterval: Duration{2 * time.Hour},
-				},
-			},
+			name:        "invalid default interval",
+			modify:      func(cfg *Config) { cfg.Scheduler.DefaultInterval = Duration{30 * time.Second} },
 			shouldError: true,
 		},
 		{
-			name: "invalid digest interval",
-			config: Config{
-				Telegram: struct {
-					BotToken              string   `json:"bot_token" validate:"required" env:"TELEGRAM_BOT_TOKEN"`
-					DefaultDigestInterval Duration `json:"default_digest_interval" validate:"min=1h" env:"TELEGRAM_DEFAULT_DIGEST_INTERVAL"`
-				}{
-					BotToken:              "test-token",
-					DefaultDigestInterval: Duration{30 * time.Minute},
-				},
-			},
+			name:        "negative refresh before expiry",
+			modify:      func(cfg *Config) { cfg.Auth.RefreshBeforeExpiry = Duration{-time.Minute} },
 			shouldError: true,
 		},
 		{
-			name: "invalid email",
-			config: Config{
-				Gmail: struct {
-					ForwardEmail string `json:"forward_email" validate:"email" env:"GMAIL_FORWARD_EMAIL"`
-					BatchSize    int    `json:"batch_size" validate:"min=1,max=100" env:"GMAIL_BATCH_SIZE"`
-				}{
-					ForwardEmail: "not-an-email",
-					BatchSize:    50,
-				},
-			},
+			name:        "invalid email",
+			modify:      func(cfg *Config) { cfg.Gmail.ForwardEmail = "not-an-email" },
 			shouldError: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.config.Validate()
+			cfg := validConfig(credentialsPath)
+			tt.modify(&cfg)
+			err := cfg.validate()
 			if tt.shouldError {
 				assert.Error(t, err)
 			} else {
@@ -166,54 +167,38 @@ func TestConfig_Validation(t *testing.T) {
 }
 
 func TestConfig_EnvironmentOverrides(t *testing.T) {
-	// Set up environment variables
-	os.Setenv("TELEGRAM_BOT_TOKEN", "env-token")
-	os.Setenv("TELEGRAM_DEFAULT_DIGEST_INTERVAL", "3h")
-	os.Setenv("GMAIL_BATCH_SIZE", "75")
-	os.Setenv("SUMMARY_TIMEOUT", "15s")
-	defer func() {
-		os.Unsetenv("TELEGRAM_BOT_TOKEN")
-		os.Unsetenv("TELEGRAM_DEFAULT_DIGEST_INTERVAL")
-		os.Unsetenv("GMAIL_BATCH_SIZE")
-		os.Unsetenv("SUMMARY_TIMEOUT")
-	}()
-
-	// Create temporary config file
+	t.Setenv("TELEGRAM_BOT_TOKEN", "env-token")
+	t.Setenv("SCHEDULER_DEFAULT_INTERVAL", "3h")
+	t.Setenv("SUMMARY_TIMEOUT", "15s")
+
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, "config.json")
-	credentialsPath := filepath.Join(tmpDir, "credentials.json")
-	err := os.WriteFile(credentialsPath, []byte("{}"), 0644)
-	require.NoError(t, err)
+	credentialsPath := writeCredentials(t, tmpDir)
 
 	configJSON := `{
-		"telegram": {
-			"bot_token": "file-token",
-			"default_digest_interval": "2h"
-		},
+		"log_level": "info",
+		"num_workers": 1,
+		"db_path": "app.db",
+		"encryption_key": "0123456789abcdef0123456789abcdef",
 		"auth": {
-			"credentials_path": "` + credentialsPath + `",
-			"token_db_path": "/path/to/tokens.db",
-			"token_encryption_key": "0123456789abcdef0123456789abcdef"
+			"client_id": "client-id",
+			"client_secret": "client-secret",
+			"credentials_path": "` + credentialsPath + `"
 		},
-		"gmail": {
-			"forward_email": "test@example.com",
-			"batch_size": 50
-		},
-		"summary": {
-			"timeout": "10s"
-		}
+		"telegram": {"bot_token": "file-token"},
+		"scheduler": {"default_interval": "2h"},
+		"gmail": {"forward_email": "test@example.com"},
+		"summary": {"timeout": "10s"}
 	}`
-	err = os.WriteFile(configPath, []byte(configJSON), 0644)
-	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(configPath, []byte(configJSON), 0644))
 
 	// Load config and verify environment overrides
-	cfg, err := LoadFromFile(configPath)
+	cfg, err := Load(configPath)
 	require.NoError(t, err)
 
 	// Check that environment variables override file values
 	assert.Equal(t, "env-token", cfg.Telegram.BotToken)
-	assert.Equal(t, 3*time.Hour, cfg.Telegram.DefaultDigestInterval.Duration)
-	assert.Equal(t, 75, cfg.Gmail.BatchSize)
+	assert.Equal(t, 3*time.Hour, cfg.Scheduler.DefaultInterval.Duration)
 	assert.Equal(t, 15*time.Second, cfg.Summary.Timeout.Duration)
 
 	// Check that non-overridden values remain
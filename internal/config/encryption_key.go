@@ -0,0 +1,43 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// encryptionKeySize is the AES-256 key size in bytes
+const encryptionKeySize = 32
+
+// encryptionKeyTag is the validation tag for EncryptionKey
+const encryptionKeyTag = "aes256key"
+
+// DecodeEncryptionKey returns the AES-256 key encoded by s, which must be
+// either 32 raw bytes or 64 hex characters
+func DecodeEncryptionKey(s string) ([]byte, error) {
+	switch len(s) {
+	case encryptionKeySize:
+		return []byte(s), nil
+	case hex.EncodedLen(encryptionKeySize):
+		key, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key has %d characters but is not valid hex: %w", len(s), err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("encryption key must be %d raw bytes or %d hex characters, got %d characters",
+			encryptionKeySize, hex.EncodedLen(encryptionKeySize), len(s))
+	}
+}
+
+// EncryptionKeyBytes returns the decoded token encryption key
+func (c *Config) EncryptionKeyBytes() ([]byte, error) {
+	return DecodeEncryptionKey(c.EncryptionKey)
+}
+
+// validateEncryptionKey implements the aes256key validation tag
+func validateEncryptionKey(fl validator.FieldLevel) bool {
+	_, err := DecodeEncryptionKey(fl.Field().String())
+	return err == nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeEncryptionKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		want    []byte
+		wantErr string
+	}{
+		{
+			name: "hex key",
+			key:  "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+			want: []byte{
+				0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+				0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+			},
+		},
+		{
+			name: "raw key",
+			key:  "0123456789abcdef0123456789abcdef",
+			want: []byte("0123456789abcdef0123456789abcdef"),
+		},
+		{
+			name:    "too short",
+			key:     "0123456789abcdef",
+			wantErr: "got 16 characters",
+		},
+		{
+			name:    "64 characters that are not hex",
+			key:     string(bytes.Repeat([]byte("z"), 64)),
+			wantErr: "not valid hex",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeEncryptionKey(tt.key)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Len(t, got, encryptionKeySize)
+		})
+	}
+}
+
+func TestLoad_EncryptionKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	credentialsPath := filepath.Join(tmpDir, "credentials.json")
+	require.NoError(t, os.WriteFile(credentialsPath, []byte("{}"), 0644))
+	configPath := filepath.Join(tmpDir, "config.json")
+
+	// The key is validated when the config is loaded
+	writeWatcherConfig(t, configPath, credentialsPath, "info", 1, "app.db")
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	key, err := cfg.EncryptionKeyBytes()
+	require.NoError(t, err)
+	assert.Len(t, key, encryptionKeySize)
+
+	t.Setenv("ENCRYPTION_KEY", "too-short")
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid encryption_key")
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+)
+
+// restartOnly lists settings that a reload cannot apply to a running process
+var restartOnly = []struct {
+	name string
+	get  func(*Config) interface{}
+}{
+	{"db_path", func(c *Config) interface{} { return c.DBPath }},
+	{"encryption_key", func(c *Config) interface{} { return c.EncryptionKey }},
+	{"http_port", func(c *Config) interface{} { return c.HTTPPort }},
+	{"metrics_port", func(c *Config) interface{} { return c.MetricsPort }},
+	{"worker_queue_size", func(c *Config) interface{} { return c.WorkerQueueSize }},
+	{"auth", func(c *Config) interface{} { return c.Auth }},
+	{"telegram", func(c *Config) interface{} { return c.Telegram }},
+	{"db", func(c *Config) interface{} { return c.DB }},
+	{"session", func(c *Config) interface{} { return c.Session }},
+	{"summary", func(c *Config) interface{} { return c.Summary }},
+	{"gmail", func(c *Config) interface{} { return c.Gmail }},
+	{"openai", func(c *Config) interface{} { return c.OpenAI }},
+	{"scheduler.stale_job_threshold", func(c *Config) interface{} { return c.Scheduler.StaleJobThreshold }},
+	{"scheduler.dead_letter_webhook_url", func(c *Config) interface{} { return c.Scheduler.DeadLetterWebhookURL }},
+	{"scheduler.jitter", func(c *Config) interface{} { return c.Scheduler.Jitter }},
+	{"maintenance", func(c *Config) interface{} { return c.Maintenance }},
+	{"backup", func(c *Config) interface{} { return c.Backup }},
+}
+
+// Watcher reloads the configuration file on SIGHUP. Only the log level,
+// default digest interval and number of workers change live; changes to
+// other settings are logged and ignored until the next restart.
+type Watcher struct {
+	path     string
+	logger   *slog.Logger
+	mu       sync.RWMutex
+	current  *Config
+	onReload []func(*Config)
+	signals  chan os.Signal
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewWatcher creates a Watcher for the file at path, starting from cfg
+func NewWatcher(path string, cfg *Config, logger *slog.Logger) *Watcher {
+	return &Watcher{
+		path:    path,
+		logger:  logger,
+		current: cfg,
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// OnReload registers fn to be called with the new configuration after each
+// successful reload. It must be called before Start.
+func (w *Watcher) OnReload(fn func(*Config)) {
+	w.onReload = append(w.onReload, fn)
+}
+
+// Current returns the configuration in effect
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Start listens for SIGHUP in the background
+func (w *Watcher) Start() {
+	signal.Notify(w.signals, syscall.SIGHUP)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			select {
+			case <-w.signals:
+				w.logger.Info("Reloading configuration", "path", w.path)
+				if _, err := w.Reload(); err != nil {
+					w.logger.Error("Configuration reload failed, keeping current settings", "error", err)
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops listening for SIGHUP
+func (w *Watcher) Stop() {
+	signal.Stop(w.signals)
+	close(w.done)
+	w.wg.Wait()
+}
+
+// Reload re-reads and validates the file, applies the settings that can
+// change live and notifies the OnReload callbacks. An invalid file leaves the
+// current configuration untouched.
+func (w *Watcher) Reload() (*Config, error) {
+	loaded, err := Load(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	old := w.current
+	for _, setting := range restartOnly {
+		if !reflect.DeepEqual(setting.get(old), setting.get(loaded)) {
+			w.logger.Warn("Configuration change requires a restart and was ignored", "setting", setting.name)
+		}
+	}
+
+	next := *old
+	next.LogLevel = loaded.LogLevel
+	next.NumWorkers = loaded.NumWorkers
+	next.Scheduler.DefaultInterval = loaded.Scheduler.DefaultInterval
+	w.current = &next
+	w.mu.Unlock()
+
+	if next.LogLevel != old.LogLevel {
+		w.logger.Info("Log level changed", "from", old.LogLevel, "to", next.LogLevel)
+	}
+	for _, fn := range w.onReload {
+		fn(&next)
+	}
+	return &next, nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeWatcherConfig writes a valid config file with the given settings
+func writeWatcherConfig(t *testing.T, path, credentialsPath, logLevel string, numWorkers int, dbPath string) {
+	t.Helper()
+	writeWatcherConfigWithBackup(t, path, credentialsPath, logLevel, numWorkers, dbPath, "")
+}
+
+// writeWatcherConfigWithBackup writes a valid config file like
+// writeWatcherConfig, with the given backup schedule
+func writeWatcherConfigWithBackup(t *testing.T, path, credentialsPath, logLevel string, numWorkers int, dbPath, backupSchedule string) {
+	t.Helper()
+	configJSON := fmt.Sprintf(`{
+		"http_port": 8080,
+		"log_level": %q,
+		"num_workers": %d,
+		"db_path": %q,
+		"encryption_key": "0123456789abcdef0123456789abcdef",
+		"auth": {
+			"client_id": "client-id",
+			"client_secret": "client-secret",
+			"credentials_path": %q
+		},
+		"telegram": {"bot_token": "test-token"},
+		"scheduler": {"default_interval": "1h"},
+		"summary": {"timeout": "10s"},
+		"backup": {"schedule": %q}
+	}`, logLevel, numWorkers, dbPath, credentialsPath, backupSchedule)
+	require.NoError(t, os.WriteFile(path, []byte(configJSON), 0644))
+}
+
+func TestWatcher_ReloadOnSIGHUP(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	credentialsPath := filepath.Join(tmpDir, "credentials.json")
+	require.NoError(t, os.WriteFile(credentialsPath, []byte("{}"), 0644))
+
+	writeWatcherConfig(t, configPath, credentialsPath, "info", 2, "app.db")
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	watcher := NewWatcher(configPath, cfg, slog.New(slog.NewTextHandler(&logs, nil)))
+	reloaded := make(chan *Config, 1)
+	watcher.OnReload(func(c *Config) { reloaded <- c })
+	watcher.Start()
+	defer watcher.Stop()
+
+	writeWatcherConfigWithBackup(t, configPath, credentialsPath, "debug", 4, "other.db", "0 3 * * *")
+	watcher.signals <- syscall.SIGHUP
+
+	select {
+	case got := <-reloaded:
+		assert.Equal(t, "debug", got.LogLevel)
+		assert.Equal(t, 4, got.NumWorkers)
+		// The database path cannot change while running
+		assert.Equal(t, "app.db", got.DBPath)
+		assert.Empty(t, got.Backup.Schedule)
+	case <-time.After(time.Second):
+		t.Fatal("configuration was not reloaded")
+	}
+
+	assert.Equal(t, "debug", watcher.Current().LogLevel)
+	assert.Equal(t, "info", cfg.LogLevel, "the original config is not modified")
+	assert.Contains(t, logs.String(), "requires a restart and was ignored\" setting=db_path")
+	assert.Contains(t, logs.String(), "requires a restart and was ignored\" setting=backup")
+}
+
+func TestWatcher_ReloadInvalidKeepsCurrent(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	credentialsPath := filepath.Join(tmpDir, "credentials.json")
+	require.NoError(t, os.WriteFile(credentialsPath, []byte("{}"), 0644))
+
+	writeWatcherConfig(t, configPath, credentialsPath, "info", 2, "app.db")
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	watcher := NewWatcher(configPath, cfg, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+	watcher.OnReload(func(c *Config) { t.Error("callback should not run for an invalid config") })
+
+	writeWatcherConfig(t, configPath, credentialsPath, "verbose", 2, "app.db")
+	_, err = watcher.Reload()
+	assert.Error(t, err)
+	assert.Same(t, cfg, watcher.Current())
+}
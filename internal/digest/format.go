@@ -0,0 +1,74 @@
+package digest
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"gmaildigest-go/pkg/models"
+)
+
+// DigestFormat is how a digest is rendered for its delivery channel
+type DigestFormat string
+
+const (
+	// FormatPlain renders plain text
+	FormatPlain DigestFormat = "plain"
+	// FormatMarkdown renders Telegram Markdown, with *bold* headings
+	FormatMarkdown DigestFormat = "markdown"
+	// FormatHTML renders an HTML fragment suitable for an email body
+	FormatHTML DigestFormat = "html"
+)
+
+// ParseFormat returns the DigestFormat named by s
+func ParseFormat(s string) (DigestFormat, error) {
+	switch format := DigestFormat(s); format {
+	case FormatPlain, FormatMarkdown, FormatHTML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown digest format %q", s)
+	}
+}
+
+// markdownEscaper escapes the characters Telegram Markdown treats as markup
+var markdownEscaper = strings.NewReplacer(`_`, `\_`, `*`, `\*`, "`", "\\`", `[`, `\[`)
+
+// FormatDigest renders the summary followed by the list of emails it covers.
+// Email subjects and senders are escaped for the format, so they cannot
+// inject markup; the summary is escaped the same way.
+func FormatDigest(emails []models.Email, summary string, format DigestFormat) (string, error) {
+	var b strings.Builder
+	switch format {
+	case FormatPlain:
+		b.WriteString("Summary\n\n" + summary + "\n")
+		if len(emails) > 0 {
+			fmt.Fprintf(&b, "\nEmails (%d)\n", len(emails))
+			for _, email := range emails {
+				fmt.Fprintf(&b, "- %s (%s)\n", email.Subject, email.From)
+			}
+		}
+	case FormatMarkdown:
+		b.WriteString("*Summary*\n\n" + markdownEscaper.Replace(summary) + "\n")
+		if len(emails) > 0 {
+			fmt.Fprintf(&b, "\n*Emails (%d)*\n", len(emails))
+			for _, email := range emails {
+				fmt.Fprintf(&b, "- *%s* (%s)\n",
+					markdownEscaper.Replace(email.Subject), markdownEscaper.Replace(email.From))
+			}
+		}
+	case FormatHTML:
+		b.WriteString("<h2>Summary</h2>\n<p>" +
+			strings.ReplaceAll(html.EscapeString(summary), "\n", "<br>\n") + "</p>\n")
+		if len(emails) > 0 {
+			fmt.Fprintf(&b, "<h2>Emails (%d)</h2>\n<ul>\n", len(emails))
+			for _, email := range emails {
+				fmt.Fprintf(&b, "<li><b>%s</b> (%s)</li>\n",
+					html.EscapeString(email.Subject), html.EscapeString(email.From))
+			}
+			b.WriteString("</ul>\n")
+		}
+	default:
+		return "", fmt.Errorf("unknown digest format %q", format)
+	}
+	return b.String(), nil
+}
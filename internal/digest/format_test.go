@@ -0,0 +1,64 @@
+package digest
+
+import (
+	"testing"
+
+	"gmaildigest-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEmails = []models.Email{
+	{From: "alice@example.com", Subject: "Lunch on Friday"},
+	{From: "bob@example.com", Subject: "Invoice <#42> for *project_x*"},
+}
+
+func TestFormatDigest(t *testing.T) {
+	const summary = "Alice asks about lunch.\nBob sent an invoice."
+
+	plain, err := FormatDigest(testEmails, summary, FormatPlain)
+	require.NoError(t, err)
+	assert.Equal(t, "Summary\n\n"+summary+"\n\n"+
+		"Emails (2)\n"+
+		"- Lunch on Friday (alice@example.com)\n"+
+		"- Invoice <#42> for *project_x* (bob@example.com)\n", plain)
+
+	markdown, err := FormatDigest(testEmails, summary, FormatMarkdown)
+	require.NoError(t, err)
+	assert.Contains(t, markdown, "*Summary*\n\n"+summary)
+	assert.Contains(t, markdown, "*Emails (2)*")
+	assert.Contains(t, markdown, "- *Lunch on Friday* (alice@example.com)")
+	// Markup in subjects is escaped rather than rendered
+	assert.Contains(t, markdown, `- *Invoice <#42> for \*project\_x\** (bob@example.com)`)
+
+	htmlDigest, err := FormatDigest(testEmails, summary, FormatHTML)
+	require.NoError(t, err)
+	assert.Contains(t, htmlDigest, "<h2>Summary</h2>")
+	assert.Contains(t, htmlDigest, "<p>Alice asks about lunch.<br>\nBob sent an invoice.</p>")
+	assert.Contains(t, htmlDigest, "<ul>\n<li><b>Lunch on Friday</b> (alice@example.com)</li>")
+	assert.Contains(t, htmlDigest, "<li><b>Invoice &lt;#42&gt; for *project_x*</b> (bob@example.com)</li>\n</ul>")
+
+	// Without emails only the summary is rendered
+	for _, format := range []DigestFormat{FormatPlain, FormatMarkdown, FormatHTML} {
+		rendered, err := FormatDigest(nil, "No new emails.", format)
+		require.NoError(t, err)
+		assert.Contains(t, rendered, "No new emails.", format)
+		assert.NotContains(t, rendered, "Emails", format)
+	}
+
+	_, err = FormatDigest(testEmails, summary, "pdf")
+	assert.Error(t, err)
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"plain", "markdown", "html"} {
+		format, err := ParseFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, DigestFormat(name), format)
+	}
+	_, err := ParseFormat("")
+	assert.Error(t, err)
+	_, err = ParseFormat("HTML")
+	assert.Error(t, err)
+}
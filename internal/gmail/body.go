@@ -0,0 +1,69 @@
+package gmail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"google.golang.org/api/gmail/v1"
+)
+
+// decodePartBody returns the text of a message part. The base64url data is
+// decoded first, then any quoted-printable transfer encoding, and the result
+// is converted from the part's charset to UTF-8. A step that fails leaves the
+// text as the previous step produced it.
+func decodePartBody(part *gmail.MessagePart) (string, error) {
+	data, err := base64.URLEncoding.DecodeString(part.Body.Data)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.EqualFold(strings.TrimSpace(partHeader(part, "Content-Transfer-Encoding")), "quoted-printable") {
+		if decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data))); err == nil {
+			data = decoded
+		}
+	}
+
+	return toUTF8(data, partCharset(part)), nil
+}
+
+// partHeader returns the value of the named header of a part, or "" if it has none
+func partHeader(part *gmail.MessagePart, name string) string {
+	for _, h := range part.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// partCharset returns the charset parameter of the part's Content-Type header
+func partCharset(part *gmail.MessagePart) string {
+	_, params, err := mime.ParseMediaType(partHeader(part, "Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// toUTF8 converts data from charset to UTF-8. An empty, UTF-8 or unknown
+// charset returns the data unchanged.
+func toUTF8(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return string(data)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
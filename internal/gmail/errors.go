@@ -0,0 +1,45 @@
+package gmail
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FetchError records a message that could not be fetched or parsed
+type FetchError struct {
+	MessageID string
+	Err       error
+}
+
+// Error implements error
+func (e FetchError) Error() string {
+	return fmt.Sprintf("message %s: %v", e.MessageID, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e FetchError) Unwrap() error {
+	return e.Err
+}
+
+// FetchErrors is returned by FetchEmails, along with the emails that were
+// fetched, when some messages could not be. Use errors.As to tell a partial
+// result from a failed fetch.
+type FetchErrors []FetchError
+
+// Error implements error
+func (e FetchErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("failed to fetch %d messages: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error of each message, so errors.Is matches any of them
+func (e FetchErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
@@ -0,0 +1,95 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultMaxAttempts is the default number of tries for a Gmail API call
+const DefaultMaxAttempts = 4
+
+// defaultBackoff is the delay before the first retry; it doubles on each attempt
+const defaultBackoff = 500 * time.Millisecond
+
+// maxBackoff caps the delay between attempts, including one asked for by Retry-After
+const maxBackoff = 30 * time.Second
+
+// SetRetryPolicy sets how many times a Gmail API call is tried and the delay
+// before the first retry. Zero values use the defaults.
+func (s *Service) SetRetryPolicy(maxAttempts int, backoff time.Duration) {
+	s.maxAttempts = maxAttempts
+	s.backoff = backoff
+}
+
+// withRetry runs call until it succeeds, fails with an error that is not
+// transient, or the attempts run out. It returns the last error.
+func (s *Service) withRetry(ctx context.Context, call func() error) error {
+	attempts := s.maxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	delay := s.backoff
+	if delay <= 0 {
+		delay = defaultBackoff
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = call()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		wait, ok := retryDelay(err, delay)
+		if !ok {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// retryDelay reports whether err is a transient Gmail error and how long to
+// wait before retrying it: the Retry-After header if present, else backoff
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable:
+	default:
+		return 0, false
+	}
+
+	if wait, ok := parseRetryAfter(apiErr.Header.Get("Retry-After"), time.Now()); ok {
+		return min(wait, maxBackoff), true
+	}
+	return backoff, true
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,111 @@
+package gmail
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+)
+
+// flakyServer fails the first fetches of each message with status before
+// handing requests to next
+type flakyServer struct {
+	next     http.Handler
+	status   int
+	failures int
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/gmail/v1/users/me/messages/"
+	id := strings.TrimPrefix(r.URL.Path, prefix)
+	if r.Method == http.MethodGet && id != r.URL.Path {
+		f.mu.Lock()
+		f.attempts[id]++
+		attempt := f.attempts[id]
+		f.mu.Unlock()
+		if attempt <= f.failures {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "try again", f.status)
+			return
+		}
+	}
+	f.next.ServeHTTP(w, r)
+}
+
+func TestService_FetchUnreadEmails_RetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		failures     int
+		wantEmails   int
+		wantAttempts int
+	}{
+		{
+			name:         "succeeds after two 503s",
+			status:       http.StatusServiceUnavailable,
+			failures:     2,
+			wantEmails:   1,
+			wantAttempts: 3,
+		},
+		{
+			name:         "skipped once attempts are exhausted",
+			status:       http.StatusTooManyRequests,
+			failures:     DefaultMaxAttempts,
+			wantEmails:   0,
+			wantAttempts: DefaultMaxAttempts,
+		},
+		{
+			name:         "not retried when the error is permanent",
+			status:       http.StatusNotFound,
+			failures:     1,
+			wantEmails:   0,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGmailServer{pages: map[string]*gmail.ListMessagesResponse{
+				"": {Messages: messageRefs("m1")},
+			}}
+			flaky := &flakyServer{next: fake, status: tt.status, failures: tt.failures, attempts: map[string]int{}}
+			service := newTestService(t, flaky)
+
+			emails, err := service.FetchUnreadEmails(context.Background(), 0)
+			if tt.wantEmails == 0 {
+				var fetchErrs FetchErrors
+				require.ErrorAs(t, err, &fetchErrs)
+				assert.Equal(t, "m1", fetchErrs[0].MessageID)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Len(t, emails, tt.wantEmails)
+			assert.Equal(t, tt.wantAttempts, flaky.attempts["m1"])
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	wait, ok := parseRetryAfter("7", now)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, wait)
+
+	wait, ok = parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Second, wait)
+
+	_, ok = parseRetryAfter("", now)
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,103 @@
+package gmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrSendScopeMissing is returned when the user's token does not grant the
+// gmail.send scope needed to send email
+var ErrSendScopeMissing = errors.New("gmail.send scope not granted")
+
+// Content types a digest email can be sent as
+const (
+	ContentTypePlain = "text/plain"
+	ContentTypeHTML  = "text/html"
+)
+
+// mimeLineLength is the longest base64 body line written, as RFC 2045 allows
+const mimeLineLength = 76
+
+// SendDigestEmail sends an email from the user's mailbox with a body of
+// contentType, ContentTypePlain or ContentTypeHTML. It needs the gmail.send
+// scope; without it the error wraps ErrSendScopeMissing. Sends are not
+// retried, since a failed call may still have sent the email.
+func (s *Service) SendDigestEmail(ctx context.Context, to, subject, body, contentType string) error {
+	raw, err := buildDigestMessage(to, subject, body, contentType, time.Now())
+	if err != nil {
+		return err
+	}
+
+	msg := &gmail.Message{Raw: base64.URLEncoding.EncodeToString(raw)}
+	if _, err := s.srv.Users.Messages.Send("me", msg).Context(ctx).Do(); err != nil {
+		if isInsufficientScope(err) {
+			return fmt.Errorf("%w: cannot send digest to %s: %v", ErrSendScopeMissing, to, err)
+		}
+		return fmt.Errorf("failed to send digest email: %w", err)
+	}
+	return nil
+}
+
+// buildDigestMessage composes an RFC 822 message with a UTF-8 body of
+// contentType, plain text if empty. The subject is encoded as an RFC 2047
+// word when it is not plain ASCII, and the body is base64 encoded so any
+// text survives transport.
+func buildDigestMessage(to, subject, body, contentType string, date time.Time) ([]byte, error) {
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+	switch contentType {
+	case "":
+		contentType = ContentTypePlain
+	case ContentTypePlain, ContentTypeHTML:
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	header("To", addr.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", contentType+`; charset="UTF-8"`)
+	header("Content-Transfer-Encoding", "base64")
+	msg.WriteString("\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > mimeLineLength {
+		msg.WriteString(encoded[:mimeLineLength] + "\r\n")
+		encoded = encoded[mimeLineLength:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	return msg.Bytes(), nil
+}
+
+// isInsufficientScope reports whether err is Gmail refusing a call because
+// the token lacks a scope it needs
+func isInsufficientScope(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "insufficientPermissions" {
+			return true
+		}
+	}
+	return strings.Contains(apiErr.Message, "insufficient authentication scopes")
+}
@@ -2,24 +2,32 @@ package gmail
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
-	"log"
+	"log/slog"
+	"net/mail"
+	"strings"
 	"gmaildigest-go/pkg/models"
+	"sync"
 	"time"
 )
 
+// DefaultFetchConcurrency is the default number of messages fetched at once
+const DefaultFetchConcurrency = 10
+
 // Service provides methods for interacting with the Gmail API.
 type Service struct {
-	logger *log.Logger
-	srv    *gmail.Service
+	logger      *slog.Logger
+	srv         *gmail.Service
+	concurrency int
+	maxAttempts int
+	backoff     time.Duration
 }
 
 // NewService creates a new Gmail Service.
-func NewService(ctx context.Context, token *oauth2.Token, logger *log.Logger) (*Service, error) {
+func NewService(ctx context.Context, token *oauth2.Token, logger *slog.Logger) (*Service, error) {
 	config := &oauth2.Config{} // This can be empty as we're providing a token source
 	client := config.Client(ctx, token)
 	srv, err := gmail.NewService(ctx, option.WithHTTPClient(client))
@@ -27,11 +35,18 @@ func NewService(ctx context.Context, token *oauth2.Token, logger *log.Logger) (*
 		return nil, err
 	}
 	return &Service{
-		logger: logger,
-		srv:    srv,
+		logger:      logger,
+		srv:         srv,
+		concurrency: DefaultFetchConcurrency,
 	}, nil
 }
 
+// SetFetchConcurrency sets how many messages are fetched in parallel.
+// Values below 1 fetch one message at a time.
+func (s *Service) SetFetchConcurrency(n int) {
+	s.concurrency = n
+}
+
 // FetchUnreadEmailSubjects fetches the subjects of unread emails.
 // This is a simplified version for now.
 func (s *Service) FetchUnreadEmailSubjects(ctx context.Context) ([]string, error) {
@@ -39,47 +54,177 @@ func (s *Service) FetchUnreadEmailSubjects(ctx context.Context) ([]string, error
 	return []string{"Subject 1: Test", "Subject 2: Another Test"}, nil
 }
 
-// FetchUnreadEmails fetches the subjects and bodies of unread emails.
-func (s *Service) FetchUnreadEmails(ctx context.Context) ([]models.Email, error) {
-	var emails []models.Email
+// DefaultMaxResults is the default cap on the number of messages fetched per digest.
+const DefaultMaxResults = 500
+
+// pageSize is the number of message references requested per list call (Gmail allows up to 500).
+const pageSize = 100
 
-	listResp, err := s.srv.Users.Messages.List("me").Q("is:unread").Do()
+// FetchUnreadEmails fetches the subjects and bodies of unread emails, following
+// pagination until all messages are listed or maxResults is reached.
+// A maxResults of zero or less means no cap. Messages that fail are reported
+// as in FetchEmails.
+func (s *Service) FetchUnreadEmails(ctx context.Context, maxResults int) ([]models.Email, error) {
+	return s.FetchEmailsSince(ctx, time.Time{}, maxResults)
+}
+
+// FetchEmailsSince fetches unread emails received after since, so messages from
+// earlier digests are not downloaded again. A zero since fetches all unread emails.
+func (s *Service) FetchEmailsSince(ctx context.Context, since time.Time, maxResults int) ([]models.Email, error) {
+	return s.FetchEmails(ctx, "", since, maxResults)
+}
+
+// FetchEmails fetches the emails matching a Gmail search query, such as
+// "label:newsletters", received after since. An empty query fetches unread
+// emails. Messages are fetched in parallel and returned in list order; any
+// that cannot be fetched or parsed are skipped and reported in a FetchErrors
+// error returned with the emails that were fetched.
+func (s *Service) FetchEmails(ctx context.Context, query string, since time.Time, maxResults int) ([]models.Email, error) {
+	msgRefs, err := s.listMessages(ctx, buildQuery(query, since), maxResults)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list emails: %w", err)
+		return nil, err
 	}
 
-	for _, msgRef := range listResp.Messages {
-		msg, err := s.srv.Users.Messages.Get("me", msgRef.Id).Format("full").Do()
-		if err != nil {
-			s.logger.Printf("Failed to get message %s: %v", msgRef.Id, err)
-			continue
-		}
+	// Each message is written to its own slot, preserving order
+	results := make([]*models.Email, len(msgRefs))
+	errs := make([]error, len(msgRefs))
+	sem := make(chan struct{}, max(s.concurrency, 1))
+	var wg sync.WaitGroup
+	for i, msgRef := range msgRefs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = s.fetchEmail(ctx, msgRef.Id)
+		}()
+	}
+	wg.Wait()
 
-		email, err := s.parseEmail(msg)
-		if err != nil {
-			s.logger.Printf("Failed to parse email %s: %v", msg.Id, err)
+	var emails []models.Email
+	var fetchErrs FetchErrors
+	for i, email := range results {
+		if errs[i] != nil {
+			fetchErrs = append(fetchErrs, FetchError{MessageID: msgRefs[i].Id, Err: errs[i]})
 			continue
 		}
 		emails = append(emails, *email)
+	}
+	if len(fetchErrs) > 0 {
+		return emails, fetchErrs
+	}
+	return emails, nil
+}
+
+// fetchEmail downloads and parses a single message. Transient errors are
+// retried; it fails if the message still could not be fetched or could not
+// be parsed.
+func (s *Service) fetchEmail(ctx context.Context, id string) (*models.Email, error) {
+	var msg *gmail.Message
+	err := s.withRetry(ctx, func() error {
+		var err error
+		msg, err = s.srv.Users.Messages.Get("me", id).Format("full").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	email, err := s.parseEmail(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+	return email, nil
+}
+
+// markReadBatchSize is the most message IDs Gmail accepts in one batchModify call
+const markReadBatchSize = 1000
 
-		// Mark email as read
-		modifyReq := &gmail.ModifyMessageRequest{
+// MarkRead removes the UNREAD label from the given messages, batching the
+// requests. Fetching does not change a message, so callers mark emails read
+// only once they have been delivered.
+func (s *Service) MarkRead(ctx context.Context, messageIDs []string) error {
+	for start := 0; start < len(messageIDs); start += markReadBatchSize {
+		end := min(start+markReadBatchSize, len(messageIDs))
+		req := &gmail.BatchModifyMessagesRequest{
+			Ids:            messageIDs[start:end],
 			RemoveLabelIds: []string{"UNREAD"},
 		}
-		if _, err := s.srv.Users.Messages.Modify("me", msg.Id, modifyReq).Do(); err != nil {
-			s.logger.Printf("Failed to mark message %s as read: %v", msg.Id, err)
-			// Continue processing even if marking as read fails
+		err := s.withRetry(ctx, func() error {
+			return s.srv.Users.Messages.BatchModify("me", req).Context(ctx).Do()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark messages as read: %w", err)
 		}
 	}
+	return nil
+}
 
-	return emails, nil
+// defaultQuery selects the emails digested when the user has no query of their own
+const defaultQuery = "is:unread"
+
+// buildQuery returns the Gmail search query for emails matching query, or
+// unread emails if it is empty, received after since
+func buildQuery(query string, since time.Time) string {
+	if query == "" {
+		query = defaultQuery
+	}
+	if since.IsZero() {
+		return query
+	}
+	return fmt.Sprintf("%s after:%d", query, since.Unix())
+}
+
+// listMessages returns message references matching query across all result pages, up to maxResults.
+func (s *Service) listMessages(ctx context.Context, query string, maxResults int) ([]*gmail.Message, error) {
+	var msgRefs []*gmail.Message
+	pageToken := ""
+	for {
+		call := s.srv.Users.Messages.List("me").Q(query).Context(ctx)
+		size := int64(pageSize)
+		if maxResults > 0 && maxResults-len(msgRefs) < pageSize {
+			size = int64(maxResults - len(msgRefs))
+		}
+		call = call.MaxResults(size)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var listResp *gmail.ListMessagesResponse
+		err := s.withRetry(ctx, func() error {
+			var err error
+			listResp, err = call.Do()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list emails: %w", err)
+		}
+		msgRefs = append(msgRefs, listResp.Messages...)
+
+		if maxResults > 0 && len(msgRefs) >= maxResults {
+			return msgRefs[:maxResults], nil
+		}
+		if listResp.NextPageToken == "" {
+			return msgRefs, nil
+		}
+		pageToken = listResp.NextPageToken
+	}
 }
 
 func (s *Service) parseEmail(msg *gmail.Message) (*models.Email, error) {
-	email := &models.Email{ID: msg.Id}
+	email := &models.Email{ID: msg.Id, ThreadID: msg.ThreadId, Snippet: msg.Snippet}
 	if msg.Payload == nil {
 		return nil, fmt.Errorf("message %q has no payload", msg.Id)
 	}
+	for _, label := range msg.LabelIds {
+		if label == "IMPORTANT" {
+			email.Important = true
+		}
+	}
+	// Gmail's receive time stands in for a missing or unparseable Date header
+	if msg.InternalDate > 0 {
+		email.Date = time.UnixMilli(msg.InternalDate)
+	}
 
 	for _, h := range msg.Payload.Headers {
 		switch h.Name {
@@ -87,6 +232,10 @@ func (s *Service) parseEmail(msg *gmail.Message) (*models.Email, error) {
 			email.Subject = h.Value
 		case "From":
 			email.From = h.Value
+		case "To":
+			email.To = parseAddressList(h.Value)
+		case "Cc":
+			email.Cc = parseAddressList(h.Value)
 		case "Date":
 			t, err := time.Parse(time.RFC1123Z, h.Value)
 			if err == nil {
@@ -95,25 +244,77 @@ func (s *Service) parseEmail(msg *gmail.Message) (*models.Email, error) {
 		}
 	}
 
-	if msg.Payload.Body.Data != "" {
-		body, err := base64.URLEncoding.DecodeString(msg.Payload.Body.Data)
+	if msg.Payload.Body != nil && msg.Payload.Body.Data != "" {
+		body, err := decodePartBody(msg.Payload)
 		if err == nil {
-			email.Body = string(body)
-		}
-	} else {
-		for _, part := range msg.Payload.Parts {
-			if part == nil || part.Body == nil {
-				continue
-			}
-			if part.MimeType == "text/plain" && part.Body.Data != "" {
-				body, err := base64.URLEncoding.DecodeString(part.Body.Data)
-				if err == nil {
-					email.Body = string(body)
-					break
-				}
-			}
+			email.Body = body
 		}
 	}
+	for _, part := range msg.Payload.Parts {
+		collectParts(email, part)
+	}
 
 	return email, nil
-} 
\ No newline at end of file
+}
+
+// parseAddressList returns the addresses in an address-list header such as
+// To, dropping display names. A list that is not valid RFC 5322 is split on
+// commas instead, keeping the part in angle brackets of each entry, so one
+// malformed entry does not lose the rest.
+func parseAddressList(value string) []string {
+	var addresses []string
+	if list, err := mail.ParseAddressList(value); err == nil {
+		for _, addr := range list {
+			addresses = append(addresses, addr.Address)
+		}
+		return addresses
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if addr, err := mail.ParseAddress(entry); err == nil {
+			addresses = append(addresses, addr.Address)
+			continue
+		}
+		if start, end := strings.LastIndex(entry, "<"), strings.LastIndex(entry, ">"); start >= 0 && end > start {
+			entry = strings.TrimSpace(entry[start+1 : end])
+		}
+		if strings.Contains(entry, "@") {
+			addresses = append(addresses, entry)
+		}
+	}
+	return addresses
+}
+
+// collectParts walks a MIME part tree, recording attachment metadata and
+// using the first text/plain part as the body if none was found yet.
+func collectParts(email *models.Email, part *gmail.MessagePart) {
+	if part == nil {
+		return
+	}
+
+	attachmentID := ""
+	var size int64
+	if part.Body != nil {
+		attachmentID = part.Body.AttachmentId
+		size = part.Body.Size
+	}
+
+	if part.Filename != "" || attachmentID != "" {
+		email.Attachments = append(email.Attachments, models.Attachment{
+			Filename:  part.Filename,
+			MimeType:  part.MimeType,
+			SizeBytes: size,
+			PartID:    part.PartId,
+		})
+	} else if email.Body == "" && part.MimeType == "text/plain" && part.Body != nil && part.Body.Data != "" {
+		body, err := decodePartBody(part)
+		if err == nil {
+			email.Body = body
+		}
+	}
+
+	for _, child := range part.Parts {
+		collectParts(email, child)
+	}
+}
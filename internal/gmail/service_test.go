@@ -0,0 +1,551 @@
+package gmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"gmaildigest-go/pkg/models"
+)
+
+// fakeGmailServer serves a paginated message list and message bodies
+type fakeGmailServer struct {
+	mu       sync.Mutex
+	pages    map[string]*gmail.ListMessagesResponse // pageToken -> page
+	queries  []string
+	modified []string
+	batches  []*gmail.BatchModifyMessagesRequest
+}
+
+func (f *fakeGmailServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const prefix = "/gmail/v1/users/me/messages"
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		f.queries = append(f.queries, r.URL.Query().Get("q"))
+		page, ok := f.pages[r.URL.Query().Get("pageToken")]
+		if !ok {
+			http.Error(w, "unknown page", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	case path == "/batchModify" && r.Method == http.MethodPost:
+		var req gmail.BatchModifyMessagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.batches = append(f.batches, &req)
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(path, "/modify"):
+		f.modified = append(f.modified, strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/modify"))
+		json.NewEncoder(w).Encode(&gmail.Message{})
+	default:
+		id := strings.TrimPrefix(path, "/")
+		json.NewEncoder(w).Encode(&gmail.Message{
+			Id: id,
+			Payload: &gmail.MessagePart{
+				Headers: []*gmail.MessagePartHeader{
+					{Name: "Subject", Value: "Subject " + id},
+					{Name: "From", Value: "sender@example.com"},
+				},
+				Body: &gmail.MessagePartBody{
+					Data: base64.URLEncoding.EncodeToString([]byte("Body " + id)),
+				},
+			},
+		})
+	}
+}
+
+func newTestService(t *testing.T, handler http.Handler) *Service {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	srv, err := gmail.NewService(context.Background(),
+		option.WithHTTPClient(server.Client()),
+		option.WithEndpoint(server.URL+"/"),
+	)
+	require.NoError(t, err)
+	// Retry quickly so tests of failing calls stay fast
+	return &Service{logger: slog.New(slog.DiscardHandler), srv: srv, backoff: time.Millisecond}
+}
+
+func messageRefs(ids ...string) []*gmail.Message {
+	refs := make([]*gmail.Message, len(ids))
+	for i, id := range ids {
+		refs[i] = &gmail.Message{Id: id}
+	}
+	return refs
+}
+
+func TestService_FetchUnreadEmails_Pagination(t *testing.T) {
+	fake := &fakeGmailServer{pages: map[string]*gmail.ListMessagesResponse{
+		"":       {Messages: messageRefs("m1", "m2"), NextPageToken: "page-2"},
+		"page-2": {Messages: messageRefs("m3")},
+	}}
+	service := newTestService(t, fake)
+
+	emails, err := service.FetchUnreadEmails(context.Background(), 0)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, email := range emails {
+		ids = append(ids, email.ID)
+	}
+	assert.Equal(t, []string{"m1", "m2", "m3"}, ids)
+	assert.Equal(t, "Subject m3", emails[2].Subject)
+	assert.Equal(t, "Body m3", emails[2].Body)
+	assert.Equal(t, []string{"is:unread", "is:unread"}, fake.queries)
+	// Fetching leaves messages unread; see MarkRead
+	assert.Empty(t, fake.modified)
+	assert.Empty(t, fake.batches)
+}
+
+func TestService_FetchUnreadEmails_MaxResults(t *testing.T) {
+	fake := &fakeGmailServer{pages: map[string]*gmail.ListMessagesResponse{
+		"":       {Messages: messageRefs("m1", "m2"), NextPageToken: "page-2"},
+		"page-2": {Messages: messageRefs("m3", "m4"), NextPageToken: "page-3"},
+		"page-3": {Messages: messageRefs("m5")},
+	}}
+	service := newTestService(t, fake)
+
+	emails, err := service.FetchUnreadEmails(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Len(t, emails, 3)
+
+	// The third page is never requested once the cap is reached
+	assert.Len(t, fake.queries, 2)
+}
+
+func TestService_FetchUnreadEmails_ListError(t *testing.T) {
+	service := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprintf("boom: %s", r.URL.Path), http.StatusInternalServerError)
+	}))
+
+	_, err := service.FetchUnreadEmails(context.Background(), 0)
+	assert.Error(t, err)
+}
+
+func TestBuildQuery(t *testing.T) {
+	assert.Equal(t, "is:unread", buildQuery("", time.Time{}))
+
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, fmt.Sprintf("is:unread after:%d", since.Unix()), buildQuery("", since))
+	assert.Equal(t, "is:unread after:1704164645", buildQuery("", since))
+
+	// A custom query replaces the unread default
+	assert.Equal(t, "label:newsletters", buildQuery("label:newsletters", time.Time{}))
+	assert.Equal(t, "label:newsletters after:1704164645", buildQuery("label:newsletters", since))
+}
+
+func TestService_FetchEmailsSince(t *testing.T) {
+	fake := &fakeGmailServer{pages: map[string]*gmail.ListMessagesResponse{
+		"": {Messages: messageRefs("m1")},
+	}}
+	service := newTestService(t, fake)
+
+	since := time.Unix(1704164645, 0)
+	emails, err := service.FetchEmailsSince(context.Background(), since, 0)
+	require.NoError(t, err)
+	assert.Len(t, emails, 1)
+	assert.Equal(t, []string{"is:unread after:1704164645"}, fake.queries)
+}
+
+func TestService_FetchEmails_CustomQuery(t *testing.T) {
+	fake := &fakeGmailServer{pages: map[string]*gmail.ListMessagesResponse{
+		"": {Messages: messageRefs("m1", "m2")},
+	}}
+	service := newTestService(t, fake)
+
+	emails, err := service.FetchEmails(context.Background(), "label:newsletters", time.Time{}, 0)
+	require.NoError(t, err)
+	assert.Len(t, emails, 2)
+	assert.Equal(t, []string{"label:newsletters"}, fake.queries)
+}
+
+func TestService_ParseEmail_Attachments(t *testing.T) {
+	encode := func(s string) string { return base64.URLEncoding.EncodeToString([]byte(s)) }
+	msg := &gmail.Message{
+		Id: "m1",
+		Payload: &gmail.MessagePart{
+			MimeType: "multipart/mixed",
+			Headers: []*gmail.MessagePartHeader{
+				{Name: "Subject", Value: "Quarterly report"},
+			},
+			Body: &gmail.MessagePartBody{},
+			Parts: []*gmail.MessagePart{
+				{
+					PartId:   "0",
+					MimeType: "multipart/alternative",
+					Body:     &gmail.MessagePartBody{},
+					Parts: []*gmail.MessagePart{
+						{PartId: "0.0", MimeType: "text/plain", Body: &gmail.MessagePartBody{Data: encode("See attached.")}},
+						{PartId: "0.1", MimeType: "text/html", Body: &gmail.MessagePartBody{Data: encode("<p>See attached.</p>")}},
+					},
+				},
+				{
+					PartId:   "1",
+					MimeType: "application/pdf",
+					Filename: "report.pdf",
+					Body:     &gmail.MessagePartBody{AttachmentId: "att-1", Size: 48213},
+				},
+			},
+		},
+	}
+
+	service := &Service{logger: slog.New(slog.DiscardHandler)}
+	email, err := service.parseEmail(msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Quarterly report", email.Subject)
+	assert.Equal(t, "See attached.", email.Body)
+	require.Len(t, email.Attachments, 1)
+	assert.Equal(t, models.Attachment{
+		Filename:  "report.pdf",
+		MimeType:  "application/pdf",
+		SizeBytes: 48213,
+		PartID:    "1",
+	}, email.Attachments[0])
+}
+
+func TestService_ParseEmail_ThreadAndDate(t *testing.T) {
+	received := time.Date(2024, 3, 4, 10, 30, 0, 0, time.UTC)
+	msg := &gmail.Message{
+		Id:           "m2",
+		ThreadId:     "t1",
+		Snippet:      "Following up on the plan",
+		InternalDate: received.UnixMilli(),
+		Payload: &gmail.MessagePart{
+			Headers: []*gmail.MessagePartHeader{{Name: "Subject", Value: "Re: Plan"}},
+			Body:    &gmail.MessagePartBody{},
+		},
+	}
+
+	service := &Service{logger: slog.New(slog.DiscardHandler)}
+	email, err := service.parseEmail(msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "t1", email.ThreadID)
+	assert.Equal(t, "Following up on the plan", email.Snippet)
+	// Without a Date header the receive time is used
+	assert.True(t, received.Equal(email.Date))
+}
+
+func TestService_ParseEmail_RecipientsAndImportance(t *testing.T) {
+	msg := &gmail.Message{
+		Id:       "m3",
+		LabelIds: []string{"INBOX", "IMPORTANT", "UNREAD"},
+		Payload: &gmail.MessagePart{
+			Headers: []*gmail.MessagePartHeader{
+				{Name: "To", Value: `"Doe, Jane" <jane@example.com>, bob@example.com`},
+				{Name: "Cc", Value: "Carol <carol@example.com>, Dave <dave@example.com>"},
+			},
+			Body: &gmail.MessagePartBody{},
+		},
+	}
+
+	service := &Service{logger: slog.New(slog.DiscardHandler)}
+	email, err := service.parseEmail(msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"jane@example.com", "bob@example.com"}, email.To)
+	assert.Equal(t, []string{"carol@example.com", "dave@example.com"}, email.Cc)
+	assert.True(t, email.Important)
+
+	msg.LabelIds = []string{"INBOX"}
+	email, err = service.parseEmail(msg)
+	require.NoError(t, err)
+	assert.False(t, email.Important)
+}
+
+func TestService_ParseEmail_TransferEncodingAndCharset(t *testing.T) {
+	encode := func(s string) string { return base64.URLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name    string
+		headers []*gmail.MessagePartHeader
+		data    string
+		want    string
+	}{
+		{
+			name: "quoted-printable ISO-8859-1",
+			headers: []*gmail.MessagePartHeader{
+				{Name: "Content-Type", Value: `text/plain; charset="ISO-8859-1"`},
+				{Name: "Content-Transfer-Encoding", Value: "quoted-printable"},
+			},
+			data: "Caf=E9 cr=E8me br=FBl=E9e, =\r\nvoil=E0",
+			want: "Café crème brûlée, voilà",
+		},
+		{
+			name:    "Windows-1252 without transfer encoding",
+			headers: []*gmail.MessagePartHeader{{Name: "Content-Type", Value: "text/plain; charset=windows-1252"}},
+			data:    "\x93Quoted\x94 \x96 50\x80",
+			want:    "\u201cQuoted\u201d \u2013 50\u20ac",
+		},
+		{
+			name:    "UTF-8",
+			headers: []*gmail.MessagePartHeader{{Name: "Content-Type", Value: "text/plain; charset=UTF-8"}},
+			data:    "Grüße",
+			want:    "Grüße",
+		},
+		{
+			name:    "unknown charset",
+			headers: []*gmail.MessagePartHeader{{Name: "Content-Type", Value: "text/plain; charset=x-unknown"}},
+			data:    "plain text",
+			want:    "plain text",
+		},
+	}
+
+	service := &Service{logger: slog.New(slog.DiscardHandler)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &gmail.Message{
+				Id: "m4",
+				Payload: &gmail.MessagePart{
+					MimeType: "multipart/alternative",
+					Body:     &gmail.MessagePartBody{},
+					Parts: []*gmail.MessagePart{
+						{PartId: "0", MimeType: "text/plain", Headers: tt.headers, Body: &gmail.MessagePartBody{Data: encode(tt.data)}},
+					},
+				},
+			}
+
+			email, err := service.parseEmail(msg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, email.Body)
+		})
+	}
+}
+
+func TestParseAddressList(t *testing.T) {
+	// Display names and angle brackets are dropped
+	assert.Equal(t, []string{"a@example.com", "b@example.com"},
+		parseAddressList("Alice <a@example.com>, <b@example.com>"))
+
+	// One malformed entry does not lose the others
+	assert.Equal(t, []string{"a@example.com", "b@example.com"},
+		parseAddressList("Alice Smith (work <a@example.com>, b@example.com, undisclosed-recipients"))
+
+	assert.Empty(t, parseAddressList(""))
+}
+
+// inFlightTracker records the peak number of concurrent message fetches
+// and fails the fetch of one message
+type inFlightTracker struct {
+	next     http.Handler
+	failID   string
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (f *inFlightTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/gmail/v1/users/me/messages/"
+	id := strings.TrimPrefix(r.URL.Path, prefix)
+	if r.Method != http.MethodGet || id == r.URL.Path {
+		f.next.ServeHTTP(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	f.inFlight++
+	f.peak = max(f.peak, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	// Hold the request so concurrent fetches overlap
+	time.Sleep(20 * time.Millisecond)
+	if id == f.failID {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	f.next.ServeHTTP(w, r)
+}
+
+func TestService_FetchUnreadEmails_Concurrency(t *testing.T) {
+	var ids []string
+	for i := 1; i <= 12; i++ {
+		ids = append(ids, fmt.Sprintf("m%d", i))
+	}
+	fake := &fakeGmailServer{pages: map[string]*gmail.ListMessagesResponse{
+		"": {Messages: messageRefs(ids...)},
+	}}
+	tracker := &inFlightTracker{next: fake, failID: "m5"}
+	service := newTestService(t, tracker)
+	service.SetFetchConcurrency(3)
+
+	emails, err := service.FetchUnreadEmails(context.Background(), 0)
+	var fetchErrs FetchErrors
+	require.ErrorAs(t, err, &fetchErrs)
+	require.Len(t, fetchErrs, 1)
+	assert.Equal(t, "m5", fetchErrs[0].MessageID)
+
+	// All messages but the failed one are returned, in list order
+	var got []string
+	for _, email := range emails {
+		got = append(got, email.ID)
+	}
+	want := append(append([]string{}, ids[:4]...), ids[5:]...)
+	assert.Equal(t, want, got)
+
+	assert.LessOrEqual(t, tracker.peak, 3)
+	assert.Greater(t, tracker.peak, 1, "messages should be fetched in parallel")
+}
+
+func TestService_MarkRead(t *testing.T) {
+	fake := &fakeGmailServer{}
+	service := newTestService(t, fake)
+
+	ids := make([]string, markReadBatchSize+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("m%d", i)
+	}
+	require.NoError(t, service.MarkRead(context.Background(), ids))
+
+	// The IDs are split across requests that each remove the UNREAD label
+	require.Len(t, fake.batches, 2)
+	assert.Equal(t, ids[:markReadBatchSize], fake.batches[0].Ids)
+	assert.Equal(t, ids[markReadBatchSize:], fake.batches[1].Ids)
+	for _, batch := range fake.batches {
+		assert.Equal(t, []string{"UNREAD"}, batch.RemoveLabelIds)
+		assert.Empty(t, batch.AddLabelIds)
+	}
+
+	// Nothing to mark makes no request
+	require.NoError(t, service.MarkRead(context.Background(), nil))
+	assert.Len(t, fake.batches, 2)
+}
+
+func TestBuildDigestMessage(t *testing.T) {
+	body := strings.Repeat("Ünïcode digest line\n", 10)
+	date := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	raw, err := buildDigestMessage("Me <me@example.com>", "Digest für März", body, "", date)
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, `"Me" <me@example.com>`, msg.Header.Get("To"))
+	assert.Equal(t, "1.0", msg.Header.Get("MIME-Version"))
+	assert.Equal(t, `text/plain; charset="UTF-8"`, msg.Header.Get("Content-Type"))
+	assert.Equal(t, "base64", msg.Header.Get("Content-Transfer-Encoding"))
+	sent, err := msg.Header.Date()
+	require.NoError(t, err)
+	assert.True(t, date.Equal(sent))
+
+	// The subject is an encoded word that decodes back to the original
+	rawSubject := msg.Header.Get("Subject")
+	assert.True(t, strings.HasPrefix(rawSubject, "=?utf-8?q?"), rawSubject)
+	subject, err := new(mime.WordDecoder).DecodeHeader(rawSubject)
+	require.NoError(t, err)
+	assert.Equal(t, "Digest für März", subject)
+
+	// The body is base64 in lines of at most 76 characters
+	encoded, err := io.ReadAll(msg.Body)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(encoded), "\r\n"), "\r\n")
+	require.Greater(t, len(lines), 1)
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), mimeLineLength)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Line breaks in the subject cannot add headers
+	raw, err = buildDigestMessage("me@example.com", "Digest\r\nBcc: other@example.com", "", ContentTypePlain, date)
+	require.NoError(t, err)
+	msg, err = mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Empty(t, msg.Header.Get("Bcc"))
+
+	_, err = buildDigestMessage("not an address", "Digest", "", ContentTypePlain, date)
+	assert.Error(t, err)
+	_, err = buildDigestMessage("me@example.com", "Digest", "", "application/pdf", date)
+	assert.Error(t, err)
+
+	// HTML digests are labelled as HTML so mail clients render them
+	raw, err = buildDigestMessage("me@example.com", "Digest", "<h2>Summary</h2>", ContentTypeHTML, date)
+	require.NoError(t, err)
+	msg, err = mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, `text/html; charset="UTF-8"`, msg.Header.Get("Content-Type"))
+}
+
+func TestService_SendDigestEmail(t *testing.T) {
+	var sent []*gmail.Message
+	scopeGranted := true
+	service := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !scopeGranted {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"error":{"code":403,"message":"Request had insufficient authentication scopes.",`+
+				`"errors":[{"reason":"insufficientPermissions"}]}}`)
+			return
+		}
+		require.Equal(t, "/gmail/v1/users/me/messages/send", r.URL.Path)
+		var msg gmail.Message
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		sent = append(sent, &msg)
+		json.NewEncoder(w).Encode(&gmail.Message{Id: "sent-1"})
+	}))
+
+	require.NoError(t, service.SendDigestEmail(context.Background(), "me@example.com", "Digest", "3 new emails", ContentTypePlain))
+	require.Len(t, sent, 1)
+	raw, err := base64.URLEncoding.DecodeString(sent[0].Raw)
+	require.NoError(t, err)
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "<me@example.com>", msg.Header.Get("To"))
+	assert.Equal(t, "Digest", msg.Header.Get("Subject"))
+
+	scopeGranted = false
+	err = service.SendDigestEmail(context.Background(), "me@example.com", "Digest", "3 new emails", ContentTypePlain)
+	assert.ErrorIs(t, err, ErrSendScopeMissing)
+	assert.Len(t, sent, 1)
+}
+
+func TestService_FetchEmails_CollectsMessageErrors(t *testing.T) {
+	fake := &fakeGmailServer{pages: map[string]*gmail.ListMessagesResponse{
+		"": {Messages: messageRefs("m1", "m2", "m3")},
+	}}
+	service := newTestService(t, &inFlightTracker{next: fake, failID: "m2"})
+
+	emails, err := service.FetchEmails(context.Background(), "", time.Time{}, 0)
+	require.Len(t, emails, 2)
+	assert.Equal(t, "m1", emails[0].ID)
+	assert.Equal(t, "m3", emails[1].ID)
+
+	var fetchErrs FetchErrors
+	require.ErrorAs(t, err, &fetchErrs)
+	require.Len(t, fetchErrs, 1)
+	assert.Equal(t, "m2", fetchErrs[0].MessageID)
+	assert.Contains(t, err.Error(), "message m2")
+
+	var apiErr *googleapi.Error
+	require.ErrorAs(t, err, &apiErr, "the API error is kept for callers to inspect")
+	assert.Equal(t, http.StatusNotFound, apiErr.Code)
+}
@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"gmaildigest-go/internal/storage"
+	"gmaildigest-go/internal/worker"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	jobsByStatusDesc = prometheus.NewDesc(
+		"gmaildigest_jobs",
+		"The number of scheduled jobs by status.",
+		[]string{"status"}, nil,
+	)
+	workerActiveDesc = prometheus.NewDesc(
+		"gmaildigest_worker_active",
+		"The number of workers currently executing a task.",
+		nil, nil,
+	)
+	workerQueuedDesc = prometheus.NewDesc(
+		"gmaildigest_worker_queued_tasks",
+		"The number of tasks waiting for a worker.",
+		nil, nil,
+	)
+	workerCompletedDesc = prometheus.NewDesc(
+		"gmaildigest_worker_tasks_completed_total",
+		"The total number of tasks the worker pool completed successfully.",
+		nil, nil,
+	)
+	workerFailedDesc = prometheus.NewDesc(
+		"gmaildigest_worker_tasks_failed_total",
+		"The total number of tasks that failed in the worker pool.",
+		nil, nil,
+	)
+	usersTotalDesc = prometheus.NewDesc(
+		"gmaildigest_users_total",
+		"The number of registered users.",
+		nil, nil,
+	)
+	usersActiveDesc = prometheus.NewDesc(
+		"gmaildigest_users_active",
+		"The number of users with a valid Google token.",
+		nil, nil,
+	)
+	emailsProcessedDesc = prometheus.NewDesc(
+		"gmaildigest_emails_processed_total",
+		"The number of processed emails still on record.",
+		nil, nil,
+	)
+	tokensValidDesc = prometheus.NewDesc(
+		"gmaildigest_tokens_valid",
+		"The number of stored tokens belonging to users with a valid Google token.",
+		nil, nil,
+	)
+)
+
+const (
+	// DefaultStorageMetricsTimeout limits the database queries run on a scrape
+	DefaultStorageMetricsTimeout = 5 * time.Second
+	// DefaultStorageMetricsCacheTTL is how long storage metrics are reused
+	// before the database is queried again
+	DefaultStorageMetricsCacheTTL = 30 * time.Second
+)
+
+// JobStatusCounter returns the current number of jobs keyed by status
+type JobStatusCounter func() map[string]int
+
+// jobStatusCollector reports job counts by status at scrape time
+type jobStatusCollector struct {
+	count JobStatusCounter
+}
+
+// NewJobStatusCollector creates a collector exposing gmaildigest_jobs{status}
+// using the counts returned by count on every scrape
+func NewJobStatusCollector(count JobStatusCounter) prometheus.Collector {
+	return &jobStatusCollector{count: count}
+}
+
+// Describe implements prometheus.Collector
+func (c *jobStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobsByStatusDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *jobStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	for status, n := range c.count() {
+		ch <- prometheus.MustNewConstMetric(jobsByStatusDesc, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+// workerPoolCollector reports worker pool statistics at scrape time
+type workerPoolCollector struct {
+	pool *worker.WorkerPool
+}
+
+// NewWorkerPoolCollector creates a collector exposing the worker pool metrics
+func NewWorkerPoolCollector(pool *worker.WorkerPool) prometheus.Collector {
+	return &workerPoolCollector{pool: pool}
+}
+
+// Describe implements prometheus.Collector
+func (c *workerPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- workerActiveDesc
+	ch <- workerQueuedDesc
+	ch <- workerCompletedDesc
+	ch <- workerFailedDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *workerPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	m := c.pool.GetMetrics()
+	ch <- prometheus.MustNewConstMetric(workerActiveDesc, prometheus.GaugeValue, float64(m.ActiveWorkers()))
+	ch <- prometheus.MustNewConstMetric(workerQueuedDesc, prometheus.GaugeValue, float64(m.QueuedTasks()))
+	ch <- prometheus.MustNewConstMetric(workerCompletedDesc, prometheus.CounterValue, float64(m.CompletedTasks()))
+	ch <- prometheus.MustNewConstMetric(workerFailedDesc, prometheus.CounterValue, float64(m.FailedTasks()))
+}
+
+// StorageMetricsSource returns system-wide storage metrics. It is
+// implemented by storage.SQLiteStorage.
+type StorageMetricsSource interface {
+	GetMetrics(ctx context.Context) (*storage.Metrics, error)
+}
+
+// storageCollector reports storage metrics, querying the database at most
+// once per cache period
+type storageCollector struct {
+	source  StorageMetricsSource
+	timeout time.Duration
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	cached   *storage.Metrics
+	cachedAt time.Time
+}
+
+// NewStorageCollector creates a collector exposing user, processed email and
+// token counts from source. A scrape whose query fails omits these metrics
+// and the next scrape queries again.
+func NewStorageCollector(source StorageMetricsSource) prometheus.Collector {
+	return &storageCollector{
+		source:  source,
+		timeout: DefaultStorageMetricsTimeout,
+		ttl:     DefaultStorageMetricsCacheTTL,
+		now:     time.Now,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersTotalDesc
+	ch <- usersActiveDesc
+	ch <- emailsProcessedDesc
+	ch <- tokensValidDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	m, err := c.metrics()
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(usersTotalDesc, prometheus.GaugeValue, float64(m.TotalUsers))
+	ch <- prometheus.MustNewConstMetric(usersActiveDesc, prometheus.GaugeValue, float64(m.ActiveUsers))
+	ch <- prometheus.MustNewConstMetric(emailsProcessedDesc, prometheus.GaugeValue, float64(m.ProcessedEmails))
+	ch <- prometheus.MustNewConstMetric(tokensValidDesc, prometheus.GaugeValue, float64(m.ValidTokens))
+}
+
+// metrics returns the cached metrics, refreshing them once they expire
+func (c *storageCollector) metrics() (*storage.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && c.now().Sub(c.cachedAt) < c.ttl {
+		return c.cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	m, err := c.source.GetMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cached, c.cachedAt = m, c.now()
+	return m, nil
+}
+
+// Register registers collectors with the default registry served by Handler.
+// Collectors that are already registered are skipped.
+func Register(collectors ...prometheus.Collector) error {
+	for _, c := range collectors {
+		if err := prometheus.Register(c); err != nil {
+			var already prometheus.AlreadyRegisteredError
+			if errors.As(err, &already) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gmaildigest-go/internal/storage"
+	"gmaildigest-go/internal/worker"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTask struct {
+	err error
+}
+
+func (t *testTask) Execute(ctx context.Context) error { return t.err }
+func (t *testTask) OnSuccess()                        {}
+func (t *testTask) OnFailure(err error)               {}
+
+func TestHandler_ExposesSchedulerAndWorkerMetrics(t *testing.T) {
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+	require.True(t, pool.Submit(&testTask{}))
+	require.True(t, pool.Submit(&testTask{err: errors.New("boom")}))
+	require.Eventually(t, func() bool {
+		m := pool.GetMetrics()
+		return m.CompletedTasks() == 1 && m.FailedTasks() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	counts := func() map[string]int {
+		return map[string]int{"pending": 2, "running": 1, "failed": 0, "dead": 3}
+	}
+	require.NoError(t, Register(NewJobStatusCollector(counts), NewWorkerPoolCollector(pool)))
+	// Registering again is a no-op
+	require.NoError(t, Register(NewJobStatusCollector(counts)))
+
+	JobsDispatched.WithLabelValues("digest").Inc()
+	JobsCompleted.WithLabelValues("digest").Inc()
+	JobsFailed.WithLabelValues("digest").Inc()
+	JobDuration.WithLabelValues("digest").Observe(0.2)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+	out := string(body)
+
+	for _, want := range []string{
+		`gmaildigest_jobs{status="pending"} 2`,
+		`gmaildigest_jobs{status="dead"} 3`,
+		`gmaildigest_jobs_dispatched_total{job_type="digest"}`,
+		`gmaildigest_jobs_completed_total{job_type="digest"}`,
+		`gmaildigest_jobs_failed_total{job_type="digest"}`,
+		`gmaildigest_job_duration_seconds_bucket{job_type="digest"`,
+		`gmaildigest_worker_tasks_completed_total 1`,
+		`gmaildigest_worker_tasks_failed_total 1`,
+		`gmaildigest_worker_active`,
+	} {
+		assert.Contains(t, out, want)
+	}
+}
+
+// fakeStorageMetrics counts the queries made for storage metrics
+type fakeStorageMetrics struct {
+	calls int
+	err   error
+}
+
+func (f *fakeStorageMetrics) GetMetrics(ctx context.Context) (*storage.Metrics, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("no deadline")
+	}
+	return &storage.Metrics{TotalUsers: 5, ActiveUsers: 4, ProcessedEmails: 120, ValidTokens: 3}, nil
+}
+
+func TestStorageCollector(t *testing.T) {
+	source := &fakeStorageMetrics{}
+	collector := NewStorageCollector(source).(*storageCollector)
+	now := time.Now()
+	collector.now = func() time.Time { return now }
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(collector))
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		body, err := io.ReadAll(rec.Result().Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	out := scrape()
+	for _, want := range []string{
+		"gmaildigest_users_total 5",
+		"gmaildigest_users_active 4",
+		"gmaildigest_emails_processed_total 120",
+		"gmaildigest_tokens_valid 3",
+	} {
+		assert.Contains(t, out, want)
+	}
+
+	// Scrapes within the cache period reuse the last query
+	scrape()
+	assert.Equal(t, 1, source.calls)
+	now = now.Add(DefaultStorageMetricsCacheTTL)
+	scrape()
+	assert.Equal(t, 2, source.calls)
+
+	// A failed query leaves the metrics out and is retried on the next scrape
+	source.err = errors.New("database is locked")
+	now = now.Add(DefaultStorageMetricsCacheTTL)
+	assert.NotContains(t, scrape(), "gmaildigest_users_total")
+	scrape()
+	assert.Equal(t, 4, source.calls)
+}
@@ -15,6 +15,15 @@ var (
 		[]string{"job_type"},
 	)
 
+	// JobsDispatched is a counter for jobs handed to the worker pool.
+	JobsDispatched = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gmaildigest_jobs_dispatched_total",
+			Help: "The total number of jobs dispatched to the worker pool.",
+		},
+		[]string{"job_type"},
+	)
+
 	// JobsCompleted is a counter for jobs completed successfully.
 	JobsCompleted = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -42,6 +51,43 @@ var (
 		[]string{"job_type"},
 	)
 
+	// JobsSkipped is a counter for due runs skipped because the previous run
+	// of a no-overlap job was still in progress.
+	JobsSkipped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gmaildigest_jobs_skipped_total",
+			Help: "The total number of due runs skipped because another run was in progress.",
+		},
+		[]string{"job_type"},
+	)
+
+	// JobClaimErrors is a counter for failed attempts to claim due jobs from the store.
+	JobClaimErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gmaildigest_job_claim_errors_total",
+			Help: "The total number of failed attempts to claim due jobs.",
+		},
+	)
+
+	// JobReleaseErrors is a counter for failed attempts to hand a claimed job
+	// back to the store without running it.
+	JobReleaseErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gmaildigest_job_release_errors_total",
+			Help: "The total number of claimed jobs that could not be handed back to the store.",
+		},
+		[]string{"job_type"},
+	)
+
+	// StaleJobRecoveryErrors is a counter for failed passes of the scheduling
+	// loop's stale job recovery.
+	StaleJobRecoveryErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gmaildigest_stale_job_recovery_errors_total",
+			Help: "The total number of failed attempts to recover stale running jobs.",
+		},
+	)
+
 	// JobDuration is a histogram of the time it takes to execute a job.
 	JobDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffStrategy decides how long to wait before retrying a failed job
+type BackoffStrategy interface {
+	// NextDelay returns the delay before the given retry attempt (starting at 1)
+	NextDelay(retryCount int) time.Duration
+}
+
+// BackoffFunc adapts a plain function to the BackoffStrategy interface
+type BackoffFunc func(retryCount int) time.Duration
+
+// NextDelay implements BackoffStrategy
+func (f BackoffFunc) NextDelay(retryCount int) time.Duration {
+	return f(retryCount)
+}
+
+// DefaultBackoff waits RetryCount^2 minutes, capped at 24 hours
+var DefaultBackoff BackoffStrategy = BackoffFunc(func(retryCount int) time.Duration {
+	return capDelay(time.Duration(retryCount*retryCount)*time.Minute, 24*time.Hour)
+})
+
+// ConstantBackoff waits the same delay before every retry
+type ConstantBackoff struct {
+	Delay  time.Duration
+	Jitter float64 // fraction of the delay to randomize, between 0 and 1
+}
+
+// NextDelay implements BackoffStrategy
+func (b ConstantBackoff) NextDelay(retryCount int) time.Duration {
+	return applyJitter(b.Delay, b.Jitter)
+}
+
+// LinearBackoff grows the delay by Step on every retry
+type LinearBackoff struct {
+	Initial time.Duration
+	Step    time.Duration
+	Max     time.Duration // zero means no limit
+	Jitter  float64       // fraction of the delay to randomize, between 0 and 1
+}
+
+// NextDelay implements BackoffStrategy
+func (b LinearBackoff) NextDelay(retryCount int) time.Duration {
+	if retryCount < 1 {
+		retryCount = 1
+	}
+	delay := b.Initial + time.Duration(retryCount-1)*b.Step
+	return applyJitter(capDelay(delay, b.Max), b.Jitter)
+}
+
+// ExponentialBackoff multiplies the delay by Multiplier on every retry
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Multiplier float64       // defaults to 2 when not set
+	Max        time.Duration // zero means no limit
+	Jitter     float64       // fraction of the delay to randomize, between 0 and 1
+}
+
+// NextDelay implements BackoffStrategy
+func (b ExponentialBackoff) NextDelay(retryCount int) time.Duration {
+	if retryCount < 1 {
+		retryCount = 1
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(retryCount-1))
+	if delay > math.MaxInt64 {
+		delay = math.MaxInt64
+	}
+	return applyJitter(capDelay(time.Duration(delay), b.Max), b.Jitter)
+}
+
+// capDelay limits delay to max, ignoring a non-positive max
+func capDelay(delay, max time.Duration) time.Duration {
+	if max > 0 && delay > max {
+		return max
+	}
+	return delay
+}
+
+// applyJitter randomizes delay by up to +/- jitter of its value
+func applyJitter(delay time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	offset := (rand.Float64()*2 - 1) * jitter * float64(delay)
+	return delay + time.Duration(offset)
+}
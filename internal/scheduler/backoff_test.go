@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"gmaildigest-go/internal/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy BackoffStrategy
+		want     []time.Duration // delays for retries 1..n
+	}{
+		{
+			name:     "default",
+			strategy: DefaultBackoff,
+			want:     []time.Duration{time.Minute, 4 * time.Minute, 9 * time.Minute},
+		},
+		{
+			name:     "constant",
+			strategy: ConstantBackoff{Delay: 30 * time.Second},
+			want:     []time.Duration{30 * time.Second, 30 * time.Second, 30 * time.Second},
+		},
+		{
+			name:     "linear",
+			strategy: LinearBackoff{Initial: time.Minute, Step: 2 * time.Minute, Max: 4 * time.Minute},
+			want:     []time.Duration{time.Minute, 3 * time.Minute, 4 * time.Minute},
+		},
+		{
+			name:     "exponential",
+			strategy: ExponentialBackoff{Initial: 10 * time.Second, Max: time.Minute},
+			want:     []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute},
+		},
+		{
+			name:     "exponential with multiplier",
+			strategy: ExponentialBackoff{Initial: time.Second, Multiplier: 3},
+			want:     []time.Duration{time.Second, 3 * time.Second, 9 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				assert.Equal(t, want, tt.strategy.NextDelay(i+1), "retry %d", i+1)
+			}
+		})
+	}
+}
+
+func TestDefaultBackoff_Capped(t *testing.T) {
+	assert.Equal(t, 24*time.Hour, DefaultBackoff.NextDelay(100))
+}
+
+func TestBackoffJitter(t *testing.T) {
+	strategy := ConstantBackoff{Delay: time.Minute, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay := strategy.NextDelay(1)
+		assert.GreaterOrEqual(t, delay, 30*time.Second)
+		assert.LessOrEqual(t, delay, 90*time.Second)
+	}
+}
+
+func TestJobHandlerRegistry_GetBackoff(t *testing.T) {
+	registry := NewJobHandlerRegistry()
+	handler := func(ctx context.Context, job *Job) error { return nil }
+
+	assert.Equal(t, DefaultBackoff.NextDelay(2), registry.GetBackoff("unknown").NextDelay(2))
+
+	strategy := ConstantBackoff{Delay: 5 * time.Second}
+	registry.RegisterHandlerWithBackoff("fast", handler, strategy)
+	assert.NotNil(t, registry.GetHandler("fast"))
+	assert.Equal(t, strategy, registry.GetBackoff("fast"))
+
+	registry.UnregisterHandler("fast")
+	assert.Equal(t, DefaultBackoff.NextDelay(2), registry.GetBackoff("fast").NextDelay(2))
+}
+
+func TestJobTask_OnFailureUsesBackoff(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+
+	scheduler.RegisterHandlerWithBackoff("token_refresh", func(ctx context.Context, job *Job) error {
+		return nil
+	}, ConstantBackoff{Delay: 10 * time.Second})
+
+	job, err := scheduler.ScheduleJob("user1", "token_refresh", "* * * * *", nil)
+	require.NoError(t, err)
+
+	task := NewJobTask(ctx, job, scheduler.registry)
+	task.scheduler = scheduler
+
+	before := time.Now()
+	task.OnFailure(errors.New("refresh failed"))
+	assert.WithinDuration(t, before.Add(10*time.Second), job.NextRun, time.Second)
+}
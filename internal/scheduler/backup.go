@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupJobType is the recurring job that writes a backup of the database
+const BackupJobType = "backup"
+
+// DefaultBackupSchedule runs backups daily at 02:00 UTC, before maintenance
+const DefaultBackupSchedule = "0 2 * * *"
+
+// DefaultBackupRetention is how many backup files are kept when no count is configured
+const DefaultBackupRetention = 7
+
+const (
+	backupFilePrefix = "gmaildigest-"
+	backupFileSuffix = ".db"
+	// backupTimeFormat sorts in the order the backups were written
+	backupTimeFormat = "20060102T150405.000000000Z"
+)
+
+// BackupStorage defines the backup operation run by the BackupJob.
+// It is implemented by storage.SQLiteStorage.
+type BackupStorage interface {
+	Backup(ctx context.Context, backupPath string) error
+}
+
+// BackupConfig sets where backups are written and how many are kept
+type BackupConfig struct {
+	// Dir is the directory backup files are written to
+	Dir string
+	// Keep is how many of the most recent backups are kept; zero keeps them all
+	Keep int
+}
+
+// BackupJob writes timestamped backups of the database and prunes old ones
+type BackupJob struct {
+	logger  *slog.Logger
+	storage BackupStorage
+	config  BackupConfig
+	now     func() time.Time
+}
+
+// NewBackupJob creates a new BackupJob
+func NewBackupJob(logger *slog.Logger, storage BackupStorage, config BackupConfig) *BackupJob {
+	return &BackupJob{
+		logger:  logger,
+		storage: storage,
+		config:  config,
+		now:     time.Now,
+	}
+}
+
+// HandleBackup handles a backup job. A backup that cannot be written, for
+// example because the disk is full, is logged and removed rather than
+// failing the job, so the next scheduled run still happens.
+func (b *BackupJob) HandleBackup(ctx context.Context, job *Job) error {
+	if job == nil {
+		return fmt.Errorf("job cannot be nil")
+	}
+
+	name := backupFilePrefix + b.now().UTC().Format(backupTimeFormat) + backupFileSuffix
+	path := filepath.Join(b.config.Dir, name)
+	if err := b.storage.Backup(ctx, path); err != nil {
+		b.logger.Error("Failed to write backup", "path", path, "error", err)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			b.logger.Error("Failed to remove incomplete backup", "path", path, "error", err)
+		}
+		return nil
+	}
+	b.logger.Info("Wrote backup", "path", path)
+
+	if err := b.prune(); err != nil {
+		b.logger.Error("Failed to prune old backups", "error", err)
+	}
+	return nil
+}
+
+// prune deletes the oldest backups beyond the configured count
+func (b *BackupJob) prune() error {
+	if b.config.Keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(b.config.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= b.config.Keep {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-b.config.Keep] {
+		if err := os.Remove(filepath.Join(b.config.Dir, name)); err != nil {
+			return fmt.Errorf("failed to remove backup %s: %w", name, err)
+		}
+		b.logger.Info("Removed old backup", "path", name)
+	}
+	return nil
+}
+
+// ScheduleBackup schedules the backup job on the given cron schedule,
+// replacing a backup job left from a different schedule
+func (s *Scheduler) ScheduleBackup(ctx context.Context, schedule string) error {
+	return s.scheduleSystemJob(ctx, BackupJobType, schedule)
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gmaildigest-go/internal/worker"
+)
+
+// mockBackupStorage writes a placeholder backup file, or part of one before failing
+type mockBackupStorage struct {
+	fail bool
+}
+
+func (m *mockBackupStorage) Backup(ctx context.Context, backupPath string) error {
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(backupPath, []byte("backup"), 0644); err != nil {
+		return err
+	}
+	if m.fail {
+		return errors.New("no space left on device")
+	}
+	return nil
+}
+
+// backupFiles lists the backup directory in name order
+func backupFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBackupJob_HandleBackup(t *testing.T) {
+	dir := t.TempDir()
+	var logs bytes.Buffer
+	job := NewBackupJob(slog.New(slog.NewTextHandler(&logs, nil)), &mockBackupStorage{}, BackupConfig{Dir: dir, Keep: 2})
+	now := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	job.now = func() time.Time { return now }
+
+	// Each scheduled run writes its own timestamped file
+	require.NoError(t, job.HandleBackup(context.Background(), &Job{ID: "1"}))
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, job.HandleBackup(context.Background(), &Job{ID: "1"}))
+	first := backupFiles(t, dir)
+	assert.Equal(t, []string{
+		"gmaildigest-20240101T020000.000000000Z.db",
+		"gmaildigest-20240102T020000.000000000Z.db",
+	}, first)
+
+	// Other files in the directory are left alone by pruning
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644))
+
+	// A third backup exceeds the cap and removes the oldest
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, job.HandleBackup(context.Background(), &Job{ID: "1"}))
+	assert.Equal(t, []string{
+		"gmaildigest-20240102T020000.000000000Z.db",
+		"gmaildigest-20240103T020000.000000000Z.db",
+		"notes.txt",
+	}, backupFiles(t, dir))
+	assert.Contains(t, logs.String(), "msg=\"Removed old backup\" path="+first[0])
+
+	assert.Error(t, job.HandleBackup(context.Background(), nil))
+}
+
+func TestBackupJob_HandleBackup_WriteError(t *testing.T) {
+	dir := t.TempDir()
+	var logs bytes.Buffer
+	job := NewBackupJob(slog.New(slog.NewTextHandler(&logs, nil)), &mockBackupStorage{fail: true}, BackupConfig{Dir: dir, Keep: 2})
+
+	// The failure is logged rather than failing the recurring job, and the
+	// incomplete file is removed
+	require.NoError(t, job.HandleBackup(context.Background(), &Job{ID: "1"}))
+	assert.Contains(t, logs.String(), "no space left on device")
+	assert.Empty(t, backupFiles(t, dir))
+}
+
+func TestScheduler_ScheduleBackup(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	assert.Error(t, scheduler.ScheduleBackup(ctx, ""))
+	require.NoError(t, scheduler.ScheduleBackup(ctx, "0 2 * * *"))
+	require.NoError(t, scheduler.ScheduleMaintenance(ctx, "0 3 * * *"))
+	require.NoError(t, scheduler.ScheduleBackup(ctx, "0 1 * * *"))
+
+	// A changed schedule replaces the old backup job and leaves maintenance alone
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{Type: BackupJobType})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, MaintenanceUserID, jobs[0].UserID)
+	assert.Equal(t, "0 1 * * *", jobs[0].Schedule)
+
+	jobs, err = scheduler.ListJobs(ctx, &ListJobsOptions{Type: MaintenanceJobType})
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
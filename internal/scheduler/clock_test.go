@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	fired := func(timer Timer) bool {
+		select {
+		case <-timer.C():
+			return true
+		default:
+			return false
+		}
+	}
+
+	short := clock.NewTimer(time.Minute)
+	long := clock.NewTimer(time.Hour)
+	stopped := clock.NewTimer(time.Minute)
+	assert.Equal(t, 3, clock.PendingTimers())
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	clock.Advance(30 * time.Second)
+	assert.False(t, fired(short))
+
+	// Advancing past a deadline fires only the timers due by then
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(90*time.Second), clock.Now())
+	assert.True(t, fired(short))
+	assert.False(t, fired(long))
+	assert.False(t, fired(stopped))
+	assert.Equal(t, 1, clock.PendingTimers())
+	assert.False(t, short.Stop())
+
+	clock.Set(start.Add(2 * time.Hour))
+	assert.True(t, fired(long))
+	assert.Zero(t, clock.PendingTimers())
+
+	// A timer that is already due fires straight away
+	assert.True(t, fired(clock.NewTimer(0)))
+}
@@ -1,103 +1,330 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Schedule decides when a recurring job runs. It is implemented by
+// CronSchedule and IntervalSchedule.
+type Schedule interface {
+	// Next returns the first time after 'after' that the schedule fires, or
+	// the zero time if it never does
+	Next(after time.Time) time.Time
+}
+
 // CronSchedule represents a parsed cron schedule (minute, hour, day, month, weekday)
 type CronSchedule struct {
-	Minute  map[int]bool // 0-59
-	Hour    map[int]bool // 0-23
-	Day     map[int]bool // 1-31
-	Month   map[int]bool // 1-12
-	Weekday map[int]bool // 0-6 (Sunday=0)
+	Minute   map[int]bool   // 0-59
+	Hour     map[int]bool   // 0-23
+	Day      map[int]bool   // 1-31
+	Month    map[int]bool   // 1-12
+	Weekday  map[int]bool   // 0-6 (Sunday=0)
+	Location *time.Location // zone the fields are evaluated in; nil uses the zone of the 'after' time
+}
+
+// cronSearchWindow bounds how far ahead Next and NextN look for run times. It
+// is long enough for a leap day to come round, so only a schedule that can
+// never fire, or fires on a leap day that is also a given weekday, finds none.
+const cronSearchWindow = 5 * 366 * 24 * time.Hour
+
+// minInterval is the shortest interval accepted by an @every schedule
+const minInterval = time.Second
+
+// everyPrefix introduces an interval schedule, e.g. @every 90m
+const everyPrefix = "@every "
+
+// ErrImpossibleSchedule is returned for a cron schedule that never fires
+var ErrImpossibleSchedule = errors.New("schedule never fires")
+
+// cronTimezonePrefixes are the accepted prefixes for an inline timezone, e.g. CRON_TZ=Europe/Berlin
+var cronTimezonePrefixes = []string{"CRON_TZ=", "TZ="}
+
+// cronShortcuts maps the predefined schedule macros to their 5-field equivalents
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronMonthNames maps the three-letter month names accepted in the month field
+var cronMonthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+// cronWeekdayNames maps the three-letter day names accepted in the weekday field
+var cronWeekdayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+// ParseSchedule parses a job schedule: either an interval such as "@every 2h"
+// or anything ParseCron accepts.
+func ParseSchedule(expr string) (Schedule, error) {
+	return ParseScheduleInLocation(expr, nil)
+}
+
+// ParseScheduleInLocation parses a job schedule like ParseSchedule, evaluating
+// a cron expression in loc. Intervals do not depend on a timezone.
+func ParseScheduleInLocation(expr string, loc *time.Location) (Schedule, error) {
+	trimmed := strings.TrimSpace(expr)
+	if len(trimmed) >= len(everyPrefix) && strings.EqualFold(trimmed[:len(everyPrefix)], everyPrefix) {
+		return ParseInterval(trimmed)
+	}
+	return ParseCronInLocation(expr, loc)
 }
 
-// ParseCron parses a 5-field cron expression into a CronSchedule
+// IntervalSchedule fires at a fixed interval after the previous run
+type IntervalSchedule struct {
+	Interval time.Duration
+}
+
+// ParseInterval parses an "@every <duration>" schedule, such as "@every 90m".
+// The duration uses time.ParseDuration syntax and must be at least a second.
+func ParseInterval(expr string) (*IntervalSchedule, error) {
+	trimmed := strings.TrimSpace(expr)
+	if len(trimmed) < len(everyPrefix) || !strings.EqualFold(trimmed[:len(everyPrefix)], everyPrefix) {
+		return nil, fmt.Errorf("invalid interval schedule %q: expected @every <duration>", expr)
+	}
+	interval, err := time.ParseDuration(strings.TrimSpace(trimmed[len(everyPrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval schedule %q: %w", expr, err)
+	}
+	if interval < minInterval {
+		return nil, fmt.Errorf("invalid interval schedule %q: interval must be at least %s", expr, minInterval)
+	}
+	return &IntervalSchedule{Interval: interval}, nil
+}
+
+// Next returns 'after' plus the interval, as a UTC instant
+func (i *IntervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(i.Interval).UTC()
+}
+
+// ParseCron parses a 5-field cron expression (or a shortcut such as @daily) into a CronSchedule.
+// The month and weekday fields also accept three-letter names in any case, such as JAN or MON-FRI.
+// The expression may be prefixed with CRON_TZ=<zone> to evaluate it in that timezone.
 func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	var loc *time.Location
+	for _, prefix := range cronTimezonePrefixes {
+		if !strings.HasPrefix(expr, prefix) {
+			continue
+		}
+		zone, rest, _ := strings.Cut(expr[len(prefix):], " ")
+		l, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron timezone %q: %w", zone, err)
+		}
+		loc = l
+		expr = strings.TrimSpace(rest)
+		break
+	}
+	if strings.HasPrefix(expr, "@") {
+		spec, ok := cronShortcuts[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("invalid cron expression: unknown shortcut %s", expr)
+		}
+		expr = spec
+	}
 	fields := strings.Fields(expr)
 	if len(fields) != 5 {
 		return nil, fmt.Errorf("invalid cron expression: expected 5 fields, got %d", len(fields))
 	}
-	minute, err := parseCronField(fields[0], 0, 59)
+	minute, err := parseCronField(fields[0], 0, 59, nil)
 	if err != nil {
 		return nil, fmt.Errorf("minute: %w", err)
 	}
-	hour, err := parseCronField(fields[1], 0, 23)
+	hour, err := parseCronField(fields[1], 0, 23, nil)
 	if err != nil {
 		return nil, fmt.Errorf("hour: %w", err)
 	}
-	day, err := parseCronField(fields[2], 1, 31)
+	day, err := parseCronField(fields[2], 1, 31, nil)
 	if err != nil {
 		return nil, fmt.Errorf("day: %w", err)
 	}
-	month, err := parseCronField(fields[3], 1, 12)
+	month, err := parseCronField(fields[3], 1, 12, cronMonthNames)
 	if err != nil {
 		return nil, fmt.Errorf("month: %w", err)
 	}
-	weekday, err := parseCronField(fields[4], 0, 6)
+	weekday, err := parseCronField(fields[4], 0, 6, cronWeekdayNames)
 	if err != nil {
 		return nil, fmt.Errorf("weekday: %w", err)
 	}
 	return &CronSchedule{
-		Minute:  minute,
-		Hour:    hour,
-		Day:     day,
-		Month:   month,
-		Weekday: weekday,
+		Minute:   minute,
+		Hour:     hour,
+		Day:      day,
+		Month:    month,
+		Weekday:  weekday,
+		Location: loc,
 	}, nil
 }
 
-// parseCronField parses a single cron field (supports *, single values, lists, and ranges)
-func parseCronField(field string, min, max int) (map[int]bool, error) {
-	result := make(map[int]bool)
-	if field == "*" {
-		for i := min; i <= max; i++ {
-			result[i] = true
-		}
-		return result, nil
+// ParseCronInLocation parses a cron expression whose fields are evaluated in loc.
+// An inline CRON_TZ prefix in the expression takes precedence over loc.
+func ParseCronInLocation(expr string, loc *time.Location) (*CronSchedule, error) {
+	c, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	if c.Location == nil {
+		c.Location = loc
 	}
+	return c, nil
+}
+
+// parseCronField parses a single cron field (supports *, single values, lists, ranges, and steps).
+// Values may also be given by the names in names, matched case-insensitively.
+func parseCronField(field string, min, max int, names map[string]int) (map[int]bool, error) {
+	result := make(map[int]bool)
 	parts := strings.Split(field, ",")
 	for _, part := range parts {
-		if strings.Contains(part, "-") {
-			rangeParts := strings.Split(part, "-")
+		step := 1
+		base := part
+		if strings.Contains(part, "/") {
+			stepParts := strings.Split(part, "/")
+			if len(stepParts) != 2 {
+				return nil, fmt.Errorf("invalid step: %s", part)
+			}
+			val, err := strconv.Atoi(stepParts[1])
+			if err != nil || val <= 0 {
+				return nil, fmt.Errorf("invalid step: %s", part)
+			}
+			base = stepParts[0]
+			step = val
+		}
+
+		var start, end int
+		switch {
+		case base == "*":
+			start, end = min, max
+		case strings.Contains(base, "-"):
+			rangeParts := strings.Split(base, "-")
 			if len(rangeParts) != 2 {
 				return nil, fmt.Errorf("invalid range: %s", part)
 			}
-			start, err1 := strconv.Atoi(rangeParts[0])
-			end, err2 := strconv.Atoi(rangeParts[1])
+			var err1, err2 error
+			start, err1 = parseCronValue(rangeParts[0], names)
+			end, err2 = parseCronValue(rangeParts[1], names)
 			if err1 != nil || err2 != nil || start > end || start < min || end > max {
 				return nil, fmt.Errorf("invalid range: %s", part)
 			}
-			for i := start; i <= end; i++ {
-				result[i] = true
-			}
-		} else {
-			val, err := strconv.Atoi(part)
+		default:
+			val, err := parseCronValue(base, names)
 			if err != nil || val < min || val > max {
 				return nil, fmt.Errorf("invalid value: %s", part)
 			}
-			result[val] = true
+			start, end = val, val
+			if step > 1 {
+				// A single value with a step (e.g. 5/15) runs from that value to the field maximum
+				end = max
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			result[i] = true
 		}
 	}
 	return result, nil
 }
 
-// Next returns the next time after 'after' that matches the schedule
+// parseCronValue parses a single field value, either a number or one of names
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToUpper(value)]; ok {
+		return n, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Next returns the next time after 'after' that matches the schedule, as a UTC instant.
+// Fields are matched against the wall clock in the schedule's location. A wall-clock time
+// skipped by a DST spring-forward fires at the first instant after the gap, and a time
+// repeated by a fall-back fires only once. Next returns the zero time when the schedule
+// does not fire within cronSearchWindow, as for an impossible date like "0 0 30 2 *".
 func (c *CronSchedule) Next(after time.Time) time.Time {
+	loc := c.Location
+	if loc == nil {
+		loc = after.Location()
+	}
+	after = after.In(loc)
+	afterWall := wallClock(after)
+	limit := after.Add(cronSearchWindow)
+
 	// Brute-force: increment minute by minute until all fields match
 	t := after.Add(time.Minute).Truncate(time.Minute)
-	for {
-		if c.Minute[t.Minute()] &&
-			c.Hour[t.Hour()] &&
-			c.Day[t.Day()] &&
-			c.Month[int(t.Month())] &&
-			c.Weekday[int(t.Weekday())] {
-			return t
+	prevWall := wallClock(t.Add(-time.Minute))
+	for !t.After(limit) {
+		wall := wallClock(t)
+		if wall.After(afterWall) {
+			if c.matches(wall) {
+				return t.UTC()
+			}
+			// The clock jumped forward; fire now if a skipped wall-clock time matched
+			for w := prevWall.Add(time.Minute); w.Before(wall); w = w.Add(time.Minute) {
+				if w.After(afterWall) && c.matches(w) {
+					return t.UTC()
+				}
+			}
 		}
+		if !c.matchesDate(wall) {
+			// No minute of this day matches; continue from the next midnight
+			t = time.Date(wall.Year(), wall.Month(), wall.Day()+1, 0, 0, 0, 0, loc)
+			prevWall = wallClock(t.Add(-time.Minute))
+			continue
+		}
+		prevWall = wall
 		t = t.Add(time.Minute)
 	}
-} 
\ No newline at end of file
+	return time.Time{}
+}
+
+// NextN returns the next n times after 'after' that the schedule fires. The
+// search stops cronSearchWindow after 'after', so fewer than n times are
+// returned for schedules that fire rarely or never.
+func (c *CronSchedule) NextN(after time.Time, n int) []time.Time {
+	return nextN(c, after, n)
+}
+
+// nextN returns the next n times after 'after' that a schedule fires, within
+// cronSearchWindow of 'after'
+func nextN(sched Schedule, after time.Time, n int) []time.Time {
+	limit := after.Add(cronSearchWindow)
+	var times []time.Time
+	for len(times) < n {
+		next := sched.Next(after)
+		if next.IsZero() || next.After(limit) {
+			break
+		}
+		times = append(times, next)
+		after = next
+	}
+	return times
+}
+
+// matches reports whether a wall-clock time satisfies every field of the schedule
+func (c *CronSchedule) matches(wall time.Time) bool {
+	return c.Minute[wall.Minute()] &&
+		c.Hour[wall.Hour()] &&
+		c.matchesDate(wall)
+}
+
+// matchesDate reports whether the date of a wall-clock time satisfies the day,
+// month and weekday fields of the schedule
+func (c *CronSchedule) matchesDate(wall time.Time) bool {
+	return c.Day[wall.Day()] &&
+		c.Month[int(wall.Month())] &&
+		c.Weekday[int(wall.Weekday())]
+}
+
+// wallClock returns the wall-clock reading of t expressed in UTC, so readings taken
+// at different offsets of the same location compare by their clock face
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
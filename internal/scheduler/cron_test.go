@@ -84,6 +84,66 @@ func TestParseCron(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "step over wildcard",
+			expr: "*/15 * * * *",
+			check: func(t *testing.T, c *CronSchedule) {
+				assert.Len(t, c.Minute, 4)
+				for _, m := range []int{0, 15, 30, 45} {
+					assert.True(t, c.Minute[m], "minute %d should be set", m)
+				}
+			},
+		},
+		{
+			name: "step over range",
+			expr: "10-50/10 */6 * * *",
+			check: func(t *testing.T, c *CronSchedule) {
+				assert.Len(t, c.Minute, 5)
+				for _, m := range []int{10, 20, 30, 40, 50} {
+					assert.True(t, c.Minute[m], "minute %d should be set", m)
+				}
+				assert.Len(t, c.Hour, 4)
+				for _, h := range []int{0, 6, 12, 18} {
+					assert.True(t, c.Hour[h], "hour %d should be set", h)
+				}
+			},
+		},
+		{
+			name: "step from single value",
+			expr: "5/20 * * * *",
+			check: func(t *testing.T, c *CronSchedule) {
+				assert.Len(t, c.Minute, 3)
+				assert.True(t, c.Minute[5] && c.Minute[25] && c.Minute[45])
+			},
+		},
+		{
+			name: "step within list",
+			expr: "0,30-59/15 * * * *",
+			check: func(t *testing.T, c *CronSchedule) {
+				assert.Len(t, c.Minute, 3)
+				assert.True(t, c.Minute[0] && c.Minute[30] && c.Minute[45])
+			},
+		},
+		{
+			name:    "zero step",
+			expr:    "*/0 * * * *",
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric step",
+			expr:    "*/x * * * *",
+			wantErr: true,
+		},
+		{
+			name:    "double step",
+			expr:    "*/5/2 * * * *",
+			wantErr: true,
+		},
+		{
+			name:    "unknown shortcut",
+			expr:    "@fortnightly",
+			wantErr: true,
+		},
 		{
 			name:    "invalid minute",
 			expr:    "60 * * * *",
@@ -134,6 +194,69 @@ func TestParseCron(t *testing.T) {
 	}
 }
 
+func TestParseCron_Shortcuts(t *testing.T) {
+	tests := []struct {
+		shortcut   string
+		equivalent string
+	}{
+		{"@yearly", "0 0 1 1 *"},
+		{"@annually", "0 0 1 1 *"},
+		{"@monthly", "0 0 1 * *"},
+		{"@weekly", "0 0 * * 0"},
+		{"@daily", "0 0 * * *"},
+		{"@hourly", "0 * * * *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shortcut, func(t *testing.T) {
+			got, err := ParseCron(tt.shortcut)
+			require.NoError(t, err)
+			want, err := ParseCron(tt.equivalent)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestParseCron_Names(t *testing.T) {
+	tests := []struct {
+		name       string
+		expr       string
+		equivalent string
+	}{
+		{"weekday name", "0 9 * * MON", "0 9 * * 1"},
+		{"month name", "0 0 1 JAN *", "0 0 1 1 *"},
+		{"lower case", "0 0 1 dec sun", "0 0 1 12 0"},
+		{"named weekday range", "0 9 * * MON-FRI", "0 9 * * 1-5"},
+		{"named month list", "0 0 1 JAN,JUL *", "0 0 1 1,7 *"},
+		{"mixed list", "0 0 * * SUN,3,Fri", "0 0 * * 0,3,5"},
+		{"mixed range", "0 0 * 3-Jun *", "0 0 * 3-6 *"},
+		{"named range with step", "0 0 * JAN-DEC/3 *", "0 0 * 1-12/3 *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+			want, err := ParseCron(tt.equivalent)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	for _, expr := range []string{
+		"MON * * * *",     // names only apply to the month and weekday fields
+		"0 0 * * JAN",     // month name in the weekday field
+		"0 0 * MON *",     // weekday name in the month field
+		"0 0 * * FOO",     // unknown name
+		"0 0 * * FRI-MON", // reversed range
+		"0 0 * * MONDAY",  // only three-letter names
+	} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
 func TestCronSchedule_Next(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -183,6 +306,54 @@ func TestCronSchedule_Next(t *testing.T) {
 			after:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
 			want:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
 		},
+		{
+			name:     "every 15 minutes",
+			schedule: "*/15 * * * *",
+			after:    time.Date(2024, 1, 1, 0, 16, 0, 0, time.UTC),
+			want:     time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "stepped range wraps to next hour",
+			schedule: "10-50/10 * * * *",
+			after:    time.Date(2024, 1, 1, 0, 50, 0, 0, time.UTC),
+			want:     time.Date(2024, 1, 1, 1, 10, 0, 0, time.UTC),
+		},
+		{
+			name:     "hourly shortcut",
+			schedule: "@hourly",
+			after:    time.Date(2024, 1, 1, 5, 30, 0, 0, time.UTC),
+			want:     time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily shortcut",
+			schedule: "@daily",
+			after:    time.Date(2024, 1, 1, 5, 30, 0, 0, time.UTC),
+			want:     time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly shortcut",
+			schedule: "@weekly",
+			after:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), // Monday
+			want:     time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), // Sunday
+		},
+		{
+			name:     "monthly shortcut",
+			schedule: "@monthly",
+			after:    time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			want:     time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "yearly shortcut",
+			schedule: "@yearly",
+			after:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			want:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "annually shortcut",
+			schedule: "@annually",
+			after:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			want:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
 	}
 
 	for _, tt := range tests {
@@ -193,4 +364,151 @@ func TestCronSchedule_Next(t *testing.T) {
 			assert.Equal(t, tt.want, got)
 		})
 	}
-} 
\ No newline at end of file
+} 
+func TestParseCron_Timezone(t *testing.T) {
+	c, err := ParseCron("CRON_TZ=Europe/Berlin 0 9 * * *")
+	require.NoError(t, err)
+	require.NotNil(t, c.Location)
+	assert.Equal(t, "Europe/Berlin", c.Location.String())
+
+	c, err = ParseCron("TZ=Asia/Tokyo @daily")
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", c.Location.String())
+
+	_, err = ParseCron("CRON_TZ=Mars/Olympus 0 9 * * *")
+	assert.Error(t, err)
+
+	// An inline prefix takes precedence over the supplied location
+	c, err = ParseCronInLocation("CRON_TZ=Asia/Tokyo 0 9 * * *", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", c.Location.String())
+}
+
+func TestCronSchedule_NextInLocation(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		schedule string
+		after    time.Time
+		want     time.Time
+	}{
+		{
+			name:     "local wall clock",
+			schedule: "0 9 * * *",
+			after:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:     time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC), // 09:00 EST
+		},
+		{
+			name:     "spring forward gap fires after the gap",
+			schedule: "30 2 * * *",
+			after:    time.Date(2024, 3, 10, 5, 0, 0, 0, time.UTC), // 00:00 EST
+			want:     time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC), // 03:00 EDT
+		},
+		{
+			name:     "fall back repeated hour fires once",
+			schedule: "30 1 * * *",
+			after:    time.Date(2024, 11, 3, 4, 0, 0, 0, time.UTC),  // 00:00 EDT
+			want:     time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+		},
+		{
+			name:     "fall back skips the repeated occurrence",
+			schedule: "30 1 * * *",
+			after:    time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+			want:     time.Date(2024, 11, 4, 6, 30, 0, 0, time.UTC), // 01:30 EST next day
+		},
+		{
+			name:     "step schedule across fall back",
+			schedule: "*/30 * * * *",
+			after:    time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+			want:     time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC),  // 02:00 EST
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCronInLocation(tt.schedule, newYork)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c.Next(tt.after))
+		})
+	}
+}
+
+func TestCronSchedule_NextN(t *testing.T) {
+	c, err := ParseCron("0 9 * * *")
+	require.NoError(t, err)
+
+	after := time.Date(2024, 2, 27, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 2, 28, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 3, 9, 0, 0, 0, time.UTC),
+	}, c.NextN(after, 5))
+	assert.Empty(t, c.NextN(after, 0))
+
+	// A date that never exists stops at the end of the search window
+	c, err = ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.Empty(t, c.NextN(after, 1))
+}
+
+func TestCronSchedule_NextImpossibleDate(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, expr := range []string{"0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		c, err := ParseCron(expr)
+		require.NoError(t, err)
+
+		start := time.Now()
+		assert.True(t, c.Next(after).IsZero(), expr)
+		assert.Less(t, time.Since(start), time.Second, expr)
+	}
+
+	// Leap days are found within the search window
+	c, err := ParseCron("0 0 29 2 *")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC), c.Next(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestParseSchedule(t *testing.T) {
+	sched, err := ParseSchedule("@every 90m")
+	require.NoError(t, err)
+	require.IsType(t, &IntervalSchedule{}, sched)
+	assert.Equal(t, 90*time.Minute, sched.(*IntervalSchedule).Interval)
+
+	sched, err = ParseSchedule("  @EVERY 2h ")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, sched.(*IntervalSchedule).Interval)
+
+	sched, err = ParseSchedule("0 9 * * *")
+	require.NoError(t, err)
+	assert.IsType(t, &CronSchedule{}, sched)
+
+	for _, expr := range []string{"@every", "@every soon", "@every 0s", "@every -1h", "@every 500ms", "@fortnightly"} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestIntervalSchedule_Next(t *testing.T) {
+	sched, err := ParseSchedule("@every 90m")
+	require.NoError(t, err)
+
+	after := time.Date(2024, 3, 1, 8, 15, 30, 0, time.UTC)
+	times := nextN(sched, after, 4)
+	require.Len(t, times, 4)
+	assert.Equal(t, after.Add(90*time.Minute), times[0])
+	for i := 1; i < len(times); i++ {
+		assert.Equal(t, 90*time.Minute, times[i].Sub(times[i-1]))
+	}
+
+	// Intervals are elapsed time, unaffected by the zone of 'after'
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	beforeDST := time.Date(2024, 3, 31, 1, 30, 0, 0, berlin)
+	next := sched.Next(beforeDST)
+	assert.Equal(t, 90*time.Minute, next.Sub(beforeDST))
+	assert.Equal(t, time.UTC, next.Location())
+}
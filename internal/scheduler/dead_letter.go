@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultDeadLetterWebhookAttempts is how many times a dead letter
+	// notification is posted before it is given up
+	DefaultDeadLetterWebhookAttempts = 3
+	// DefaultDeadLetterWebhookTimeout limits each webhook request
+	DefaultDeadLetterWebhookTimeout = 10 * time.Second
+)
+
+// DefaultDeadLetterWebhookBackoff is the wait between webhook attempts
+var DefaultDeadLetterWebhookBackoff = ExponentialBackoff{Initial: time.Second, Max: 30 * time.Second}
+
+// DeadLetterWebhook posts jobs that entered the dead letter state to a
+// webhook URL as JSON. Use its Notify method as the scheduler's dead letter hook.
+type DeadLetterWebhook struct {
+	logger     *slog.Logger
+	url        string
+	attempts   int
+	backoff    BackoffStrategy
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// NewDeadLetterWebhook creates a DeadLetterWebhook that posts to url
+func NewDeadLetterWebhook(logger *slog.Logger, url string) *DeadLetterWebhook {
+	return &DeadLetterWebhook{
+		logger:     logger,
+		url:        url,
+		attempts:   DefaultDeadLetterWebhookAttempts,
+		backoff:    DefaultDeadLetterWebhookBackoff,
+		timeout:    DefaultDeadLetterWebhookTimeout,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// Notify posts the job to the webhook, retrying failed requests with backoff.
+// A notification that still fails after the last attempt is logged and dropped.
+func (w *DeadLetterWebhook) Notify(job *Job) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		w.logger.Error("Failed to marshal dead letter job", "job", job.ID, "error", err)
+		return
+	}
+
+	for attempt := 1; attempt <= w.attempts; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return
+		}
+		if attempt < w.attempts {
+			time.Sleep(w.backoff.NextDelay(attempt))
+		}
+	}
+	w.logger.Error("Failed to send dead letter notification", "job", job.ID, "attempts", w.attempts, "error", err)
+}
+
+// post sends one webhook request, treating any non-2xx response as a failure
+func (w *DeadLetterWebhook) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook error (status %d)", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterWebhook_Notify(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, body)
+		// The first attempt fails and is retried
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	webhook := NewDeadLetterWebhook(slog.New(slog.NewTextHandler(&logs, nil)), server.URL)
+	webhook.backoff = ConstantBackoff{}
+
+	webhook.Notify(&Job{ID: "job1", UserID: "user1", Type: "digest", Status: JobStatusDead, LastError: "boom"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, bodies, 2)
+	var got Job
+	require.NoError(t, json.Unmarshal(bodies[1], &got))
+	assert.Equal(t, "job1", got.ID)
+	assert.Equal(t, JobStatusDead, got.Status)
+	assert.Equal(t, "boom", got.LastError)
+	assert.Empty(t, logs.String())
+}
+
+func TestDeadLetterWebhook_GivesUp(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	webhook := NewDeadLetterWebhook(slog.New(slog.NewTextHandler(&logs, nil)), server.URL)
+	webhook.backoff = ConstantBackoff{}
+
+	webhook.Notify(&Job{ID: "job1"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, DefaultDeadLetterWebhookAttempts, attempts)
+	assert.Contains(t, logs.String(), "job=job1 attempts=3")
+	assert.Contains(t, logs.String(), "status 500")
+}
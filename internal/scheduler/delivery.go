@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gmaildigest-go/internal/digest"
+	"gmaildigest-go/internal/gmail"
+	"gmaildigest-go/internal/storage"
+
+	"golang.org/x/oauth2"
+)
+
+// Deliverer sends a finished digest to a user over one delivery channel.
+// The format tells the channel how to present the digest, such as an HTML
+// email body or Telegram Markdown.
+type Deliverer interface {
+	Deliver(ctx context.Context, userID, text string, format digest.DigestFormat) error
+}
+
+// FormattedMessageSender delivers a digest to a chat with a Telegram parse
+// mode. It is implemented by telegram.Service.
+type FormattedMessageSender interface {
+	SendFormattedMessage(chatID int64, text, parseMode string) error
+}
+
+// telegramMarkdown is the Telegram parse mode that digest.FormatMarkdown is written for
+const telegramMarkdown = "Markdown"
+
+// UserLookup finds the user a digest is delivered to.
+// It is implemented by storage.SQLiteStorage.
+type UserLookup interface {
+	GetUserByID(ctx context.Context, id string) (*storage.User, error)
+}
+
+// TelegramDeliverer sends digests to the Telegram chat the user connected
+type TelegramDeliverer struct {
+	users  UserLookup
+	sender FormattedMessageSender
+}
+
+// NewTelegramDeliverer creates a new TelegramDeliverer
+func NewTelegramDeliverer(users UserLookup, sender FormattedMessageSender) *TelegramDeliverer {
+	return &TelegramDeliverer{users: users, sender: sender}
+}
+
+// Deliver sends the digest to the user's Telegram chat. Markdown digests are
+// sent with the Markdown parse mode; Telegram cannot render the HTML format,
+// so it arrives as text like any other.
+func (d *TelegramDeliverer) Deliver(ctx context.Context, userID, text string, format digest.DigestFormat) error {
+	user, err := d.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user %s: %w", userID, err)
+	}
+	if !user.TelegramChatID.Valid {
+		return fmt.Errorf("user %s has not connected their telegram account", userID)
+	}
+	parseMode := ""
+	if format == digest.FormatMarkdown {
+		parseMode = telegramMarkdown
+	}
+	if err := d.sender.SendFormattedMessage(user.TelegramChatID.Int64, text, parseMode); err != nil {
+		return fmt.Errorf("failed to send digest to user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// DigestMailerFactory creates a DigestMailer authenticated with a user's token
+type DigestMailerFactory func(ctx context.Context, token *oauth2.Token, logger *slog.Logger) (DigestMailer, error)
+
+// newGmailMailer is the default DigestMailerFactory
+func newGmailMailer(ctx context.Context, token *oauth2.Token, logger *slog.Logger) (DigestMailer, error) {
+	return gmail.NewService(ctx, token, logger)
+}
+
+// EmailDeliverer emails digests to the user's own address from their Gmail
+// account, which needs the gmail.send scope
+type EmailDeliverer struct {
+	logger     *slog.Logger
+	users      UserLookup
+	tokenStore Storage
+	newMailer  DigestMailerFactory
+}
+
+// NewEmailDeliverer creates a new EmailDeliverer
+func NewEmailDeliverer(logger *slog.Logger, users UserLookup, tokenStore Storage) *EmailDeliverer {
+	return &EmailDeliverer{
+		logger:     logger,
+		users:      users,
+		tokenStore: tokenStore,
+		newMailer:  newGmailMailer,
+	}
+}
+
+// SetMailerFactory overrides how the Gmail client is created, primarily for testing.
+func (d *EmailDeliverer) SetMailerFactory(factory DigestMailerFactory) {
+	if factory == nil {
+		factory = newGmailMailer
+	}
+	d.newMailer = factory
+}
+
+// Deliver emails the digest to the user, as an HTML body for the HTML format
+func (d *EmailDeliverer) Deliver(ctx context.Context, userID, text string, format digest.DigestFormat) error {
+	user, err := d.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user %s: %w", userID, err)
+	}
+	if user.Email == "" {
+		return fmt.Errorf("user %s has no email address", userID)
+	}
+
+	token, err := d.tokenStore.GetToken(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get token for user %s: %w", userID, err)
+	}
+	mailer, err := d.newMailer(ctx, token, d.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create gmail service for user %s: %w", userID, err)
+	}
+
+	if err := mailer.SendDigestEmail(ctx, user.Email, digestSubject(time.Now()), text, emailContentType(format)); err != nil {
+		return fmt.Errorf("failed to email digest to user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// emailContentType is the content type of an email body in format
+func emailContentType(format digest.DigestFormat) string {
+	if format == digest.FormatHTML {
+		return gmail.ContentTypeHTML
+	}
+	return gmail.ContentTypePlain
+}
+
+// digestSubject is the subject of a digest sent by email
+func digestSubject(sentAt time.Time) string {
+	return "Gmail digest for " + sentAt.Format("2 January 2006")
+}
@@ -2,47 +2,155 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
+	"gmaildigest-go/internal/digest"
 	"gmaildigest-go/internal/gmail"
 	"gmaildigest-go/internal/storage"
 	"gmaildigest-go/internal/summary"
-	"gmaildigest-go/internal/telegram"
+	"gmaildigest-go/pkg/models"
 
 	"golang.org/x/oauth2"
 )
 
+// DigestPayload represents the data needed for a digest job
+type DigestPayload struct {
+	UserID string `json:"user_id"`
+}
+
+// DigestStorage defines the user persistence required by the DigestJob.
+// It is implemented by storage.SQLiteStorage.
+type DigestStorage interface {
+	GetUserByID(ctx context.Context, id string) (*storage.User, error)
+	MarkEmailsProcessed(ctx context.Context, userID string, messageIDs []string) error
+	FilterUnprocessed(ctx context.Context, userID string, messageIDs []string) ([]string, error)
+	UpdateLastDigestSent(ctx context.Context, userID string, sentAt time.Time) error
+}
+
+// EmailFetcher fetches the emails to include in a digest and marks them
+// read once delivered. It is implemented by gmail.Service.
+type EmailFetcher interface {
+	FetchEmails(ctx context.Context, query string, since time.Time, maxResults int) ([]models.Email, error)
+	MarkRead(ctx context.Context, messageIDs []string) error
+}
+
+// DigestMailer sends a digest by email from the user's mailbox.
+// It is implemented by gmail.Service.
+type DigestMailer interface {
+	SendDigestEmail(ctx context.Context, to, subject, body, contentType string) error
+}
+
+// MessageSender delivers a digest to a chat.
+// It is implemented by telegram.Service.
+type MessageSender interface {
+	SendMessage(chatID int64, text string) error
+}
+
+// EmailFetcherFactory creates an EmailFetcher authenticated with a user's token
+type EmailFetcherFactory func(ctx context.Context, token *oauth2.Token, logger *slog.Logger) (EmailFetcher, error)
+
+// newGmailFetcher is the default EmailFetcherFactory
+func newGmailFetcher(ctx context.Context, token *oauth2.Token, logger *slog.Logger) (EmailFetcher, error) {
+	return gmail.NewService(ctx, token, logger)
+}
+
 // DigestJob holds the dependencies for creating and sending a digest.
 type DigestJob struct {
-	logger          *log.Logger
-	storage         storage.Storage
-	tokenStore      *storage.TokenStore
-	summaryService  *summary.Service
-	telegramService *telegram.Service
+	logger         *slog.Logger
+	storage        DigestStorage
+	tokenStore     Storage
+	summaryService summary.Summarizer
+	newFetcher     EmailFetcherFactory
+	markRead       bool
+	forwardEmail   string
+	maxBodyChars   int
+	deliverers     map[string]Deliverer // delivery channel -> deliverer
 }
 
 // NewDigestJob creates a new DigestJob.
 func NewDigestJob(
-	logger *log.Logger,
-	storage storage.Storage,
-	tokenStore *storage.TokenStore,
-	summaryService *summary.Service,
-	telegramService *telegram.Service,
+	logger *slog.Logger,
+	db DigestStorage,
+	tokenStore Storage,
+	summaryService summary.Summarizer,
+	telegramService FormattedMessageSender,
 ) *DigestJob {
 	return &DigestJob{
-		logger:          logger,
-		storage:         storage,
-		tokenStore:      tokenStore,
-		summaryService:  summaryService,
-		telegramService: telegramService,
+		logger:         logger,
+		storage:        db,
+		tokenStore:     tokenStore,
+		summaryService: summaryService,
+		newFetcher:     newGmailFetcher,
+		maxBodyChars:   models.DefaultMaxBodyChars,
+		deliverers: map[string]Deliverer{
+			storage.DeliveryChannelTelegram: NewTelegramDeliverer(db, telegramService),
+			storage.DeliveryChannelEmail:    NewEmailDeliverer(logger, db, tokenStore),
+		},
+	}
+}
+
+// SetDeliverer sets the deliverer used for users who chose a delivery
+// channel, such as storage.DeliveryChannelEmail
+func (j *DigestJob) SetDeliverer(channel string, deliverer Deliverer) {
+	j.deliverers[channel] = deliverer
+}
+
+// SetEmailFetcherFactory overrides how the Gmail client is created, primarily for testing.
+func (j *DigestJob) SetEmailFetcherFactory(factory EmailFetcherFactory) {
+	if factory == nil {
+		factory = newGmailFetcher
 	}
+	j.newFetcher = factory
+}
+
+// SetMarkRead sets whether emails are marked read in Gmail once a digest
+// containing them has been sent
+func (j *DigestJob) SetMarkRead(markRead bool) {
+	j.markRead = markRead
+}
+
+// SetForwardEmail sets an address that also receives each digest by email,
+// sent from the user's Gmail account. An empty address disables forwarding.
+func (j *DigestJob) SetForwardEmail(address string) {
+	j.forwardEmail = address
+}
+
+// SetMaxBodyChars sets how many characters of each email body are passed to
+// the summarizer. Zero or less uses models.DefaultMaxBodyChars.
+func (j *DigestJob) SetMaxBodyChars(maxChars int) {
+	j.maxBodyChars = maxChars
+}
+
+// HandleDigest handles a digest job
+func (j *DigestJob) HandleDigest(ctx context.Context, job *Job) error {
+	if job == nil {
+		return fmt.Errorf("job cannot be nil")
+	}
+
+	var payload DigestPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal digest payload: %w", err)
+	}
+
+	if payload.UserID == "" {
+		return fmt.Errorf("userID cannot be empty in payload")
+	}
+
+	return j.run(ctx, payload.UserID)
 }
 
 // Run executes the digest creation and delivery process for a given user.
 func (j *DigestJob) Run(userID string) error {
-	j.logger.Printf("Running digest job for user %s", userID)
-	ctx := context.Background()
+	return j.run(context.Background(), userID)
+}
+
+// run creates and delivers the digest for a single user
+func (j *DigestJob) run(ctx context.Context, userID string) error {
+	j.logger.Info("Running digest job", "user", userID)
 
 	// 1. Get user's token from token store
 	oauthToken, err := j.tokenStore.GetToken(ctx, userID)
@@ -50,41 +158,211 @@ func (j *DigestJob) Run(userID string) error {
 		return fmt.Errorf("failed to get token for user %s: %w", userID, err)
 	}
 
-	// 2. Get user from storage (for telegram details)
+	// 2. Get user from storage (for the query and delivery channel)
 	user, err := j.storage.GetUserByID(ctx, userID)
 	if err != nil {
 		return fmt.Errorf("failed to get user %s: %w", userID, err)
 	}
 
 	// 3. Create Gmail service
-	gmailService, err := gmail.NewService(ctx, oauthToken, j.logger)
+	gmailService, err := j.newFetcher(ctx, oauthToken, j.logger)
 	if err != nil {
 		return fmt.Errorf("failed to create gmail service for user %s: %w", userID, err)
 	}
 
-	// 4. Fetch unread emails
-	emails, err := gmailService.FetchUnreadEmails(ctx)
-	if err != nil {
+	// 4. Fetch the emails matching the user's query, unread emails by
+	// default, received since the last digest. The new watermark is taken
+	// before fetching so nothing arriving meanwhile is skipped.
+	var since time.Time
+	if user.LastDigestSent != nil {
+		since = *user.LastDigestSent
+	}
+	digestStarted := time.Now()
+	emails, err := gmailService.FetchEmails(ctx, user.GmailQuery, since, gmail.DefaultMaxResults)
+	var fetchErrs gmail.FetchErrors
+	switch {
+	case errors.As(err, &fetchErrs) && len(emails) > 0:
+		// A partial result is still worth sending
+		j.logger.Warn("Skipped emails that could not be fetched", "user", userID, "count", len(fetchErrs), "error", err)
+	case err != nil:
 		return fmt.Errorf("failed to fetch emails for user %s: %w", userID, err)
 	}
+	emails, err = j.unprocessedEmails(ctx, userID, emails)
+	if err != nil {
+		return err
+	}
 
-	// 5. Create summary
-	digest, err := j.summaryService.Summarize(ctx, emails)
+	// 5. Create summary, rendered in the user's digest format if they chose
+	// one. Bodies are cut down first so huge emails fit the summarizer.
+	for i := range emails {
+		emails[i].Truncate(j.maxBodyChars)
+	}
+	summaryText, err := j.summaryService.Summarize(ctx, emails)
 	if err != nil {
 		return fmt.Errorf("failed to summarize emails for user %s: %w", userID, err)
 	}
+	digest, format, err := formatDigest(user, emails, summaryText)
+	if err != nil {
+		return fmt.Errorf("failed to format digest for user %s: %w", userID, err)
+	}
 
-	// 6. Get telegram chat ID
-	if !user.TelegramChatID.Valid {
-		return fmt.Errorf("user %s has not connected their telegram account", userID)
+	// 6. Deliver the digest over the user's chosen channel
+	channel := user.DeliveryChannel
+	if channel == "" {
+		channel = storage.DeliveryChannelTelegram
+	}
+	deliverer, ok := j.deliverers[channel]
+	if !ok {
+		return fmt.Errorf("no deliverer for channel %q of user %s", channel, userID)
+	}
+	if err := deliverer.Deliver(ctx, userID, digest, format); err != nil {
+		return err
 	}
-	chatID := user.TelegramChatID.Int64
 
-	// 7. Send digest
-	if err := j.telegramService.SendMessage(chatID, digest); err != nil {
-		return fmt.Errorf("failed to send digest to user %s: %w", userID, err)
+	// Forward a copy by email. The chosen channel remains the primary
+	// delivery, so a failure here, such as a token without gmail.send, is
+	// only logged.
+	if j.forwardEmail != "" {
+		j.forwardDigest(ctx, gmailService, userID, digest, format, digestStarted)
 	}
 
-	j.logger.Printf("Successfully sent digest to user %s", userID)
+	// 7. Record what was delivered
+	ids := make([]string, len(emails))
+	for i, email := range emails {
+		ids[i] = email.ID
+	}
+	if err := j.storage.MarkEmailsProcessed(ctx, userID, ids); err != nil {
+		j.logger.Error("Failed to mark emails processed", "user", userID, "error", err)
+	}
+	if err := j.storage.UpdateLastDigestSent(ctx, userID, digestStarted); err != nil {
+		return fmt.Errorf("failed to update last digest time for user %s: %w", userID, err)
+	}
+
+	// 8. Clear the emails from the user's unread count. The digest has been
+	// sent, so a failure here is logged rather than failing the job.
+	if j.markRead && len(ids) > 0 {
+		if err := gmailService.MarkRead(ctx, ids); err != nil {
+			j.logger.Error("Failed to mark emails read", "user", userID, "error", err)
+		}
+	}
+
+	j.logger.Info("Successfully sent digest", "user", userID)
 	return nil
-} 
\ No newline at end of file
+}
+
+// unprocessedEmails drops the emails already included in one of the user's
+// earlier digests
+func (j *DigestJob) unprocessedEmails(ctx context.Context, userID string, emails []models.Email) ([]models.Email, error) {
+	if len(emails) == 0 {
+		return emails, nil
+	}
+	ids := make([]string, len(emails))
+	for i, email := range emails {
+		ids[i] = email.ID
+	}
+	unprocessed, err := j.storage.FilterUnprocessed(ctx, userID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check processed emails for user %s: %w", userID, err)
+	}
+
+	keep := make(map[string]bool, len(unprocessed))
+	for _, id := range unprocessed {
+		keep[id] = true
+	}
+	filtered := emails[:0]
+	for _, email := range emails {
+		if keep[email.ID] {
+			filtered = append(filtered, email)
+		}
+	}
+	return filtered, nil
+}
+
+// formatDigest renders the summary in the user's digest format and returns
+// it with the format. Users without a format get the summary as written, as
+// plain text.
+func formatDigest(user *storage.User, emails []models.Email, summaryText string) (string, digest.DigestFormat, error) {
+	if user.DigestFormat == "" {
+		return summaryText, digest.FormatPlain, nil
+	}
+	format, err := digest.ParseFormat(user.DigestFormat)
+	if err != nil {
+		return "", "", err
+	}
+	text, err := digest.FormatDigest(emails, summaryText, format)
+	return text, format, err
+}
+
+// forwardDigest emails the digest to the forward address through the
+// user's Gmail account
+func (j *DigestJob) forwardDigest(ctx context.Context, fetcher EmailFetcher, userID, text string, format digest.DigestFormat, sentAt time.Time) {
+	mailer, ok := fetcher.(DigestMailer)
+	if !ok {
+		j.logger.Warn("Cannot forward digest: the Gmail client cannot send email", "user", userID)
+		return
+	}
+	if err := mailer.SendDigestEmail(ctx, j.forwardEmail, digestSubject(sentAt), text, emailContentType(format)); err != nil {
+		j.logger.Error("Failed to forward digest", "user", userID, "error", err)
+	}
+}
+
+// ScheduleDigest schedules a recurring digest job for a user. A slow digest
+// is never run twice at once; the due run is skipped instead.
+func (s *Scheduler) ScheduleDigest(ctx context.Context, userID string, schedule string) error {
+	if userID == "" {
+		return fmt.Errorf("userID cannot be empty")
+	}
+	if schedule == "" {
+		return fmt.Errorf("schedule cannot be empty")
+	}
+
+	payloadBytes, err := json.Marshal(DigestPayload{UserID: userID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest payload: %w", err)
+	}
+
+	_, err = s.ScheduleJobWithOptions(userID, "digest", schedule, json.RawMessage(payloadBytes), ScheduleOptions{NoOverlap: true})
+	return err
+}
+
+// DigestSchedule returns the schedule of a digest sent every interval. The
+// interval must be a whole number of minutes, the granularity users choose
+// it in.
+func DigestSchedule(interval time.Duration) (string, error) {
+	if interval < time.Minute || interval%time.Minute != 0 {
+		return "", fmt.Errorf("digest interval %s must be a whole number of minutes", interval)
+	}
+	return everyPrefix + interval.String(), nil
+}
+
+// RescheduleDigest moves the user's recurring digest to a new interval,
+// recomputing its next run so the change takes effect right away. A user
+// without a digest job gets one. A zero interval uses DefaultInterval.
+func (s *Scheduler) RescheduleDigest(ctx context.Context, userID string, interval time.Duration) error {
+	if interval == 0 {
+		interval = s.DefaultInterval()
+	}
+	schedule, err := DigestSchedule(interval)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := s.ListJobs(ctx, &ListJobsOptions{UserID: userID, Type: "digest"})
+	if err != nil {
+		return fmt.Errorf("failed to list digest jobs for user %s: %w", userID, err)
+	}
+	rescheduled := false
+	for _, job := range jobs {
+		if job.OneShot {
+			continue
+		}
+		if _, err := s.RescheduleJob(ctx, job.ID, schedule); err != nil {
+			return fmt.Errorf("failed to reschedule digest for user %s: %w", userID, err)
+		}
+		rescheduled = true
+	}
+	if rescheduled {
+		return nil
+	}
+	return s.ScheduleDigest(ctx, userID, schedule)
+}
@@ -0,0 +1,512 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"gmaildigest-go/internal/digest"
+	"gmaildigest-go/internal/gmail"
+	"gmaildigest-go/internal/storage"
+	"gmaildigest-go/internal/worker"
+	"gmaildigest-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// mockDigestStorage is an in-memory DigestStorage
+type mockDigestStorage struct {
+	mu        sync.Mutex
+	users     map[string]*storage.User
+	processed []string
+	lastSent  map[string]time.Time
+}
+
+func newMockDigestStorage() *mockDigestStorage {
+	return &mockDigestStorage{
+		users:    make(map[string]*storage.User),
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+func (m *mockDigestStorage) GetUserByID(ctx context.Context, id string) (*storage.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *mockDigestStorage) MarkEmailsProcessed(ctx context.Context, userID string, messageIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.processed = append(m.processed, messageIDs...)
+	return nil
+}
+
+func (m *mockDigestStorage) FilterUnprocessed(ctx context.Context, userID string, messageIDs []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	processed := make(map[string]bool, len(m.processed))
+	for _, id := range m.processed {
+		processed[id] = true
+	}
+	var unprocessed []string
+	for _, id := range messageIDs {
+		if !processed[id] {
+			unprocessed = append(unprocessed, id)
+		}
+	}
+	return unprocessed, nil
+}
+
+func (m *mockDigestStorage) UpdateLastDigestSent(ctx context.Context, userID string, sentAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSent[userID] = sentAt
+	if user, ok := m.users[userID]; ok {
+		user.LastDigestSent = &sentAt
+	}
+	return nil
+}
+
+// mockEmailFetcher returns canned emails and records the query and since
+// arguments, the emails marked read and the digests sent by email with
+// their content types
+type mockEmailFetcher struct {
+	emails       []models.Email
+	queries      []string
+	since        []time.Time
+	read         []string
+	mailed       []string
+	contentTypes []string
+	mailErr      error
+	fetchErr     error
+}
+
+func (m *mockEmailFetcher) FetchEmails(ctx context.Context, query string, since time.Time, maxResults int) ([]models.Email, error) {
+	m.queries = append(m.queries, query)
+	m.since = append(m.since, since)
+	return m.emails, m.fetchErr
+}
+
+func (m *mockEmailFetcher) MarkRead(ctx context.Context, messageIDs []string) error {
+	m.read = append(m.read, messageIDs...)
+	return nil
+}
+
+func (m *mockEmailFetcher) SendDigestEmail(ctx context.Context, to, subject, body, contentType string) error {
+	if m.mailErr != nil {
+		return m.mailErr
+	}
+	m.mailed = append(m.mailed, to+"|"+subject+"|"+body)
+	m.contentTypes = append(m.contentTypes, contentType)
+	return nil
+}
+
+// mockSummarizer records the bodies of the emails it summarizes
+type mockSummarizer struct {
+	err    error
+	bodies []string
+}
+
+func (m *mockSummarizer) Summarize(ctx context.Context, emails []models.Email) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	for _, email := range emails {
+		m.bodies = append(m.bodies, email.Body)
+	}
+	return fmt.Sprintf("%d new emails", len(emails)), nil
+}
+
+type sentMessage struct {
+	chatID int64
+	text   string
+}
+
+// mockSender records the messages sent and the parse mode of each
+type mockSender struct {
+	mu         sync.Mutex
+	sent       []sentMessage
+	parseModes []string
+}
+
+func (m *mockSender) SendMessage(chatID int64, text string) error {
+	return m.SendFormattedMessage(chatID, text, "")
+}
+
+func (m *mockSender) SendFormattedMessage(chatID int64, text, parseMode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentMessage{chatID, text})
+	m.parseModes = append(m.parseModes, parseMode)
+	return nil
+}
+
+func (m *mockSender) messages() []sentMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]sentMessage(nil), m.sent...)
+}
+
+func newTestDigestJob(t *testing.T, summarizer *mockSummarizer) (*DigestJob, *mockDigestStorage, *mockEmailFetcher, *mockSender) {
+	db := newMockDigestStorage()
+	db.users["user1"] = &storage.User{
+		ID:             "user1",
+		TelegramChatID: sql.NullInt64{Int64: 42, Valid: true},
+	}
+
+	tokens := newMockStorage()
+	require.NoError(t, tokens.StoreToken(context.Background(), "user1", &oauth2.Token{AccessToken: "access"}))
+
+	fetcher := &mockEmailFetcher{emails: []models.Email{
+		{ID: "m1", Subject: "Hello"},
+		{ID: "m2", Subject: "Invoice"},
+	}}
+	sender := &mockSender{}
+
+	job := NewDigestJob(slog.New(slog.DiscardHandler), db, tokens, summarizer, sender)
+	job.SetEmailFetcherFactory(func(ctx context.Context, token *oauth2.Token, logger *slog.Logger) (EmailFetcher, error) {
+		assert.Equal(t, "access", token.AccessToken)
+		return fetcher, nil
+	})
+	return job, db, fetcher, sender
+}
+
+func TestDigestJob_HandleDigest(t *testing.T) {
+	digestJob, db, fetcher, sender := newTestDigestJob(t, &mockSummarizer{})
+
+	payload, err := json.Marshal(DigestPayload{UserID: "user1"})
+	require.NoError(t, err)
+
+	before := time.Now()
+	require.NoError(t, digestJob.HandleDigest(context.Background(), &Job{Type: "digest", Payload: payload}))
+
+	assert.Equal(t, []sentMessage{{42, "2 new emails"}}, sender.messages())
+	assert.Equal(t, []string{"m1", "m2"}, db.processed)
+	assert.False(t, db.lastSent["user1"].Before(before))
+	assert.Empty(t, fetcher.read, "emails are left unread unless enabled")
+
+	// The second run only asks for emails since the first digest
+	require.NoError(t, digestJob.HandleDigest(context.Background(), &Job{Type: "digest", Payload: payload}))
+	require.Len(t, fetcher.since, 2)
+	assert.True(t, fetcher.since[0].IsZero())
+	assert.False(t, fetcher.since[1].Before(before))
+
+	// Users without a query of their own get the default
+	assert.Equal(t, []string{"", ""}, fetcher.queries)
+}
+
+func TestDigestJob_HandleDigest_SkipsProcessedEmails(t *testing.T) {
+	summarizer := &mockSummarizer{}
+	digestJob, db, fetcher, sender := newTestDigestJob(t, summarizer)
+	fetcher.emails[0].Body = "already sent"
+	fetcher.emails[1].Body = "new"
+	db.processed = []string{"m1"}
+
+	require.NoError(t, digestJob.HandleDigest(context.Background(), &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}))
+	assert.Equal(t, []string{"new"}, summarizer.bodies)
+	assert.Equal(t, []sentMessage{{42, "1 new emails"}}, sender.messages())
+	assert.Equal(t, []string{"m1", "m2"}, db.processed)
+}
+
+func TestDigestJob_HandleDigest_PartialFetch(t *testing.T) {
+	digestJob, db, fetcher, sender := newTestDigestJob(t, &mockSummarizer{})
+	job := &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}
+
+	// The emails that were fetched are still sent
+	fetcher.fetchErr = gmail.FetchErrors{{MessageID: "m3", Err: fmt.Errorf("not found")}}
+	require.NoError(t, digestJob.HandleDigest(context.Background(), job))
+	assert.Equal(t, []sentMessage{{42, "2 new emails"}}, sender.messages())
+	assert.Equal(t, []string{"m1", "m2"}, db.processed)
+
+	// A fetch where every message failed is retried
+	fetcher.emails = nil
+	err := digestJob.HandleDigest(context.Background(), job)
+	assert.ErrorContains(t, err, "message m3")
+	assert.Len(t, sender.messages(), 1)
+}
+
+func TestDigestJob_HandleDigest_CustomQuery(t *testing.T) {
+	digestJob, db, fetcher, _ := newTestDigestJob(t, &mockSummarizer{})
+	db.users["user1"].GmailQuery = "label:newsletters"
+
+	require.NoError(t, digestJob.HandleDigest(context.Background(), &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}))
+	assert.Equal(t, []string{"label:newsletters"}, fetcher.queries)
+}
+
+func TestDigestJob_HandleDigest_MarkRead(t *testing.T) {
+	digestJob, _, fetcher, sender := newTestDigestJob(t, &mockSummarizer{})
+	digestJob.SetMarkRead(true)
+
+	require.NoError(t, digestJob.HandleDigest(context.Background(), &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}))
+	assert.Len(t, sender.messages(), 1)
+	assert.Equal(t, []string{"m1", "m2"}, fetcher.read)
+}
+
+func TestDigestJob_HandleDigest_MaxBodyChars(t *testing.T) {
+	summarizer := &mockSummarizer{}
+	digestJob, _, fetcher, _ := newTestDigestJob(t, summarizer)
+	digestJob.SetMaxBodyChars(12)
+	fetcher.emails[0].Body = "Please review\x00 the attached contract"
+	fetcher.emails[1].Body = "Paid"
+
+	require.NoError(t, digestJob.HandleDigest(context.Background(), &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}))
+	assert.Equal(t, []string{"Please…", "Paid"}, summarizer.bodies)
+}
+
+func TestDigestJob_HandleDigest_ForwardEmail(t *testing.T) {
+	digestJob, db, fetcher, sender := newTestDigestJob(t, &mockSummarizer{})
+	payload := &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}
+
+	require.NoError(t, digestJob.HandleDigest(context.Background(), payload))
+	assert.Empty(t, fetcher.mailed, "digests are only forwarded when an address is set")
+
+	// Forget the first digest so the same emails are summarized again
+	db.processed = nil
+	digestJob.SetForwardEmail("me@example.com")
+	require.NoError(t, digestJob.HandleDigest(context.Background(), payload))
+	subject := "Gmail digest for " + time.Now().Format("2 January 2006")
+	assert.Equal(t, []string{"me@example.com|" + subject + "|2 new emails"}, fetcher.mailed)
+
+	// A failed forward is logged; the digest still counts as delivered
+	var logs bytes.Buffer
+	digestJob.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	fetcher.mailErr = fmt.Errorf("%w: insufficient scopes", gmail.ErrSendScopeMissing)
+	require.NoError(t, digestJob.HandleDigest(context.Background(), payload))
+	assert.Len(t, sender.messages(), 3)
+	assert.Contains(t, logs.String(), `level=ERROR msg="Failed to forward digest" user=user1 error="gmail.send scope not granted`)
+}
+
+// recordingDeliverer records the digests it was asked to deliver
+type recordingDeliverer struct {
+	delivered []string
+	formats   []digest.DigestFormat
+}
+
+func (d *recordingDeliverer) Deliver(ctx context.Context, userID, text string, format digest.DigestFormat) error {
+	d.delivered = append(d.delivered, userID+"|"+text)
+	d.formats = append(d.formats, format)
+	return nil
+}
+
+func TestDigestJob_HandleDigest_DeliveryChannel(t *testing.T) {
+	digestJob, db, _, _ := newTestDigestJob(t, &mockSummarizer{})
+	telegram, email := &recordingDeliverer{}, &recordingDeliverer{}
+	digestJob.SetDeliverer(storage.DeliveryChannelTelegram, telegram)
+	digestJob.SetDeliverer(storage.DeliveryChannelEmail, email)
+	payload := &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}
+
+	// Users without a stored preference get Telegram
+	require.NoError(t, digestJob.HandleDigest(context.Background(), payload))
+	assert.Equal(t, []string{"user1|2 new emails"}, telegram.delivered)
+	assert.Empty(t, email.delivered)
+
+	db.users["user1"].DeliveryChannel = storage.DeliveryChannelEmail
+	db.processed = nil
+	require.NoError(t, digestJob.HandleDigest(context.Background(), payload))
+	assert.Len(t, telegram.delivered, 1)
+	assert.Equal(t, []string{"user1|2 new emails"}, email.delivered)
+
+	// A channel without a deliverer fails before anything is recorded
+	db.users["user1"].DeliveryChannel = "fax"
+	db.processed = nil
+	err := digestJob.HandleDigest(context.Background(), payload)
+	assert.ErrorContains(t, err, `no deliverer for channel "fax"`)
+	assert.Empty(t, db.processed)
+}
+
+func TestEmailDeliverer_Deliver(t *testing.T) {
+	db := newMockDigestStorage()
+	db.users["user1"] = &storage.User{ID: "user1", Email: "user1@example.com"}
+	db.users["user2"] = &storage.User{ID: "user2"}
+	tokens := newMockStorage()
+	require.NoError(t, tokens.StoreToken(context.Background(), "user1", &oauth2.Token{AccessToken: "access"}))
+	require.NoError(t, tokens.StoreToken(context.Background(), "user2", &oauth2.Token{AccessToken: "access"}))
+
+	mailer := &mockEmailFetcher{}
+	deliverer := NewEmailDeliverer(slog.New(slog.DiscardHandler), db, tokens)
+	deliverer.SetMailerFactory(func(ctx context.Context, token *oauth2.Token, logger *slog.Logger) (DigestMailer, error) {
+		assert.Equal(t, "access", token.AccessToken)
+		return mailer, nil
+	})
+
+	require.NoError(t, deliverer.Deliver(context.Background(), "user1", "2 new emails", digest.FormatPlain))
+	assert.Equal(t, []string{"user1@example.com|" + digestSubject(time.Now()) + "|2 new emails"}, mailer.mailed)
+
+	// HTML digests are sent as an HTML body; Markdown stays plain text
+	require.NoError(t, deliverer.Deliver(context.Background(), "user1", "<p>2 new emails</p>", digest.FormatHTML))
+	require.NoError(t, deliverer.Deliver(context.Background(), "user1", "*2 new emails*", digest.FormatMarkdown))
+	assert.Equal(t, []string{gmail.ContentTypePlain, gmail.ContentTypeHTML, gmail.ContentTypePlain}, mailer.contentTypes)
+
+	assert.ErrorContains(t, deliverer.Deliver(context.Background(), "user2", "digest", digest.FormatPlain), "no email address")
+	mailer.mailErr = gmail.ErrSendScopeMissing
+	assert.ErrorIs(t, deliverer.Deliver(context.Background(), "user1", "digest", digest.FormatPlain), gmail.ErrSendScopeMissing)
+}
+
+func TestDigestJob_HandleDigest_Format(t *testing.T) {
+	digestJob, db, fetcher, sender := newTestDigestJob(t, &mockSummarizer{})
+	payload := &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)}
+
+	db.users["user1"].DigestFormat = "markdown"
+	require.NoError(t, digestJob.HandleDigest(context.Background(), payload))
+	require.Len(t, sender.messages(), 1)
+	assert.Equal(t, "*Summary*\n\n2 new emails\n\n*Emails (2)*\n- *Hello* ()\n- *Invoice* ()\n", sender.messages()[0].text)
+	// Telegram is told to render the Markdown
+	assert.Equal(t, []string{telegramMarkdown}, sender.parseModes)
+
+	// The forwarded copy of an HTML digest is an HTML email
+	db.users["user1"].DigestFormat = "html"
+	digestJob.SetForwardEmail("me@example.com")
+	require.NoError(t, digestJob.HandleDigest(context.Background(), payload))
+	assert.Equal(t, []string{telegramMarkdown, ""}, sender.parseModes)
+	assert.Equal(t, []string{gmail.ContentTypeHTML}, fetcher.contentTypes)
+	digestJob.SetForwardEmail("")
+
+	db.users["user1"].DigestFormat = "pdf"
+	assert.ErrorContains(t, digestJob.HandleDigest(context.Background(), payload), "unknown digest format")
+	assert.Len(t, sender.messages(), 2)
+}
+
+func TestDigestJob_HandleDigest_Errors(t *testing.T) {
+	digestJob, db, _, sender := newTestDigestJob(t, &mockSummarizer{err: fmt.Errorf("rate limited")})
+	ctx := context.Background()
+
+	assert.Error(t, digestJob.HandleDigest(ctx, nil))
+	assert.Error(t, digestJob.HandleDigest(ctx, &Job{Payload: json.RawMessage(`{}`)}))
+	assert.Error(t, digestJob.HandleDigest(ctx, &Job{Payload: json.RawMessage(`{"user_id":"unknown"}`)}))
+
+	// A failed summary sends nothing and leaves the watermark untouched
+	err := digestJob.HandleDigest(ctx, &Job{Payload: json.RawMessage(`{"user_id":"user1"}`)})
+	assert.ErrorContains(t, err, "rate limited")
+	assert.Empty(t, sender.messages())
+	assert.Empty(t, db.processed)
+	assert.Empty(t, db.lastSent)
+}
+
+func TestScheduler_ScheduleDigest(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	digestJob, _, _, sender := newTestDigestJob(t, &mockSummarizer{})
+	scheduler.RegisterDigestHandler(digestJob.HandleDigest)
+
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	assert.Error(t, scheduler.ScheduleDigest(ctx, "", "0 8 * * *"))
+	assert.Error(t, scheduler.ScheduleDigest(ctx, "user1", ""))
+
+	require.NoError(t, scheduler.ScheduleDigest(ctx, "user1", "0 8 * * *"))
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{UserID: "user1", Type: "digest"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "0 8 * * *", jobs[0].Schedule)
+	assert.True(t, jobs[0].NoOverlap)
+	assert.JSONEq(t, `{"user_id":"user1"}`, string(jobs[0].Payload))
+
+	// Run a digest through the scheduler and worker pool end to end
+	_, err = scheduler.ScheduleOnceJob("user1", "digest", time.Now(), DigestPayload{UserID: "user1"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(sender.messages()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "2 new emails", sender.messages()[0].text)
+}
+
+func TestDigestSchedule(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     string
+		wantErr  bool
+	}{
+		{15 * time.Minute, "@every 15m0s", false},
+		{90 * time.Minute, "@every 1h30m0s", false},
+		{48 * time.Hour, "@every 48h0m0s", false},
+		{0, "", true},
+		{30 * time.Second, "", true},
+		{90 * time.Second, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval.String(), func(t *testing.T) {
+			got, err := DigestSchedule(tt.interval)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScheduler_RescheduleDigest(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	// A user without a digest job gets one
+	require.NoError(t, scheduler.RescheduleDigest(ctx, "user1", 24*time.Hour))
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{UserID: "user1", Type: "digest"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	daily := jobs[0]
+	assert.Equal(t, "@every 24h0m0s", daily.Schedule)
+
+	// Shortening the interval moves the next run earlier without waiting
+	// for the daily run
+	require.NoError(t, scheduler.RescheduleDigest(ctx, "user1", time.Minute))
+	got, err := scheduler.GetJob(ctx, daily.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "@every 1m0s", got.Schedule)
+	assert.False(t, got.NextRun.After(time.Now().Add(time.Minute)))
+	assert.True(t, got.NextRun.Before(daily.NextRun))
+
+	jobs, err = scheduler.ListJobs(ctx, &ListJobsOptions{UserID: "user1", Type: "digest"})
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1, "rescheduling should not add a second digest job")
+
+	assert.Error(t, scheduler.RescheduleDigest(ctx, "user1", 90*time.Second))
+
+	// A zero interval falls back to the scheduler default
+	scheduler.SetDefaultInterval(2 * time.Hour)
+	require.NoError(t, scheduler.RescheduleDigest(ctx, "user1", 0))
+	got, err = scheduler.GetJob(ctx, daily.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "@every 2h0m0s", got.Schedule)
+
+	// A running job keeps its schedule
+	got.Status = JobStatusRunning
+	require.NoError(t, scheduler.store.UpdateJob(ctx, got))
+	assert.ErrorIs(t, scheduler.RescheduleDigest(ctx, "user1", time.Hour), ErrJobRunning)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -22,12 +23,37 @@ const (
 	JobStatusDead      JobStatus = "dead"
 )
 
+var (
+	// ErrJobNotFound is returned by a JobStore when no job has the given ID
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobRunning is returned when an operation needs a job that is not running
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// CatchUpPolicy decides what happens to the runs of a recurring job that
+// were missed, for example while no scheduler was running
+type CatchUpPolicy string
+
+const (
+	// CatchUpLatest runs the job once in place of all its missed runs. An
+	// empty policy means CatchUpLatest.
+	CatchUpLatest CatchUpPolicy = "latest"
+	// CatchUpAll runs the job once for every missed run, one after another
+	CatchUpAll CatchUpPolicy = "all"
+	// CatchUpSkip drops the missed runs and waits for the next scheduled one
+	CatchUpSkip CatchUpPolicy = "skip"
+)
+
 // Job represents a scheduled task in the system
 type Job struct {
 	ID         string          `json:"id"`
 	UserID     string          `json:"user_id"`
 	Type       string          `json:"type"`
 	Schedule   string          `json:"schedule"`
+	Timezone   string          `json:"timezone,omitempty"`
+	OneShot    bool            `json:"one_shot,omitempty"`
+	NoOverlap  bool            `json:"no_overlap,omitempty"`
+	CatchUp    CatchUpPolicy   `json:"catch_up,omitempty"`
 	Payload    json.RawMessage `json:"payload"`
 	Status     JobStatus       `json:"status"`
 	RetryCount int            `json:"retry_count"`
@@ -49,6 +75,10 @@ type JobStore interface {
 	// GetJob retrieves a job by ID
 	GetJob(ctx context.Context, id string) (*Job, error)
 
+	// GetJobByKey retrieves the job with the given user, type and schedule,
+	// which together are unique
+	GetJobByKey(ctx context.Context, userID, jobType, schedule string) (*Job, error)
+
 	// UpdateJob updates an existing job
 	UpdateJob(ctx context.Context, job *Job) error
 
@@ -57,6 +87,28 @@ type JobStore interface {
 
 	// DeleteJob deletes a job by ID
 	DeleteJob(ctx context.Context, id string) error
+
+	// DueJobs returns up to limit jobs waiting to run at or before before,
+	// soonest first, without claiming them
+	DueJobs(ctx context.Context, before time.Time, limit int) ([]*Job, error)
+
+	// ClaimDueJobs atomically marks up to limit schedulable jobs due at or
+	// before now as running and returns them. A job is only ever returned
+	// to one caller, even across processes sharing the database.
+	ClaimDueJobs(ctx context.Context, now time.Time, limit int) ([]*Job, error)
+
+	// NextRunTime returns the soonest NextRun among schedulable jobs, or
+	// the zero time when no job is waiting to run
+	NextRunTime(ctx context.Context) (time.Time, error)
+
+	// CountJobsByStatus returns the number of jobs in each status
+	CountJobsByStatus(ctx context.Context) (map[JobStatus]int, error)
+
+	// RecordJobRun appends an execution attempt to the job's history
+	RecordJobRun(ctx context.Context, run *JobRun) error
+
+	// ListJobRuns returns a job's most recent runs first, up to limit (0 for all)
+	ListJobRuns(ctx context.Context, jobID string, limit int) ([]JobRun, error)
 }
 
 // JobFilter defines criteria for listing jobs
@@ -64,18 +116,70 @@ type JobFilter struct {
 	UserID   string    `json:"user_id,omitempty"`
 	Type     string    `json:"type,omitempty"`
 	Status   JobStatus `json:"status,omitempty"`
-	NextRun  time.Time `json:"next_run,omitempty"`
+	NextRun  time.Time `json:"next_run,omitempty"` // due at or before
 	Statuses []JobStatus `json:"statuses,omitempty"`
+
+	NextRunAfter time.Time `json:"next_run_after,omitempty"` // due at or after
+	Limit        int       `json:"limit,omitempty"`
+	Offset       int       `json:"offset,omitempty"`
+	// OrderBy is next_run, created_at or updated_at, optionally followed by
+	// asc or desc (e.g. "created_at desc"). Empty means "next_run asc".
+	OrderBy string `json:"order_by,omitempty"`
 }
 
 // ListJobsOptions represents the options for listing jobs
 type ListJobsOptions struct {
-	Type   string    `json:"type,omitempty"`
-	UserID string    `json:"user_id,omitempty"`
-	Status JobStatus `json:"status,omitempty"`
-	Before time.Time `json:"before,omitempty"`
-	After  time.Time `json:"after,omitempty"`
-	Limit  int       `json:"limit,omitempty"`
+	Type    string    `json:"type,omitempty"`
+	UserID  string    `json:"user_id,omitempty"`
+	Status  JobStatus `json:"status,omitempty"`
+	Before  time.Time `json:"before,omitempty"`
+	After   time.Time `json:"after,omitempty"`
+	Limit   int       `json:"limit,omitempty"`
+	Offset  int       `json:"offset,omitempty"`
+	OrderBy string    `json:"order_by,omitempty"` // see JobFilter.OrderBy
+}
+
+// jobOrderColumns are the columns ListJobs can sort by
+var jobOrderColumns = map[string]bool{
+	"next_run":   true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// jobOrderClause validates JobFilter.OrderBy and returns the ORDER BY clause
+// for it. Ties are broken by id so pages are stable.
+func jobOrderClause(orderBy string) (string, error) {
+	fields := strings.Fields(strings.ToLower(orderBy))
+	column, direction := "next_run", "ASC"
+	switch len(fields) {
+	case 0:
+	case 1, 2:
+		column = fields[0]
+		if len(fields) == 2 {
+			direction = strings.ToUpper(fields[1])
+		}
+	default:
+		return "", fmt.Errorf("invalid order by %q", orderBy)
+	}
+	if !jobOrderColumns[column] || (direction != "ASC" && direction != "DESC") {
+		return "", fmt.Errorf("invalid order by %q", orderBy)
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction), nil
+}
+
+// jobColumns lists the jobs table columns in the order scanJob expects them
+const jobColumns = `id, user_id, type, schedule, timezone, one_shot, no_overlap, catch_up,
+	payload, status, retry_count, last_error, next_run, last_run, created_at, updated_at`
+
+// jobColumnUpgrades adds columns introduced after the jobs table was first created
+var jobColumnUpgrades = []struct {
+	name       string
+	definition string
+}{
+	{"timezone", "TEXT NOT NULL DEFAULT ''"},
+	{"one_shot", "INTEGER NOT NULL DEFAULT 0"},
+	{"no_overlap", "INTEGER NOT NULL DEFAULT 0"},
+	{"catch_up", "TEXT NOT NULL DEFAULT ''"},
 }
 
 // SQLiteJobStore implements JobStore using SQLite
@@ -96,6 +200,10 @@ func (s *SQLiteJobStore) Initialize(ctx context.Context) error {
 		user_id TEXT NOT NULL,
 		type TEXT NOT NULL,
 		schedule TEXT NOT NULL,
+		timezone TEXT NOT NULL DEFAULT '',
+		one_shot INTEGER NOT NULL DEFAULT 0,
+		no_overlap INTEGER NOT NULL DEFAULT 0,
+		catch_up TEXT NOT NULL DEFAULT '',
 		payload TEXT NOT NULL,
 		status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed', 'dead')),
 		retry_count INTEGER NOT NULL DEFAULT 0,
@@ -107,12 +215,71 @@ func (s *SQLiteJobStore) Initialize(ctx context.Context) error {
 		UNIQUE(user_id, type, schedule)
 	);
 
-	CREATE INDEX IF NOT EXISTS idx_jobs_next_run ON jobs(next_run) WHERE status = 'pending';
+	DROP INDEX IF EXISTS idx_jobs_next_run;
+	CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(next_run) WHERE ` + waitingJobs + `;
 	CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id);
+
+	CREATE TABLE IF NOT EXISTS job_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		duration_ns INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs(job_id, started_at);
 	`
 
-	_, err := s.db.ExecContext(ctx, schema)
-	return err
+	if _, err := s.db.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+	if err := s.upgradeColumns(ctx); err != nil {
+		return err
+	}
+
+	// Older versions stored next_run with the local UTC offset. Due jobs are
+	// found by comparing the stored text, which only orders correctly in UTC.
+	if _, err := s.db.ExecContext(ctx, `
+	UPDATE jobs SET next_run = strftime('%Y-%m-%d %H:%M:%f+00:00', next_run)
+	WHERE next_run NOT LIKE '%+00:00'
+	`); err != nil {
+		return fmt.Errorf("convert next_run to UTC: %w", err)
+	}
+	return nil
+}
+
+// upgradeColumns adds any missing columns to a jobs table created by an older version
+func (s *SQLiteJobStore) upgradeColumns(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM pragma_table_info('jobs')`)
+	if err != nil {
+		return fmt.Errorf("read jobs columns: %w", err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan jobs column: %w", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate jobs columns: %w", err)
+	}
+
+	for _, col := range jobColumnUpgrades {
+		if existing[col.name] {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE jobs ADD COLUMN %s %s", col.name, col.definition)
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("add jobs column %s: %w", col.name, err)
+		}
+	}
+	return nil
 }
 
 // CreateJob implements JobStore
@@ -136,15 +303,15 @@ func (s *SQLiteJobStore) CreateJob(ctx context.Context, job *Job) error {
 
 	query := `
 	INSERT INTO jobs (
-		id, user_id, type, schedule, payload, status,
+		id, user_id, type, schedule, timezone, one_shot, no_overlap, catch_up, payload, status,
 		retry_count, last_error, next_run, last_run,
 		created_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err = s.db.ExecContext(ctx, query,
-		job.ID, job.UserID, job.Type, job.Schedule, string(payload),
-		job.Status, job.RetryCount, job.LastError, job.NextRun, job.LastRun,
+		job.ID, job.UserID, job.Type, job.Schedule, job.Timezone, job.OneShot, job.NoOverlap, job.CatchUp, string(payload),
+		job.Status, job.RetryCount, job.LastError, job.NextRun.UTC(), job.LastRun,
 		job.CreatedAt, job.UpdatedAt,
 	)
 	if err != nil {
@@ -155,8 +322,24 @@ func (s *SQLiteJobStore) CreateJob(ctx context.Context, job *Job) error {
 
 // GetJob implements JobStore
 func (s *SQLiteJobStore) GetJob(ctx context.Context, id string) (*Job, error) {
-	query := `SELECT * FROM jobs WHERE id = ?`
-	return s.queryJob(ctx, query, id)
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
+	job, err := s.queryJob(ctx, query, id)
+	if errors.Is(err, ErrJobNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return job, err
+}
+
+// jobByKeyQuery looks a job up through the UNIQUE(user_id, type, schedule) index
+const jobByKeyQuery = `SELECT ` + jobColumns + ` FROM jobs WHERE user_id = ? AND type = ? AND schedule = ?`
+
+// GetJobByKey implements JobStore
+func (s *SQLiteJobStore) GetJobByKey(ctx context.Context, userID, jobType, schedule string) (*Job, error) {
+	job, err := s.queryJob(ctx, jobByKeyQuery, userID, jobType, schedule)
+	if errors.Is(err, ErrJobNotFound) {
+		return nil, fmt.Errorf("%w: %s %s %q", ErrJobNotFound, userID, jobType, schedule)
+	}
+	return job, err
 }
 
 // UpdateJob implements JobStore
@@ -169,16 +352,16 @@ func (s *SQLiteJobStore) UpdateJob(ctx context.Context, job *Job) error {
 
 	query := `
 	UPDATE jobs SET
-		user_id = ?, type = ?, schedule = ?, payload = ?,
+		user_id = ?, type = ?, schedule = ?, timezone = ?, one_shot = ?, no_overlap = ?, catch_up = ?, payload = ?,
 		status = ?, retry_count = ?, last_error = ?,
 		next_run = ?, last_run = ?, updated_at = ?
 	WHERE id = ?
 	`
 
 	result, err := s.db.ExecContext(ctx, query,
-		job.UserID, job.Type, job.Schedule, string(payload),
+		job.UserID, job.Type, job.Schedule, job.Timezone, job.OneShot, job.NoOverlap, job.CatchUp, string(payload),
 		job.Status, job.RetryCount, job.LastError,
-		job.NextRun, job.LastRun, job.UpdatedAt,
+		job.NextRun.UTC(), job.LastRun, job.UpdatedAt,
 		job.ID,
 	)
 	if err != nil {
@@ -190,7 +373,7 @@ func (s *SQLiteJobStore) UpdateJob(ctx context.Context, job *Job) error {
 		return fmt.Errorf("get rows affected: %w", err)
 	}
 	if rows == 0 {
-		return fmt.Errorf("job not found: %s", job.ID)
+		return fmt.Errorf("%w: %s", ErrJobNotFound, job.ID)
 	}
 	return nil
 }
@@ -222,15 +405,33 @@ func (s *SQLiteJobStore) ListJobs(ctx context.Context, filter JobFilter) ([]*Job
 			strings.Join(placeholders, ",")))
 	}
 	if !filter.NextRun.IsZero() {
-		conditions = append(conditions, "next_run >= ?")
+		conditions = append(conditions, "next_run <= ?")
 		args = append(args, filter.NextRun)
 	}
+	if !filter.NextRunAfter.IsZero() {
+		conditions = append(conditions, "next_run >= ?")
+		args = append(args, filter.NextRunAfter)
+	}
 
-	query := "SELECT * FROM jobs"
+	order, err := jobOrderClause(filter.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + jobColumns + " FROM jobs"
 	if len(conditions) > 0 {
 		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
-	query += " ORDER BY next_run ASC"
+	query += order
+	if filter.Limit > 0 || filter.Offset > 0 {
+		// SQLite needs a LIMIT for OFFSET; -1 means no limit
+		limit := -1
+		if filter.Limit > 0 {
+			limit = filter.Limit
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, max(filter.Offset, 0))
+	}
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -265,17 +466,140 @@ func (s *SQLiteJobStore) DeleteJob(ctx context.Context, id string) error {
 		return fmt.Errorf("get rows affected: %w", err)
 	}
 	if rows == 0 {
-		return fmt.Errorf("job not found: %s", id)
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
 	}
 	return nil
 }
 
+// waitingJobs matches jobs waiting for their next run: new and completed
+// recurring jobs and failed jobs awaiting a retry. It is the predicate of the
+// idx_jobs_due partial index; queries must repeat it word for word for SQLite
+// to use the index.
+const waitingJobs = `status IN ('pending', 'completed', 'failed')`
+
+// dueJobsQuery selects the jobs due at or before its first argument
+const dueJobsQuery = `SELECT ` + jobColumns + ` FROM jobs
+	WHERE ` + waitingJobs + ` AND next_run <= ? AND next_run > ?
+	ORDER BY next_run ASC
+	LIMIT ?`
+
+// DueJobs implements JobStore. next_run is stored as UTC text, so comparing
+// it directly lets SQLite range-scan idx_jobs_due. A zero next_run marks a
+// job that must not run again.
+func (s *SQLiteJobStore) DueJobs(ctx context.Context, before time.Time, limit int) ([]*Job, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, dueJobsQuery, before.UTC(), time.Time{}, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query due jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := s.scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+	return jobs, nil
+}
+
+// ClaimDueJobs implements JobStore. Each job from DueJobs is claimed with a
+// conditional update, so when two schedulers race for a job only the one
+// whose update changes the row gets it.
+func (s *SQLiteJobStore) ClaimDueJobs(ctx context.Context, now time.Time, limit int) ([]*Job, error) {
+	due, err := s.DueJobs(ctx, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	now = now.UTC()
+
+	var jobs []*Job
+	for _, job := range due {
+		result, err := s.db.ExecContext(ctx,
+			`UPDATE jobs SET status = 'running', last_run = ?, updated_at = ?
+			WHERE id = ? AND `+waitingJobs+` AND next_run <= ? AND next_run > ?`,
+			now, time.Now().UTC(), job.ID, now, time.Time{})
+		if err != nil {
+			return jobs, fmt.Errorf("claim job: %w", err)
+		}
+		claimed, err := result.RowsAffected()
+		if err != nil {
+			return jobs, fmt.Errorf("get rows affected: %w", err)
+		}
+		if claimed == 0 {
+			// Another scheduler got there first
+			continue
+		}
+
+		job, err := s.GetJob(ctx, job.ID)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// NextRunTime implements JobStore
+func (s *SQLiteJobStore) NextRunTime(ctx context.Context) (time.Time, error) {
+	var next time.Time
+	err := s.db.QueryRowContext(ctx, `
+	SELECT next_run FROM jobs
+	WHERE `+waitingJobs+` AND next_run > ?
+	ORDER BY next_run ASC
+	LIMIT 1
+	`, time.Time{}).Scan(&next)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("query next run: %w", err)
+	}
+	return next, nil
+}
+
+// CountJobsByStatus implements JobStore
+func (s *SQLiteJobStore) CountJobsByStatus(ctx context.Context) (map[JobStatus]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("count jobs: %w", err)
+	}
+	return scanStatusCounts(rows)
+}
+
+// scanStatusCounts reads status, count rows and closes them
+func scanStatusCounts(rows *sql.Rows) (map[JobStatus]int, error) {
+	defer rows.Close()
+
+	counts := make(map[JobStatus]int)
+	for rows.Next() {
+		var status JobStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("scan job count: %w", err)
+		}
+		counts[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+	return counts, nil
+}
+
 // scanJob scans a row into a Job struct
 func (s *SQLiteJobStore) scanJob(rows *sql.Rows) (*Job, error) {
 	var job Job
 	var payloadStr string
 	err := rows.Scan(
-		&job.ID, &job.UserID, &job.Type, &job.Schedule,
+		&job.ID, &job.UserID, &job.Type, &job.Schedule, &job.Timezone, &job.OneShot, &job.NoOverlap, &job.CatchUp,
 		&payloadStr, &job.Status, &job.RetryCount, &job.LastError,
 		&job.NextRun, &job.LastRun, &job.CreatedAt, &job.UpdatedAt,
 	)
@@ -299,7 +623,7 @@ func (s *SQLiteJobStore) queryJob(ctx context.Context, query string, args ...int
 	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, fmt.Errorf("job not found")
+		return nil, ErrJobNotFound
 	}
 
 	job, err := s.scanJob(rows)
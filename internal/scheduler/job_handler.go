@@ -2,12 +2,20 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"gmaildigest-go/internal/metrics"
 	"sync"
 	"time"
 )
 
+// ErrJobCancelled is recorded as the error of a job run stopped by Scheduler.CancelJob
+var ErrJobCancelled = errors.New("job cancelled")
+
+// ErrPermanent marks a handler error that retrying cannot fix. A job whose
+// handler returns an error wrapping it is moved straight to the dead state.
+var ErrPermanent = errors.New("permanent failure")
+
 // JobHandler is a function that handles a specific type of job
 type JobHandler func(ctx context.Context, job *Job) error
 
@@ -15,12 +23,14 @@ type JobHandler func(ctx context.Context, job *Job) error
 type JobHandlerRegistry struct {
 	mu       sync.RWMutex
 	handlers map[string]JobHandler
+	backoffs map[string]BackoffStrategy
 }
 
 // NewJobHandlerRegistry creates a new job handler registry
 func NewJobHandlerRegistry() *JobHandlerRegistry {
 	return &JobHandlerRegistry{
 		handlers: make(map[string]JobHandler),
+		backoffs: make(map[string]BackoffStrategy),
 	}
 }
 
@@ -35,6 +45,32 @@ func (r *JobHandlerRegistry) RegisterHandler(jobType string, handler JobHandler)
 	r.handlers[jobType] = handler
 }
 
+// RegisterHandlerWithBackoff registers a handler together with the retry backoff for its job type
+func (r *JobHandlerRegistry) RegisterHandlerWithBackoff(jobType string, handler JobHandler, strategy BackoffStrategy) {
+	if jobType == "" || handler == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[jobType] = handler
+	if strategy != nil {
+		r.backoffs[jobType] = strategy
+	} else {
+		delete(r.backoffs, jobType)
+	}
+}
+
+// GetBackoff returns the backoff strategy for a job type, or DefaultBackoff if none is registered
+func (r *JobHandlerRegistry) GetBackoff(jobType string) BackoffStrategy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if strategy, ok := r.backoffs[jobType]; ok {
+		return strategy
+	}
+	return DefaultBackoff
+}
+
 // GetHandler returns the handler for a job type
 func (r *JobHandlerRegistry) GetHandler(jobType string) JobHandler {
 	r.mu.RLock()
@@ -47,6 +83,7 @@ func (r *JobHandlerRegistry) UnregisterHandler(jobType string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	delete(r.handlers, jobType)
+	delete(r.backoffs, jobType)
 }
 
 // ListHandlerTypes returns a list of registered job types
@@ -67,6 +104,10 @@ type JobTask struct {
 	job       *Job
 	registry  *JobHandlerRegistry
 	scheduler *Scheduler
+	priority  int
+	runCtx    context.Context // cancelled with ErrJobCancelled by Scheduler.CancelJob
+	startedAt time.Time       // set by Execute for the job_runs history
+	duration  time.Duration
 }
 
 // NewJobTask creates a new JobTask
@@ -78,26 +119,51 @@ func NewJobTask(ctx context.Context, job *Job, registry *JobHandlerRegistry) *Jo
 	}
 }
 
+// Priority implements the worker.Prioritized interface
+func (t *JobTask) Priority() int {
+	return t.priority
+}
+
 // Execute implements the worker.Task interface
 func (t *JobTask) Execute(ctx context.Context) error {
 	if t.job == nil {
 		return fmt.Errorf("job cannot be nil")
 	}
+	t.startedAt = t.now().UTC()
 
 	handler := t.registry.GetHandler(t.job.Type)
 	if handler == nil {
 		return fmt.Errorf("no handler registered for job type: %s", t.job.Type)
 	}
 
-	startTime := time.Now()
+	// The handler stops when either the pool shuts down or the job is cancelled
+	if t.runCtx != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(t.runCtx, cancel)
+		defer stop()
+	}
+
+	startTime := t.now()
 	err := handler(ctx, t.job)
-	duration := time.Since(startTime)
+	duration := t.now().Sub(startTime)
+	t.duration = duration
 
 	metrics.JobDuration.WithLabelValues(t.job.Type).Observe(duration.Seconds())
 
 	return err
 }
 
+// now reads the scheduler's clock, or the real time for a task built without
+// a scheduler
+func (t *JobTask) now() time.Time {
+	if t.scheduler == nil {
+		return time.Now()
+	}
+	return t.scheduler.clock.Now()
+}
+
 // OnSuccess implements the worker.Task interface
 func (t *JobTask) OnSuccess() {
 	metrics.JobsInFlight.Dec()
@@ -108,63 +174,127 @@ func (t *JobTask) OnSuccess() {
 
 	t.scheduler.JobMu.Lock()
 	defer t.scheduler.JobMu.Unlock()
+	t.scheduler.endRun(t.job.ID)
 
 	// Update job status
 	t.job.Status = JobStatusCompleted
 	t.job.LastError = ""
 	t.job.RetryCount = 0
 
-	// Calculate next run time based on schedule
-	t.job.NextRun = t.scheduler.nextRunTime(t.job.Schedule)
+	// Calculate next run time based on schedule; one-shot jobs never run again
+	switch {
+	case t.job.OneShot:
+		t.job.NextRun = time.Time{}
+	case t.job.CatchUp == CatchUpAll:
+		// Continue from the run just made, so each missed run is made in turn
+		t.job.NextRun = t.scheduler.nextRunAfter(t.job, t.job.NextRun)
+	default:
+		t.job.NextRun = t.scheduler.nextRunTime(t.job)
+	}
+	if !t.job.OneShot && t.job.NextRun.IsZero() {
+		// The schedule has no run left, so the job cannot run again
+		t.job.Status = JobStatusDead
+		t.job.LastError = ErrImpossibleSchedule.Error()
+	}
 
 	// Persist changes
-	if err := t.scheduler.store.UpdateJob(t.ctx, t.job); err != nil {
-		// Log error but continue
-		fmt.Printf("Failed to update job status: %v\n", err)
+	if t.saveJob() {
+		t.recordRun(JobStatusCompleted, "")
+		if hook := t.scheduler.onDeadLetter; hook != nil && t.job.Status == JobStatusDead {
+			job := *t.job
+			go hook(&job)
+		}
 	}
 
-	// Update in-memory job
-	t.scheduler.Jobs[t.job.ID] = t.job
 	t.scheduler.signalCronWakeup()
 }
 
 // OnFailure implements the worker.Task interface
 func (t *JobTask) OnFailure(err error) {
+	cancelled := t.runCtx != nil && errors.Is(context.Cause(t.runCtx), ErrJobCancelled)
+	permanent := errors.Is(err, ErrPermanent)
 	metrics.JobsInFlight.Dec()
 	metrics.JobsFailed.WithLabelValues(t.job.Type).Inc()
-	metrics.JobRetries.WithLabelValues(t.job.Type).Inc()
+	if !cancelled && !permanent {
+		metrics.JobRetries.WithLabelValues(t.job.Type).Inc()
+	}
 	if t.scheduler == nil {
 		return
 	}
 
 	t.scheduler.JobMu.Lock()
 	defer t.scheduler.JobMu.Unlock()
+	t.scheduler.endRun(t.job.ID)
 
-	// Update job status
-	t.job.Status = JobStatusFailed
-	t.job.LastError = err.Error()
-	t.job.RetryCount++
+	if cancelled {
+		// A cancelled run is not retried; the job waits for its next scheduled run
+		t.job.Status = JobStatusFailed
+		t.job.LastError = ErrJobCancelled.Error()
+		if t.job.OneShot {
+			t.job.NextRun = time.Time{}
+		} else {
+			t.job.NextRun = t.scheduler.nextRunTime(t.job)
+		}
+	} else {
+		// Update job status
+		t.job.Status = JobStatusFailed
+		t.job.LastError = err.Error()
+		t.job.RetryCount++
 
-	// Calculate retry delay using exponential backoff
-	delay := time.Duration(t.job.RetryCount*t.job.RetryCount) * time.Minute
-	if delay > 24*time.Hour {
-		delay = 24 * time.Hour
-	}
-	t.job.NextRun = time.Now().Add(delay)
+		// Calculate retry delay using the job type's backoff strategy
+		delay := t.registry.GetBackoff(t.job.Type).NextDelay(t.job.RetryCount)
+		t.job.NextRun = t.scheduler.clock.Now().Add(delay)
 
-	// Check if max retries exceeded
-	if t.job.RetryCount >= 5 { // Max 5 retries
-		t.job.Status = JobStatusFailed
-		t.job.NextRun = time.Time{} // Zero time indicates no more retries
+		// Move to the dead letter state once retries are exhausted or cannot help
+		if permanent || t.job.RetryCount >= t.scheduler.maxRetries {
+			t.job.Status = JobStatusDead
+			t.job.NextRun = time.Time{} // Zero time indicates no more retries
+		}
 	}
 
 	// Persist changes
-	if err := t.scheduler.store.UpdateJob(t.ctx, t.job); err != nil {
-		// Log error but continue
-		fmt.Printf("Failed to update job status: %v\n", err)
+	if t.saveJob() {
+		t.recordRun(JobStatusFailed, t.job.LastError)
+		if hook := t.scheduler.onDeadLetter; hook != nil && t.job.Status == JobStatusDead {
+			job := *t.job
+			go hook(&job)
+		}
 	}
 
-	// Update in-memory job
-	t.scheduler.Jobs[t.job.ID] = t.job
 	t.scheduler.signalCronWakeup()
-} 
\ No newline at end of file
+}
+
+// saveJob persists the job's state after a run. It returns false when the
+// job was deleted while it ran, leaving no job to record the run against.
+func (t *JobTask) saveJob() bool {
+	err := t.scheduler.store.UpdateJob(t.ctx, t.job)
+	if errors.Is(err, ErrJobNotFound) {
+		return false
+	}
+	if err != nil {
+		// Log error but continue
+		t.scheduler.logger.Error("Failed to update job status", "job", t.job.ID, "error", err)
+	}
+	return true
+}
+
+// recordRun appends this execution to the job's run history
+func (t *JobTask) recordRun(status JobStatus, errMsg string) {
+	finished := t.scheduler.clock.Now().UTC()
+	started := t.startedAt
+	if started.IsZero() {
+		started = finished
+	}
+	run := &JobRun{
+		JobID:      t.job.ID,
+		StartedAt:  started,
+		FinishedAt: finished,
+		Status:     status,
+		Error:      errMsg,
+		Duration:   t.duration,
+	}
+	if err := t.scheduler.store.RecordJobRun(t.ctx, run); err != nil {
+		// Log error but continue
+		t.scheduler.logger.Error("Failed to record job run", "job", t.job.ID, "error", err)
+	}
+}
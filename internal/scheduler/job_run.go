@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// JobRun records a single execution attempt of a job
+type JobRun struct {
+	ID         int64         `json:"id"`
+	JobID      string        `json:"job_id"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Status     JobStatus     `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// jobRunColumns lists the job_runs columns in the order scanJobRuns expects them
+const jobRunColumns = `id, job_id, started_at, finished_at, status, error, duration_ns`
+
+// RecordJobRun implements JobStore
+func (s *SQLiteJobStore) RecordJobRun(ctx context.Context, run *JobRun) error {
+	query := `
+	INSERT INTO job_runs (job_id, started_at, finished_at, status, error, duration_ns)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.db.ExecContext(ctx, query,
+		run.JobID, run.StartedAt, run.FinishedAt, run.Status, run.Error, int64(run.Duration),
+	)
+	if err != nil {
+		return fmt.Errorf("insert job run: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get job run id: %w", err)
+	}
+	run.ID = id
+	return nil
+}
+
+// ListJobRuns implements JobStore
+func (s *SQLiteJobStore) ListJobRuns(ctx context.Context, jobID string, limit int) ([]JobRun, error) {
+	query := `SELECT ` + jobRunColumns + ` FROM job_runs WHERE job_id = ? ORDER BY started_at DESC, id DESC`
+	args := []interface{}{jobID}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query job runs: %w", err)
+	}
+	return scanJobRuns(rows)
+}
+
+// scanJobRuns reads every job run from rows and closes them
+func scanJobRuns(rows *sql.Rows) ([]JobRun, error) {
+	defer rows.Close()
+
+	var runs []JobRun
+	for rows.Next() {
+		var run JobRun
+		var durationNS int64
+		err := rows.Scan(&run.ID, &run.JobID, &run.StartedAt, &run.FinishedAt,
+			&run.Status, &run.Error, &durationNS)
+		if err != nil {
+			return nil, fmt.Errorf("scan job run: %w", err)
+		}
+		run.Duration = time.Duration(durationNS)
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+	return runs, nil
+}
+
+// GetJobRuns returns the execution history of a job, most recent first. A
+// limit of 0 or less returns every run.
+func (s *Scheduler) GetJobRuns(ctx context.Context, jobID string, limit int) ([]JobRun, error) {
+	return s.store.ListJobRuns(ctx, jobID, limit)
+}
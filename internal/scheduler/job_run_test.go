@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"gmaildigest-go/internal/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_GetJobRuns(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+
+	fail := false
+	scheduler.RegisterHandler("test", func(ctx context.Context, job *Job) error {
+		time.Sleep(5 * time.Millisecond)
+		if fail {
+			return errors.New("token expired")
+		}
+		return nil
+	})
+
+	job, err := scheduler.ScheduleJob("user1", "test", "0 * * * *", nil)
+	require.NoError(t, err)
+
+	// run executes the job the way the worker pool does
+	run := func() {
+		task := NewJobTask(ctx, job, scheduler.registry)
+		task.scheduler = scheduler
+		if err := task.Execute(ctx); err != nil {
+			task.OnFailure(err)
+		} else {
+			task.OnSuccess()
+		}
+	}
+
+	before := time.Now()
+	run()
+	fail = true
+	run()
+
+	runs, err := scheduler.GetJobRuns(ctx, job.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+
+	// Most recent first
+	failed, succeeded := runs[0], runs[1]
+
+	assert.Equal(t, job.ID, succeeded.JobID)
+	assert.Equal(t, JobStatusCompleted, succeeded.Status)
+	assert.Empty(t, succeeded.Error)
+	assert.False(t, succeeded.StartedAt.Before(before.Add(-time.Second)))
+	assert.False(t, succeeded.FinishedAt.Before(succeeded.StartedAt))
+	assert.GreaterOrEqual(t, succeeded.Duration, 5*time.Millisecond)
+
+	assert.Equal(t, job.ID, failed.JobID)
+	assert.Equal(t, JobStatusFailed, failed.Status)
+	assert.Equal(t, "token expired", failed.Error)
+	assert.False(t, failed.StartedAt.Before(succeeded.StartedAt))
+	assert.GreaterOrEqual(t, failed.Duration, 5*time.Millisecond)
+
+	limited, err := scheduler.GetJobRuns(ctx, job.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, limited, 1)
+	assert.Equal(t, failed.ID, limited[0].ID)
+
+	none, err := scheduler.GetJobRuns(ctx, "missing", 10)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func TestScheduler_DeletedDuringRunRecordsNoRun(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+
+	job, err := scheduler.ScheduleJob("user1", "test", "0 * * * *", nil)
+	require.NoError(t, err)
+	scheduler.RegisterHandler("test", func(ctx context.Context, j *Job) error {
+		return scheduler.DeleteJob(ctx, j.ID)
+	})
+
+	task := NewJobTask(ctx, job, scheduler.registry)
+	task.scheduler = scheduler
+	require.NoError(t, task.Execute(ctx))
+	task.OnSuccess()
+
+	_, err = scheduler.GetJob(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	runs, err := scheduler.GetJobRuns(ctx, job.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
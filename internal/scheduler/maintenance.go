@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// MaintenanceJobType is the recurring job that prunes old data and compacts
+// the database
+const MaintenanceJobType = "maintenance"
+
+// MaintenanceUserID owns the maintenance and backup jobs, which belong to no user
+const MaintenanceUserID = "system"
+
+// DefaultMaintenanceSchedule runs maintenance daily at 03:00 UTC
+const DefaultMaintenanceSchedule = "0 3 * * *"
+
+// DefaultProcessedEmailRetention is how long processed email records are kept
+// when no retention period is configured
+const DefaultProcessedEmailRetention = 30 * 24 * time.Hour
+
+// MaintenanceStorage defines the cleanup operations run by the MaintenanceJob.
+// It is implemented by storage.SQLiteStorage.
+type MaintenanceStorage interface {
+	CleanupProcessedEmails(ctx context.Context, retentionPeriod time.Duration) (int64, error)
+	CleanupInvalidTokens(ctx context.Context) (int64, error)
+	CleanupInactiveUsers(ctx context.Context, inactivityPeriod time.Duration) (int64, error)
+	Vacuum(ctx context.Context) error
+}
+
+// MaintenanceConfig sets how long data is kept. A zero period skips that cleanup.
+type MaintenanceConfig struct {
+	// ProcessedEmailRetention is how long processed email records are kept
+	ProcessedEmailRetention time.Duration
+	// InactiveUserRetention is how long a user may go without activity
+	// before the account and its token are deleted
+	InactiveUserRetention time.Duration
+}
+
+// MaintenanceJob removes expired data and then vacuums the database
+type MaintenanceJob struct {
+	logger  *slog.Logger
+	storage MaintenanceStorage
+	config  MaintenanceConfig
+}
+
+// NewMaintenanceJob creates a new MaintenanceJob
+func NewMaintenanceJob(logger *slog.Logger, storage MaintenanceStorage, config MaintenanceConfig) *MaintenanceJob {
+	return &MaintenanceJob{
+		logger:  logger,
+		storage: storage,
+		config:  config,
+	}
+}
+
+// HandleMaintenance handles a maintenance job. A failed cleanup does not stop
+// the others; the database is only vacuumed when every cleanup succeeded.
+func (m *MaintenanceJob) HandleMaintenance(ctx context.Context, job *Job) error {
+	if job == nil {
+		return fmt.Errorf("job cannot be nil")
+	}
+
+	var errs []error
+	cleanup := func(name string, run func() (int64, error)) {
+		deleted, err := run()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to clean up %s: %w", name, err))
+			return
+		}
+		m.logger.Info("Maintenance deleted rows", "table", name, "count", deleted)
+	}
+
+	if retention := m.config.ProcessedEmailRetention; retention > 0 {
+		cleanup("processed emails", func() (int64, error) {
+			return m.storage.CleanupProcessedEmails(ctx, retention)
+		})
+	}
+	cleanup("invalid tokens", func() (int64, error) {
+		return m.storage.CleanupInvalidTokens(ctx)
+	})
+	if retention := m.config.InactiveUserRetention; retention > 0 {
+		cleanup("inactive users", func() (int64, error) {
+			return m.storage.CleanupInactiveUsers(ctx, retention)
+		})
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if err := m.storage.Vacuum(ctx); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
+// ScheduleMaintenance schedules the maintenance job on the given cron
+// schedule, replacing a maintenance job left from a different schedule
+func (s *Scheduler) ScheduleMaintenance(ctx context.Context, schedule string) error {
+	return s.scheduleSystemJob(ctx, MaintenanceJobType, schedule)
+}
+
+// scheduleSystemJob schedules a recurring job owned by MaintenanceUserID,
+// replacing any job of the same type left from a different schedule
+func (s *Scheduler) scheduleSystemJob(ctx context.Context, jobType, schedule string) error {
+	if schedule == "" {
+		return fmt.Errorf("schedule cannot be empty")
+	}
+	if _, err := ParseSchedule(schedule); err != nil {
+		return err
+	}
+
+	existing, err := s.store.ListJobs(ctx, JobFilter{UserID: MaintenanceUserID, Type: jobType})
+	if err != nil {
+		return fmt.Errorf("failed to list %s jobs: %w", jobType, err)
+	}
+	for _, job := range existing {
+		if job.Schedule == schedule {
+			continue
+		}
+		// Another instance may have replaced it already
+		if err := s.DeleteJob(ctx, job.ID); err != nil && !errors.Is(err, ErrJobNotFound) {
+			return fmt.Errorf("failed to replace %s job: %w", jobType, err)
+		}
+	}
+
+	_, err = s.ScheduleJob(MaintenanceUserID, jobType, schedule, nil)
+	return err
+}
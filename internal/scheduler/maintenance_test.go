@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gmaildigest-go/internal/worker"
+)
+
+// mockMaintenanceStorage records the cleanups it was asked to run
+type mockMaintenanceStorage struct {
+	calls      []string
+	retentions map[string]time.Duration
+	failEmails bool
+}
+
+func (m *mockMaintenanceStorage) CleanupProcessedEmails(ctx context.Context, retentionPeriod time.Duration) (int64, error) {
+	m.calls = append(m.calls, "emails")
+	m.retentions["emails"] = retentionPeriod
+	if m.failEmails {
+		return 0, errors.New("disk I/O error")
+	}
+	return 3, nil
+}
+
+func (m *mockMaintenanceStorage) CleanupInvalidTokens(ctx context.Context) (int64, error) {
+	m.calls = append(m.calls, "tokens")
+	return 1, nil
+}
+
+func (m *mockMaintenanceStorage) CleanupInactiveUsers(ctx context.Context, inactivityPeriod time.Duration) (int64, error) {
+	m.calls = append(m.calls, "users")
+	m.retentions["users"] = inactivityPeriod
+	return 0, nil
+}
+
+func (m *mockMaintenanceStorage) Vacuum(ctx context.Context) error {
+	m.calls = append(m.calls, "vacuum")
+	return nil
+}
+
+func TestMaintenanceJob_HandleMaintenance(t *testing.T) {
+	db := &mockMaintenanceStorage{retentions: make(map[string]time.Duration)}
+	var logs bytes.Buffer
+	job := NewMaintenanceJob(slog.New(slog.NewTextHandler(&logs, nil)), db, MaintenanceConfig{
+		ProcessedEmailRetention: 30 * 24 * time.Hour,
+		InactiveUserRetention:   365 * 24 * time.Hour,
+	})
+
+	require.NoError(t, job.HandleMaintenance(context.Background(), &Job{ID: "1"}))
+	assert.Equal(t, []string{"emails", "tokens", "users", "vacuum"}, db.calls)
+	assert.Equal(t, 30*24*time.Hour, db.retentions["emails"])
+	assert.Equal(t, 365*24*time.Hour, db.retentions["users"])
+	assert.Contains(t, logs.String(), `table="processed emails" count=3`)
+	assert.Contains(t, logs.String(), `table="invalid tokens" count=1`)
+
+	assert.Error(t, job.HandleMaintenance(context.Background(), nil))
+}
+
+func TestMaintenanceJob_HandleMaintenance_SkipsAndFailures(t *testing.T) {
+	db := &mockMaintenanceStorage{retentions: make(map[string]time.Duration), failEmails: true}
+	job := NewMaintenanceJob(slog.New(slog.DiscardHandler), db, MaintenanceConfig{
+		ProcessedEmailRetention: time.Hour,
+	})
+
+	// Inactive users are kept without a retention period, the remaining
+	// cleanups still run after a failure, and vacuum waits for a clean pass
+	err := job.HandleMaintenance(context.Background(), &Job{ID: "1"})
+	assert.ErrorContains(t, err, "processed emails")
+	assert.Equal(t, []string{"emails", "tokens"}, db.calls)
+}
+
+func TestScheduler_ScheduleMaintenance(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	assert.Error(t, scheduler.ScheduleMaintenance(ctx, ""))
+	assert.Error(t, scheduler.ScheduleMaintenance(ctx, "not a cron"))
+
+	require.NoError(t, scheduler.ScheduleMaintenance(ctx, "0 3 * * *"))
+	require.NoError(t, scheduler.ScheduleMaintenance(ctx, "0 3 * * *"))
+	require.NoError(t, scheduler.ScheduleMaintenance(ctx, "30 4 * * 0"))
+
+	// A changed schedule replaces the old job instead of adding another
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{Type: MaintenanceJobType})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, MaintenanceUserID, jobs[0].UserID)
+	assert.Equal(t, "30 4 * * 0", jobs[0].Schedule)
+}
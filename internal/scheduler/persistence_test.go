@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -123,6 +126,84 @@ func TestSQLiteJobStore_UpdateJob(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestSQLiteJobStore_Timezone(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+
+	job := createTestJob("user1", "test")
+	job.Timezone = "Europe/Berlin"
+	require.NoError(t, store.CreateJob(context.Background(), job))
+
+	saved, err := store.GetJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Berlin", saved.Timezone)
+
+	job.Timezone = "Asia/Tokyo"
+	require.NoError(t, store.UpdateJob(context.Background(), job))
+	saved, err = store.GetJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", saved.Timezone)
+}
+
+func TestSQLiteJobStore_OneShot(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+
+	job := createTestJob("user1", "test")
+	job.OneShot = true
+	require.NoError(t, store.CreateJob(context.Background(), job))
+
+	saved, err := store.GetJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.True(t, saved.OneShot)
+
+	job.Status = JobStatusCompleted
+	job.NextRun = time.Time{}
+	require.NoError(t, store.UpdateJob(context.Background(), job))
+	saved, err = store.GetJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.True(t, saved.NextRun.IsZero())
+}
+
+func TestSQLiteJobStore_UpgradesLegacySchema(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Jobs table as created before the timezone column existed
+	_, err = db.Exec(`
+	CREATE TABLE jobs (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		schedule TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		retry_count INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_run DATETIME NOT NULL,
+		last_run DATETIME,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		UNIQUE(user_id, type, schedule)
+	)`)
+	require.NoError(t, err)
+
+	store := NewSQLiteJobStore(db)
+	require.NoError(t, store.Initialize(context.Background()))
+
+	job := createTestJob("user1", "test")
+	job.Timezone = "Europe/Berlin"
+	job.NoOverlap = true
+	job.CatchUp = CatchUpAll
+	require.NoError(t, store.CreateJob(context.Background(), job))
+	saved, err := store.GetJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Berlin", saved.Timezone)
+	assert.True(t, saved.NoOverlap)
+	assert.Equal(t, CatchUpAll, saved.CatchUp)
+}
+
 func TestSQLiteJobStore_ListJobs(t *testing.T) {
 	db, store := setupTestDB(t)
 	defer db.Close()
@@ -198,6 +279,77 @@ func TestSQLiteJobStore_ListJobs(t *testing.T) {
 	}
 }
 
+func TestSQLiteJobStore_ListJobs_PagingAndOrder(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	// next_run ascends with i while created_at descends
+	var ids []string
+	for i := 0; i < 5; i++ {
+		job := createTestJob(fmt.Sprintf("user%d", i), "test")
+		job.NextRun = now.Add(time.Duration(i+1) * time.Minute)
+		job.CreatedAt = now.Add(-time.Duration(i+1) * time.Hour)
+		require.NoError(t, store.CreateJob(ctx, job))
+		ids = append(ids, job.ID)
+	}
+	// Touch the jobs so updated_at ascends in the order 3, 1, 4, 0, 2
+	for _, i := range []int{3, 1, 4, 0, 2} {
+		job, err := store.GetJob(ctx, ids[i])
+		require.NoError(t, err)
+		require.NoError(t, store.UpdateJob(ctx, job))
+		time.Sleep(time.Millisecond)
+	}
+
+	jobIDs := func(jobs []*Job) []string {
+		out := make([]string, len(jobs))
+		for i, job := range jobs {
+			out[i] = job.ID
+		}
+		return out
+	}
+	pick := func(order ...int) []string {
+		out := make([]string, len(order))
+		for i, n := range order {
+			out[i] = ids[n]
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		filter JobFilter
+		want   []string
+	}{
+		{"default order", JobFilter{}, pick(0, 1, 2, 3, 4)},
+		{"first page", JobFilter{Limit: 2}, pick(0, 1)},
+		{"second page", JobFilter{Limit: 2, Offset: 2}, pick(2, 3)},
+		{"last page", JobFilter{Limit: 2, Offset: 4}, pick(4)},
+		{"offset only", JobFilter{Offset: 3}, pick(3, 4)},
+		{"past the end", JobFilter{Limit: 2, Offset: 10}, pick()},
+		{"next_run desc", JobFilter{OrderBy: "next_run desc"}, pick(4, 3, 2, 1, 0)},
+		{"created_at asc", JobFilter{OrderBy: "created_at"}, pick(4, 3, 2, 1, 0)},
+		{"created_at desc", JobFilter{OrderBy: "created_at DESC", Limit: 2}, pick(0, 1)},
+		{"updated_at asc", JobFilter{OrderBy: "updated_at asc"}, pick(3, 1, 4, 0, 2)},
+		{"updated_at desc", JobFilter{OrderBy: "updated_at desc", Limit: 3, Offset: 1}, pick(0, 4, 1)},
+		{"next run window", JobFilter{NextRunAfter: now.Add(2 * time.Minute), NextRun: now.Add(4 * time.Minute)}, pick(1, 2, 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.ListJobs(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, jobIDs(got))
+		})
+	}
+
+	for _, orderBy := range []string{"id", "next_run sideways", "next_run asc id", "user_id; DROP TABLE jobs"} {
+		_, err := store.ListJobs(ctx, JobFilter{OrderBy: orderBy})
+		assert.Error(t, err, orderBy)
+	}
+}
+
 func TestSQLiteJobStore_DeleteJob(t *testing.T) {
 	db, store := setupTestDB(t)
 	defer db.Close()
@@ -213,11 +365,55 @@ func TestSQLiteJobStore_DeleteJob(t *testing.T) {
 
 	// Verify job was deleted
 	_, err = store.GetJob(context.Background(), job.ID)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrJobNotFound)
 
 	// Test deleting non-existent job
 	err = store.DeleteJob(context.Background(), "non-existent")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestSQLiteJobStore_GetJobByKey(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	job := createTestJob("user1", "digest")
+	require.NoError(t, store.CreateJob(ctx, job))
+	require.NoError(t, store.CreateJob(ctx, createTestJob("user2", "digest")))
+
+	got, err := store.GetJobByKey(ctx, "user1", "digest", job.Schedule)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, got.ID)
+
+	_, err = store.GetJobByKey(ctx, "user1", "digest", "0 8 * * *")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	_, err = store.GetJobByKey(ctx, "user3", "digest", job.Schedule)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	// A single lookup of the unique index rather than a scan
+	var id, parent, notUsed int
+	var detail string
+	require.NoError(t, db.QueryRow("EXPLAIN QUERY PLAN "+jobByKeyQuery, "user1", "digest", job.Schedule).
+		Scan(&id, &parent, &notUsed, &detail))
+	assert.Contains(t, detail, "SEARCH jobs USING INDEX sqlite_autoindex_jobs")
+}
+
+func TestSQLiteJobStore_NotFound(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	_, err := store.GetJob(ctx, "missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.ErrorContains(t, err, "missing")
+
+	assert.ErrorIs(t, store.UpdateJob(ctx, createTestJob("user1", "test")), ErrJobNotFound)
+
+	// A closed database is a real failure, not a missing job
+	require.NoError(t, db.Close())
+	_, err = store.GetJob(ctx, "missing")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrJobNotFound)
 }
 
 func TestSQLiteJobStore_DeadLetterHandling(t *testing.T) {
@@ -258,6 +454,167 @@ func TestSQLiteJobStore_DeadLetterHandling(t *testing.T) {
 	assert.Equal(t, job.ID, deadJobs[0].ID)
 }
 
+func TestSQLiteJobStore_ClaimDueJobs(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	due := createTestJob("user1", "due")
+	due.NextRun = now.Add(-time.Minute)
+	retry := createTestJob("user1", "retry")
+	retry.Status = JobStatusFailed
+	retry.NextRun = now.Add(-time.Second)
+	future := createTestJob("user1", "future")
+	finished := createTestJob("user1", "finished")
+	finished.Status = JobStatusCompleted
+	finished.NextRun = time.Time{}
+	for _, job := range []*Job{due, retry, future, finished} {
+		require.NoError(t, store.CreateJob(ctx, job))
+	}
+
+	claimed, err := store.ClaimDueJobs(ctx, now, 1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, due.ID, claimed[0].ID)
+	assert.Equal(t, JobStatusRunning, claimed[0].Status)
+	require.NotNil(t, claimed[0].LastRun)
+
+	claimed, err = store.ClaimDueJobs(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, retry.ID, claimed[0].ID)
+
+	// Running, future and finished jobs are never claimed
+	claimed, err = store.ClaimDueJobs(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+func TestSQLiteJobStore_ClaimDueJobs_Race(t *testing.T) {
+	// Two stores on separate connections stand in for two server instances
+	dsn := filepath.Join(t.TempDir(), "jobs.db") + "?_busy_timeout=5000"
+	var stores []*SQLiteJobStore
+	for i := 0; i < 2; i++ {
+		db, err := sql.Open("sqlite3", dsn)
+		require.NoError(t, err)
+		defer db.Close()
+		store := NewSQLiteJobStore(db)
+		require.NoError(t, store.Initialize(context.Background()))
+		stores = append(stores, store)
+	}
+	ctx := context.Background()
+
+	for round := 0; round < 20; round++ {
+		now := time.Now().UTC()
+		job := createTestJob(fmt.Sprintf("user%d", round), "race")
+		job.NextRun = now.Add(-time.Second)
+		require.NoError(t, stores[0].CreateJob(ctx, job))
+
+		var wg sync.WaitGroup
+		results := make([][]*Job, len(stores))
+		start := make(chan struct{})
+		for i, store := range stores {
+			wg.Add(1)
+			go func(i int, store *SQLiteJobStore) {
+				defer wg.Done()
+				<-start
+				claimed, err := store.ClaimDueJobs(ctx, now, 10)
+				assert.NoError(t, err)
+				results[i] = claimed
+			}(i, store)
+		}
+		close(start)
+		wg.Wait()
+
+		assert.Equal(t, 1, len(results[0])+len(results[1]), "round %d: job must be claimed exactly once", round)
+	}
+}
+
+func TestSQLiteJobStore_DueJobs(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	later := createTestJob("user1", "later")
+	later.NextRun = now.Add(-time.Second)
+	earlier := createTestJob("user1", "earlier")
+	earlier.Status = JobStatusCompleted
+	// Stored with another offset, but still ordered by instant
+	earlier.NextRun = now.Add(-time.Hour).In(time.FixedZone("UTC+5", 5*60*60))
+	running := createTestJob("user1", "running")
+	running.Status = JobStatusRunning
+	running.NextRun = now.Add(-time.Minute)
+	future := createTestJob("user1", "future")
+	finished := createTestJob("user1", "finished")
+	finished.Status = JobStatusCompleted
+	finished.NextRun = time.Time{}
+	for _, job := range []*Job{later, earlier, running, future, finished} {
+		require.NoError(t, store.CreateJob(ctx, job))
+	}
+
+	due, err := store.DueJobs(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, earlier.ID, due[0].ID)
+	assert.Equal(t, later.ID, due[1].ID)
+
+	due, err = store.DueJobs(ctx, now, 1)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, earlier.ID, due[0].ID)
+
+	// DueJobs does not claim anything
+	saved, err := store.GetJob(ctx, earlier.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusCompleted, saved.Status)
+}
+
+func TestSQLiteJobStore_DueJobsUsesIndex(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+dueJobsQuery, time.Now().UTC(), time.Time{}, 10)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		require.NoError(t, rows.Scan(&id, &parent, &notUsed, &detail))
+		plan = append(plan, detail)
+	}
+	require.NoError(t, rows.Err())
+
+	// A range search of the partial index, already in next_run order
+	require.Len(t, plan, 1, "plan: %v", plan)
+	assert.Contains(t, plan[0], "SEARCH jobs USING INDEX idx_jobs_due")
+}
+
+func TestSQLiteJobStore_ConvertsNextRunToUTC(t *testing.T) {
+	db, store := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// A row written by an older version in local time
+	job := createTestJob("user1", "legacy")
+	require.NoError(t, store.CreateJob(ctx, job))
+	_, err := db.Exec(`UPDATE jobs SET next_run = '2024-01-02 11:00:00+02:00' WHERE id = ?`, job.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Initialize(ctx))
+
+	var stored string
+	require.NoError(t, db.QueryRow(`SELECT CAST(next_run AS TEXT) FROM jobs WHERE id = ?`, job.ID).Scan(&stored))
+	assert.Equal(t, "2024-01-02 09:00:00.000+00:00", stored)
+
+	saved, err := store.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.True(t, saved.NextRun.Equal(time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)))
+}
+
 // Test: Job persistence - saving jobs to database
 func TestPersistence_SaveJobs(t *testing.T) {
 	// TODO: Test that jobs are saved to the database correctly
@@ -0,0 +1,395 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq" // registers the "postgres" driver
+)
+
+// PostgresJobStore implements JobStore using PostgreSQL for deployments where
+// several scheduler instances share one database
+type PostgresJobStore struct {
+	db *sql.DB
+}
+
+// NewPostgresJobStore creates a new PostgreSQL-backed job store
+func NewPostgresJobStore(db *sql.DB) *PostgresJobStore {
+	return &PostgresJobStore{db: db}
+}
+
+// Initialize implements JobStore
+func (s *PostgresJobStore) Initialize(ctx context.Context) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		schedule TEXT NOT NULL,
+		timezone TEXT NOT NULL DEFAULT '',
+		one_shot BOOLEAN NOT NULL DEFAULT FALSE,
+		no_overlap BOOLEAN NOT NULL DEFAULT FALSE,
+		catch_up TEXT NOT NULL DEFAULT '',
+		payload JSONB NOT NULL,
+		status TEXT NOT NULL,
+		retry_count INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_run TIMESTAMPTZ NOT NULL,
+		last_run TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		CONSTRAINT jobs_status_check CHECK (status IN ('pending', 'running', 'completed', 'failed', 'dead')),
+		CONSTRAINT jobs_user_type_schedule_key UNIQUE (user_id, type, schedule)
+	);
+
+	DROP INDEX IF EXISTS idx_jobs_next_run;
+	CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(next_run) WHERE ` + waitingJobs + `;
+	CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id);
+
+	CREATE TABLE IF NOT EXISTS job_runs (
+		id BIGSERIAL PRIMARY KEY,
+		job_id TEXT NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		duration_ns BIGINT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs(job_id, started_at);
+	`
+
+	if _, err := s.db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("create jobs schema: %w", err)
+	}
+
+	// Postgres can add missing columns idempotently, so no catalog lookup is needed
+	upgrades := []struct {
+		name       string
+		definition string
+	}{
+		{"timezone", "TEXT NOT NULL DEFAULT ''"},
+		{"one_shot", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"no_overlap", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"catch_up", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, col := range upgrades {
+		stmt := fmt.Sprintf("ALTER TABLE jobs ADD COLUMN IF NOT EXISTS %s %s", col.name, col.definition)
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("add jobs column %s: %w", col.name, err)
+		}
+	}
+	return nil
+}
+
+// CreateJob implements JobStore
+func (s *PostgresJobStore) CreateJob(ctx context.Context, job *Job) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	if job.Status == "" {
+		job.Status = JobStatusPending
+	}
+	now := time.Now().UTC()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	job.UpdatedAt = now
+
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+
+	query := `
+	INSERT INTO jobs (
+		id, user_id, type, schedule, timezone, one_shot, no_overlap, catch_up, payload, status,
+		retry_count, last_error, next_run, last_run,
+		created_at, updated_at
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`
+
+	_, err = s.db.ExecContext(ctx, query,
+		job.ID, job.UserID, job.Type, job.Schedule, job.Timezone, job.OneShot, job.NoOverlap, job.CatchUp, string(payload),
+		job.Status, job.RetryCount, job.LastError, job.NextRun, job.LastRun,
+		job.CreatedAt, job.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert job: %w", err)
+	}
+	return nil
+}
+
+// GetJob implements JobStore
+func (s *PostgresJobStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query job: %w", err)
+	}
+	jobs, err := scanPostgresJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return jobs[0], nil
+}
+
+// GetJobByKey implements JobStore
+func (s *PostgresJobStore) GetJobByKey(ctx context.Context, userID, jobType, schedule string) (*Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs
+	WHERE user_id = $1 AND type = $2 AND schedule = $3`, userID, jobType, schedule)
+	if err != nil {
+		return nil, fmt.Errorf("query job: %w", err)
+	}
+	jobs, err := scanPostgresJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%w: %s %s %q", ErrJobNotFound, userID, jobType, schedule)
+	}
+	return jobs[0], nil
+}
+
+// UpdateJob implements JobStore
+func (s *PostgresJobStore) UpdateJob(ctx context.Context, job *Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+
+	query := `
+	UPDATE jobs SET
+		user_id = $1, type = $2, schedule = $3, timezone = $4, one_shot = $5, no_overlap = $6,
+		catch_up = $7, payload = $8, status = $9, retry_count = $10, last_error = $11,
+		next_run = $12, last_run = $13, updated_at = $14
+	WHERE id = $15
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		job.UserID, job.Type, job.Schedule, job.Timezone, job.OneShot, job.NoOverlap, job.CatchUp, string(payload),
+		job.Status, job.RetryCount, job.LastError,
+		job.NextRun, job.LastRun, job.UpdatedAt,
+		job.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update job: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, job.ID)
+	}
+	return nil
+}
+
+// ListJobs implements JobStore
+func (s *PostgresJobStore) ListJobs(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	var conditions []string
+	var args []interface{}
+
+	// arg appends a value and returns its positional placeholder
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = "+arg(filter.UserID))
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "type = "+arg(filter.Type))
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = "+arg(filter.Status))
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = arg(status)
+		}
+		conditions = append(conditions, fmt.Sprintf("status IN (%s)",
+			strings.Join(placeholders, ",")))
+	}
+	if !filter.NextRun.IsZero() {
+		conditions = append(conditions, "next_run <= "+arg(filter.NextRun))
+	}
+	if !filter.NextRunAfter.IsZero() {
+		conditions = append(conditions, "next_run >= "+arg(filter.NextRunAfter))
+	}
+
+	order, err := jobOrderClause(filter.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + jobColumns + " FROM jobs"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += order
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += " OFFSET " + arg(filter.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query jobs: %w", err)
+	}
+	return scanPostgresJobs(rows)
+}
+
+// DeleteJob implements JobStore
+func (s *PostgresJobStore) DeleteJob(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM jobs WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete job: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return nil
+}
+
+// DueJobs implements JobStore. A zero next_run marks a job that must not run again.
+func (s *PostgresJobStore) DueJobs(ctx context.Context, before time.Time, limit int) ([]*Job, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs
+	WHERE `+waitingJobs+` AND next_run <= $1 AND next_run > $2
+	ORDER BY next_run ASC
+	LIMIT $3`, before.UTC(), time.Time{}, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query due jobs: %w", err)
+	}
+	return scanPostgresJobs(rows)
+}
+
+// ClaimDueJobs implements JobStore. Rows locked by a concurrent claim are
+// skipped rather than waited on, so two schedulers never receive the same job.
+func (s *PostgresJobStore) ClaimDueJobs(ctx context.Context, now time.Time, limit int) ([]*Job, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	// A zero next_run marks a job that must not run again
+	query := `
+	UPDATE jobs SET status = 'running', last_run = $1, updated_at = $1
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE ` + waitingJobs + `
+			AND next_run <= $1 AND next_run > $2
+		ORDER BY next_run ASC
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+
+	rows, err := s.db.QueryContext(ctx, query, now.UTC(), time.Time{}, limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim jobs: %w", err)
+	}
+	return scanPostgresJobs(rows)
+}
+
+// NextRunTime implements JobStore
+func (s *PostgresJobStore) NextRunTime(ctx context.Context) (time.Time, error) {
+	var next sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+	SELECT MIN(next_run) FROM jobs
+	WHERE `+waitingJobs+` AND next_run > $1
+	`, time.Time{}).Scan(&next)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("query next run: %w", err)
+	}
+	return next.Time, nil
+}
+
+// CountJobsByStatus implements JobStore
+func (s *PostgresJobStore) CountJobsByStatus(ctx context.Context) (map[JobStatus]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("count jobs: %w", err)
+	}
+	return scanStatusCounts(rows)
+}
+
+// RecordJobRun implements JobStore
+func (s *PostgresJobStore) RecordJobRun(ctx context.Context, run *JobRun) error {
+	query := `
+	INSERT INTO job_runs (job_id, started_at, finished_at, status, error, duration_ns)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+	`
+	err := s.db.QueryRowContext(ctx, query,
+		run.JobID, run.StartedAt, run.FinishedAt, run.Status, run.Error, int64(run.Duration),
+	).Scan(&run.ID)
+	if err != nil {
+		return fmt.Errorf("insert job run: %w", err)
+	}
+	return nil
+}
+
+// ListJobRuns implements JobStore
+func (s *PostgresJobStore) ListJobRuns(ctx context.Context, jobID string, limit int) ([]JobRun, error) {
+	query := `SELECT ` + jobRunColumns + ` FROM job_runs WHERE job_id = $1 ORDER BY started_at DESC, id DESC`
+	args := []interface{}{jobID}
+	if limit > 0 {
+		query += ` LIMIT $2`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query job runs: %w", err)
+	}
+	return scanJobRuns(rows)
+}
+
+// scanPostgresJobs reads every job from rows and closes them
+func scanPostgresJobs(rows *sql.Rows) ([]*Job, error) {
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		var job Job
+		var payload []byte
+		err := rows.Scan(
+			&job.ID, &job.UserID, &job.Type, &job.Schedule, &job.Timezone, &job.OneShot, &job.NoOverlap, &job.CatchUp,
+			&payload, &job.Status, &job.RetryCount, &job.LastError,
+			&job.NextRun, &job.LastRun, &job.CreatedAt, &job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan job: %w", err)
+		}
+		if err := json.Unmarshal(payload, &job.Payload); err != nil {
+			return nil, fmt.Errorf("unmarshal payload: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,178 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openPostgresTestStore connects to POSTGRES_DSN and returns a store working in
+// the given schema. Each store uses a single connection so search_path sticks.
+func openPostgresTestStore(t *testing.T, dsn, schema string) *PostgresJobStore {
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schema))
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, fmt.Sprintf("SET search_path TO %s", schema))
+	require.NoError(t, err)
+
+	store := NewPostgresJobStore(db)
+	require.NoError(t, store.Initialize(ctx))
+	return store
+}
+
+func setupPostgresTest(t *testing.T) (string, string) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN not set")
+	}
+
+	schema := fmt.Sprintf("scheduler_test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return
+		}
+		defer db.Close()
+		db.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", schema))
+	})
+	return dsn, schema
+}
+
+func TestPostgresJobStore_CRUD(t *testing.T) {
+	dsn, schema := setupPostgresTest(t)
+	store := openPostgresTestStore(t, dsn, schema)
+	ctx := context.Background()
+
+	// Initialize is idempotent
+	require.NoError(t, store.Initialize(ctx))
+
+	job := createTestJob("user1", "test")
+	job.Timezone = "Europe/Berlin"
+	require.NoError(t, store.CreateJob(ctx, job))
+
+	// The unique constraint still applies to user/type/schedule
+	dup := createTestJob("user1", "test")
+	assert.Error(t, store.CreateJob(ctx, dup))
+
+	got, err := store.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job.UserID, got.UserID)
+	assert.Equal(t, "Europe/Berlin", got.Timezone)
+	assert.JSONEq(t, `{"key":"value"}`, string(got.Payload))
+	assert.WithinDuration(t, job.NextRun, got.NextRun, time.Millisecond)
+	assert.Nil(t, got.LastRun)
+
+	got, err = store.GetJobByKey(ctx, "user1", "test", job.Schedule)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, got.ID)
+	_, err = store.GetJobByKey(ctx, "user1", "test", "0 8 * * *")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	job.Status = JobStatusFailed
+	job.LastError = "boom"
+	job.OneShot = true
+	job.NoOverlap = true
+	job.CatchUp = CatchUpSkip
+	require.NoError(t, store.UpdateJob(ctx, job))
+
+	jobs, err := store.ListJobs(ctx, JobFilter{UserID: "user1", Statuses: []JobStatus{JobStatusFailed, JobStatusDead}})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "boom", jobs[0].LastError)
+	assert.True(t, jobs[0].OneShot)
+	assert.True(t, jobs[0].NoOverlap)
+	assert.Equal(t, CatchUpSkip, jobs[0].CatchUp)
+
+	// The CHECK constraint rejects unknown statuses
+	job.Status = "bogus"
+	assert.Error(t, store.UpdateJob(ctx, job))
+
+	started := time.Now().UTC()
+	run := &JobRun{JobID: job.ID, StartedAt: started, FinishedAt: started.Add(time.Second),
+		Status: JobStatusFailed, Error: "boom", Duration: time.Second}
+	require.NoError(t, store.RecordJobRun(ctx, run))
+	assert.NotZero(t, run.ID)
+	runs, err := store.ListJobRuns(ctx, job.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "boom", runs[0].Error)
+	assert.Equal(t, time.Second, runs[0].Duration)
+
+	require.NoError(t, store.DeleteJob(ctx, job.ID))
+	assert.Error(t, store.DeleteJob(ctx, job.ID))
+	_, err = store.GetJob(ctx, job.ID)
+	assert.Error(t, err)
+}
+
+func TestPostgresJobStore_ClaimDueJobs(t *testing.T) {
+	dsn, schema := setupPostgresTest(t)
+	stores := []*PostgresJobStore{
+		openPostgresTestStore(t, dsn, schema),
+		openPostgresTestStore(t, dsn, schema),
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	const dueJobs = 20
+	for i := 0; i < dueJobs; i++ {
+		job := createTestJob(fmt.Sprintf("user%d", i), "test")
+		job.NextRun = now.Add(-time.Minute)
+		require.NoError(t, stores[0].CreateJob(ctx, job))
+	}
+	future := createTestJob("future", "test")
+	require.NoError(t, stores[0].CreateJob(ctx, future))
+	finished := createTestJob("finished", "test")
+	finished.Status = JobStatusCompleted
+	finished.NextRun = time.Time{}
+	require.NoError(t, stores[0].CreateJob(ctx, finished))
+
+	due, err := stores[0].DueJobs(ctx, now, 100)
+	require.NoError(t, err)
+	assert.Len(t, due, dueJobs)
+
+	// Two schedulers race to claim the same jobs one at a time
+	var mu sync.Mutex
+	claimedBy := make(map[string]int)
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func(instance int, store *PostgresJobStore) {
+			defer wg.Done()
+			for {
+				jobs, err := store.ClaimDueJobs(ctx, now, 1)
+				if !assert.NoError(t, err) || len(jobs) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, job := range jobs {
+					assert.Equal(t, JobStatusRunning, job.Status)
+					_, dup := claimedBy[job.ID]
+					assert.False(t, dup, "job %s claimed twice", job.ID)
+					claimedBy[job.ID] = instance
+				}
+				mu.Unlock()
+			}
+		}(i, store)
+	}
+	wg.Wait()
+
+	assert.Len(t, claimedBy, dueJobs)
+	assert.NotContains(t, claimedBy, future.ID)
+	assert.NotContains(t, claimedBy, finished.ID)
+
+	jobs, err := stores[1].ClaimDueJobs(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
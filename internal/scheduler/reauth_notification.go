@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"gmaildigest-go/internal/storage"
+)
+
+// ReauthNotificationJobType is the one-shot job that asks a user to sign in
+// again after their Google grant was revoked
+const ReauthNotificationJobType = "reauth_notification"
+
+// ReauthNotificationPayload represents the data needed for a reauth notification job
+type ReauthNotificationPayload struct {
+	UserID string `json:"user_id"`
+}
+
+// UserStorage looks up the user to notify.
+// It is implemented by storage.SQLiteStorage.
+type UserStorage interface {
+	GetUserByID(ctx context.Context, id string) (*storage.User, error)
+}
+
+// ReauthNotifier sends the Telegram message asking a user to sign in again
+type ReauthNotifier struct {
+	logger   *slog.Logger
+	storage  UserStorage
+	sender   MessageSender
+	loginURL string
+}
+
+// NewReauthNotifier creates a ReauthNotifier that points users at loginURL
+func NewReauthNotifier(logger *slog.Logger, storage UserStorage, sender MessageSender, loginURL string) *ReauthNotifier {
+	return &ReauthNotifier{
+		logger:   logger,
+		storage:  storage,
+		sender:   sender,
+		loginURL: loginURL,
+	}
+}
+
+// HandleReauthNotification handles a reauth notification job
+func (n *ReauthNotifier) HandleReauthNotification(ctx context.Context, job *Job) error {
+	if job == nil {
+		return fmt.Errorf("job cannot be nil")
+	}
+
+	var payload ReauthNotificationPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal reauth notification payload: %w", ErrPermanent, err)
+	}
+	if payload.UserID == "" {
+		return fmt.Errorf("%w: userID cannot be empty in payload", ErrPermanent)
+	}
+
+	user, err := n.storage.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.TelegramChatID.Valid {
+		n.logger.Warn("User has no Telegram chat to notify about reauthentication", "user", payload.UserID)
+		return nil
+	}
+
+	text := fmt.Sprintf("Gmail Digest can no longer read your Gmail because access was revoked or expired. "+
+		"Please sign in again to keep receiving digests: %s", n.loginURL)
+	if err := n.sender.SendMessage(user.TelegramChatID.Int64, text); err != nil {
+		return fmt.Errorf("failed to send reauth notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gmaildigest-go/internal/storage"
+)
+
+func TestReauthNotifier_HandleReauthNotification(t *testing.T) {
+	db := newMockDigestStorage()
+	db.users["user1"] = &storage.User{ID: "user1", TelegramChatID: sql.NullInt64{Int64: 42, Valid: true}}
+	db.users["user2"] = &storage.User{ID: "user2"}
+	sender := &mockSender{}
+	notifier := NewReauthNotifier(slog.New(slog.DiscardHandler), db, sender, "https://digest.example.com/login")
+
+	notify := func(userID string) error {
+		payload, err := json.Marshal(ReauthNotificationPayload{UserID: userID})
+		require.NoError(t, err)
+		return notifier.HandleReauthNotification(context.Background(), &Job{ID: "1", Payload: payload})
+	}
+
+	require.NoError(t, notify("user1"))
+	messages := sender.messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, int64(42), messages[0].chatID)
+	assert.Contains(t, messages[0].text, "https://digest.example.com/login")
+
+	// Users without a linked chat are skipped
+	require.NoError(t, notify("user2"))
+	assert.Len(t, sender.messages(), 1)
+
+	assert.ErrorIs(t, notify(""), ErrPermanent)
+	assert.ErrorIs(t, notify("missing"), storage.ErrNotFound)
+}
@@ -4,105 +4,388 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"gmaildigest-go/internal/metrics"
+	"hash/fnv"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
 	"gmaildigest-go/internal/worker"
 )
 
-// Scheduler manages job scheduling, deduplication, and persistence
+// DefaultMaxRetries is the number of failed attempts before a job is moved to the dead state
+const DefaultMaxRetries = 5
+
+// DefaultJobPriorities are the worker queue priorities of built-in job types.
+// Token refreshes run ahead of digests so tokens do not expire while queued.
+var DefaultJobPriorities = map[string]int{
+	"token_refresh": 10,
+	"digest":        worker.DefaultPriority,
+}
+
+// DefaultStaleJobThreshold is how long a job may stay running in a shared
+// store before it is assumed orphaned by a crashed instance and handed back
+// to the scheduler
+const DefaultStaleJobThreshold = 30 * time.Minute
+
+// DefaultDigestInterval is how often digests are sent to a user who has not
+// chosen an interval, matching the users.digest_interval column default
+const DefaultDigestInterval = time.Hour
+
+// Scheduler manages job scheduling, deduplication, and persistence. Jobs
+// live in the store; only the runs in flight on this scheduler are held in
+// memory.
 type Scheduler struct {
-	store      JobStore
-	Jobs       map[string]*Job // jobID -> Job (exported for testing)
-	JobMu      sync.Mutex      // exported for testing
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
-	cronWakeup chan struct{}
-	pool       *worker.WorkerPool
-	registry   *JobHandlerRegistry
-}
-
-// NewScheduler creates a new Scheduler and loads jobs from the database
-func NewScheduler(ctx context.Context, db *sql.DB, pool *worker.WorkerPool) (*Scheduler, error) {
+	store        JobStore
+	JobMu        sync.Mutex // exported for testing
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	cronWakeup   chan struct{}
+	pool         *worker.WorkerPool
+	registry     *JobHandlerRegistry
+	maxRetries   int
+	priorities   map[string]int                     // job type -> worker queue priority
+	running      map[string]context.CancelCauseFunc // jobID -> cancels the in-flight run
+	onDeadLetter func(*Job)                         // called when a job enters the dead letter state
+	stopping     chan struct{}                      // closed to stop dispatching new jobs
+	stopOnce     sync.Once
+	idle         chan struct{} // closed by endRun when the last in-flight run ends during a drain
+	logger       *slog.Logger
+	interval     time.Duration // digest interval used when none is given
+	jitter       time.Duration // recurring runs are offset by up to this much either way
+	clock        Clock
+	// staleAfter is how long a job may stay running before recovery resets it
+	staleAfter time.Duration
+	// sharedStore is set when other instances may be running the store's
+	// jobs, so stale jobs are recovered periodically instead of at startup
+	sharedStore bool
+}
+
+// Option configures a Scheduler when it is created
+type Option func(*Scheduler)
+
+// WithJitter offsets the runs of each recurring job by a fixed amount within
+// ±max, so jobs sharing a schedule such as "0 8 * * *" do not all fire at
+// once. The offset is derived from the job ID, so it survives restarts and
+// a job keeps to its shifted schedule instead of drifting.
+func WithJitter(max time.Duration) Option {
+	return func(s *Scheduler) {
+		if max > 0 {
+			s.jitter = max
+		}
+	}
+}
+
+// WithStaleJobThreshold sets how long a job in a shared store may stay
+// running before the scheduling loop resets it as orphaned. It must exceed
+// the longest run of any job. The default is DefaultStaleJobThreshold.
+func WithStaleJobThreshold(threshold time.Duration) Option {
+	return func(s *Scheduler) {
+		if threshold > 0 {
+			s.staleAfter = threshold
+		}
+	}
+}
+
+// NewScheduler creates a new Scheduler backed by SQLite and recovers every job
+// left running by a previous process. The SQLite database belongs to this
+// process alone, so no job it has not started yet can be running anywhere.
+func NewScheduler(ctx context.Context, db *sql.DB, pool *worker.WorkerPool, opts ...Option) (*Scheduler, error) {
+	s, err := NewSchedulerWithStore(ctx, NewSQLiteJobStore(db), pool, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.sharedStore = false
+
+	s.JobMu.Lock()
+	_, err = s.recoverStaleJobs(s.ctx, 0)
+	s.JobMu.Unlock()
+	if err != nil {
+		s.cancel()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSchedulerWithStore creates a new Scheduler using the given JobStore, such
+// as a PostgresJobStore shared by several instances. It leaves running jobs
+// alone at startup, since another instance may still be running them; once
+// started, the scheduling loop resets jobs running for longer than the stale
+// job threshold.
+func NewSchedulerWithStore(ctx context.Context, store JobStore, pool *worker.WorkerPool, opts ...Option) (*Scheduler, error) {
 	cctx, cancel := context.WithCancel(ctx)
-	store := NewSQLiteJobStore(db)
 	if err := store.Initialize(cctx); err != nil {
 		cancel()
 		return nil, err
 	}
 
 	s := &Scheduler{
-		store:      store,
-		Jobs:       make(map[string]*Job),
-		ctx:        cctx,
-		cancel:     cancel,
-		cronWakeup: make(chan struct{}, 1),
-		pool:       pool,
-		registry:   NewJobHandlerRegistry(),
-	}
-	if err := s.loadJobsFromDB(); err != nil {
-		cancel()
-		return nil, err
+		store:       store,
+		ctx:         cctx,
+		cancel:      cancel,
+		cronWakeup:  make(chan struct{}, 1),
+		stopping:    make(chan struct{}),
+		pool:        pool,
+		registry:    NewJobHandlerRegistry(),
+		maxRetries:  DefaultMaxRetries,
+		priorities:  make(map[string]int, len(DefaultJobPriorities)),
+		running:     make(map[string]context.CancelCauseFunc),
+		logger:      slog.Default(),
+		interval:    DefaultDigestInterval,
+		clock:       RealClock{},
+		staleAfter:  DefaultStaleJobThreshold,
+		sharedStore: true,
+	}
+	for jobType, priority := range DefaultJobPriorities {
+		s.priorities[jobType] = priority
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	return s, nil
 }
 
-// loadJobsFromDB loads persisted jobs into memory
-func (s *Scheduler) loadJobsFromDB() error {
-	jobs, err := s.store.ListJobs(s.ctx, JobFilter{})
+// RecoverStaleJobs resets jobs that have been running for longer than
+// threshold to pending so they run again right away, and returns how many
+// were reset. A threshold of 0 or less uses the scheduler's stale job
+// threshold. With a shared store the threshold must exceed the longest run of
+// any job.
+func (s *Scheduler) RecoverStaleJobs(ctx context.Context, threshold time.Duration) (int, error) {
+	if threshold <= 0 {
+		threshold = s.staleAfter
+	}
+
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+
+	recovered, err := s.recoverStaleJobs(ctx, threshold)
+	if recovered > 0 {
+		s.signalCronWakeup()
+	}
+	return recovered, err
+}
+
+// recoverStaleJobs implements RecoverStaleJobs; a threshold of 0 resets every
+// running job this scheduler is not running itself. The caller holds JobMu.
+func (s *Scheduler) recoverStaleJobs(ctx context.Context, threshold time.Duration) (int, error) {
+	now := s.clock.Now()
+	cutoff := now.Add(-threshold)
+
+	jobs, err := s.store.ListJobs(ctx, JobFilter{Status: JobStatusRunning})
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("list running jobs: %w", err)
 	}
+
+	recovered := 0
 	for _, job := range jobs {
-		s.Jobs[job.ID] = job
+		if _, ok := s.running[job.ID]; ok {
+			continue
+		}
+		if threshold > 0 && job.LastRun != nil && job.LastRun.After(cutoff) {
+			continue
+		}
+		job.Status = JobStatusPending
+		job.NextRun = now
+		if err := s.store.UpdateJob(ctx, job); err != nil {
+			return recovered, fmt.Errorf("recover job %s: %w", job.ID, err)
+		}
+		recovered++
 	}
-	return nil
+	return recovered, nil
 }
 
-// ScheduleJob schedules a new job or deduplicates if one exists for user/type/schedule
+// ScheduleJob schedules a new job or deduplicates if one exists for user/type/schedule.
+// The schedule is a cron expression or an interval such as "@every 2h".
 func (s *Scheduler) ScheduleJob(userID, jobType, schedule string, payload interface{}) (*Job, error) {
+	return s.ScheduleJobInTimezone(userID, jobType, schedule, "", payload)
+}
+
+// ScheduleJobInTimezone schedules a job whose cron schedule is evaluated in the
+// given IANA timezone (e.g. "Europe/Berlin"). An empty timezone means UTC.
+// An invalid schedule or timezone is returned as an error and no job is stored.
+func (s *Scheduler) ScheduleJobInTimezone(userID, jobType, schedule, timezone string, payload interface{}) (*Job, error) {
+	return s.ScheduleJobWithOptions(userID, jobType, schedule, payload, ScheduleOptions{Timezone: timezone})
+}
+
+// ScheduleOptions are the optional settings of a recurring job
+type ScheduleOptions struct {
+	// Timezone is the IANA timezone the schedule is evaluated in; empty means UTC
+	Timezone string
+	// NoOverlap skips a due run while another run of the same user and job
+	// type is still in progress, instead of running them side by side
+	NoOverlap bool
+	// CatchUp decides what happens to runs missed while no scheduler was
+	// running; empty means CatchUpLatest
+	CatchUp CatchUpPolicy
+}
+
+// ScheduleJobWithOptions schedules a recurring job like ScheduleJob with the
+// given options. Rescheduling an existing job replaces its payload and
+// options, except that an empty CatchUp keeps the job's policy. Unless the
+// timezone changes, the job keeps its next run, so a run missed while no
+// scheduler was running still follows the catch-up policy.
+func (s *Scheduler) ScheduleJobWithOptions(userID, jobType, schedule string, payload interface{}, opts ScheduleOptions) (*Job, error) {
+	timezone := opts.Timezone
+	loc, err := loadTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+	sched, err := ParseScheduleInLocation(schedule, loc)
+	if err != nil {
+		return nil, err
+	}
+	switch opts.CatchUp {
+	case "", CatchUpLatest, CatchUpAll, CatchUpSkip:
+	default:
+		return nil, fmt.Errorf("invalid catch-up policy %q", opts.CatchUp)
+	}
+	now := s.clock.Now()
+	if sched.Next(now).IsZero() {
+		return nil, fmt.Errorf("%w: %q", ErrImpossibleSchedule, schedule)
+	}
+
 	s.JobMu.Lock()
 	defer s.JobMu.Unlock()
 
-	// Convert payload to JSON
-	var payloadJSON json.RawMessage
-	if p, ok := payload.(json.RawMessage); ok {
-		payloadJSON = p
-	} else {
-		var err error
-		payloadJSON, err = json.Marshal(payload)
-		if err != nil {
+	payloadJSON, err := marshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deduplication: check for existing job
+	job, err := s.findJob(userID, jobType, schedule)
+	if err != nil {
+		return nil, err
+	}
+	if job != nil {
+		// Update payload and reset status. A run in progress keeps its status
+		// so the job is not dispatched again before the run ends.
+		job.Payload = payloadJSON
+		if job.Status != JobStatusRunning {
+			job.Status = JobStatusPending
+		}
+		job.RetryCount = 0
+		job.NoOverlap = opts.NoOverlap
+		if opts.CatchUp != "" {
+			job.CatchUp = opts.CatchUp
+		}
+		if job.Timezone != timezone {
+			job.Timezone = timezone
+			job.NextRun = s.nextJitteredRun(sched, job.ID, now)
+		}
+		if err := s.store.UpdateJob(s.ctx, job); err != nil {
 			return nil, err
 		}
+		s.signalCronWakeup()
+		return job, nil
 	}
 
-	// Deduplication: check for existing job
-	for _, job := range s.Jobs {
-		if job.UserID == userID && job.Type == jobType && job.Schedule == schedule {
-			// Update payload and reset status
+	// New job
+	job = &Job{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      jobType,
+		Schedule:  schedule,
+		Timezone:  timezone,
+		NoOverlap: opts.NoOverlap,
+		CatchUp:   opts.CatchUp,
+		Payload:   payloadJSON,
+		Status:    JobStatusPending,
+	}
+	job.NextRun = s.nextJitteredRun(sched, job.ID, now)
+
+	if err := s.store.CreateJob(s.ctx, job); err != nil {
+		return nil, err
+	}
+
+	metrics.JobsScheduled.WithLabelValues(jobType).Inc()
+	s.signalCronWakeup()
+	return job, nil
+}
+
+// findJob returns the job with the given user, type and schedule from the
+// store, or nil if there is none. The caller holds JobMu.
+func (s *Scheduler) findJob(userID, jobType, schedule string) (*Job, error) {
+	job, err := s.store.GetJobByKey(s.ctx, userID, jobType, schedule)
+	if errors.Is(err, ErrJobNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find job: %w", err)
+	}
+	return job, nil
+}
+
+// ScheduleOnceJob schedules a job that runs a single time at runAt and is then
+// left completed instead of being rescheduled
+func (s *Scheduler) ScheduleOnceJob(userID, jobType string, runAt time.Time, payload interface{}) (*Job, error) {
+	return s.scheduleOnce(userID, jobType, runAt, payload, true)
+}
+
+// ScheduleOnceJobNoDedup schedules a one-shot job like ScheduleOnceJob but
+// always adds a new job, even when one exists for the same user, type and
+// run time. Use it for ad-hoc tasks that each carry their own work, such as
+// sending a specific email.
+func (s *Scheduler) ScheduleOnceJobNoDedup(userID, jobType string, runAt time.Time, payload interface{}) (*Job, error) {
+	return s.scheduleOnce(userID, jobType, runAt, payload, false)
+}
+
+// scheduleOnce implements ScheduleOnceJob and ScheduleOnceJobNoDedup
+func (s *Scheduler) scheduleOnce(userID, jobType string, runAt time.Time, payload interface{}, dedup bool) (*Job, error) {
+	if runAt.IsZero() {
+		return nil, fmt.Errorf("run time cannot be zero")
+	}
+	payloadJSON, err := marshalPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+
+	runAt = runAt.UTC()
+	schedule := onceSchedule(runAt)
+
+	var id string
+	if dedup {
+		// Deduplication: the same one-shot for user/type/time replaces the payload
+		job, err := s.findJob(userID, jobType, schedule)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
 			job.Payload = payloadJSON
 			job.Status = JobStatusPending
 			job.RetryCount = 0
-			job.NextRun = s.nextRunTime(schedule)
+			job.OneShot = true
+			job.NextRun = runAt
 			if err := s.store.UpdateJob(s.ctx, job); err != nil {
 				return nil, err
 			}
 			s.signalCronWakeup()
 			return job, nil
 		}
+	} else {
+		// The job ID in the label keeps the user/type/schedule key unique
+		id = uuid.New().String()
+		schedule += " " + id
 	}
 
-	// New job
-	nextRun := s.nextRunTime(schedule)
 	job := &Job{
+		ID:       id,
 		UserID:   userID,
 		Type:     jobType,
 		Schedule: schedule,
+		OneShot:  true,
 		Payload:  payloadJSON,
 		Status:   JobStatusPending,
-		NextRun:  nextRun,
+		NextRun:  runAt,
 	}
 
 	if err := s.store.CreateJob(s.ctx, job); err != nil {
@@ -110,18 +393,97 @@ func (s *Scheduler) ScheduleJob(userID, jobType, schedule string, payload interf
 	}
 
 	metrics.JobsScheduled.WithLabelValues(jobType).Inc()
-	s.Jobs[job.ID] = job
 	s.signalCronWakeup()
 	return job, nil
 }
 
-// nextRunTime computes the next run time for a cron schedule
-func (s *Scheduler) nextRunTime(schedule string) time.Time {
-	cron, err := ParseCron(schedule)
+// onceSchedule builds the schedule label stored for a one-shot job
+func onceSchedule(runAt time.Time) string {
+	return "@once " + runAt.Format(time.RFC3339)
+}
+
+// marshalPayload converts a job payload to JSON
+func marshalPayload(payload interface{}) (json.RawMessage, error) {
+	if p, ok := payload.(json.RawMessage); ok {
+		return p, nil
+	}
+	return json.Marshal(payload)
+}
+
+// nextRunTime computes the next run time of a recurring job from now
+func (s *Scheduler) nextRunTime(job *Job) time.Time {
+	return s.nextRunAfter(job, s.clock.Now())
+}
+
+// nextRunAfter returns the first time after 'after' that a recurring job's
+// cron or interval schedule fires, in the job's timezone and offset by its
+// jitter
+func (s *Scheduler) nextRunAfter(job *Job, after time.Time) time.Time {
+	loc, err := loadTimezone(job.Timezone)
 	if err != nil {
-		return time.Now().Add(time.Hour) // fallback: 1 hour later
+		return s.clock.Now().Add(time.Hour) // fallback: 1 hour later
 	}
-	return cron.Next(time.Now())
+	sched, err := ParseScheduleInLocation(job.Schedule, loc)
+	if err != nil {
+		return s.clock.Now().Add(time.Hour) // fallback: 1 hour later
+	}
+	return s.nextJitteredRun(sched, job.ID, after)
+}
+
+// nextJitteredRun returns the first run after 'after' of the job with the
+// given ID on sched shifted by the job's jitter, or the zero time if sched
+// never fires
+func (s *Scheduler) nextJitteredRun(sched Schedule, jobID string, after time.Time) time.Time {
+	offset := s.jitterFor(jobID)
+	next := sched.Next(after.Add(-offset))
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(offset)
+}
+
+// jitterFor returns the fixed offset, within ±jitter, of a job's runs
+func (s *Scheduler) jitterFor(jobID string) time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(jobID))
+	return time.Duration(h.Sum64()%uint64(2*s.jitter+1)) - s.jitter
+}
+
+// PreviewSchedule returns the next n times a schedule fires, starting
+// now. It fails when the expression is invalid or fires fewer than n times
+// within the search window, as an impossible date like "0 0 30 2 *" does.
+func (s *Scheduler) PreviewSchedule(expr string, n int) ([]time.Time, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("preview count must be positive, got %d", n)
+	}
+	sched, err := ParseSchedule(expr)
+	if err != nil {
+		return nil, err
+	}
+	times := nextN(sched, s.clock.Now(), n)
+	if len(times) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrImpossibleSchedule, expr)
+	}
+	if len(times) < n {
+		return nil, fmt.Errorf("schedule %q fires only %d of %d times in the next %d days",
+			expr, len(times), n, int(cronSearchWindow.Hours()/24))
+	}
+	return times, nil
+}
+
+// loadTimezone resolves a job timezone name, treating an empty name as UTC
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
 }
 
 // signalCronWakeup notifies the scheduling loop to re-evaluate jobs
@@ -140,118 +502,556 @@ func (s *Scheduler) ForceCheck() {
 
 // Start begins the scheduling loop (does not execute jobs yet)
 func (s *Scheduler) Start() {
+	s.warnUnregisteredJobs()
 	s.wg.Add(1)
 	go s.schedulingLoop()
 }
 
-// schedulingLoop waits for the next job and triggers execution
+// warnUnregisteredJobs logs the pending jobs whose type has no registered
+// handler. They would fail with "no handler registered" once dispatched.
+func (s *Scheduler) warnUnregisteredJobs() {
+	jobs, err := s.store.ListJobs(s.ctx, JobFilter{Status: JobStatusPending})
+	if err != nil {
+		s.logger.Error("Failed to check pending jobs for handlers", "error", err)
+		return
+	}
+
+	unregistered := make(map[string]int)
+	for _, job := range jobs {
+		if s.registry.GetHandler(job.Type) == nil {
+			unregistered[job.Type]++
+		}
+	}
+	types := make([]string, 0, len(unregistered))
+	for jobType := range unregistered {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	for _, jobType := range types {
+		s.logger.Warn("Pending jobs have no registered handler", "type", jobType, "count", unregistered[jobType])
+	}
+}
+
+// schedulingLoop waits for the next job and triggers execution. With a
+// shared store it also recovers stale jobs every half stale job threshold, so
+// an orphaned job is rerun at most one and a half thresholds after it started.
 func (s *Scheduler) schedulingLoop() {
 	defer s.wg.Done()
+
+	var recovery Timer
+	if s.sharedStore {
+		recovery = s.clock.NewTimer(s.staleAfter / 2)
+		defer func() { recovery.Stop() }()
+	}
+
 	for {
 		next := s.findNextJobTime()
-		timer := time.NewTimer(time.Until(next))
+		timer := s.clock.NewTimer(next.Sub(s.clock.Now()))
 		select {
 		case <-s.ctx.Done():
 			timer.Stop()
 			return
-		case <-timer.C:
+		case <-s.stopping:
+			timer.Stop()
+			return
+		case <-timer.C():
 			// Dispatch jobs due at 'next' to the WorkerPool
 			s.dispatchDueJobs(next)
 		case <-s.cronWakeup:
 			timer.Stop()
 			continue
+		case <-recoveryC(recovery):
+			timer.Stop()
+			s.recoverStaleJobsInLoop()
+			recovery = s.clock.NewTimer(s.staleAfter / 2)
 		}
 	}
 }
 
-// dispatchDueJobs submits all jobs due at or before 'now' to the WorkerPool
+// recoveryC returns the channel of the stale job recovery timer, or nil, which
+// never receives, when the scheduler does not recover jobs periodically
+func recoveryC(t Timer) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.C()
+}
+
+// recoverStaleJobsInLoop runs stale job recovery for the scheduling loop,
+// logging the jobs it reset and any failure, which is retried on the next pass
+func (s *Scheduler) recoverStaleJobsInLoop() {
+	recovered, err := s.RecoverStaleJobs(s.ctx, s.staleAfter)
+	if recovered > 0 {
+		s.logger.Info("Recovered stale running jobs", "count", recovered, "threshold", s.staleAfter)
+	}
+	if err != nil {
+		metrics.StaleJobRecoveryErrors.Inc()
+		s.logger.Error("Failed to recover stale jobs", "error", err)
+	}
+}
+
+// dispatchBatchSize caps how many due jobs are claimed per dispatch
+const dispatchBatchSize = 100
+
+// BackpressureRetryDelay is how long a job waits before being dispatched again
+// when the worker pool queue was full
+const BackpressureRetryDelay = 5 * time.Second
+
+// dispatchDueJobs claims the jobs due at or before 'now' in the store and
+// submits them to the WorkerPool. Claiming is atomic, so when several
+// scheduler instances share a database each job is dispatched only once.
+// A NoOverlap job whose previous run is still in progress skips this run,
+// and a run missed by more than MissedRunGrace follows the job's CatchUpPolicy.
 func (s *Scheduler) dispatchDueJobs(now time.Time) {
 	s.JobMu.Lock()
 	defer s.JobMu.Unlock()
-	for id, job := range s.Jobs {
-		if job.Status == JobStatusPending && !job.NextRun.After(now) {
-			jt := NewJobTask(s.ctx, job, s.registry)
-			jt.scheduler = s // Set the scheduler
-			ok := s.pool.Submit(jt)
-			if ok {
-				metrics.JobsInFlight.Inc()
-				job.Status = JobStatusRunning
-				job.LastRun = &now
-				if err := s.store.UpdateJob(s.ctx, job); err != nil {
-					// Log error but continue with other jobs
-					continue
-				}
-				s.Jobs[id] = job // Update job in memory
-			} else {
-				// Backpressure: could not submit, reschedule or log
+
+	claimed, err := s.store.ClaimDueJobs(s.ctx, now, dispatchBatchSize)
+	if err != nil {
+		// Leave the jobs as they are and retry on the next pass
+		metrics.JobClaimErrors.Inc()
+		s.logger.Error("Failed to claim due jobs", "error", err)
+		return
+	}
+
+	// Claimed jobs are marked running before they are dispatched, so those
+	// still waiting in this batch must not count as runs in progress
+	undecided := make(map[string]bool, len(claimed))
+	for _, job := range claimed {
+		undecided[job.ID] = true
+	}
+
+	for _, job := range claimed {
+		delete(undecided, job.ID)
+		if job.CatchUp == CatchUpSkip && s.missedRun(job) {
+			s.skipRun(job, nil)
+			continue
+		}
+		if job.NoOverlap {
+			if overlap, err := s.overlaps(job, undecided); overlap || err != nil {
+				s.skipRun(job, err)
+				continue
 			}
 		}
+
+		jt := NewJobTask(s.ctx, job, s.registry)
+		jt.scheduler = s // Set the scheduler
+		jt.priority = s.priorities[job.Type]
+		runCtx, cancel := context.WithCancelCause(s.ctx)
+		jt.runCtx = runCtx
+		s.running[job.ID] = cancel
+		if s.pool.Submit(jt) {
+			metrics.JobsDispatched.WithLabelValues(job.Type).Inc()
+			metrics.JobsInFlight.Inc()
+			continue
+		}
+		s.endRun(job.ID)
+		// Backpressure: the queue is full, so hand the job back and retry
+		// shortly instead of leaving it marked running
+		job.Status = JobStatusPending
+		job.NextRun = s.clock.Now().Add(BackpressureRetryDelay)
+		if err := s.store.UpdateJob(s.ctx, job); err != nil {
+			// The job stays running until stale job recovery resets it
+			metrics.JobReleaseErrors.WithLabelValues(job.Type).Inc()
+			s.logger.Error("Failed to requeue job after the worker queue was full", "job", job.ID, "error", err)
+		}
 	}
 }
 
-// findNextJobTime finds the soonest NextRun among scheduled jobs
-func (s *Scheduler) findNextJobTime() time.Time {
+// overlaps reports whether another run of the job's user and type is in
+// progress, on this scheduler or on another instance sharing the store. Jobs
+// in ignore were claimed alongside this one and have not started. The caller
+// holds JobMu.
+func (s *Scheduler) overlaps(job *Job, ignore map[string]bool) (bool, error) {
+	// Stale job recovery may hand back a job whose run is still going here
+	if _, ok := s.running[job.ID]; ok {
+		return true, nil
+	}
+
+	running, err := s.store.ListJobs(s.ctx, JobFilter{UserID: job.UserID, Type: job.Type, Status: JobStatusRunning})
+	if err != nil {
+		return false, fmt.Errorf("find running jobs: %w", err)
+	}
+	for _, other := range running {
+		if other.ID != job.ID && !ignore[other.ID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MissedRunGrace is how late a recurring job may be dispatched before its run
+// counts as missed rather than merely delayed
+const MissedRunGrace = time.Minute
+
+// missedRun reports whether a claimed recurring job is being dispatched more
+// than MissedRunGrace after it was due
+func (s *Scheduler) missedRun(job *Job) bool {
+	return !job.OneShot && s.clock.Now().Sub(job.NextRun) > MissedRunGrace
+}
+
+// skipRun hands a claimed job back without running it. A recurring job waits
+// for its next scheduled run; a one-shot job, or one whose overlap check
+// failed, is retried shortly. The caller holds JobMu.
+func (s *Scheduler) skipRun(job *Job, checkErr error) {
+	job.Status = JobStatusPending
+	if checkErr != nil || job.OneShot {
+		job.NextRun = s.clock.Now().Add(BackpressureRetryDelay)
+	} else {
+		job.NextRun = s.nextRunTime(job)
+		metrics.JobsSkipped.WithLabelValues(job.Type).Inc()
+	}
+	if err := s.store.UpdateJob(s.ctx, job); err != nil {
+		// The job stays running until stale job recovery resets it
+		metrics.JobReleaseErrors.WithLabelValues(job.Type).Inc()
+		s.logger.Error("Failed to skip job run", "job", job.ID, "error", err)
+	}
+}
+
+// endRun releases the context of a job's in-flight run. The caller holds JobMu.
+func (s *Scheduler) endRun(id string) {
+	if cancel, ok := s.running[id]; ok {
+		cancel(nil)
+		delete(s.running, id)
+	}
+	if len(s.running) == 0 && s.idle != nil {
+		close(s.idle)
+		s.idle = nil
+	}
+}
+
+// CancelJob cancels the context of a job running on this scheduler so its
+// handler can unwind. The run is recorded as failed with ErrJobCancelled and
+// the job waits for its next scheduled run.
+func (s *Scheduler) CancelJob(ctx context.Context, id string) error {
 	s.JobMu.Lock()
 	defer s.JobMu.Unlock()
-	next := time.Now().Add(24 * time.Hour)
-	for _, job := range s.Jobs {
-		if job.Status == JobStatusPending && job.NextRun.Before(next) {
-			next = job.NextRun
+
+	cancel, ok := s.running[id]
+	if !ok {
+		job, err := s.store.GetJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		if job.Status == JobStatusRunning {
+			return fmt.Errorf("job %s is running on another scheduler", id)
 		}
+		return fmt.Errorf("job %s is not running: %s", id, job.Status)
+	}
+	cancel(ErrJobCancelled)
+	return nil
+}
+
+// idleCheckInterval is how long the scheduling loop sleeps when no job is
+// scheduled, so jobs added by other instances sharing the store are noticed
+const idleCheckInterval = 24 * time.Hour
+
+// storeRetryDelay is how long the scheduling loop waits before asking the
+// store again after a failed query
+const storeRetryDelay = 5 * time.Second
+
+// findNextJobTime asks the store for the soonest NextRun among scheduled jobs
+func (s *Scheduler) findNextJobTime() time.Time {
+	now := s.clock.Now()
+	next, err := s.store.NextRunTime(s.ctx)
+	if err != nil {
+		return now.Add(storeRetryDelay)
+	}
+	if limit := now.Add(idleCheckInterval); next.IsZero() || next.After(limit) {
+		return limit
 	}
 	return next
 }
 
-// Stop gracefully shuts down the scheduler
+// Stop shuts down the scheduler, cancelling the context of any job still
+// running. Use StopWithTimeout to let running jobs finish first.
 func (s *Scheduler) Stop() {
 	s.cancel()
 	s.wg.Wait()
 }
 
+// StopWithTimeout stops dispatching new jobs, then waits up to d for the jobs
+// already dispatched to finish and record their result before shutting the
+// scheduler down. Jobs still running after d are cancelled and it returns an
+// error wrapping worker.ErrStopTimeout; they stay running in the store until
+// stale job recovery resets them. A d of 0 or less waits indefinitely. The
+// worker pool must still be running for dispatched jobs to finish.
+func (s *Scheduler) StopWithTimeout(d time.Duration) error {
+	s.stopOnce.Do(func() { close(s.stopping) })
+	s.wg.Wait()
+
+	s.JobMu.Lock()
+	var idle chan struct{}
+	if len(s.running) > 0 {
+		if s.idle == nil {
+			s.idle = make(chan struct{})
+		}
+		idle = s.idle
+	}
+	s.JobMu.Unlock()
+
+	var err error
+	if idle != nil {
+		var timeout <-chan time.Time
+		if d > 0 {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-idle:
+			// The last run closes idle before saving its result under JobMu
+			s.JobMu.Lock()
+			s.JobMu.Unlock()
+		case <-timeout:
+			s.JobMu.Lock()
+			err = fmt.Errorf("%w: %d jobs still running after %s", worker.ErrStopTimeout, len(s.running), d)
+			s.JobMu.Unlock()
+		}
+	}
+
+	s.Stop()
+	return err
+}
+
 // RegisterTokenRefreshHandler registers the token refresh handler with the scheduler
 func (s *Scheduler) RegisterTokenRefreshHandler(handler JobHandler) {
 	s.registry.RegisterHandler("token_refresh", handler)
 }
 
+// RegisterDigestHandler registers the digest handler with the scheduler
+func (s *Scheduler) RegisterDigestHandler(handler JobHandler) {
+	s.registry.RegisterHandler("digest", handler)
+}
+
 // RegisterHandler registers a handler function for a job type
 func (s *Scheduler) RegisterHandler(jobType string, handler JobHandler) {
 	s.registry.RegisterHandler(jobType, handler)
 }
 
-// ListJobs returns a list of jobs matching the given options
-func (s *Scheduler) ListJobs(ctx context.Context, opts *ListJobsOptions) ([]*Job, error) {
-	if opts == nil {
-		opts = &ListJobsOptions{}
+// RegisteredTypes returns the job types that have a handler, sorted by name
+func (s *Scheduler) RegisteredTypes() []string {
+	types := s.registry.ListHandlerTypes()
+	sort.Strings(types)
+	return types
+}
+
+// RegisterHandlerWithBackoff registers a handler and the retry backoff strategy for a job type
+func (s *Scheduler) RegisterHandlerWithBackoff(jobType string, handler JobHandler, strategy BackoffStrategy) {
+	s.registry.RegisterHandlerWithBackoff(jobType, handler, strategy)
+}
+
+// SetMaxRetries sets how many failed attempts a job gets before it is marked dead.
+// Values below 1 restore the default.
+func (s *Scheduler) SetMaxRetries(n int) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+	if n < 1 {
+		n = DefaultMaxRetries
 	}
+	s.maxRetries = n
+}
 
-	filter := JobFilter{
-		UserID: opts.UserID,
-		Type:   opts.Type,
-		Status: opts.Status,
+// SetDeadLetterHook sets a function called with a copy of each job that
+// enters the dead letter state, such as DeadLetterWebhook.Notify. The hook
+// runs on its own goroutine so a slow hook does not hold up the scheduler.
+// A nil hook disables notifications.
+func (s *Scheduler) SetDeadLetterHook(hook func(*Job)) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+	s.onDeadLetter = hook
+}
+
+// SetLogger sets the logger that receives the scheduler's warnings
+func (s *Scheduler) SetLogger(logger *slog.Logger) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+	s.logger = logger
+}
+
+// SetDefaultInterval sets the digest interval RescheduleDigest uses when it
+// is given none. A non-positive interval restores DefaultDigestInterval.
+func (s *Scheduler) SetDefaultInterval(interval time.Duration) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+	if interval <= 0 {
+		interval = DefaultDigestInterval
 	}
+	s.interval = interval
+}
 
-	if !opts.Before.IsZero() {
-		filter.NextRun = opts.Before
+// DefaultInterval returns the digest interval used when none is given
+func (s *Scheduler) DefaultInterval() time.Duration {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+	return s.interval
+}
+
+// CountJobsByStatus returns the number of jobs in the store in each status.
+// Every status is present, so gauges drop back to zero once a status empties.
+func (s *Scheduler) CountJobsByStatus() map[string]int {
+	counts := map[string]int{
+		string(JobStatusPending):   0,
+		string(JobStatusRunning):   0,
+		string(JobStatusCompleted): 0,
+		string(JobStatusFailed):    0,
+		string(JobStatusDead):      0,
+	}
+	stored, err := s.store.CountJobsByStatus(s.ctx)
+	if err != nil {
+		return counts
 	}
+	for status, n := range stored {
+		counts[string(status)] = n
+	}
+	return counts
+}
 
-	jobs, err := s.store.ListJobs(ctx, filter)
+// SetJobPriority sets the worker queue priority for a job type. Higher
+// priorities are dequeued first; unknown types use worker.DefaultPriority.
+func (s *Scheduler) SetJobPriority(jobType string, priority int) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+	s.priorities[jobType] = priority
+}
+
+// ListDeadJobs returns jobs that exhausted their retries
+func (s *Scheduler) ListDeadJobs(ctx context.Context) ([]*Job, error) {
+	return s.store.ListJobs(ctx, JobFilter{Status: JobStatusDead})
+}
+
+// RequeueDeadJob resets a dead job to pending with a fresh retry count so it runs again
+func (s *Scheduler) RequeueDeadJob(ctx context.Context, id string) (*Job, error) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+
+	job, err := s.store.GetJob(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if job.Status != JobStatusDead {
+		return nil, fmt.Errorf("job %s is not dead: %s", id, job.Status)
+	}
 
-	// Apply additional filtering
-	var filtered []*Job
-	for _, job := range jobs {
-		if !opts.After.IsZero() && job.NextRun.Before(opts.After) {
-			continue
-		}
-		filtered = append(filtered, job)
+	job.Status = JobStatusPending
+	job.RetryCount = 0
+	job.LastError = ""
+	job.NextRun = s.clock.Now()
+	if err := s.store.UpdateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	s.signalCronWakeup()
+	return job, nil
+}
+
+// GetJob returns the job with the given ID from the store
+func (s *Scheduler) GetJob(ctx context.Context, id string) (*Job, error) {
+	return s.store.GetJob(ctx, id)
+}
+
+// DeleteJob removes a job so it never runs again. A run in progress on this
+// scheduler is cancelled first.
+func (s *Scheduler) DeleteJob(ctx context.Context, id string) error {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+
+	if err := s.store.DeleteJob(ctx, id); err != nil {
+		return err
+	}
+	if cancel, ok := s.running[id]; ok {
+		cancel(ErrJobCancelled)
+	}
+	return nil
+}
+
+// RunJobNow makes a job due immediately so the next dispatch runs it, without
+// waiting for its schedule. Its retry count is left alone.
+func (s *Scheduler) RunJobNow(ctx context.Context, id string) (*Job, error) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+
+	job, err := s.store.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == JobStatusRunning {
+		return nil, fmt.Errorf("%w: %s", ErrJobRunning, id)
+	}
+
+	job.Status = JobStatusPending
+	job.NextRun = s.clock.Now()
+	if err := s.store.UpdateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	s.signalCronWakeup()
+	return job, nil
+}
+
+// RescheduleJob changes the schedule of a recurring job and moves its next
+// run to the first time the new schedule fires. A job running at the time
+// is left alone and ErrJobRunning is returned, as finishing the run would
+// write its old schedule back.
+func (s *Scheduler) RescheduleJob(ctx context.Context, id, schedule string) (*Job, error) {
+	s.JobMu.Lock()
+	defer s.JobMu.Unlock()
+
+	job, err := s.store.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.OneShot {
+		return nil, fmt.Errorf("job %s runs once and has no schedule to change", id)
+	}
+	if job.Status == JobStatusRunning {
+		return nil, fmt.Errorf("%w: %s", ErrJobRunning, id)
+	}
+
+	loc, err := loadTimezone(job.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	sched, err := ParseScheduleInLocation(schedule, loc)
+	if err != nil {
+		return nil, err
+	}
+	nextRun := s.nextJitteredRun(sched, job.ID, s.clock.Now())
+	if nextRun.IsZero() {
+		return nil, fmt.Errorf("%w: %q", ErrImpossibleSchedule, schedule)
 	}
 
-	// Apply limit
-	if opts.Limit > 0 && len(filtered) > opts.Limit {
-		filtered = filtered[:opts.Limit]
+	job.Schedule = schedule
+	job.NextRun = nextRun
+	if job.Status == JobStatusDead && job.LastError == ErrImpossibleSchedule.Error() {
+		// The old schedule had run out; the new one brings the job back
+		job.Status = JobStatusPending
+		job.LastError = ""
+	}
+	if err := s.store.UpdateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	s.signalCronWakeup()
+	return job, nil
+}
+
+// ListJobs returns a list of jobs matching the given options
+func (s *Scheduler) ListJobs(ctx context.Context, opts *ListJobsOptions) ([]*Job, error) {
+	if opts == nil {
+		opts = &ListJobsOptions{}
+	}
+
+	filter := JobFilter{
+		UserID:       opts.UserID,
+		Type:         opts.Type,
+		Status:       opts.Status,
+		NextRun:      opts.Before,
+		NextRunAfter: opts.After,
+		Limit:        opts.Limit,
+		Offset:       opts.Offset,
+		OrderBy:      opts.OrderBy,
 	}
 
-	return filtered, nil
+	return s.store.ListJobs(ctx, filter)
 } 
\ No newline at end of file
@@ -8,6 +8,14 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"gmaildigest-go/internal/worker"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"bytes"
+	"sync"
+	"gmaildigest-go/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/assert"
 )
@@ -48,6 +56,240 @@ func TestScheduler_ScheduleJob(t *testing.T) {
 	assert.Equal(t, "* * * * *", job.Schedule)
 }
 
+// Test: An invalid cron schedule is rejected without storing a job
+func TestScheduler_ScheduleJob_InvalidSchedule(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+
+	_, err = scheduler.ScheduleJob("user1", "test", "* * *", nil)
+	assert.ErrorContains(t, err, "invalid cron expression")
+	_, err = scheduler.ScheduleJobInTimezone("user1", "test", "61 * * * *", "Europe/Berlin", nil)
+	assert.Error(t, err)
+	assert.Error(t, scheduler.ScheduleDigest(ctx, "user1", "@fortnightly"))
+
+	jobs, err := scheduler.ListJobs(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+// Test: Jobs scheduled in a timezone persist it and compute NextRun there
+func TestScheduler_ScheduleJobInTimezone(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	job, err := scheduler.ScheduleJobInTimezone("user1", "digest", "0 9 * * *", "Asia/Tokyo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", job.Timezone)
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	local := job.NextRun.In(tokyo)
+	assert.Equal(t, 9, local.Hour())
+	assert.Equal(t, 0, local.Minute())
+
+	saved, err := scheduler.store.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", saved.Timezone)
+
+	_, err = scheduler.ScheduleJobInTimezone("user1", "digest", "0 9 * * *", "Mars/Olympus", nil)
+	assert.Error(t, err)
+}
+
+// Test: One-shot jobs run once and are not rescheduled
+func TestScheduler_ScheduleOnceJob(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	executed := make(chan struct{}, 2)
+	scheduler.RegisterHandler("reminder", func(ctx context.Context, job *Job) error {
+		executed <- struct{}{}
+		return nil
+	})
+
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	job, err := scheduler.ScheduleOnceJob("user1", "reminder", time.Now(), map[string]string{"msg": "hi"})
+	require.NoError(t, err)
+	assert.True(t, job.OneShot)
+
+	select {
+	case <-executed:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("one-shot job was not executed")
+	}
+
+	require.Eventually(t, func() bool {
+		saved, err := scheduler.store.GetJob(ctx, job.ID)
+		return err == nil && saved.Status == JobStatusCompleted
+	}, time.Second, 10*time.Millisecond)
+
+	saved, err := scheduler.store.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.True(t, saved.OneShot)
+	assert.True(t, saved.NextRun.IsZero())
+
+	// A completed one-shot job is never dispatched again
+	scheduler.ForceCheck()
+	select {
+	case <-executed:
+		t.Fatal("one-shot job ran twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = scheduler.ScheduleOnceJob("user1", "reminder", time.Time{}, nil)
+	assert.Error(t, err)
+}
+
+// Test: One-shot jobs scheduled without deduplication are all kept
+func TestScheduler_ScheduleOnceJobNoDedup(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+
+	runAt := time.Now().Add(time.Hour)
+	first, err := scheduler.ScheduleOnceJobNoDedup("user1", "send_email", runAt, map[string]string{"message_id": "a"})
+	require.NoError(t, err)
+	second, err := scheduler.ScheduleOnceJobNoDedup("user1", "send_email", runAt, map[string]string{"message_id": "b"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{UserID: "user1", Type: "send_email"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	for _, job := range jobs {
+		assert.True(t, job.OneShot)
+		assert.Equal(t, JobStatusPending, job.Status)
+		assert.WithinDuration(t, runAt, job.NextRun, time.Second)
+	}
+
+	// ScheduleOnceJob still replaces a job with the same user, type and time
+	deduped, err := scheduler.ScheduleOnceJob("user1", "reminder", runAt, map[string]string{"msg": "hi"})
+	require.NoError(t, err)
+	again, err := scheduler.ScheduleOnceJob("user1", "reminder", runAt, map[string]string{"msg": "bye"})
+	require.NoError(t, err)
+	assert.Equal(t, deduped.ID, again.ID)
+	assert.JSONEq(t, `{"msg":"bye"}`, string(again.Payload))
+}
+
+// Test: Jobs left running by a crashed process are recovered on startup
+func TestScheduler_RecoversStaleRunningJobs(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	store := NewSQLiteJobStore(db)
+	require.NoError(t, store.Initialize(ctx))
+
+	staleRun := time.Now().Add(-2 * DefaultStaleJobThreshold)
+	stale := createTestJob("user1", "stale")
+	stale.Status = JobStatusRunning
+	stale.LastRun = &staleRun
+	require.NoError(t, store.CreateJob(ctx, stale))
+
+	recentRun := time.Now().Add(-time.Minute)
+	recent := createTestJob("user1", "recent")
+	recent.Status = JobStatusRunning
+	recent.LastRun = &recentRun
+	require.NoError(t, store.CreateJob(ctx, recent))
+
+	before := time.Now()
+	_, err = NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+
+	// The SQLite store belongs to this process, so however recently a job
+	// started, nothing else is running it
+	for _, id := range []string{stale.ID, recent.ID} {
+		got, err := store.GetJob(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusPending, got.Status)
+		assert.False(t, got.NextRun.Before(before))
+		assert.False(t, got.NextRun.After(time.Now()))
+	}
+}
+
+// Test: A shared store's running jobs are left alone at startup and
+// recovered by the scheduling loop once they pass the threshold
+func TestScheduler_SharedStoreRecoversStaleJobsPeriodically(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := NewSQLiteJobStore(db)
+	require.NoError(t, store.Initialize(ctx))
+
+	const threshold = 10 * time.Minute
+	clock := NewFakeClock(time.Now())
+
+	// Started just under the threshold ago, so stale by the first check
+	staleRun := clock.Now().Add(-threshold + time.Minute)
+	stale := createTestJob("user1", "stale")
+	stale.Status = JobStatusRunning
+	stale.LastRun = &staleRun
+	require.NoError(t, store.CreateJob(ctx, stale))
+
+	recentRun := clock.Now()
+	recent := createTestJob("user1", "recent")
+	recent.Status = JobStatusRunning
+	recent.LastRun = &recentRun
+	require.NoError(t, store.CreateJob(ctx, recent))
+
+	scheduler, err := NewSchedulerWithStore(ctx, store, worker.NewWorkerPool(1),
+		WithClock(clock), WithStaleJobThreshold(threshold))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	got, err := store.GetJob(ctx, stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusRunning, got.Status, "another instance may still be running it")
+
+	// The loop waits on its next job and on the recovery check
+	scheduler.Start()
+	require.Eventually(t, func() bool { return clock.PendingTimers() == 2 }, time.Second, time.Millisecond)
+	clock.Advance(threshold / 2)
+
+	// Once reset the job is due straight away, so it may already have been
+	// claimed again by the time it is read
+	require.Eventually(t, func() bool {
+		got, err := store.GetJob(ctx, stale.ID)
+		return err == nil && (got.Status != JobStatusRunning || !got.LastRun.Equal(staleRun))
+	}, time.Second, time.Millisecond)
+
+	got, err = store.GetJob(ctx, recent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusRunning, got.Status)
+	assert.True(t, got.LastRun.Equal(recentRun))
+}
+
 // Test: Recurring job handling
 func TestScheduler_RecurringJobs(t *testing.T) {
 	// TODO: Test that recurring jobs are executed at the correct intervals
@@ -78,14 +320,391 @@ func TestScheduler_JobDeduplication(t *testing.T) {
 	// TODO: Test that scheduling a job with the same type and user deduplicates (updates/reschedules) the job
 }
 
-// Test: Generic payload support
-func TestScheduler_GenericPayloadSupport(t *testing.T) {
-	// TODO: Test that jobs can accept and persist generic (e.g., JSON-encoded) payloads
-}
+// Test: Generic payload support
+func TestScheduler_GenericPayloadSupport(t *testing.T) {
+	// TODO: Test that jobs can accept and persist generic (e.g., JSON-encoded) payloads
+}
+
+// Test: Retry and dead letter handling
+func TestScheduler_DeadLetterHandling(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+	scheduler.SetMaxRetries(3)
+
+	job, err := scheduler.ScheduleJob("user1", "test", "* * * * *", nil)
+	require.NoError(t, err)
+
+	task := NewJobTask(ctx, job, scheduler.registry)
+	task.scheduler = scheduler
+
+	for i := 1; i < 3; i++ {
+		task.OnFailure(errors.New("boom"))
+		assert.Equal(t, JobStatusFailed, job.Status)
+		assert.Equal(t, i, job.RetryCount)
+		assert.False(t, job.NextRun.IsZero())
+	}
+
+	// The final failure moves the job to the dead state
+	task.OnFailure(errors.New("boom"))
+	assert.Equal(t, JobStatusDead, job.Status)
+	assert.True(t, job.NextRun.IsZero())
+
+	dead, err := scheduler.ListDeadJobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, job.ID, dead[0].ID)
+	assert.Equal(t, "boom", dead[0].LastError)
+
+	requeued, err := scheduler.RequeueDeadJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusPending, requeued.Status)
+	assert.Equal(t, 0, requeued.RetryCount)
+	assert.False(t, requeued.NextRun.IsZero())
+
+	dead, err = scheduler.ListDeadJobs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	// Only dead jobs can be requeued
+	_, err = scheduler.RequeueDeadJob(ctx, job.ID)
+	assert.Error(t, err)
+}
+
+// Test: The dead letter hook fires once, when retries are exhausted or a failure is permanent
+func TestScheduler_DeadLetterHook(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	scheduler.SetMaxRetries(3)
+
+	notified := make(chan *Job, 10)
+	scheduler.SetDeadLetterHook(func(job *Job) { notified <- job })
+	expectNoNotification := func() {
+		select {
+		case job := <-notified:
+			t.Fatalf("unexpected dead letter notification for job %s", job.ID)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	job, err := scheduler.ScheduleJob("user1", "test", "* * * * *", nil)
+	require.NoError(t, err)
+	task := NewJobTask(ctx, job, scheduler.registry)
+	task.scheduler = scheduler
+
+	for i := 1; i < 3; i++ {
+		task.OnFailure(errors.New("boom"))
+	}
+	expectNoNotification()
+
+	task.OnFailure(errors.New("boom"))
+	select {
+	case got := <-notified:
+		assert.Equal(t, job.ID, got.ID)
+		assert.Equal(t, JobStatusDead, got.Status)
+		assert.Equal(t, 3, got.RetryCount)
+		assert.Equal(t, "boom", got.LastError)
+	case <-time.After(time.Second):
+		t.Fatal("dead letter hook was not called")
+	}
+	expectNoNotification()
+
+	// A permanent failure skips the remaining retries
+	permanent, err := scheduler.ScheduleJob("user2", "test", "* * * * *", nil)
+	require.NoError(t, err)
+	task = NewJobTask(ctx, permanent, scheduler.registry)
+	task.scheduler = scheduler
+	task.OnFailure(fmt.Errorf("%w: bad payload", ErrPermanent))
+	select {
+	case got := <-notified:
+		assert.Equal(t, permanent.ID, got.ID)
+	case <-time.After(time.Second):
+		t.Fatal("dead letter hook was not called")
+	}
+	expectNoNotification()
+}
+
+// Test: Jobs that do not fit in the worker queue stay pending and are retried shortly
+func TestScheduler_RequeuesOnBackpressure(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	// Not started, so the single queue slot stays occupied
+	pool := worker.NewWorkerPoolWithConfig(1, 1)
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	now := time.Now()
+	first, err := scheduler.ScheduleOnceJob("user1", "test", now.Add(-2*time.Second), nil)
+	require.NoError(t, err)
+	second, err := scheduler.ScheduleOnceJob("user2", "test", now.Add(-time.Second), nil)
+	require.NoError(t, err)
+
+	scheduler.dispatchDueJobs(now)
+
+	got, err := scheduler.store.GetJob(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusRunning, got.Status)
+
+	got, err = scheduler.store.GetJob(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusPending, got.Status)
+	assert.True(t, got.NextRun.After(now))
+	assert.False(t, got.NextRun.After(time.Now().Add(BackpressureRetryDelay)))
+
+	// The requeued job is not due yet, so nothing more is dispatched
+	scheduler.dispatchDueJobs(now)
+	metrics := pool.GetMetrics()
+	assert.Equal(t, int64(1), metrics.QueuedTasks())
+}
+
+// Test: A NoOverlap job never runs twice at once, even when it falls due again
+// or its run outlives the stale job threshold
+func TestScheduler_NoOverlapSkipsRunsInProgress(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(4)
+	pool.Start()
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	var mu sync.Mutex
+	var active, maxActive, runs int
+	release := make(chan struct{})
+	scheduler.RegisterHandler("slow", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		active++
+		runs++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return nil
+	})
+
+	opts := ScheduleOptions{NoOverlap: true}
+	job, err := scheduler.ScheduleJobWithOptions("user1", "slow", "* * * * *", nil, opts)
+	require.NoError(t, err)
+	assert.True(t, job.NoOverlap)
+	other, err := scheduler.ScheduleJobWithOptions("user1", "slow", "*/2 * * * *", nil, opts)
+	require.NoError(t, err)
+
+	// Both jobs fall due every simulated minute while the first run is blocked
+	for i := 1; i <= 5; i++ {
+		if i > 1 {
+			_, err := scheduler.RecoverStaleJobs(ctx, time.Nanosecond)
+			require.NoError(t, err)
+		}
+		scheduler.dispatchDueJobs(time.Now().Add(time.Duration(i) * time.Hour))
+	}
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs == 1
+	}, time.Second, 10*time.Millisecond)
+	got, err := scheduler.store.GetJob(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusPending, got.Status)
+	assert.True(t, got.NextRun.After(time.Now()))
+
+	close(release)
+	require.Eventually(t, func() bool {
+		got, err := scheduler.store.GetJob(ctx, job.ID)
+		return err == nil && got.Status == JobStatusCompleted
+	}, time.Second, 10*time.Millisecond)
+
+	// With the run finished the next due run goes ahead
+	scheduler.dispatchDueJobs(time.Now().Add(10 * time.Hour))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs == 2 && active == 0
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, maxActive)
+}
+
+// Test: Job types are dequeued by their configured priority
+func TestScheduler_JobPriorities(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	// A single worker started after dispatch, so all jobs wait in the queue together
+	pool := worker.NewWorkerPoolWithConfig(1, 10)
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+	scheduler.SetJobPriority("cleanup", -1)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, job.Type)
+		return nil
+	}
+	for _, jobType := range []string{"cleanup", "digest", "token_refresh"} {
+		scheduler.RegisterHandler(jobType, record)
+	}
+
+	// Claimed in next_run order: cleanup, digest, token_refresh
+	now := time.Now()
+	for i, jobType := range []string{"cleanup", "digest", "token_refresh"} {
+		_, err := scheduler.ScheduleOnceJob("user1", jobType, now.Add(time.Duration(i-3)*time.Second), nil)
+		require.NoError(t, err)
+	}
+	scheduler.dispatchDueJobs(now)
+	pool.Start()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) == 3
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"token_refresh", "digest", "cleanup"}, order)
+}
+
+// Test: CancelJob stops an in-flight handler and records the cancellation
+func TestScheduler_CancelJob(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	unblocked := make(chan error, 1)
+	scheduler.RegisterHandler("blocking", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		unblocked <- ctx.Err()
+		return ctx.Err()
+	})
+
+	job, err := scheduler.ScheduleJob("user1", "blocking", "0 * * * *", nil)
+	require.NoError(t, err)
+
+	// Only running jobs can be cancelled
+	assert.Error(t, scheduler.CancelJob(ctx, job.ID))
+	assert.Error(t, scheduler.CancelJob(ctx, "missing"))
+
+	scheduler.dispatchDueJobs(time.Now().Add(2 * time.Hour))
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("handler did not start")
+	}
+
+	require.NoError(t, scheduler.CancelJob(ctx, job.ID))
+	select {
+	case err := <-unblocked:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("CancelJob did not unblock the handler")
+	}
+
+	require.Eventually(t, func() bool {
+		got, err := scheduler.store.GetJob(ctx, job.ID)
+		return err == nil && got.Status == JobStatusFailed
+	}, time.Second, 10*time.Millisecond)
+
+	got, err := scheduler.store.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ErrJobCancelled.Error(), got.LastError)
+	assert.Equal(t, 0, got.RetryCount)
+	assert.True(t, got.NextRun.After(time.Now()))
+
+	// The run is over, so there is nothing left to cancel
+	assert.Error(t, scheduler.CancelJob(ctx, job.ID))
+}
+
+// Test: RunJobNow dispatches a job ahead of its schedule and DeleteJob removes it
+func TestScheduler_RunJobNowAndDeleteJob(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	ran := make(chan string, 1)
+	scheduler.RegisterHandler("manual", func(ctx context.Context, job *Job) error {
+		ran <- job.ID
+		return nil
+	})
+
+	job, err := scheduler.ScheduleJob("user1", "manual", "0 0 1 1 *", nil)
+	require.NoError(t, err)
+
+	forced, err := scheduler.RunJobNow(ctx, job.ID)
+	require.NoError(t, err)
+	assert.False(t, forced.NextRun.After(time.Now()))
+	select {
+	case id := <-ran:
+		assert.Equal(t, job.ID, id)
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunJobNow did not dispatch the job")
+	}
+
+	// Once the run finishes the job goes back to its yearly schedule
+	require.Eventually(t, func() bool {
+		got, err := scheduler.GetJob(ctx, job.ID)
+		return err == nil && got.Status == JobStatusCompleted && got.NextRun.After(time.Now())
+	}, time.Second, 10*time.Millisecond)
 
-// Test: Retry and dead letter handling
-func TestScheduler_DeadLetterHandling(t *testing.T) {
-	// TODO: Test that jobs are retried up to 10 times and then moved to a dead letter queue/failure routine
+	require.NoError(t, scheduler.DeleteJob(ctx, job.ID))
+	_, err = scheduler.GetJob(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.ErrorIs(t, scheduler.DeleteJob(ctx, job.ID), ErrJobNotFound)
+	_, err = scheduler.RunJobNow(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
 }
 
 // Test: Scheduler dispatches jobs to WorkerPool
@@ -94,6 +713,8 @@ func TestScheduler_DispatchesJobsToWorkerPool(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
 
 	ctx := context.Background()
 	pool := worker.NewWorkerPool(2)
@@ -141,19 +762,22 @@ func TestScheduler_RegisterTokenRefreshHandler(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
 
 	ctx := context.Background()
 	pool := worker.NewWorkerPool(1)
 	pool.Start()
 	defer pool.Stop()
 
-	scheduler, err := NewScheduler(ctx, db, pool)
+	clock := NewFakeClock(time.Date(2024, 3, 1, 10, 2, 0, 0, time.UTC))
+	scheduler, err := NewScheduler(ctx, db, pool, WithClock(clock))
 	require.NoError(t, err)
 
 	// Register a token refresh handler
-	handlerCalled := false
+	called := make(chan struct{}, 1)
 	scheduler.RegisterTokenRefreshHandler(func(ctx context.Context, job *Job) error {
-		handlerCalled = true
+		called <- struct{}{}
 		return nil
 	})
 
@@ -161,24 +785,660 @@ func TestScheduler_RegisterTokenRefreshHandler(t *testing.T) {
 	scheduler.Start()
 	defer scheduler.Stop()
 
-	// Wait for the scheduler to start
-	time.Sleep(100 * time.Millisecond)
-
-	// Schedule a token refresh job
+	// Schedule a token refresh job, due at 10:05
 	payload := TokenRefreshPayload{UserID: "user1"}
 	payloadBytes, err := json.Marshal(payload)
 	require.NoError(t, err)
 
 	job, err := scheduler.ScheduleJob("user1", "token_refresh", "*/5 * * * *", json.RawMessage(payloadBytes))
 	require.NoError(t, err)
+	assert.WithinDuration(t, time.Date(2024, 3, 1, 10, 5, 0, 0, time.UTC), job.NextRun, 0)
 
-	// Set the job's next run time to now
-	job.NextRun = time.Now()
-	err = scheduler.store.UpdateJob(ctx, job)
+	// Nothing runs until the clock reaches the job's next run
+	require.Eventually(t, func() bool { return clock.PendingTimers() > 0 }, time.Second, time.Millisecond)
+	select {
+	case <-called:
+		t.Fatal("token refresh ran before it was due")
+	default:
+	}
+
+	clock.Advance(3 * time.Minute)
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("token refresh was not executed once due")
+	}
+
+	// The next run is computed from the fake clock too
+	assert.Eventually(t, func() bool {
+		got, err := scheduler.GetJob(ctx, job.ID)
+		return err == nil && got.NextRun.Equal(time.Date(2024, 3, 1, 10, 10, 0, 0, time.UTC))
+	}, time.Second, 10*time.Millisecond)
+}
+
+// Test: Finished jobs stay in the store and are never held in memory or dispatched
+func TestScheduler_DoesNotReloadFinishedJobs(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
-	scheduler.signalCronWakeup()
+	defer db.Close()
 
-	// Wait for the job to be executed
-	time.Sleep(100 * time.Millisecond)
-	assert.True(t, handlerCalled)
+	ctx := context.Background()
+	store := NewSQLiteJobStore(db)
+	require.NoError(t, store.Initialize(ctx))
+
+	now := time.Now().UTC()
+	oneShot := createTestJob("user1", "test")
+	oneShot.Status = JobStatusCompleted
+	oneShot.OneShot = true
+	oneShot.NextRun = time.Time{}
+	require.NoError(t, store.CreateJob(ctx, oneShot))
+
+	dead := createTestJob("user2", "test")
+	dead.Status = JobStatusDead
+	dead.NextRun = time.Time{}
+	require.NoError(t, store.CreateJob(ctx, dead))
+
+	recurring := createTestJob("user3", "test")
+	recurring.Status = JobStatusCompleted
+	recurring.NextRun = now.Add(time.Hour)
+	require.NoError(t, store.CreateJob(ctx, recurring))
+
+	due := createTestJob("user4", "test")
+	due.NextRun = now.Add(-time.Minute)
+	require.NoError(t, store.CreateJob(ctx, due))
+
+	// Not started, so dispatched jobs stay in flight
+	pool := worker.NewWorkerPoolWithConfig(1, 10)
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	assert.WithinDuration(t, due.NextRun, scheduler.findNextJobTime(), time.Second)
+	scheduler.dispatchDueJobs(now)
+
+	// Only the due job was claimed, and it is the only one in memory
+	scheduler.JobMu.Lock()
+	assert.Len(t, scheduler.running, 1)
+	assert.Contains(t, scheduler.running, due.ID)
+	scheduler.JobMu.Unlock()
+
+	for _, job := range []*Job{oneShot, dead, recurring} {
+		got, err := store.GetJob(ctx, job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, job.Status, got.Status)
+	}
+	assert.WithinDuration(t, recurring.NextRun, scheduler.findNextJobTime(), time.Second)
+
+	counts := scheduler.CountJobsByStatus()
+	assert.Equal(t, 2, counts[string(JobStatusCompleted)])
+	assert.Equal(t, 1, counts[string(JobStatusDead)])
+	assert.Equal(t, 1, counts[string(JobStatusRunning)])
+	assert.Equal(t, 0, counts[string(JobStatusPending)])
+}
+
+// BenchmarkScheduler_FindNextJobTime measures a scheduling pass over a store
+// holding a large history of finished jobs
+func BenchmarkScheduler_FindNextJobTime(b *testing.B) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(b, err)
+	defer db.Close()
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	store := NewSQLiteJobStore(db)
+	require.NoError(b, store.Initialize(ctx))
+
+	for i := 0; i < 10000; i++ {
+		job := createTestJob(fmt.Sprintf("user%d", i), "digest")
+		job.Status = JobStatusCompleted
+		job.OneShot = true
+		job.NextRun = time.Time{}
+		if i%10 == 0 {
+			job.Status = JobStatusDead
+		}
+		require.NoError(b, store.CreateJob(ctx, job))
+	}
+	require.NoError(b, store.CreateJob(ctx, createTestJob("pending", "digest")))
+
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scheduler.findNextJobTime()
+		scheduler.dispatchDueJobs(time.Now())
+	}
+}
+
+// Test: StopWithTimeout stops dispatching and lets running jobs finish
+func TestScheduler_StopWithTimeoutDrainsRunningJobs(t *testing.T) {
+	newScheduler := func(t *testing.T) *Scheduler {
+		db, err := sql.Open("sqlite3", ":memory:")
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		// The scheduler loop and workers share the one :memory: database
+		db.SetMaxOpenConns(1)
+
+		pool := worker.NewWorkerPool(2)
+		pool.Start()
+		t.Cleanup(pool.Stop)
+		scheduler, err := NewScheduler(context.Background(), db, pool)
+		require.NoError(t, err)
+		t.Cleanup(scheduler.Stop)
+		return scheduler
+	}
+
+	t.Run("drains", func(t *testing.T) {
+		scheduler := newScheduler(t)
+		ctx := context.Background()
+
+		started := make(chan string, 2)
+		scheduler.RegisterHandler("slow", func(ctx context.Context, job *Job) error {
+			started <- job.ID
+			select {
+			case <-time.After(300 * time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		scheduler.Start()
+
+		job, err := scheduler.ScheduleOnceJob("user1", "slow", time.Now(), nil)
+		require.NoError(t, err)
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("job was not started")
+		}
+		// Becomes due while the first job is draining
+		later, err := scheduler.ScheduleOnceJob("user2", "slow", time.Now().Add(100*time.Millisecond), nil)
+		require.NoError(t, err)
+
+		require.NoError(t, scheduler.StopWithTimeout(5*time.Second))
+
+		saved, err := scheduler.store.GetJob(ctx, job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusCompleted, saved.Status)
+		saved, err = scheduler.store.GetJob(ctx, later.ID)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusPending, saved.Status, "no job is dispatched once stopping")
+		assert.Len(t, started, 0)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		scheduler := newScheduler(t)
+		ctx := context.Background()
+
+		started := make(chan struct{}, 1)
+		scheduler.RegisterHandler("stuck", func(ctx context.Context, job *Job) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		scheduler.Start()
+
+		job, err := scheduler.ScheduleOnceJob("user1", "stuck", time.Now(), nil)
+		require.NoError(t, err)
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("job was not started")
+		}
+
+		err = scheduler.StopWithTimeout(50 * time.Millisecond)
+		assert.ErrorIs(t, err, worker.ErrStopTimeout)
+		assert.ErrorContains(t, err, "1 jobs still running")
+
+		// The job is cancelled and left for stale job recovery
+		saved, err := scheduler.store.GetJob(ctx, job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusRunning, saved.Status)
+	})
+}
+
+// Test: Runs missed while no scheduler was running follow the job's CatchUpPolicy
+func TestScheduler_CatchUpPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   CatchUpPolicy
+		wantRuns int
+	}{
+		{name: "default", policy: "", wantRuns: 1},
+		{name: "latest", policy: CatchUpLatest, wantRuns: 1},
+		// The slots three, two and one hours ago and the one this hour
+		{name: "all", policy: CatchUpAll, wantRuns: 4},
+		{name: "skip", policy: CatchUpSkip, wantRuns: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", ":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+			// The scheduler loop and workers share the one :memory: database
+			db.SetMaxOpenConns(1)
+
+			ctx := context.Background()
+			pool := worker.NewWorkerPool(1)
+			pool.Start()
+			defer pool.Stop()
+			scheduler, err := NewScheduler(ctx, db, pool)
+			require.NoError(t, err)
+			defer scheduler.Stop()
+
+			var mu sync.Mutex
+			runs := 0
+			scheduler.RegisterHandler("hourly", func(ctx context.Context, job *Job) error {
+				mu.Lock()
+				runs++
+				mu.Unlock()
+				return nil
+			})
+
+			job, err := scheduler.ScheduleJobWithOptions("user1", "hourly", "0 * * * *", nil, ScheduleOptions{CatchUp: tt.policy})
+			require.NoError(t, err)
+			assert.Equal(t, tt.policy, job.CatchUp)
+
+			// The job was due several intervals ago
+			job.NextRun = time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+			require.NoError(t, scheduler.store.UpdateJob(ctx, job))
+			scheduler.Start()
+
+			require.Eventually(t, func() bool {
+				saved, err := scheduler.store.GetJob(ctx, job.ID)
+				return err == nil && saved.Status != JobStatusRunning && saved.NextRun.After(time.Now())
+			}, 2*time.Second, 10*time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.wantRuns, runs)
+		})
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	scheduler, err := NewScheduler(context.Background(), db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+	_, err = scheduler.ScheduleJobWithOptions("user1", "hourly", "0 * * * *", nil, ScheduleOptions{CatchUp: "sometimes"})
+	assert.ErrorContains(t, err, "invalid catch-up policy")
+}
+
+// Test: Re-registering a job at startup keeps its missed runs and catch-up
+// policy, so they are caught up instead of being dropped
+func TestScheduler_RescheduleKeepsMissedRuns(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	var mu sync.Mutex
+	runs := 0
+	scheduler.RegisterHandler("hourly", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		return nil
+	})
+
+	job, err := scheduler.ScheduleJobWithOptions("user1", "hourly", "0 * * * *", nil, ScheduleOptions{CatchUp: CatchUpAll})
+	require.NoError(t, err)
+
+	// The job was due several intervals ago
+	missed := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	job.NextRun = missed
+	require.NoError(t, scheduler.store.UpdateJob(ctx, job))
+
+	// Scheduling it again without a policy, as on startup, changes neither
+	again, err := scheduler.ScheduleJob("user1", "hourly", "0 * * * *", map[string]string{"v": "2"})
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, again.ID)
+	assert.True(t, again.NextRun.Equal(missed))
+	assert.Equal(t, CatchUpAll, again.CatchUp)
+	assert.JSONEq(t, `{"v":"2"}`, string(again.Payload))
+	scheduler.Start()
+
+	require.Eventually(t, func() bool {
+		saved, err := scheduler.store.GetJob(ctx, job.ID)
+		return err == nil && saved.Status != JobStatusRunning && saved.NextRun.After(time.Now())
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The slots three, two and one hours ago and the one this hour
+	assert.Equal(t, 4, runs)
+}
+
+// Test: Previews list upcoming run times and reject schedules that never fire
+func TestScheduler_PreviewSchedule(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	scheduler, err := NewScheduler(context.Background(), db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	times, err := scheduler.PreviewSchedule("0 9 * * *", 5)
+	require.NoError(t, err)
+	require.Len(t, times, 5)
+	assert.True(t, times[0].After(time.Now()))
+	for i, next := range times {
+		assert.Equal(t, 9, next.Hour())
+		assert.Zero(t, next.Minute())
+		if i > 0 {
+			assert.Equal(t, 24*time.Hour, next.Sub(times[i-1]))
+		}
+	}
+
+	_, err = scheduler.PreviewSchedule("0 0 30 2 *", 5)
+	assert.ErrorIs(t, err, ErrImpossibleSchedule)
+	_, err = scheduler.PreviewSchedule("not a cron", 5)
+	assert.Error(t, err)
+	_, err = scheduler.PreviewSchedule("0 9 * * *", 0)
+	assert.Error(t, err)
+}
+
+// Test: A schedule that never fires is rejected, and a stored job with one
+// is moved to the dead letter state after its run instead of waiting forever
+func TestScheduler_ImpossibleSchedule(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	_, err = scheduler.ScheduleJob("user1", "test", "0 0 30 2 *", nil)
+	assert.ErrorIs(t, err, ErrImpossibleSchedule)
+
+	dead := make(chan *Job, 1)
+	scheduler.SetDeadLetterHook(func(job *Job) { dead <- job })
+
+	job := &Job{
+		UserID:   "user1",
+		Type:     "test",
+		Schedule: "0 0 30 2 *",
+		Status:   JobStatusRunning,
+		NextRun:  time.Now(),
+	}
+	require.NoError(t, scheduler.store.CreateJob(ctx, job))
+
+	task := NewJobTask(ctx, job, scheduler.registry)
+	task.scheduler = scheduler
+	task.OnSuccess()
+
+	stored, err := scheduler.store.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusDead, stored.Status)
+	assert.True(t, stored.NextRun.IsZero())
+	assert.Equal(t, ErrImpossibleSchedule.Error(), stored.LastError)
+
+	select {
+	case notified := <-dead:
+		assert.Equal(t, job.ID, notified.ID)
+	case <-time.After(time.Second):
+		t.Fatal("dead letter hook was not called")
+	}
+}
+
+// Test: Start warns about pending jobs whose type has no handler
+// newTestLogger logs to w without timestamps, so tests can compare whole lines
+func newTestLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func TestScheduler_StartWarnsUnregisteredTypes(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	var logs bytes.Buffer
+	scheduler.SetLogger(newTestLogger(&logs))
+	scheduler.RegisterHandler("digest", func(ctx context.Context, job *Job) error { return nil })
+	scheduler.RegisterHandler("backup", func(ctx context.Context, job *Job) error { return nil })
+	assert.Equal(t, []string{"backup", "digest"}, scheduler.RegisteredTypes())
+
+	for i, jobType := range []string{"digest", "legacy", "legacy", "renamed"} {
+		_, err := scheduler.ScheduleJob(fmt.Sprintf("user%d", i), jobType, "0 8 * * *", nil)
+		require.NoError(t, err)
+	}
+
+	scheduler.Start()
+	assert.Equal(t,
+		"level=WARN msg=\"Pending jobs have no registered handler\" type=legacy count=2\n"+
+			"level=WARN msg=\"Pending jobs have no registered handler\" type=renamed count=1\n",
+		logs.String())
+}
+
+// failingRunStore fails every attempt to record a job run
+type failingRunStore struct {
+	JobStore
+}
+
+func (failingRunStore) RecordJobRun(ctx context.Context, run *JobRun) error {
+	return errors.New("disk full")
+}
+
+func TestScheduler_LogsRunRecordingFailures(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	var logs bytes.Buffer
+	scheduler.SetLogger(newTestLogger(&logs))
+	scheduler.store = failingRunStore{scheduler.store}
+
+	job, err := scheduler.ScheduleJob("user1", "digest", "0 8 * * *", nil)
+	require.NoError(t, err)
+
+	task := NewJobTask(ctx, job, scheduler.registry)
+	task.scheduler = scheduler
+	task.OnSuccess()
+
+	assert.Equal(t, fmt.Sprintf("level=ERROR msg=\"Failed to record job run\" job=%s error=\"disk full\"\n", job.ID), logs.String())
+}
+
+// failingClaimStore fails every attempt to claim due jobs
+type failingClaimStore struct {
+	JobStore
+}
+
+func (failingClaimStore) ClaimDueJobs(ctx context.Context, now time.Time, limit int) ([]*Job, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestScheduler_LogsClaimFailures(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	var logs bytes.Buffer
+	scheduler.SetLogger(newTestLogger(&logs))
+	scheduler.store = failingClaimStore{scheduler.store}
+
+	before := testutil.ToFloat64(metrics.JobClaimErrors)
+	scheduler.dispatchDueJobs(time.Now())
+
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.JobClaimErrors))
+	assert.Equal(t, "level=ERROR msg=\"Failed to claim due jobs\" error=\"database is locked\"\n", logs.String())
+}
+
+// failingUpdateStore fails every attempt to update a job
+type failingUpdateStore struct {
+	JobStore
+}
+
+func (failingUpdateStore) UpdateJob(ctx context.Context, job *Job) error {
+	return errors.New("database is locked")
+}
+
+func TestScheduler_LogsBackpressureRequeueFailures(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	// Not started, so the single queue slot stays occupied
+	pool := worker.NewWorkerPoolWithConfig(1, 1)
+	defer pool.Stop()
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	scheduler.SetLogger(newTestLogger(&logs))
+
+	now := time.Now()
+	_, err = scheduler.ScheduleOnceJob("user1", "test", now.Add(-2*time.Second), nil)
+	require.NoError(t, err)
+	second, err := scheduler.ScheduleOnceJob("user2", "test", now.Add(-time.Second), nil)
+	require.NoError(t, err)
+
+	scheduler.store = failingUpdateStore{scheduler.store}
+	before := testutil.ToFloat64(metrics.JobReleaseErrors.WithLabelValues("test"))
+	scheduler.dispatchDueJobs(now)
+
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.JobReleaseErrors.WithLabelValues("test")))
+	assert.Equal(t, fmt.Sprintf("level=ERROR msg=\"Failed to requeue job after the worker queue was full\" job=%s error=\"database is locked\"\n", second.ID), logs.String())
+}
+
+func TestScheduler_LogsSkipRunFailures(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	var logs bytes.Buffer
+	scheduler.SetLogger(newTestLogger(&logs))
+
+	job, err := scheduler.ScheduleJobWithOptions("user1", "skipped", "0 * * * *", nil, ScheduleOptions{CatchUp: CatchUpSkip})
+	require.NoError(t, err)
+	job.NextRun = time.Now().Add(-3 * time.Hour)
+	require.NoError(t, scheduler.store.UpdateJob(ctx, job))
+
+	scheduler.store = failingUpdateStore{scheduler.store}
+	before := testutil.ToFloat64(metrics.JobReleaseErrors.WithLabelValues("skipped"))
+	scheduler.dispatchDueJobs(time.Now())
+
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.JobReleaseErrors.WithLabelValues("skipped")))
+	assert.Equal(t, fmt.Sprintf("level=ERROR msg=\"Failed to skip job run\" job=%s error=\"database is locked\"\n", job.ID), logs.String())
+}
+
+// Test: Interval schedules run at a fixed spacing after each run
+func TestScheduler_IntervalSchedule(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	scheduler, err := NewScheduler(context.Background(), db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	before := time.Now()
+	job, err := scheduler.ScheduleJob("user1", "interval", "@every 90m", nil)
+	require.NoError(t, err)
+	assert.False(t, job.NextRun.Before(before.Add(90*time.Minute)))
+	assert.False(t, job.NextRun.After(time.Now().Add(90*time.Minute)))
+
+	after := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, after.Add(90*time.Minute), scheduler.nextRunAfter(job, after))
+
+	times, err := scheduler.PreviewSchedule("@every 90m", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, times[1].Sub(times[0]))
+	assert.Equal(t, 90*time.Minute, times[2].Sub(times[1]))
+
+	_, err = scheduler.ScheduleJob("user1", "interval", "@every never", nil)
+	assert.Error(t, err)
+}
+
+// Test: Jitter spreads jobs sharing a schedule within bounds, and each job
+// keeps the same offset across restarts
+func TestScheduler_Jitter(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	const maxJitter = 5 * time.Minute
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1), WithJitter(maxJitter))
+	require.NoError(t, err)
+	defer scheduler.Stop()
+
+	after := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	eight := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	offsets := make(map[time.Duration]bool)
+	var jobs []*Job
+	for i := 0; i < 50; i++ {
+		job, err := scheduler.ScheduleJob(fmt.Sprintf("user%d", i), "digest", "0 8 * * *", nil)
+		require.NoError(t, err)
+		jobs = append(jobs, job)
+
+		next := scheduler.nextRunAfter(job, after)
+		offset := next.Sub(eight)
+		assert.LessOrEqual(t, offset, maxJitter)
+		assert.GreaterOrEqual(t, offset, -maxJitter)
+		offsets[offset] = true
+
+		// Running at the jittered time does not drift the next run
+		assert.Equal(t, next.Add(24*time.Hour), scheduler.nextRunAfter(job, next))
+	}
+	assert.Greater(t, len(offsets), 40, "jobs should be spread across the window")
+
+	// A restarted scheduler derives the same offsets from the job IDs
+	restarted, err := NewScheduler(ctx, db, worker.NewWorkerPool(1), WithJitter(maxJitter))
+	require.NoError(t, err)
+	defer restarted.Stop()
+	for _, job := range jobs {
+		stored, err := restarted.GetJob(ctx, job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, scheduler.nextRunAfter(job, after), restarted.nextRunAfter(stored, after))
+	}
+
+	// Without jitter every job fires on the schedule
+	plain, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	defer plain.Stop()
+	assert.Equal(t, eight, plain.nextRunAfter(jobs[0], after))
 }
@@ -2,15 +2,39 @@ package scheduler
 
 import (
 	"context"
+	"gmaildigest-go/internal/storage"
 	"golang.org/x/oauth2"
+	"time"
 )
 
-// Storage defines the interface required by the TokenRefreshService
-// for handling high-level OAuth2 token operations.
+// Storage defines the interface required by the TokenRefreshService and
+// DigestJob for handling high-level OAuth2 token operations.
+// It is implemented by storage.TokenStore.
 type Storage interface {
 	// GetToken retrieves a token for a given user ID
 	GetToken(ctx context.Context, userID string) (*oauth2.Token, error)
 
 	// StoreToken stores a token for a given user ID
 	StoreToken(ctx context.Context, userID string, token *oauth2.Token) error
-} 
\ No newline at end of file
+}
+
+// RefreshRecorder records the outcome of token refreshes so accounts whose
+// refreshes keep failing can be found. It is implemented by storage.SQLiteStorage.
+type RefreshRecorder interface {
+	// RecordTokenRefresh resets the failure count after a successful refresh
+	RecordTokenRefresh(ctx context.Context, userID string, refreshedAt time.Time) error
+
+	// RecordTokenRefreshFailure counts a failed refresh and keeps its error
+	RecordTokenRefreshFailure(ctx context.Context, userID, message string) error
+
+	// SetTokenValid marks whether the user's Google grant can still be used
+	SetTokenValid(ctx context.Context, userID string, valid bool) error
+}
+
+// ValidTokenUserLister lists the users whose token can be refreshed, a page
+// at a time. It is implemented by storage.SQLiteStorage.
+type ValidTokenUserLister interface {
+	// ListUsersWithValidTokens returns up to limit users with a valid token
+	// whose ID sorts after afterID, in ID order
+	ListUsersWithValidTokens(ctx context.Context, afterID string, limit int) ([]*storage.User, error)
+}
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"golang.org/x/oauth2"
 	"net/http"
@@ -14,12 +15,34 @@ type TokenRefreshPayload struct {
 	UserID string `json:"user_id"`
 }
 
+// DefaultRefreshBeforeExpiry is how long before its expiry a token is
+// refreshed by default
+const DefaultRefreshBeforeExpiry = 5 * time.Minute
+
+// DefaultTokenRefreshSchedule is the cron schedule ScheduleAllTokenRefreshes
+// uses when none is set: every hour on the hour
+const DefaultTokenRefreshSchedule = "0 * * * *"
+
+// refreshCheckSample is how many runs of the refresh schedule are inspected
+// for the longest wait between them
+const refreshCheckSample = 64
+
+// tokenRefreshBatchSize caps how many users ScheduleAllTokenRefreshes loads at once
+const tokenRefreshBatchSize = 500
+
 // TokenRefreshService handles automatic token refresh for users
 type TokenRefreshService struct {
-	scheduler *Scheduler
-	Storage   Storage
-	Config    *oauth2.Config
-	client    *http.Client
+	scheduler           *Scheduler
+	Storage             Storage
+	Config              *oauth2.Config
+	client              *http.Client
+	recorder            RefreshRecorder
+	users               ValidTokenUserLister
+	schedule            string // cron schedule of the jobs ScheduleAllTokenRefreshes creates
+	clock               Clock
+	refreshBeforeExpiry time.Duration      // tokens expiring within this window are refreshed
+	checkPeriod         time.Duration      // longest wait between runs of schedule
+	tokenSource         oauth2.TokenSource // For testing purposes
 }
 
 // NewTokenRefreshService creates a new token refresh service
@@ -35,11 +58,15 @@ func NewTokenRefreshService(scheduler *Scheduler, storage Storage, config *oauth
 	}
 	
 	service := &TokenRefreshService{
-		scheduler: scheduler,
-		Storage:   storage,
-		Config:    config,
-		client:    http.DefaultClient,
+		scheduler:           scheduler,
+		Storage:             storage,
+		Config:              config,
+		client:              http.DefaultClient,
+		schedule:            DefaultTokenRefreshSchedule,
+		clock:               scheduler.clock,
+		refreshBeforeExpiry: DefaultRefreshBeforeExpiry,
 	}
+	service.checkPeriod = refreshCheckPeriod(service.schedule, service.now())
 
 	// Register the token refresh handler
 	scheduler.RegisterTokenRefreshHandler(service.HandleTokenRefresh)
@@ -55,7 +82,45 @@ func (s *TokenRefreshService) SetClient(client *http.Client) {
 	s.client = client
 }
 
-// ScheduleTokenRefresh schedules a token refresh job for a user
+// SetRefreshRecorder sets where the outcome of each refresh is recorded.
+// Refreshes are not tracked when it is nil.
+func (s *TokenRefreshService) SetRefreshRecorder(recorder RefreshRecorder) {
+	s.recorder = recorder
+}
+
+// SetUserLister sets where ScheduleAllTokenRefreshes finds the users to
+// schedule refreshes for
+func (s *TokenRefreshService) SetUserLister(users ValidTokenUserLister) {
+	s.users = users
+}
+
+// SetRefreshSchedule sets the cron schedule of the jobs
+// ScheduleAllTokenRefreshes creates. Empty uses DefaultTokenRefreshSchedule.
+// The refresh window is never shorter than the longest wait between its runs.
+func (s *TokenRefreshService) SetRefreshSchedule(schedule string) {
+	if schedule == "" {
+		schedule = DefaultTokenRefreshSchedule
+	}
+	s.schedule = schedule
+	s.checkPeriod = refreshCheckPeriod(schedule, s.now())
+}
+
+// SetClock sets the clock token expiries are checked against. The default is
+// the scheduler's clock.
+func (s *TokenRefreshService) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// SetRefreshBeforeExpiry sets how long before its expiry a token is
+// refreshed. A window of 0 refreshes only tokens that have expired. A window
+// shorter than the longest wait between runs of the refresh schedule is
+// raised to it, so a token cannot expire before the next check.
+func (s *TokenRefreshService) SetRefreshBeforeExpiry(window time.Duration) {
+	s.refreshBeforeExpiry = window
+}
+
+// ScheduleTokenRefresh schedules a token refresh job for a user, replacing
+// any token refresh job of theirs left from a different schedule
 func (s *TokenRefreshService) ScheduleTokenRefresh(ctx context.Context, userID string, schedule string) error {
 	if userID == "" {
 		return fmt.Errorf("userID cannot be empty")
@@ -63,6 +128,23 @@ func (s *TokenRefreshService) ScheduleTokenRefresh(ctx context.Context, userID s
 	if schedule == "" {
 		return fmt.Errorf("schedule cannot be empty")
 	}
+	if _, err := ParseSchedule(schedule); err != nil {
+		return err
+	}
+
+	existing, err := s.scheduler.store.ListJobs(ctx, JobFilter{UserID: userID, Type: "token_refresh"})
+	if err != nil {
+		return fmt.Errorf("failed to list token refresh jobs: %w", err)
+	}
+	for _, job := range existing {
+		if job.Schedule == schedule {
+			continue
+		}
+		// Another instance may have replaced it already
+		if err := s.scheduler.DeleteJob(ctx, job.ID); err != nil && !errors.Is(err, ErrJobNotFound) {
+			return fmt.Errorf("failed to replace token refresh job: %w", err)
+		}
+	}
 
 	payload := TokenRefreshPayload{
 		UserID: userID,
@@ -77,6 +159,42 @@ func (s *TokenRefreshService) ScheduleTokenRefresh(ctx context.Context, userID s
 	return err
 }
 
+// ScheduleAllTokenRefreshes schedules a refresh job on the refresh schedule
+// for every user with a valid token, returning how many it scheduled. Users
+// are loaded in batches so thousands of them are never held at once, and
+// jobs are deduplicated, so running it again at each start is safe. A user
+// whose job cannot be scheduled does not stop the rest; the errors are joined.
+func (s *TokenRefreshService) ScheduleAllTokenRefreshes(ctx context.Context) (int, error) {
+	if s.users == nil {
+		return 0, fmt.Errorf("no user lister set")
+	}
+
+	var (
+		scheduled int
+		errs      []error
+		afterID   string
+	)
+	for {
+		users, err := s.users.ListUsersWithValidTokens(ctx, afterID, tokenRefreshBatchSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list users with valid tokens: %w", err))
+			break
+		}
+		for _, user := range users {
+			if err := s.ScheduleTokenRefresh(ctx, user.ID, s.schedule); err != nil {
+				errs = append(errs, fmt.Errorf("failed to schedule token refresh for user %s: %w", user.ID, err))
+				continue
+			}
+			scheduled++
+		}
+		if len(users) < tokenRefreshBatchSize {
+			break
+		}
+		afterID = users[len(users)-1].ID
+	}
+	return scheduled, errors.Join(errs...)
+}
+
 // HandleTokenRefresh handles a token refresh job
 func (s *TokenRefreshService) HandleTokenRefresh(ctx context.Context, job *Job) error {
 	if job == nil {
@@ -99,25 +217,34 @@ func (s *TokenRefreshService) HandleTokenRefresh(ctx context.Context, job *Job)
 	}
 
 	// Check if the token needs to be refreshed
-	if token.Valid() {
+	if !s.needsRefresh(token) {
 		// Update job status and schedule next run
 		job.Status = JobStatusCompleted
 		job.LastError = ""
 		job.RetryCount = 0
-		job.NextRun = time.Now().Add(time.Hour) // Default: refresh every hour
+		job.NextRun = s.now().Add(time.Hour) // Default: refresh every hour
 		return nil
 	}
 
 	// Create a context with the HTTP client
 	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.client)
 
-	// Create a token source from the existing token
-	tokenSource := s.Config.TokenSource(ctx, token)
+	// Create a token source from the refresh token alone, so a token that is
+	// still valid but due for refresh is not handed back unchanged
+	tokenSource := s.tokenSource
+	if tokenSource == nil {
+		tokenSource = s.Config.TokenSource(ctx, &oauth2.Token{RefreshToken: token.RefreshToken})
+	}
 
 	// Get a new token
 	newToken, err := tokenSource.Token()
 	if err != nil {
-		return fmt.Errorf("failed to refresh token: %w", err)
+		return s.refreshFailed(ctx, payload.UserID, err)
+	}
+
+	// Preserve the refresh token if the new token doesn't have one
+	if newToken.RefreshToken == "" {
+		newToken.RefreshToken = token.RefreshToken
 	}
 
 	// Store the new token
@@ -125,11 +252,107 @@ func (s *TokenRefreshService) HandleTokenRefresh(ctx context.Context, job *Job)
 		return fmt.Errorf("failed to store refreshed token: %w", err)
 	}
 
+	if s.recorder != nil {
+		if err := s.recorder.RecordTokenRefresh(ctx, payload.UserID, s.now()); err != nil {
+			return fmt.Errorf("failed to record token refresh: %w", err)
+		}
+	}
+
 	// Update job status and schedule next run
 	job.Status = JobStatusCompleted
 	job.LastError = ""
 	job.RetryCount = 0
-	job.NextRun = time.Now().Add(time.Hour) // Default: refresh every hour
+	job.NextRun = s.now().Add(time.Hour) // Default: refresh every hour
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// needsRefresh reports whether token is due for refresh by the service's clock
+func (s *TokenRefreshService) needsRefresh(token *oauth2.Token) bool {
+	return NeedsRefresh(token, s.now(), s.refreshWindow())
+}
+
+// refreshWindow is how long before its expiry a token is refreshed: the
+// configured window, or the refresh schedule's period when that is longer
+func (s *TokenRefreshService) refreshWindow() time.Duration {
+	if s.checkPeriod > s.refreshBeforeExpiry {
+		return s.checkPeriod
+	}
+	return s.refreshBeforeExpiry
+}
+
+// refreshCheckPeriod returns the longest wait between runs of schedule
+// after now, or 0 when schedule is invalid or fires at most once
+func refreshCheckPeriod(schedule string, now time.Time) time.Duration {
+	sched, err := ParseSchedule(schedule)
+	if err != nil {
+		return 0
+	}
+	var period time.Duration
+	times := nextN(sched, now, refreshCheckSample)
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap > period {
+			period = gap
+		}
+	}
+	return period
+}
+
+// NeedsRefresh reports whether token should be refreshed at now: it has no
+// access token, or it expires within buffer of now. A token without an expiry
+// never needs refreshing. Both token refresh services use it, so they agree
+// on when a token is due.
+func NeedsRefresh(token *oauth2.Token, now time.Time, buffer time.Duration) bool {
+	if token.AccessToken == "" {
+		return true
+	}
+	if token.Expiry.IsZero() {
+		return false
+	}
+	return !token.Expiry.After(now.Add(buffer))
+}
+
+// now reads the service's clock, or the real time when it has none
+func (s *TokenRefreshService) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+// refreshFailed records a failed refresh. A revoked grant cannot be fixed by
+// retrying, so the token is also marked invalid, the user is asked to sign in
+// again and the returned error wraps ErrPermanent.
+func (s *TokenRefreshService) refreshFailed(ctx context.Context, userID string, refreshErr error) error {
+	err := fmt.Errorf("failed to refresh token: %w", refreshErr)
+	errs := []error{err}
+	if s.recorder != nil {
+		if recErr := s.recorder.RecordTokenRefreshFailure(ctx, userID, err.Error()); recErr != nil {
+			errs = append(errs, fmt.Errorf("failed to record refresh failure: %w", recErr))
+		}
+	}
+	if !isInvalidGrant(refreshErr) {
+		return errors.Join(errs...)
+	}
+
+	errs[0] = fmt.Errorf("%w: %w", ErrPermanent, err)
+	if s.recorder != nil {
+		if recErr := s.recorder.SetTokenValid(ctx, userID, false); recErr != nil {
+			errs = append(errs, fmt.Errorf("failed to mark token invalid: %w", recErr))
+		}
+	}
+	if s.scheduler != nil {
+		payload := ReauthNotificationPayload{UserID: userID}
+		if _, schedErr := s.scheduler.ScheduleOnceJob(userID, ReauthNotificationJobType, s.now(), payload); schedErr != nil {
+			errs = append(errs, fmt.Errorf("failed to schedule reauth notification: %w", schedErr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isInvalidGrant reports whether err is Google rejecting the refresh token,
+// which happens once the user revokes access or the grant expires
+func isInvalidGrant(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
+	"gmaildigest-go/internal/storage"
 	"gmaildigest-go/internal/worker"
 )
 
@@ -60,9 +61,13 @@ func (m *mockStorage) StoreToken(ctx context.Context, userID string, token *oaut
 // mockTokenSource implements oauth2.TokenSource for testing
 type mockTokenSource struct {
 	token *oauth2.Token
+	err   error
 }
 
 func (m *mockTokenSource) Token() (*oauth2.Token, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
 	if m.token == nil {
 		return nil, fmt.Errorf("mock token source not set")
 	}
@@ -75,6 +80,8 @@ func TestTokenRefreshService_ScheduleTokenRefresh(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
 
 	// Create scheduler
 	pool := worker.NewWorkerPool(1)
@@ -130,6 +137,23 @@ func TestTokenRefreshService_ScheduleTokenRefresh(t *testing.T) {
 	assert.Equal(t, "user1", payload.UserID)
 }
 
+func TestTokenRefreshService_ScheduleTokenRefresh_InvalidSchedule(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+	service := NewTokenRefreshService(scheduler, newMockStorage(), &oauth2.Config{})
+
+	assert.Error(t, service.ScheduleTokenRefresh(ctx, "user1", "* * *"))
+
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{Type: "token_refresh"})
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
 func TestTokenRefreshService_HandleTokenRefresh(t *testing.T) {
 	ctx := context.Background()
 	storage := newMockStorage()
@@ -231,6 +255,8 @@ func TestTokenRefreshService_TokenNotExpired(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
 
 	// Create scheduler
 	pool := worker.NewWorkerPool(1)
@@ -282,6 +308,478 @@ func TestTokenRefreshService_TokenNotExpired(t *testing.T) {
 	assert.Equal(t, validToken.AccessToken, currentToken.AccessToken)
 }
 
+func TestTokenRefreshService_RefreshBeforeExpiry(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+
+	// Pinned to the wall clock so the tokens are valid by oauth2's own check too
+	clock := NewFakeClock(time.Now())
+	scheduler, err := NewScheduler(ctx, db, pool, WithClock(clock))
+	require.NoError(t, err)
+
+	storage := newMockStorage()
+	service := NewTokenRefreshService(scheduler, storage, &oauth2.Config{
+		Endpoint: oauth2.Endpoint{TokenURL: "https://example.com/token"},
+	})
+	// Checked every minute, so the window is not raised to the schedule's period
+	service.SetRefreshSchedule("* * * * *")
+	service.SetClient(&http.Client{Transport: &mockTransport{
+		response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       &mockBody{data: []byte(`{"access_token": "new_token", "token_type": "Bearer", "expires_in": 3600}`)},
+		},
+	}})
+
+	payloadBytes, err := json.Marshal(TokenRefreshPayload{UserID: "user1"})
+	require.NoError(t, err)
+	job := &Job{ID: "1", UserID: "user1", Type: "token_refresh", Payload: payloadBytes}
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		refreshed bool
+	}{
+		{name: "expires within the window", expiresIn: 3 * time.Minute, refreshed: true},
+		{name: "expires at the window", expiresIn: DefaultRefreshBeforeExpiry, refreshed: true},
+		{name: "expires after the window", expiresIn: 10 * time.Minute, refreshed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, storage.StoreToken(ctx, "user1", &oauth2.Token{
+				AccessToken:  "old_token",
+				RefreshToken: "refresh_token",
+				Expiry:       clock.Now().Add(tt.expiresIn),
+			}))
+
+			require.NoError(t, service.HandleTokenRefresh(ctx, job))
+
+			stored, err := storage.GetToken(ctx, "user1")
+			require.NoError(t, err)
+			if tt.refreshed {
+				assert.Equal(t, "new_token", stored.AccessToken)
+			} else {
+				assert.Equal(t, "old_token", stored.AccessToken)
+			}
+			assert.WithinDuration(t, clock.Now().Add(time.Hour), job.NextRun, 0)
+		})
+	}
+
+	// Once the clock moves into its window the 10 minute token is refreshed
+	require.NoError(t, storage.StoreToken(ctx, "user1", &oauth2.Token{
+		AccessToken:  "old_token",
+		RefreshToken: "refresh_token",
+		Expiry:       clock.Now().Add(10 * time.Minute),
+	}))
+	clock.Advance(6 * time.Minute)
+	require.NoError(t, service.HandleTokenRefresh(ctx, job))
+	stored, err := storage.GetToken(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "new_token", stored.AccessToken)
+}
+
+func TestTokenRefreshService_RefreshWindowCoversSchedule(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	pool := worker.NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+
+	clock := NewFakeClock(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	scheduler, err := NewScheduler(ctx, db, pool, WithClock(clock))
+	require.NoError(t, err)
+
+	// The default hourly schedule with the default five minute buffer
+	service := NewTokenRefreshService(scheduler, newMockStorage(), &oauth2.Config{})
+
+	// A token expiring before the next hourly check is refreshed now
+	assert.True(t, service.needsRefresh(&oauth2.Token{AccessToken: "a", Expiry: clock.Now().Add(30 * time.Minute)}))
+	assert.True(t, service.needsRefresh(&oauth2.Token{AccessToken: "a", Expiry: clock.Now().Add(time.Hour)}))
+	assert.False(t, service.needsRefresh(&oauth2.Token{AccessToken: "a", Expiry: clock.Now().Add(time.Hour + time.Second)}))
+
+	// A longer configured buffer still applies
+	service.SetRefreshBeforeExpiry(2 * time.Hour)
+	assert.True(t, service.needsRefresh(&oauth2.Token{AccessToken: "a", Expiry: clock.Now().Add(90 * time.Minute)}))
+
+	// The longest gap counts on a schedule with uneven runs
+	service.SetRefreshBeforeExpiry(DefaultRefreshBeforeExpiry)
+	service.SetRefreshSchedule("0 8,20 * * *")
+	assert.True(t, service.needsRefresh(&oauth2.Token{AccessToken: "a", Expiry: clock.Now().Add(11 * time.Hour)}))
+	assert.False(t, service.needsRefresh(&oauth2.Token{AccessToken: "a", Expiry: clock.Now().Add(13 * time.Hour)}))
+}
+
+func TestNeedsRefresh(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	buffer := 10 * time.Minute
+
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		want  bool
+	}{
+		{name: "expired", token: &oauth2.Token{AccessToken: "a", Expiry: now.Add(-time.Minute)}, want: true},
+		{name: "inside the buffer", token: &oauth2.Token{AccessToken: "a", Expiry: now.Add(buffer - time.Second)}, want: true},
+		{name: "at the buffer", token: &oauth2.Token{AccessToken: "a", Expiry: now.Add(buffer)}, want: true},
+		{name: "just past the buffer", token: &oauth2.Token{AccessToken: "a", Expiry: now.Add(buffer + time.Second)}, want: false},
+		{name: "no expiry", token: &oauth2.Token{AccessToken: "a"}, want: false},
+		{name: "no access token", token: &oauth2.Token{Expiry: now.Add(time.Hour)}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NeedsRefresh(tt.token, now, buffer))
+		})
+	}
+}
+
+func TestTokenRefreshService_RefreshBuffer(t *testing.T) {
+	ctx := context.Background()
+	storage := newMockStorage()
+	clock := NewFakeClock(time.Now())
+	service := &TokenRefreshService{Storage: storage, Config: &oauth2.Config{}}
+	service.SetClock(clock)
+	service.SetRefreshBeforeExpiry(10 * time.Minute)
+	service.tokenSource = &mockTokenSource{token: &oauth2.Token{
+		AccessToken: "new_token",
+		Expiry:      clock.Now().Add(time.Hour),
+	}}
+
+	payloadBytes, err := json.Marshal(TokenRefreshPayload{UserID: "user1"})
+	require.NoError(t, err)
+	job := &Job{ID: "1", UserID: "user1", Payload: payloadBytes}
+
+	refreshedAt := func(expiresIn time.Duration) string {
+		require.NoError(t, storage.StoreToken(ctx, "user1", &oauth2.Token{
+			AccessToken:  "old_token",
+			RefreshToken: "refresh_token",
+			Expiry:       clock.Now().Add(expiresIn),
+		}))
+		require.NoError(t, service.HandleTokenRefresh(ctx, job))
+		stored, err := storage.GetToken(ctx, "user1")
+		require.NoError(t, err)
+		return stored.AccessToken
+	}
+
+	assert.Equal(t, "old_token", refreshedAt(10*time.Minute+time.Second))
+	assert.Equal(t, "new_token", refreshedAt(10*time.Minute))
+	assert.Equal(t, "new_token", refreshedAt(9*time.Minute))
+}
+
+// mockUserLister pages through users, which are sorted by ID
+type mockUserLister struct {
+	users []*storage.User
+	pages int
+}
+
+func (m *mockUserLister) ListUsersWithValidTokens(ctx context.Context, afterID string, limit int) ([]*storage.User, error) {
+	m.pages++
+	var page []*storage.User
+	for _, u := range m.users {
+		if u.ID > afterID && len(page) < limit {
+			page = append(page, u)
+		}
+	}
+	return page, nil
+}
+
+func TestTokenRefreshService_ScheduleAllTokenRefreshes(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	pool := worker.NewWorkerPool(1)
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	service := NewTokenRefreshService(scheduler, newMockStorage(), &oauth2.Config{})
+	_, err = service.ScheduleAllTokenRefreshes(ctx)
+	assert.Error(t, err, "a user lister is required")
+
+	users := &mockUserLister{users: []*storage.User{{ID: "user1"}, {ID: "user2"}, {ID: "user3"}}}
+	service.SetUserLister(users)
+
+	n, err := service.ScheduleAllTokenRefreshes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 1, users.pages)
+
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{Type: "token_refresh"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	for _, job := range jobs {
+		assert.Equal(t, DefaultTokenRefreshSchedule, job.Schedule)
+		var payload TokenRefreshPayload
+		require.NoError(t, json.Unmarshal(job.Payload, &payload))
+		assert.Equal(t, job.UserID, payload.UserID)
+	}
+
+	// Running again at the next start reuses the jobs
+	_, err = service.ScheduleAllTokenRefreshes(ctx)
+	require.NoError(t, err)
+	jobs, err = scheduler.ListJobs(ctx, &ListJobsOptions{Type: "token_refresh"})
+	require.NoError(t, err)
+	assert.Len(t, jobs, 3)
+
+	// A changed refresh schedule replaces each user's job instead of adding one
+	service.SetRefreshSchedule("*/30 * * * *")
+	n, err = service.ScheduleAllTokenRefreshes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	jobs, err = scheduler.ListJobs(ctx, &ListJobsOptions{Type: "token_refresh"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	perUser := make(map[string]int)
+	for _, job := range jobs {
+		assert.Equal(t, "*/30 * * * *", job.Schedule)
+		perUser[job.UserID]++
+	}
+	assert.Equal(t, map[string]int{"user1": 1, "user2": 1, "user3": 1}, perUser)
+}
+
+func TestTokenRefreshService_ScheduleAllTokenRefreshesInBatches(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	pool := worker.NewWorkerPool(1)
+	scheduler, err := NewScheduler(ctx, db, pool)
+	require.NoError(t, err)
+
+	service := NewTokenRefreshService(scheduler, newMockStorage(), &oauth2.Config{})
+	service.SetRefreshSchedule("*/30 * * * *")
+	users := &mockUserLister{}
+	for i := 0; i < tokenRefreshBatchSize+1; i++ {
+		users.users = append(users.users, &storage.User{ID: fmt.Sprintf("user%04d", i)})
+	}
+	service.SetUserLister(users)
+
+	n, err := service.ScheduleAllTokenRefreshes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, tokenRefreshBatchSize+1, n)
+	assert.Equal(t, 2, users.pages)
+
+	jobs, err := scheduler.ListJobs(ctx, &ListJobsOptions{Type: "token_refresh", UserID: fmt.Sprintf("user%04d", tokenRefreshBatchSize)})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "*/30 * * * *", jobs[0].Schedule)
+}
+
+// mockRefreshRecorder tracks consecutive refresh failures per user
+type mockRefreshRecorder struct {
+	failures  map[string]int
+	lastError map[string]string
+	refreshed map[string]time.Time
+	invalid   map[string]bool
+}
+
+func newMockRefreshRecorder() *mockRefreshRecorder {
+	return &mockRefreshRecorder{
+		failures:  make(map[string]int),
+		lastError: make(map[string]string),
+		refreshed: make(map[string]time.Time),
+		invalid:   make(map[string]bool),
+	}
+}
+
+func (m *mockRefreshRecorder) RecordTokenRefresh(ctx context.Context, userID string, refreshedAt time.Time) error {
+	m.failures[userID] = 0
+	m.lastError[userID] = ""
+	m.refreshed[userID] = refreshedAt
+	return nil
+}
+
+func (m *mockRefreshRecorder) RecordTokenRefreshFailure(ctx context.Context, userID, message string) error {
+	m.failures[userID]++
+	m.lastError[userID] = message
+	return nil
+}
+
+func (m *mockRefreshRecorder) SetTokenValid(ctx context.Context, userID string, valid bool) error {
+	m.invalid[userID] = !valid
+	return nil
+}
+
+func TestTokenRefreshService_RecordsRefreshOutcome(t *testing.T) {
+	ctx := context.Background()
+	storage := newMockStorage()
+	recorder := newMockRefreshRecorder()
+
+	service := &TokenRefreshService{
+		Storage: storage,
+		Config: &oauth2.Config{
+			ClientID: "test-client-id",
+			Endpoint: oauth2.Endpoint{TokenURL: "https://example.com/token"},
+		},
+	}
+	service.SetRefreshRecorder(recorder)
+
+	expiredToken := &oauth2.Token{
+		AccessToken:  "old_token",
+		RefreshToken: "refresh_token",
+		Expiry:       time.Now().Add(-1 * time.Hour),
+	}
+	require.NoError(t, storage.StoreToken(ctx, "user1", expiredToken))
+
+	payloadBytes, err := json.Marshal(TokenRefreshPayload{UserID: "user1"})
+	require.NoError(t, err)
+	job := &Job{ID: "1", UserID: "user1", Type: "token_refresh", Payload: json.RawMessage(payloadBytes)}
+
+	respond := func(status int, body string) {
+		service.SetClient(&http.Client{Transport: &mockTransport{
+			response: &http.Response{
+				StatusCode: status,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       &mockBody{data: []byte(body)},
+			},
+		}})
+	}
+
+	// Each failed refresh increments the counter
+	respond(http.StatusInternalServerError, `{"error": "server_error"}`)
+	assert.Error(t, service.HandleTokenRefresh(ctx, job))
+	assert.Error(t, service.HandleTokenRefresh(ctx, job))
+	assert.Equal(t, 2, recorder.failures["user1"])
+	assert.Contains(t, recorder.lastError["user1"], "failed to refresh token")
+
+	// A successful refresh resets it
+	respond(http.StatusOK, `{"access_token": "new_token", "token_type": "Bearer", "expires_in": 3600}`)
+	require.NoError(t, service.HandleTokenRefresh(ctx, job))
+	assert.Zero(t, recorder.failures["user1"])
+	assert.Empty(t, recorder.lastError["user1"])
+	assert.False(t, recorder.refreshed["user1"].IsZero())
+}
+
+func TestTokenRefreshService_PreservesRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	storage := newMockStorage()
+	service := &TokenRefreshService{
+		Storage: storage,
+		Config:  &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: "https://example.com/token"}},
+	}
+	// Google omits refresh_token when it does not rotate it
+	service.SetClient(&http.Client{Transport: &mockTransport{
+		response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       &mockBody{data: []byte(`{"access_token": "new_token", "token_type": "Bearer", "expires_in": 3600}`)},
+		},
+	}})
+
+	require.NoError(t, storage.StoreToken(ctx, "user1", &oauth2.Token{
+		AccessToken:  "old_token",
+		RefreshToken: "original_refresh_token",
+		Expiry:       time.Now().Add(-1 * time.Hour),
+	}))
+	payloadBytes, err := json.Marshal(TokenRefreshPayload{UserID: "user1"})
+	require.NoError(t, err)
+
+	require.NoError(t, service.HandleTokenRefresh(ctx, &Job{ID: "1", UserID: "user1", Payload: payloadBytes}))
+
+	stored, err := storage.GetToken(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "new_token", stored.AccessToken)
+	assert.Equal(t, "original_refresh_token", stored.RefreshToken)
+
+	// The handler itself keeps the refresh token when a token source drops it
+	stored.Expiry = time.Now().Add(-1 * time.Hour)
+	require.NoError(t, storage.StoreToken(ctx, "user1", stored))
+	service.tokenSource = &mockTokenSource{token: &oauth2.Token{
+		AccessToken: "newer_token",
+		Expiry:      time.Now().Add(time.Hour),
+	}}
+	require.NoError(t, service.HandleTokenRefresh(ctx, &Job{ID: "1", UserID: "user1", Payload: payloadBytes}))
+
+	stored, err = storage.GetToken(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "newer_token", stored.AccessToken)
+	assert.Equal(t, "original_refresh_token", stored.RefreshToken)
+}
+
+func TestTokenRefreshService_InvalidGrant(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	scheduler, err := NewScheduler(ctx, db, worker.NewWorkerPool(1))
+	require.NoError(t, err)
+
+	storage := newMockStorage()
+	recorder := newMockRefreshRecorder()
+	service := NewTokenRefreshService(scheduler, storage, &oauth2.Config{})
+	service.SetRefreshRecorder(recorder)
+	// Google rejects a revoked refresh token with invalid_grant
+	service.tokenSource = &mockTokenSource{err: &oauth2.RetrieveError{
+		Response:  &http.Response{StatusCode: http.StatusBadRequest},
+		ErrorCode: "invalid_grant",
+	}}
+
+	require.NoError(t, storage.StoreToken(ctx, "user1", &oauth2.Token{
+		AccessToken:  "old_token",
+		RefreshToken: "revoked_refresh_token",
+		Expiry:       time.Now().Add(-1 * time.Hour),
+	}))
+
+	job, err := scheduler.ScheduleJob("user1", "token_refresh", "*/30 * * * *", TokenRefreshPayload{UserID: "user1"})
+	require.NoError(t, err)
+
+	err = service.HandleTokenRefresh(ctx, job)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrPermanent)
+	assert.True(t, recorder.invalid["user1"])
+	assert.Equal(t, 1, recorder.failures["user1"])
+
+	// The job is not retried
+	task := NewJobTask(ctx, job, scheduler.registry)
+	task.scheduler = scheduler
+	task.OnFailure(err)
+	assert.Equal(t, JobStatusDead, job.Status)
+	assert.True(t, job.NextRun.IsZero())
+
+	// and the user is asked to sign in again
+	notifications, err := scheduler.ListJobs(ctx, &ListJobsOptions{Type: ReauthNotificationJobType})
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "user1", notifications[0].UserID)
+	assert.True(t, notifications[0].OneShot)
+}
+
+func TestTokenRefreshService_TransientFailureIsRetried(t *testing.T) {
+	ctx := context.Background()
+	storage := newMockStorage()
+	recorder := newMockRefreshRecorder()
+	service := &TokenRefreshService{Storage: storage, Config: &oauth2.Config{}}
+	service.SetRefreshRecorder(recorder)
+	service.tokenSource = &mockTokenSource{err: &oauth2.RetrieveError{
+		Response:  &http.Response{StatusCode: http.StatusServiceUnavailable},
+		ErrorCode: "temporarily_unavailable",
+	}}
+
+	require.NoError(t, storage.StoreToken(ctx, "user1", &oauth2.Token{
+		AccessToken: "old_token",
+		Expiry:      time.Now().Add(-1 * time.Hour),
+	}))
+	payloadBytes, err := json.Marshal(TokenRefreshPayload{UserID: "user1"})
+	require.NoError(t, err)
+
+	err = service.HandleTokenRefresh(ctx, &Job{ID: "1", UserID: "user1", Payload: payloadBytes})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrPermanent)
+	assert.False(t, recorder.invalid["user1"])
+}
+
 // Mock HTTP transport and body for testing
 type mockTransport struct {
 	response *http.Response
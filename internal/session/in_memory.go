@@ -4,29 +4,38 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"errors"
 	"sync"
 	"time"
 )
 
 // InMemoryStore is an in-memory implementation of the Store interface.
 type InMemoryStore struct {
-	mu       sync.RWMutex
-	sessions map[string]sessionData
+	mu          sync.RWMutex
+	sessions    map[string]sessionData
+	maxLifetime time.Duration
 }
 
 type sessionData struct {
 	userID  string
+	created time.Time
 	expires time.Time
 }
 
 // NewInMemoryStore creates a new InMemoryStore.
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
-		sessions: make(map[string]sessionData),
+		sessions:    make(map[string]sessionData),
+		maxLifetime: DefaultMaxLifetime,
 	}
 }
 
+// SetMaxLifetime caps how long Touch can keep a session alive after it was created.
+func (s *InMemoryStore) SetMaxLifetime(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxLifetime = d
+}
+
 // Create creates a new session for a user and returns the session ID.
 func (s *InMemoryStore) Create(ctx context.Context, userID string, duration time.Duration) (string, error) {
 	sessionID, err := generateSessionID()
@@ -37,9 +46,11 @@ func (s *InMemoryStore) Create(ctx context.Context, userID string, duration time
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	s.sessions[sessionID] = sessionData{
 		userID:  userID,
-		expires: time.Now().Add(duration),
+		created: now,
+		expires: now.Add(duration),
 	}
 
 	return sessionID, nil
@@ -52,18 +63,37 @@ func (s *InMemoryStore) Get(ctx context.Context, sessionID string) (string, erro
 
 	data, ok := s.sessions[sessionID]
 	if !ok {
-		return "", errors.New("session not found")
+		return "", ErrSessionNotFound
 	}
 
 	if time.Now().After(data.expires) {
 		// The session has expired, but we'll delete it lazily.
 		// A separate cleanup routine would handle proactive deletion.
-		return "", errors.New("session expired")
+		return "", ErrSessionExpired
 	}
 
 	return data.userID, nil
 }
 
+// Touch slides the expiry of an active session forward.
+func (s *InMemoryStore) Touch(ctx context.Context, sessionID string, extend time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.sessions[sessionID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	now := time.Now()
+	if now.After(data.expires) {
+		return ErrSessionExpired
+	}
+
+	data.expires = slideExpiry(data.created, data.expires, now, extend, s.maxLifetime)
+	s.sessions[sessionID] = data
+	return nil
+}
+
 // Delete removes a session.
 func (s *InMemoryStore) Delete(ctx context.Context, sessionID string) error {
 	s.mu.Lock()
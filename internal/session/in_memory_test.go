@@ -60,4 +60,51 @@ func TestInMemoryStore_Delete(t *testing.T) {
 
 	_, err = store.Get(ctx, sessionID)
 	assert.Error(t, err, "should not be able to get a deleted session")
-} 
\ No newline at end of file
+}
+
+func TestInMemoryStore_Touch(t *testing.T) {
+	store := NewInMemoryStore()
+	store.SetMaxLifetime(2 * time.Hour)
+	ctx := context.Background()
+
+	expiresAt := func(sessionID string) time.Time {
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		return store.sessions[sessionID].expires
+	}
+
+	t.Run("slides an active session", func(t *testing.T) {
+		sessionID, err := store.Create(ctx, "user-123", 50*time.Millisecond)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Touch(ctx, sessionID, time.Hour))
+		assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt(sessionID), time.Second)
+
+		// The session outlives its original duration
+		time.Sleep(100 * time.Millisecond)
+		_, err = store.Get(ctx, sessionID)
+		assert.NoError(t, err)
+
+		// A shorter extension never shortens the session
+		require.NoError(t, store.Touch(ctx, sessionID, time.Minute))
+		assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt(sessionID), time.Second)
+	})
+
+	t.Run("caps renewal at the maximum lifetime", func(t *testing.T) {
+		sessionID, err := store.Create(ctx, "user-123", time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Touch(ctx, sessionID, 24*time.Hour))
+		assert.WithinDuration(t, time.Now().Add(2*time.Hour), expiresAt(sessionID), time.Second)
+	})
+
+	t.Run("rejects expired and unknown sessions", func(t *testing.T) {
+		sessionID, err := store.Create(ctx, "user-123", -time.Hour)
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, store.Touch(ctx, sessionID, time.Hour), ErrSessionExpired)
+		_, err = store.Get(ctx, sessionID)
+		assert.ErrorIs(t, err, ErrSessionExpired)
+		assert.ErrorIs(t, store.Touch(ctx, "non-existent-session-id", time.Hour), ErrSessionNotFound)
+	})
+}
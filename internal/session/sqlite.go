@@ -0,0 +1,140 @@
+package session
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultCleanupInterval is how often expired sessions are deleted
+const defaultCleanupInterval = 10 * time.Minute
+
+// SessionStorage is the persistence required by SQLiteSessionStore.
+// It is implemented by storage.SQLiteStorage.
+type SessionStorage interface {
+	CreateSession(ctx context.Context, id, userID string, expiresAt time.Time) error
+	GetSession(ctx context.Context, id string) (string, time.Time, time.Time, error)
+	ExtendSession(ctx context.Context, id string, expiresAt time.Time) error
+	DeleteSession(ctx context.Context, id string) error
+	CleanupExpiredSessions(ctx context.Context) (int64, error)
+}
+
+// SQLiteSessionStore is a Store persisted in the database, so sessions
+// survive restarts and are shared by every instance using the database.
+type SQLiteSessionStore struct {
+	db          SessionStorage
+	maxLifetime time.Duration
+}
+
+// NewSQLiteSessionStore creates a new SQLiteSessionStore.
+func NewSQLiteSessionStore(db SessionStorage) *SQLiteSessionStore {
+	return &SQLiteSessionStore{db: db, maxLifetime: DefaultMaxLifetime}
+}
+
+// SetMaxLifetime caps how long Touch can keep a session alive after it was
+// created. It must be called before the store is used.
+func (s *SQLiteSessionStore) SetMaxLifetime(d time.Duration) {
+	s.maxLifetime = d
+}
+
+// Create creates a new session for a user and returns the session ID.
+func (s *SQLiteSessionStore) Create(ctx context.Context, userID string, duration time.Duration) (string, error) {
+	sessionID, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.CreateSession(ctx, sessionID, userID, time.Now().Add(duration)); err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// Get retrieves the user ID for a given session ID.
+func (s *SQLiteSessionStore) Get(ctx context.Context, sessionID string) (string, error) {
+	userID, _, expiresAt, err := s.db.GetSession(ctx, sessionID)
+	if err != nil {
+		return "", ErrSessionNotFound
+	}
+	if time.Now().After(expiresAt) {
+		// The row is left for the cleanup sweep
+		return "", ErrSessionExpired
+	}
+	return userID, nil
+}
+
+// Touch slides the expiry of an active session forward.
+func (s *SQLiteSessionStore) Touch(ctx context.Context, sessionID string, extend time.Duration) error {
+	_, createdAt, expiresAt, err := s.db.GetSession(ctx, sessionID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+	now := time.Now()
+	if now.After(expiresAt) {
+		return ErrSessionExpired
+	}
+
+	next := slideExpiry(createdAt, expiresAt, now, extend, s.maxLifetime)
+	if next.Equal(expiresAt) {
+		return nil
+	}
+	return s.db.ExtendSession(ctx, sessionID, next)
+}
+
+// Delete removes a session.
+func (s *SQLiteSessionStore) Delete(ctx context.Context, sessionID string) error {
+	return s.db.DeleteSession(ctx, sessionID)
+}
+
+// Sweeper periodically deletes expired sessions from a SessionStorage.
+type Sweeper struct {
+	db       SessionStorage
+	interval time.Duration
+	logger   *slog.Logger
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewSweeper creates a sweeper that runs every interval.
+// A non-positive interval uses a ten minute default.
+func NewSweeper(db SessionStorage, interval time.Duration, logger *slog.Logger) *Sweeper {
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	return &Sweeper{db: db, interval: interval, logger: logger}
+}
+
+// Start begins sweeping in the background until Stop is called.
+func (s *Sweeper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweep(ctx)
+			}
+		}
+	}()
+}
+
+// Stop halts the background sweep and waits for it to exit.
+func (s *Sweeper) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// sweep deletes expired sessions once
+func (s *Sweeper) sweep(ctx context.Context) {
+	if _, err := s.db.CleanupExpiredSessions(ctx); err != nil && s.logger != nil {
+		s.logger.Error("Failed to sweep expired sessions", "error", err)
+	}
+}
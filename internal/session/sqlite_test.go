@@ -0,0 +1,209 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type storedSession struct {
+	userID    string
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// fakeSessionStorage is an in-memory SessionStorage
+type fakeSessionStorage struct {
+	mu       sync.Mutex
+	sessions map[string]storedSession
+	cleanups int
+}
+
+func newFakeSessionStorage() *fakeSessionStorage {
+	return &fakeSessionStorage{sessions: make(map[string]storedSession)}
+}
+
+func (f *fakeSessionStorage) CreateSession(ctx context.Context, id, userID string, expiresAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.sessions[id]; ok {
+		return fmt.Errorf("duplicate session %s", id)
+	}
+	f.sessions[id] = storedSession{userID, time.Now(), expiresAt}
+	return nil
+}
+
+func (f *fakeSessionStorage) GetSession(ctx context.Context, id string) (string, time.Time, time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.sessions[id]
+	if !ok {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("not found")
+	}
+	return s.userID, s.createdAt, s.expiresAt, nil
+}
+
+func (f *fakeSessionStorage) ExtendSession(ctx context.Context, id string, expiresAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.sessions[id]
+	if !ok {
+		return fmt.Errorf("not found")
+	}
+	s.expiresAt = expiresAt
+	f.sessions[id] = s
+	return nil
+}
+
+// expiresAt returns when a stored session expires
+func (f *fakeSessionStorage) expiresAt(id string) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions[id].expiresAt
+}
+
+func (f *fakeSessionStorage) DeleteSession(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions, id)
+	return nil
+}
+
+func (f *fakeSessionStorage) CleanupExpiredSessions(ctx context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cleanups++
+	var deleted int64
+	for id, s := range f.sessions {
+		if !time.Now().Before(s.expiresAt) {
+			delete(f.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestSQLiteSessionStore_Create(t *testing.T) {
+	db := newFakeSessionStorage()
+	store := NewSQLiteSessionStore(db)
+
+	sessionID, err := store.Create(context.Background(), "user-123", time.Hour)
+	require.NoError(t, err)
+	assert.NotEmpty(t, sessionID)
+	assert.Contains(t, db.sessions, sessionID)
+}
+
+func TestSQLiteSessionStore_Get(t *testing.T) {
+	store := NewSQLiteSessionStore(newFakeSessionStorage())
+	userID := "user-123"
+	ctx := context.Background()
+
+	t.Run("gets a valid session", func(t *testing.T) {
+		sessionID, err := store.Create(ctx, userID, time.Hour)
+		require.NoError(t, err)
+
+		retrievedUserID, err := store.Get(ctx, sessionID)
+		require.NoError(t, err)
+		assert.Equal(t, userID, retrievedUserID)
+	})
+
+	t.Run("returns error for non-existent session", func(t *testing.T) {
+		_, err := store.Get(ctx, "non-existent-session-id")
+		assert.EqualError(t, err, "session not found")
+	})
+
+	t.Run("returns error for expired session", func(t *testing.T) {
+		sessionID, err := store.Create(ctx, userID, -time.Hour) // Expired an hour ago
+		require.NoError(t, err)
+
+		_, err = store.Get(ctx, sessionID)
+		assert.EqualError(t, err, "session expired")
+	})
+}
+
+func TestSQLiteSessionStore_Expiry(t *testing.T) {
+	store := NewSQLiteSessionStore(newFakeSessionStorage())
+	ctx := context.Background()
+
+	sessionID, err := store.Create(ctx, "user-123", 50*time.Millisecond)
+	require.NoError(t, err)
+
+	_, err = store.Get(ctx, sessionID)
+	require.NoError(t, err, "session should be valid before it expires")
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = store.Get(ctx, sessionID)
+	assert.EqualError(t, err, "session expired")
+}
+
+func TestSQLiteSessionStore_Touch(t *testing.T) {
+	db := newFakeSessionStorage()
+	store := NewSQLiteSessionStore(db)
+	store.SetMaxLifetime(2 * time.Hour)
+	ctx := context.Background()
+
+	sessionID, err := store.Create(ctx, "user-123", time.Minute)
+	require.NoError(t, err)
+
+	// Sliding renewal moves the expiry forward
+	require.NoError(t, store.Touch(ctx, sessionID, time.Hour))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), db.expiresAt(sessionID), time.Second)
+
+	// A shorter extension never shortens the session
+	require.NoError(t, store.Touch(ctx, sessionID, time.Minute))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), db.expiresAt(sessionID), time.Second)
+
+	// The maximum lifetime caps the renewal
+	require.NoError(t, store.Touch(ctx, sessionID, 24*time.Hour))
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), db.expiresAt(sessionID), time.Second)
+
+	expired, err := store.Create(ctx, "user-123", -time.Minute)
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.Touch(ctx, expired, time.Hour), ErrSessionExpired)
+	assert.ErrorIs(t, store.Touch(ctx, "missing", time.Hour), ErrSessionNotFound)
+}
+
+func TestSQLiteSessionStore_Delete(t *testing.T) {
+	store := NewSQLiteSessionStore(newFakeSessionStorage())
+	ctx := context.Background()
+
+	sessionID, err := store.Create(ctx, "user-123", time.Hour)
+	require.NoError(t, err)
+
+	err = store.Delete(ctx, sessionID)
+	require.NoError(t, err)
+
+	_, err = store.Get(ctx, sessionID)
+	assert.Error(t, err, "should not be able to get a deleted session")
+}
+
+func TestSweeper(t *testing.T) {
+	db := newFakeSessionStorage()
+	store := NewSQLiteSessionStore(db)
+	ctx := context.Background()
+
+	expired, err := store.Create(ctx, "user-123", -time.Minute)
+	require.NoError(t, err)
+	active, err := store.Create(ctx, "user-123", time.Hour)
+	require.NoError(t, err)
+
+	sweeper := NewSweeper(db, 10*time.Millisecond, nil)
+	sweeper.Start()
+
+	assert.Eventually(t, func() bool {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return db.cleanups >= 2
+	}, time.Second, 5*time.Millisecond)
+
+	sweeper.Stop()
+
+	assert.NotContains(t, db.sessions, expired)
+	assert.Contains(t, db.sessions, active)
+	assert.Equal(t, defaultCleanupInterval, NewSweeper(db, 0, nil).interval)
+}
@@ -2,9 +2,18 @@ package session
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// DefaultMaxLifetime caps how far Touch may extend a session past its creation.
+const DefaultMaxLifetime = 30 * 24 * time.Hour
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+)
+
 // Store defines the interface for session management.
 type Store interface {
 	// Create creates a new session for a user and returns the session ID.
@@ -13,4 +22,19 @@ type Store interface {
 	Get(ctx context.Context, sessionID string) (string, error)
 	// Delete removes a session.
 	Delete(ctx context.Context, sessionID string) error
-} 
\ No newline at end of file
+	// Touch slides an active session's expiry to extend from now, never past
+	// the store's maximum lifetime and never shortening it.
+	Touch(ctx context.Context, sessionID string, extend time.Duration) error
+}
+
+// slideExpiry returns the expiry for a session touched at now
+func slideExpiry(created, expires, now time.Time, extend, maxLifetime time.Duration) time.Time {
+	next := now.Add(extend)
+	if limit := created.Add(maxLifetime); next.After(limit) {
+		next = limit
+	}
+	if next.Before(expires) {
+		return expires
+	}
+	return next
+}
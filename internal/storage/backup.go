@@ -3,26 +3,130 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
-// Backup creates a backup of the database at the specified path
+// ErrBackupTooNew is returned when restoring a backup written by a newer
+// version whose schema this version does not know
+var ErrBackupTooNew = errors.New("backup schema is newer than this version supports")
+
+// schemaObject is an entry from sqlite_master
+type schemaObject struct {
+	Type string
+	Name string
+	SQL  string
+}
+
+// schemaQuerier is satisfied by both *sql.DB and *sql.Tx
+type schemaQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// listSchemaObjects returns every user-defined table, index, view and trigger,
+// with tables first so dependent objects can be created after them.
+func listSchemaObjects(ctx context.Context, q schemaQuerier) ([]schemaObject, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT type, name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 WHEN 'view' THEN 2 ELSE 3 END, name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	var objects []schemaObject
+	for rows.Next() {
+		var obj schemaObject
+		if err := rows.Scan(&obj.Type, &obj.Name, &obj.SQL); err != nil {
+			return nil, fmt.Errorf("failed to scan schema object: %w", err)
+		}
+		objects = append(objects, obj)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return objects, nil
+}
+
+// quoteIdentifier quotes a table name for use in SQL
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// backupStepPages is how many pages copyDatabase copies between checks of
+// its context
+const backupStepPages = 256
+
+// copyDatabase copies the main database of src over the main database of dst
+// using the SQLite online backup API. Pages are copied in steps so a
+// cancelled ctx stops the copy partway; dst is then left as it was. SQLite
+// restarts the copy when another connection writes to src between steps, so
+// the result is still a consistent snapshot.
+func copyDatabase(ctx context.Context, dst, src *sql.DB) error {
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get destination connection: %w", err)
+	}
+	defer dstConn.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get source connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			dstSQLite, ok := dstDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("destination is not a sqlite3 connection")
+			}
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("source is not a sqlite3 connection")
+			}
+
+			backup, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			for done := false; !done; {
+				if err := ctx.Err(); err != nil {
+					backup.Finish()
+					return fmt.Errorf("copy interrupted: %w", err)
+				}
+				if done, err = backup.Step(backupStepPages); err != nil {
+					backup.Finish()
+					return fmt.Errorf("failed to copy database: %w", err)
+				}
+			}
+			if err := backup.Finish(); err != nil {
+				return fmt.Errorf("failed to finish backup: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// Backup creates a backup of the database at the specified path and records
+// it as the base of the next BackupIncremental
 func (s *SQLiteStorage) Backup(ctx context.Context, backupPath string) error {
+	startedAt := time.Now().UTC()
+
 	// Ensure backup directory exists
 	backupDir := filepath.Dir(backupPath)
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		return fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
-	// Begin transaction to ensure consistent backup
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
 	// Create backup database
 	backupDB, err := sql.Open("sqlite3", backupPath)
 	if err != nil {
@@ -30,38 +134,15 @@ func (s *SQLiteStorage) Backup(ctx context.Context, backupPath string) error {
 	}
 	defer backupDB.Close()
 
-	// Enable WAL mode for better concurrency
-	_, err = backupDB.ExecContext(ctx, "PRAGMA journal_mode=WAL")
-	if err != nil {
-		return fmt.Errorf("failed to enable WAL mode: %w", err)
-	}
-
-	// Backup using SQLite's backup API
-	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
-		ATTACH DATABASE '%s' AS backup;
-		
-		-- Create tables in backup database
-		CREATE TABLE backup.schema_migrations AS SELECT * FROM schema_migrations;
-		CREATE TABLE backup.users AS SELECT * FROM users;
-		CREATE TABLE backup.tokens AS SELECT * FROM tokens;
-		CREATE TABLE backup.processed_emails AS SELECT * FROM processed_emails;
-		
-		-- Create indexes in backup database
-		CREATE INDEX backup.idx_users_gmail_user_id ON users(gmail_user_id);
-		CREATE INDEX backup.idx_processed_emails_user_id ON processed_emails(user_id);
-		CREATE INDEX backup.idx_processed_emails_processed_at ON processed_emails(processed_at);
-		
-		DETACH DATABASE backup;
-	`, backupPath))
-	if err != nil {
+	// Backup using SQLite's online backup API, which copies every table,
+	// index and trigger without needing to know the schema
+	if err := copyDatabase(ctx, backupDB, s.db); err != nil {
+		// Don't leave a partial backup behind
+		backupDB.Close()
+		os.Remove(backupPath)
 		return fmt.Errorf("failed to backup database: %w", err)
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
 	// Verify backup
 	err = s.verifyBackup(ctx, backupPath)
 	if err != nil {
@@ -70,10 +151,12 @@ func (s *SQLiteStorage) Backup(ctx context.Context, backupPath string) error {
 		return fmt.Errorf("backup verification failed: %w", err)
 	}
 
-	return nil
+	return s.recordBackup(ctx, startedAt)
 }
 
-// verifyBackup checks if the backup database is valid and contains all tables
+// verifyBackup checks that the backup database is intact and contains every
+// schema object of the source database. Row counts are not compared, as the
+// source may be written to once the copy has finished.
 func (s *SQLiteStorage) verifyBackup(ctx context.Context, backupPath string) error {
 	backupDB, err := sql.Open("sqlite3", backupPath)
 	if err != nil {
@@ -81,106 +164,174 @@ func (s *SQLiteStorage) verifyBackup(ctx context.Context, backupPath string) err
 	}
 	defer backupDB.Close()
 
-	// Check if all tables exist and have data
-	tables := []string{
-		"schema_migrations",
-		"users",
-		"tokens",
-		"processed_emails",
+	if err := checkIntegrity(ctx, backupDB); err != nil {
+		return err
 	}
+	return compareSchemas(ctx, s.db, backupDB)
+}
 
-	for _, table := range tables {
-		var count int64
-		err := backupDB.QueryRowContext(ctx,
-			fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count)
-		if err != nil {
-			return fmt.Errorf("failed to verify table %s: %w", table, err)
-		}
+// compareSchemas checks that target contains every schema object of source
+func compareSchemas(ctx context.Context, source, target *sql.DB) error {
+	sourceObjects, err := listSchemaObjects(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to read source schema: %w", err)
+	}
+	targetObjects, err := listSchemaObjects(ctx, target)
+	if err != nil {
+		return fmt.Errorf("failed to read target schema: %w", err)
 	}
 
-	// Compare row counts between source and backup
-	for _, table := range tables {
-		var sourceCount, backupCount int64
+	inTarget := make(map[string]bool, len(targetObjects))
+	for _, obj := range targetObjects {
+		inTarget[obj.Type+":"+obj.Name] = true
+	}
 
-		err := s.db.QueryRowContext(ctx,
-			fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&sourceCount)
-		if err != nil {
-			return fmt.Errorf("failed to get source count for table %s: %w", table, err)
+	for _, obj := range sourceObjects {
+		if !inTarget[obj.Type+":"+obj.Name] {
+			return fmt.Errorf("%s %s missing from target", obj.Type, obj.Name)
 		}
+	}
+	return nil
+}
 
-		err = backupDB.QueryRowContext(ctx,
-			fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&backupCount)
-		if err != nil {
-			return fmt.Errorf("failed to get backup count for table %s: %w", table, err)
-		}
+// checkIntegrity runs SQLite's integrity check over db
+func checkIntegrity(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("failed to check integrity: %w", err)
+	}
+	defer rows.Close()
 
-		if sourceCount != backupCount {
-			return fmt.Errorf("row count mismatch for table %s: source=%d, backup=%d",
-				table, sourceCount, backupCount)
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to check integrity: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
 		}
 	}
-
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check integrity: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
 	return nil
 }
 
-// Restore restores the database from a backup file
+// Restore restores the database from a backup file, replacing every table,
+// index and trigger with the contents of the backup. The backup is checked
+// before it is copied and the result after; if either check fails the live
+// database keeps its previous contents. A backup from an older schema is
+// migrated to the current one after it is restored; a backup from a newer
+// schema is refused with ErrBackupTooNew.
 func (s *SQLiteStorage) Restore(ctx context.Context, backupPath string) error {
 	// Verify backup file exists
 	if _, err := os.Stat(backupPath); err != nil {
 		return fmt.Errorf("backup file not found: %w", err)
 	}
 
-	// Begin transaction
-	tx, err := s.db.BeginTx(ctx, nil)
+	backupDB, err := sql.Open("sqlite3", backupPath)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return fmt.Errorf("failed to open backup database: %w", err)
 	}
-	defer tx.Rollback()
+	defer backupDB.Close()
 
-	// Drop existing tables
-	_, err = tx.ExecContext(ctx, `
-		DROP TABLE IF EXISTS schema_migrations;
-		DROP TABLE IF EXISTS users;
-		DROP TABLE IF EXISTS tokens;
-		DROP TABLE IF EXISTS processed_emails;
-	`)
+	// A corrupt or truncated backup is rejected before the live data is touched
+	if err := checkIntegrity(ctx, backupDB); err != nil {
+		return fmt.Errorf("backup verification failed: %w", err)
+	}
+
+	version, versioned, err := schemaVersion(ctx, backupDB)
+	if err != nil {
+		return fmt.Errorf("failed to read backup schema version: %w", err)
+	}
+	latest, err := latestMigrationVersion()
+	if err != nil {
+		return err
+	}
+	if version > latest {
+		return fmt.Errorf("%w: backup is at version %d, latest known is %d", ErrBackupTooNew, version, latest)
+	}
+
+	// Keep a snapshot of the live database to roll back to if the restored
+	// copy does not verify
+	snapshotDir, err := os.MkdirTemp("", "gmaildigest-restore-*")
 	if err != nil {
-		return fmt.Errorf("failed to drop existing tables: %w", err)
+		return fmt.Errorf("failed to create temporary directory: %w", err)
 	}
+	defer os.RemoveAll(snapshotDir)
 
-	// Restore from backup
-	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
-		ATTACH DATABASE '%s' AS backup;
-		
-		-- Restore tables
-		CREATE TABLE schema_migrations AS SELECT * FROM backup.schema_migrations;
-		CREATE TABLE users AS SELECT * FROM backup.users;
-		CREATE TABLE tokens AS SELECT * FROM backup.tokens;
-		CREATE TABLE processed_emails AS SELECT * FROM backup.processed_emails;
-		
-		-- Restore indexes
-		CREATE INDEX idx_users_gmail_user_id ON users(gmail_user_id);
-		CREATE INDEX idx_processed_emails_user_id ON processed_emails(user_id);
-		CREATE INDEX idx_processed_emails_processed_at ON processed_emails(processed_at);
-		
-		DETACH DATABASE backup;
-	`, backupPath))
+	snapshotDB, err := sql.Open("sqlite3", filepath.Join(snapshotDir, "snapshot.db"))
 	if err != nil {
+		return fmt.Errorf("failed to create snapshot database: %w", err)
+	}
+	defer snapshotDB.Close()
+	if err := copyDatabase(ctx, snapshotDB, s.db); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	// Restore from backup
+	if err := copyDatabase(ctx, s.db, backupDB); err != nil {
 		return fmt.Errorf("failed to restore from backup: %w", err)
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if err := s.verifyRestore(ctx, backupDB); err != nil {
+		// Roll back even if ctx was cancelled during verification
+		if rollbackErr := copyDatabase(context.WithoutCancel(ctx), s.db, snapshotDB); rollbackErr != nil {
+			return fmt.Errorf("restore verification failed: %w; rollback failed: %v", err, rollbackErr)
+		}
+		return fmt.Errorf("restore verification failed: %w", err)
+	}
+
+	if versioned && version < latest {
+		if err := s.Migrate(ctx); err != nil {
+			return fmt.Errorf("failed to migrate restored database: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// verifyRestore checks the live database after it was overwritten by
+// backupDB. As with verifyBackup, row counts are not compared, since the live
+// database may be written to once the copy has finished.
+func (s *SQLiteStorage) verifyRestore(ctx context.Context, backupDB *sql.DB) error {
+	if err := checkIntegrity(ctx, s.db); err != nil {
+		return err
+	}
+	return compareSchemas(ctx, backupDB, s.db)
+}
+
+// schemaVersion returns the highest migration version recorded in db. A
+// database without a schema_migrations table is reported as unversioned.
+func schemaVersion(ctx context.Context, db *sql.DB) (int64, bool, error) {
+	var tables int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tables)
+	if err != nil {
+		return 0, false, err
+	}
+	if tables == 0 {
+		return 0, false, nil
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, false, err
+	}
+	return version.Int64, true, nil
+}
+
 // Transaction backup methods
 
-// Backup creates a backup of the database at the specified path within a transaction
-func (t *Transaction) Backup(backupPath string) error {
+// Backup creates a backup of the database at the specified path within a transaction.
+// The online backup API cannot read through a transaction, so the schema from
+// sqlite_master is recreated in the backup and each table's rows are copied.
+// Cancelling ctx stops the copy and removes the partial backup.
+func (t *Transaction) Backup(ctx context.Context, backupPath string) error {
 	if t.closed {
 		return ErrTransactionClosed
 	}
@@ -190,6 +341,9 @@ func (t *Transaction) Backup(backupPath string) error {
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		return fmt.Errorf("failed to create backup directory: %w", err)
 	}
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove existing backup: %w", err)
+	}
 
 	// Create backup database
 	backupDB, err := sql.Open("sqlite3", backupPath)
@@ -198,32 +352,97 @@ func (t *Transaction) Backup(backupPath string) error {
 	}
 	defer backupDB.Close()
 
-	// Enable WAL mode for better concurrency
-	_, err = backupDB.Exec("PRAGMA journal_mode=WAL")
-	if err != nil {
-		return fmt.Errorf("failed to enable WAL mode: %w", err)
-	}
-
-	// Backup using SQLite's backup API
-	_, err = t.tx.Exec(fmt.Sprintf(`
-		ATTACH DATABASE '%s' AS backup;
-		
-		-- Create tables in backup database
-		CREATE TABLE backup.schema_migrations AS SELECT * FROM schema_migrations;
-		CREATE TABLE backup.users AS SELECT * FROM users;
-		CREATE TABLE backup.tokens AS SELECT * FROM tokens;
-		CREATE TABLE backup.processed_emails AS SELECT * FROM processed_emails;
-		
-		-- Create indexes in backup database
-		CREATE INDEX backup.idx_users_gmail_user_id ON users(gmail_user_id);
-		CREATE INDEX backup.idx_processed_emails_user_id ON processed_emails(user_id);
-		CREATE INDEX backup.idx_processed_emails_processed_at ON processed_emails(processed_at);
-		
-		DETACH DATABASE backup;
-	`, backupPath))
+	if err := copySchemaAndRows(ctx, t.tx, backupDB); err != nil {
+		// Don't leave a partial backup behind
+		backupDB.Close()
+		os.Remove(backupPath)
+		return err
+	}
+
+	return nil
+}
+
+// copySchemaAndRows recreates every schema object of src in dst and copies
+// the rows of each table, one table at a time, in a single dst transaction
+func copySchemaAndRows(ctx context.Context, src schemaQuerier, dst *sql.DB) error {
+	objects, err := listSchemaObjects(ctx, src)
 	if err != nil {
 		return fmt.Errorf("failed to backup database: %w", err)
 	}
 
+	backupTx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin backup transaction: %w", err)
+	}
+	defer backupTx.Rollback()
+
+	// Objects are ordered tables first, so rows are copied before indexes
+	// and triggers exist
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("backup interrupted: %w", err)
+		}
+		if _, err := backupTx.ExecContext(ctx, obj.SQL); err != nil {
+			return fmt.Errorf("failed to create %s %s in backup: %w", obj.Type, obj.Name, err)
+		}
+		if obj.Type != "table" {
+			continue
+		}
+		if err := copyTableRows(ctx, src, backupTx, obj.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := backupTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit backup: %w", err)
+	}
+
 	return nil
-} 
\ No newline at end of file
+}
+
+// copyTableRows copies all rows of a table from src into the same table in dst
+func copyTableRows(ctx context.Context, src schemaQuerier, dst *sql.Tx, table string) error {
+	return copyRows(ctx, src, dst, table, fmt.Sprintf("SELECT * FROM %s", quoteIdentifier(table)))
+}
+
+// copyRows copies the rows selected from a table in src by query, which must
+// select every column, into the same table in dst
+func copyRows(ctx context.Context, src schemaQuerier, dst *sql.Tx, table, query string, args ...interface{}) error {
+	rows, err := src.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to read columns of table %s: %w", table, err)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	insert, err := dst.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteIdentifier(table), placeholders))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy of table %s: %w", table, err)
+	}
+	defer insert.Close()
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("failed to scan row of table %s: %w", table, err)
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("failed to copy row of table %s: %w", table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read table %s: %w", table, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoBaseBackup   = errors.New("incremental backup needs a previous backup to build on")
+	ErrNotChangeset   = errors.New("not an incremental backup")
+	ErrChangesetOrder = errors.New("incremental backups are out of order")
+)
+
+// changeMarkers are the tables copied by BackupIncremental, parents before
+// children, with the column recording when each row last changed. Rows are
+// copied when they were inserted or updated since the last backup; deleted
+// rows are not tracked, so a full Backup is still needed from time to time.
+var changeMarkers = []struct {
+	table  string
+	column string
+}{
+	{"users", "updated_at"},
+	{"tokens", "updated_at"},
+	{"processed_emails", "processed_at"},
+	{"jobs", "updated_at"},
+}
+
+// changesetMetaTable records the period a changeset file covers
+const changesetMetaTable = "backup_changeset"
+
+// markerTimeFormat matches the second resolution of CURRENT_TIMESTAMP, so rows
+// written in the same second as the last backup started are copied again
+const markerTimeFormat = "2006-01-02 15:04:05"
+
+// LastBackupAt returns when the most recent Backup or BackupIncremental
+// started, or the zero time if the database has never been backed up
+func (s *SQLiteStorage) LastBackupAt(ctx context.Context) (time.Time, error) {
+	var last time.Time
+	err := s.db.QueryRowContext(ctx, `SELECT last_backup_at FROM backup_state WHERE id = 1`).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last backup time: %w", err)
+	}
+	return last.UTC(), nil
+}
+
+// recordBackup stores the start of a finished backup as the point the next
+// incremental backup continues from. Databases that have not been migrated
+// have no backup_state table and are backed up without tracking.
+func (s *SQLiteStorage) recordBackup(ctx context.Context, startedAt time.Time) error {
+	var tables int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'backup_state'`).Scan(&tables)
+	if err != nil {
+		return fmt.Errorf("failed to record backup: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO backup_state (id, last_backup_at) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET last_backup_at = excluded.last_backup_at
+	`, startedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record backup: %w", err)
+	}
+	return nil
+}
+
+// BackupIncremental writes a changeset holding the rows of the tracked tables
+// that changed since the last backup. Apply changesets in the order they were
+// taken with RestoreIncremental on top of the Backup they build on.
+func (s *SQLiteStorage) BackupIncremental(ctx context.Context, changesetPath string) error {
+	since, err := s.LastBackupAt(ctx)
+	if err != nil {
+		return err
+	}
+	if since.IsZero() {
+		return ErrNoBaseBackup
+	}
+	startedAt := time.Now().UTC()
+
+	if err := os.MkdirAll(filepath.Dir(changesetPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.Remove(changesetPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove existing backup: %w", err)
+	}
+
+	changesetDB, err := sql.Open("sqlite3", changesetPath)
+	if err != nil {
+		return fmt.Errorf("failed to create changeset database: %w", err)
+	}
+	defer changesetDB.Close()
+
+	objects, err := listSchemaObjects(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("failed to backup database: %w", err)
+	}
+	tableSQL := make(map[string]string)
+	for _, obj := range objects {
+		if obj.Type == "table" {
+			tableSQL[obj.Name] = obj.SQL
+		}
+	}
+
+	changesetTx, err := changesetDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin changeset transaction: %w", err)
+	}
+	defer changesetTx.Rollback()
+
+	_, err = changesetTx.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE %s (since TIMESTAMP NOT NULL, taken_at TIMESTAMP NOT NULL)`, changesetMetaTable))
+	if err != nil {
+		return fmt.Errorf("failed to create changeset metadata: %w", err)
+	}
+	_, err = changesetTx.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (since, taken_at) VALUES (?, ?)`, changesetMetaTable), since, startedAt)
+	if err != nil {
+		return fmt.Errorf("failed to write changeset metadata: %w", err)
+	}
+
+	for _, marker := range changeMarkers {
+		createSQL, ok := tableSQL[marker.table]
+		if !ok {
+			continue
+		}
+		if _, err := changesetTx.ExecContext(ctx, createSQL); err != nil {
+			return fmt.Errorf("failed to create table %s in changeset: %w", marker.table, err)
+		}
+		// julianday compares CURRENT_TIMESTAMP text and Go timestamps alike
+		query := fmt.Sprintf("SELECT * FROM %s WHERE julianday(%s) >= julianday(?)",
+			quoteIdentifier(marker.table), quoteIdentifier(marker.column))
+		if err := copyRows(ctx, s.db, changesetTx, marker.table, query, since.Format(markerTimeFormat)); err != nil {
+			return err
+		}
+	}
+
+	if err := changesetTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit changeset: %w", err)
+	}
+
+	return s.recordBackup(ctx, startedAt)
+}
+
+// changesetPeriod is the span of changes held by a changeset file
+type changesetPeriod struct {
+	since   time.Time
+	takenAt time.Time
+}
+
+// readChangesetPeriod reads the metadata of a changeset file
+func readChangesetPeriod(ctx context.Context, changesetPath string) (changesetPeriod, error) {
+	var period changesetPeriod
+	if _, err := os.Stat(changesetPath); err != nil {
+		return period, fmt.Errorf("backup file not found: %w", err)
+	}
+
+	changesetDB, err := sql.Open("sqlite3", changesetPath)
+	if err != nil {
+		return period, fmt.Errorf("failed to open changeset database: %w", err)
+	}
+	defer changesetDB.Close()
+
+	err = changesetDB.QueryRowContext(ctx, fmt.Sprintf(
+		`SELECT since, taken_at FROM %s`, changesetMetaTable)).Scan(&period.since, &period.takenAt)
+	if err != nil {
+		return period, fmt.Errorf("%w: %s: %v", ErrNotChangeset, changesetPath, err)
+	}
+	return period, nil
+}
+
+// RestoreIncremental applies changesets written by BackupIncremental, oldest
+// first, on top of the database restored from their base backup. Changed rows
+// replace the rows with the same primary key. Each changeset is applied in
+// its own transaction; each changeset must start where the previous one ended.
+func (s *SQLiteStorage) RestoreIncremental(ctx context.Context, changesetPaths ...string) error {
+	var last changesetPeriod
+	for i, path := range changesetPaths {
+		period, err := readChangesetPeriod(ctx, path)
+		if err != nil {
+			return err
+		}
+		if i > 0 && !period.since.Equal(last.takenAt) {
+			return fmt.Errorf("%w: %s does not follow %s", ErrChangesetOrder, path, changesetPaths[i-1])
+		}
+		last = period
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for restore: %w", err)
+	}
+	defer conn.Close()
+
+	for _, path := range changesetPaths {
+		if err := applyChangeset(ctx, conn, path); err != nil {
+			return err
+		}
+	}
+
+	if len(changesetPaths) == 0 {
+		return nil
+	}
+	return s.recordBackup(ctx, last.takenAt)
+}
+
+// applyChangeset attaches a changeset to conn and upserts its rows
+func applyChangeset(ctx context.Context, conn *sql.Conn, changesetPath string) error {
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS changeset`, changesetPath); err != nil {
+		return fmt.Errorf("failed to attach changeset %s: %w", changesetPath, err)
+	}
+	defer conn.ExecContext(context.Background(), `DETACH DATABASE changeset`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin restore transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, marker := range changeMarkers {
+		var tables int
+		err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM changeset.sqlite_master WHERE type = 'table' AND name = ?`, marker.table).Scan(&tables)
+		if err != nil {
+			return fmt.Errorf("failed to read changeset %s: %w", changesetPath, err)
+		}
+		if tables == 0 {
+			continue
+		}
+
+		upsert, err := changesetUpsert(ctx, tx, marker.table)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, upsert); err != nil {
+			return fmt.Errorf("failed to restore table %s from %s: %w", marker.table, changesetPath, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit restore: %w", err)
+	}
+	return nil
+}
+
+// changesetUpsert builds the statement that copies a table's rows from the
+// attached changeset into main. Rows are updated in place rather than
+// replaced, so ON DELETE CASCADE does not remove their children.
+func changesetUpsert(ctx context.Context, tx *sql.Tx, table string) (string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name, pk FROM pragma_table_info(?, 'changeset')`, table)
+	if err != nil {
+		return "", fmt.Errorf("failed to read columns of table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns, keys, updates []string
+	for rows.Next() {
+		var name string
+		var pk int
+		if err := rows.Scan(&name, &pk); err != nil {
+			return "", fmt.Errorf("failed to read columns of table %s: %w", table, err)
+		}
+		column := quoteIdentifier(name)
+		columns = append(columns, column)
+		if pk > 0 {
+			keys = append(keys, column)
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to read columns of table %s: %w", table, err)
+	}
+
+	list := strings.Join(columns, ", ")
+	// WHERE true keeps ON CONFLICT from being parsed as part of the SELECT
+	upsert := fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM changeset.%s WHERE true",
+		quoteIdentifier(table), list, list, quoteIdentifier(table))
+	switch {
+	case len(keys) == 0:
+		return upsert, nil
+	case len(updates) == 0:
+		return upsert + fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(keys, ", ")), nil
+	default:
+		return upsert + fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s",
+			strings.Join(keys, ", "), strings.Join(updates, ", ")), nil
+	}
+}
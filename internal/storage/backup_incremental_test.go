@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openBackupTestStorage opens a migrated database with a jobs table like the
+// one the scheduler creates
+func openBackupTestStorage(t *testing.T, path string) *SQLiteStorage {
+	cfg := DefaultConfig()
+	cfg.Path = path
+	storage, err := OpenDatabase(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+
+	_, err = storage.db.Exec(`CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`)
+	require.NoError(t, err)
+	return storage
+}
+
+// dumpTable returns every row of a table as text, in primary key order
+func dumpTable(t *testing.T, db *sql.DB, table string) []string {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY 1, 2", quoteIdentifier(table)))
+	require.NoError(t, err)
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	require.NoError(t, err)
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var dump []string
+	for rows.Next() {
+		require.NoError(t, rows.Scan(pointers...))
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = fmt.Sprint(v)
+		}
+		dump = append(dump, strings.Join(fields, "|"))
+	}
+	require.NoError(t, rows.Err())
+	return dump
+}
+
+func TestSQLiteStorage_BackupIncremental(t *testing.T) {
+	dir := t.TempDir()
+	storage := openBackupTestStorage(t, filepath.Join(dir, "live.db"))
+	db := storage.db
+	ctx := context.Background()
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		_, err := db.ExecContext(ctx, query, args...)
+		require.NoError(t, err)
+	}
+
+	// An incremental backup needs a base to build on
+	last, err := storage.LastBackupAt(ctx)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero())
+	assert.ErrorIs(t, storage.BackupIncremental(ctx, filepath.Join(dir, "orphan.db")), ErrNoBaseBackup)
+
+	// Data from before the base backup
+	exec(`INSERT INTO users (id, email, updated_at) VALUES ('u1', 'u1@example.com', '2020-01-01 00:00:00')`)
+	exec(`INSERT INTO processed_emails (message_id, user_id, processed_at) VALUES ('m1', 'u1', '2020-01-01 00:00:00')`)
+	exec(`INSERT INTO jobs (id, status, updated_at) VALUES ('j1', 'pending', '2020-01-01 00:00:00')`)
+
+	basePath := filepath.Join(dir, "base.db")
+	require.NoError(t, storage.Backup(ctx, basePath))
+	baseAt, err := storage.LastBackupAt(ctx)
+	require.NoError(t, err)
+	assert.False(t, baseAt.IsZero())
+
+	// First increment: a new user with a token and an email, and a job update
+	exec(`INSERT INTO users (id, email) VALUES ('u2', 'u2@example.com')`)
+	exec(`INSERT INTO tokens (user_id, encrypted_token, nonce) VALUES ('u2', 'token', 'nonce')`)
+	require.NoError(t, storage.MarkEmailProcessed(ctx, "m2", "u2"))
+	exec(`UPDATE jobs SET status = 'completed', updated_at = CURRENT_TIMESTAMP WHERE id = 'j1'`)
+
+	firstPath := filepath.Join(dir, "inc1.db")
+	require.NoError(t, storage.BackupIncremental(ctx, firstPath))
+	firstAt, err := storage.LastBackupAt(ctx)
+	require.NoError(t, err)
+	assert.True(t, firstAt.After(baseAt))
+
+	// Only the rows changed since the base backup are in the changeset
+	changeset, err := sql.Open("sqlite3", firstPath)
+	require.NoError(t, err)
+	defer changeset.Close()
+	assert.Equal(t, []string{"u2"}, columnValues(t, changeset, "SELECT id FROM users"))
+	assert.Equal(t, []string{"m2"}, columnValues(t, changeset, "SELECT message_id FROM processed_emails"))
+	assert.Equal(t, []string{"j1"}, columnValues(t, changeset, "SELECT id FROM jobs"))
+
+	// Second increment: an update of an old user and more new rows
+	require.NoError(t, storage.UpdateGmailQuery(ctx, "u1", "label:important"))
+	require.NoError(t, storage.MarkEmailProcessed(ctx, "m3", "u1"))
+	exec(`INSERT INTO jobs (id, status, updated_at) VALUES ('j2', 'pending', CURRENT_TIMESTAMP)`)
+	exec(`UPDATE tokens SET encrypted_token = 'b', updated_at = CURRENT_TIMESTAMP WHERE user_id = 'u2'`)
+
+	secondPath := filepath.Join(dir, "inc2.db")
+	require.NoError(t, storage.BackupIncremental(ctx, secondPath))
+
+	fullPath := filepath.Join(dir, "full.db")
+	require.NoError(t, storage.Backup(ctx, fullPath))
+	full, err := sql.Open("sqlite3", fullPath)
+	require.NoError(t, err)
+	defer full.Close()
+
+	// Changesets only apply in the order they were taken
+	restored := openBackupTestStorage(t, filepath.Join(dir, "restored.db"))
+	require.NoError(t, restored.Restore(ctx, basePath))
+	assert.ErrorIs(t, restored.RestoreIncremental(ctx, secondPath, firstPath), ErrChangesetOrder)
+	assert.ErrorIs(t, restored.RestoreIncremental(ctx, basePath), ErrNotChangeset)
+
+	require.NoError(t, restored.RestoreIncremental(ctx, firstPath, secondPath))
+	for _, marker := range changeMarkers {
+		assert.Equal(t, dumpTable(t, full, marker.table), dumpTable(t, restored.db, marker.table), marker.table)
+	}
+
+	// The restored database continues from the last changeset
+	secondAt, err := storage.LastBackupAt(ctx)
+	require.NoError(t, err)
+	restoredAt, err := restored.LastBackupAt(ctx)
+	require.NoError(t, err)
+	assert.True(t, restoredAt.After(firstAt))
+	assert.False(t, restoredAt.After(secondAt))
+}
+
+// columnValues returns the first column of every row the query returns
+func columnValues(t *testing.T, db *sql.DB, query string) []string {
+	rows, err := db.Query(query)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		require.NoError(t, rows.Scan(&value))
+		values = append(values, value)
+	}
+	require.NoError(t, rows.Err())
+	return values
+}
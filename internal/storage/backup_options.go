@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// encryptedBackupMagic prefixes backups encrypted by BackupWithOptions
+	encryptedBackupMagic = []byte("GDBKENC1")
+	// gzipMagic is the gzip member header
+	gzipMagic = []byte{0x1f, 0x8b}
+	// sqliteMagic is the SQLite database file header
+	sqliteMagic = []byte("SQLite format 3\x00")
+
+	ErrBackupKeyRequired = errors.New("encryption key required for encrypted backup")
+	ErrUnknownBackup     = errors.New("unrecognized backup format")
+)
+
+// BackupOptions controls how BackupWithOptions writes a backup file.
+// Compression is applied before encryption.
+type BackupOptions struct {
+	Compress bool
+	Encrypt  bool
+	// Key is the AES-256 key used when Encrypt is set, normally the token encryption key.
+	// RestoreWithOptions needs it to read encrypted backups.
+	Key []byte
+}
+
+// Extension returns the conventional file extension for a backup written with these options
+func (o BackupOptions) Extension() string {
+	ext := ".db"
+	if o.Compress {
+		ext += ".gz"
+	}
+	if o.Encrypt {
+		ext += ".enc"
+	}
+	return ext
+}
+
+// BackupWithOptions creates a backup at the specified path, optionally gzip
+// compressed and/or encrypted with AES-256-GCM
+func (s *SQLiteStorage) BackupWithOptions(ctx context.Context, backupPath string, opts BackupOptions) error {
+	if !opts.Compress && !opts.Encrypt {
+		return s.Backup(ctx, backupPath)
+	}
+	if opts.Encrypt && len(opts.Key) != KeySize {
+		return ErrInvalidKeySize
+	}
+
+	backupDir := filepath.Dir(backupPath)
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Take a plain backup next to the destination, then encode it
+	tmpDir, err := os.MkdirTemp(backupDir, ".backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	plainPath := filepath.Join(tmpDir, "backup.db")
+	if err := s.Backup(ctx, plainPath); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(plainPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	if opts.Compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return fmt.Errorf("failed to compress backup: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress backup: %w", err)
+		}
+		data = buf.Bytes()
+	}
+
+	if opts.Encrypt {
+		data, err = encryptBackup(opts.Key, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	encodedPath := filepath.Join(tmpDir, "backup.out")
+	if err := os.WriteFile(encodedPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(encodedPath, backupPath); err != nil {
+		return fmt.Errorf("failed to move backup into place: %w", err)
+	}
+
+	return nil
+}
+
+// RestoreWithOptions restores the database from a backup written by Backup or
+// BackupWithOptions. The format is detected from the file header; opts.Key is
+// only needed for encrypted backups.
+func (s *SQLiteStorage) RestoreWithOptions(ctx context.Context, backupPath string, opts BackupOptions) error {
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return fmt.Errorf("backup file not found: %w", err)
+	}
+
+	if bytes.HasPrefix(data, encryptedBackupMagic) {
+		if len(opts.Key) == 0 {
+			return ErrBackupKeyRequired
+		}
+		data, err = decryptBackup(opts.Key, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if bytes.HasPrefix(data, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decompress backup: %w", err)
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return fmt.Errorf("failed to decompress backup: %w", err)
+		}
+	}
+
+	if !bytes.HasPrefix(data, sqliteMagic) {
+		return ErrUnknownBackup
+	}
+
+	tmpDir, err := os.MkdirTemp("", "gmaildigest-restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	plainPath := filepath.Join(tmpDir, "backup.db")
+	if err := os.WriteFile(plainPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write decoded backup: %w", err)
+	}
+
+	return s.Restore(ctx, plainPath)
+}
+
+// encryptBackup seals data with AES-256-GCM as magic || nonce || ciphertext
+func encryptBackup(key, data []byte) ([]byte, error) {
+	aesGCM, err := newBackupGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(encryptedBackupMagic)+len(nonce)+len(data)+aesGCM.Overhead())
+	out = append(out, encryptedBackupMagic...)
+	out = append(out, nonce...)
+	// The header is authenticated so it cannot be swapped
+	return aesGCM.Seal(out, nonce, data, encryptedBackupMagic), nil
+}
+
+// decryptBackup opens data produced by encryptBackup
+func decryptBackup(key, data []byte) ([]byte, error) {
+	aesGCM, err := newBackupGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[len(encryptedBackupMagic):]
+	if len(data) < aesGCM.NonceSize() {
+		return nil, ErrInvalidNonce
+	}
+	nonce, ciphertext := data[:aesGCM.NonceSize()], data[aesGCM.NonceSize():]
+
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, encryptedBackupMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newBackupGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKeySize
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aesGCM, nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStorage_BackupWithOptions_RoundTrip(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		name   string
+		opts   BackupOptions
+		prefix []byte
+	}{
+		{"plain", BackupOptions{}, sqliteMagic},
+		{"compressed", BackupOptions{Compress: true}, gzipMagic},
+		{"encrypted", BackupOptions{Encrypt: true, Key: key}, encryptedBackupMagic},
+		{"compressed and encrypted", BackupOptions{Compress: true, Encrypt: true, Key: key}, encryptedBackupMagic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			ctx := context.Background()
+
+			db, err := sql.Open("sqlite3", filepath.Join(tmpDir, "source.db"))
+			require.NoError(t, err)
+			defer db.Close()
+			storage := NewSQLiteStorage(db)
+
+			_, err = db.ExecContext(ctx, `
+				CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);
+				INSERT INTO notes (body) VALUES ('first'), ('second');
+			`)
+			require.NoError(t, err)
+
+			backupPath := filepath.Join(tmpDir, "backup"+tt.opts.Extension())
+			require.NoError(t, storage.BackupWithOptions(ctx, backupPath, tt.opts))
+
+			data, err := os.ReadFile(backupPath)
+			require.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(data, tt.prefix))
+			if tt.opts.Encrypt {
+				assert.False(t, bytes.Contains(data, []byte("second")))
+			}
+
+			// Restore into a fresh database
+			restoreDB, err := sql.Open("sqlite3", filepath.Join(tmpDir, "restore.db"))
+			require.NoError(t, err)
+			defer restoreDB.Close()
+			restored := NewSQLiteStorage(restoreDB)
+
+			require.NoError(t, restored.RestoreWithOptions(ctx, backupPath, BackupOptions{Key: key}))
+
+			var body string
+			require.NoError(t, restoreDB.QueryRowContext(ctx, "SELECT body FROM notes WHERE id = 2").Scan(&body))
+			assert.Equal(t, "second", body)
+		})
+	}
+}
+
+func TestSQLiteStorage_RestoreWithOptions_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.Background()
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	db, err := sql.Open("sqlite3", filepath.Join(tmpDir, "source.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	storage := NewSQLiteStorage(db)
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE notes (body TEXT)`)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, storage.BackupWithOptions(ctx, filepath.Join(tmpDir, "x.db.enc"), BackupOptions{Encrypt: true}), ErrInvalidKeySize)
+
+	encPath := filepath.Join(tmpDir, "backup.db.enc")
+	require.NoError(t, storage.BackupWithOptions(ctx, encPath, BackupOptions{Encrypt: true, Key: key}))
+
+	assert.ErrorIs(t, storage.RestoreWithOptions(ctx, encPath, BackupOptions{}), ErrBackupKeyRequired)
+	assert.Error(t, storage.RestoreWithOptions(ctx, encPath, BackupOptions{Key: []byte("fedcba9876543210fedcba9876543210")}))
+
+	junkPath := filepath.Join(tmpDir, "junk.db")
+	require.NoError(t, os.WriteFile(junkPath, []byte("not a backup"), 0600))
+	assert.ErrorIs(t, storage.RestoreWithOptions(ctx, junkPath, BackupOptions{}), ErrUnknownBackup)
+}
@@ -3,8 +3,10 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -104,8 +106,12 @@ func TestSQLiteStorage_BackupWithTransaction(t *testing.T) {
 	err = tx.CreateUser(telegramID, gmailUserID, time.Hour)
 	require.NoError(t, err)
 
-	// Create backup before commit
-	err = storage.Backup(ctx, backupPath)
+	// A backup taken within the transaction sees its uncommitted data
+	err = tx.Backup(ctx, backupPath)
+	require.NoError(t, err)
+
+	// Roll back the transaction
+	err = tx.Rollback()
 	require.NoError(t, err)
 
 	// Open backup database
@@ -113,17 +119,11 @@ func TestSQLiteStorage_BackupWithTransaction(t *testing.T) {
 	require.NoError(t, err)
 	defer backupDB.Close()
 
-	backupStorage := NewSQLiteStorage(backupDB)
-
-	// Verify data not in backup (transaction not committed)
-	_, err = backupStorage.GetUser(ctx, telegramID)
-	assert.Error(t, err)
-
-	// Commit transaction
-	err = tx.Commit()
+	user, err := NewSQLiteStorage(backupDB).GetUser(ctx, telegramID)
 	require.NoError(t, err)
+	assert.Equal(t, gmailUserID, user.GmailUserID)
 
-	// Create new backup after commit
+	// Create new backup after rollback
 	backupPath2 := filepath.Join(tmpDir, "backup2.db")
 	err = storage.Backup(ctx, backupPath2)
 	require.NoError(t, err)
@@ -133,12 +133,9 @@ func TestSQLiteStorage_BackupWithTransaction(t *testing.T) {
 	require.NoError(t, err)
 	defer backupDB2.Close()
 
-	backupStorage2 := NewSQLiteStorage(backupDB2)
-
-	// Verify data in second backup (transaction committed)
-	user, err := backupStorage2.GetUser(ctx, telegramID)
-	require.NoError(t, err)
-	assert.Equal(t, gmailUserID, user.GmailUserID)
+	// Verify data not in second backup (transaction rolled back)
+	_, err = NewSQLiteStorage(backupDB2).GetUser(ctx, telegramID)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestSQLiteStorage_BackupFailure(t *testing.T) {
@@ -158,8 +155,8 @@ func TestSQLiteStorage_BackupFailure(t *testing.T) {
 	err = storage.Migrate(context.Background())
 	require.NoError(t, err)
 
-	// Try to backup to invalid path
-	err = storage.Backup(context.Background(), "/nonexistent/path/backup.db")
+	// Try to backup to a path under a regular file
+	err = storage.Backup(context.Background(), filepath.Join(dbPath, "backup.db"))
 	assert.Error(t, err)
 }
 
@@ -186,9 +183,9 @@ func TestSQLiteStorage_BackupWithConcurrentOperations(t *testing.T) {
 	errs := make(chan error, 10)
 
 	// Start goroutines to perform concurrent operations
-	for i := 0; i < 10; i++ {
+	for i := 1; i <= 10; i++ {
 		go func(id int64) {
-			err := storage.CreateUser(ctx, id, "test@example.com", time.Hour)
+			err := storage.CreateUser(ctx, id, fmt.Sprintf("user%d@example.com", id), time.Hour)
 			if err != nil {
 				errs <- err
 				return
@@ -228,10 +225,127 @@ func TestSQLiteStorage_BackupWithConcurrentOperations(t *testing.T) {
 	assert.True(t, count > 0)
 
 	// Verify all successful operations are reflected in backup
-	for i := 0; i < 10; i++ {
+	for i := 1; i <= 10; i++ {
 		user, err := backupStorage.GetUser(ctx, int64(i))
 		if err == nil {
-			assert.Equal(t, "test@example.com", user.GmailUserID)
+			assert.Equal(t, fmt.Sprintf("user%d@example.com", i), user.GmailUserID)
 		}
 	}
-} 
\ No newline at end of file
+}
+
+func TestSQLiteStorage_BackupCopiesWholeSchema(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	backupPath := filepath.Join(tmpDir, "backup.db")
+
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+
+	// Objects that no hardcoded table list would know about
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE jobs (id TEXT PRIMARY KEY, status TEXT NOT NULL, updated_at INTEGER);
+		CREATE INDEX idx_jobs_status ON jobs(status);
+		CREATE TRIGGER jobs_touch AFTER UPDATE ON jobs BEGIN
+			UPDATE jobs SET updated_at = 1 WHERE id = NEW.id;
+		END;
+		INSERT INTO jobs (id, status) VALUES ('job1', 'pending'), ('job2', 'dead');
+	`)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Backup(ctx, backupPath))
+
+	backupDB, err := sql.Open("sqlite3", backupPath)
+	require.NoError(t, err)
+	defer backupDB.Close()
+
+	objects, err := listSchemaObjects(ctx, backupDB)
+	require.NoError(t, err)
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.Type+":"+obj.Name)
+	}
+	assert.ElementsMatch(t, []string{"table:jobs", "index:idx_jobs_status", "trigger:jobs_touch"}, names)
+
+	var count int
+	require.NoError(t, backupDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM jobs").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	// The transaction variant copies the same schema
+	txBackupPath := filepath.Join(tmpDir, "tx_backup.db")
+	tx, err := storage.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Backup(ctx, txBackupPath))
+	require.NoError(t, tx.Rollback())
+
+	txBackupDB, err := sql.Open("sqlite3", txBackupPath)
+	require.NoError(t, err)
+	defer txBackupDB.Close()
+
+	txObjects, err := listSchemaObjects(ctx, txBackupDB)
+	require.NoError(t, err)
+	assert.Equal(t, objects, txObjects)
+	require.NoError(t, txBackupDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM jobs").Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+// cancelAfterChecks is a context that reports itself cancelled once its Err
+// method has been called a given number of times, to stop a copy partway
+type cancelAfterChecks struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelAfterChecks) Err() error {
+	if c.checks <= 0 {
+		return context.Canceled
+	}
+	c.checks--
+	return nil
+}
+
+func TestSQLiteStorage_BackupCancelled(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Path = filepath.Join(dir, "live.db")
+	storage, err := OpenDatabase(cfg)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	// Enough rows to take several backup steps
+	ctx := context.Background()
+	padding := strings.Repeat("x", 1000)
+	tx, err := storage.db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	for i := 0; i < 2000; i++ {
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`,
+			fmt.Sprintf("user%d", i), fmt.Sprintf("%s%d@example.com", padding, i))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+
+	backupPath := filepath.Join(dir, "backup.db")
+	err = storage.Backup(&cancelAfterChecks{Context: ctx, checks: 1}, backupPath)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoFileExists(t, backupPath)
+	last, err := storage.LastBackupAt(ctx)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "a cancelled backup is not recorded")
+
+	// The transaction variant stops between tables
+	txBackupPath := filepath.Join(dir, "tx_backup.db")
+	storageTx, err := storage.BeginTx(ctx)
+	require.NoError(t, err)
+	defer storageTx.Rollback()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, storageTx.Backup(cancelled, txBackupPath), context.Canceled)
+	assert.NoFileExists(t, txBackupPath)
+
+	// Without cancellation the backup completes
+	require.NoError(t, storage.Backup(ctx, backupPath))
+	assert.FileExists(t, backupPath)
+}
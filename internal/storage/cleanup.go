@@ -29,7 +29,7 @@ func (s *SQLiteStorage) CleanupInvalidTokens(ctx context.Context) (int64, error)
 	query := `
 		DELETE FROM tokens
 		WHERE user_id IN (
-			SELECT gmail_user_id
+			SELECT id
 			FROM users
 			WHERE google_token_valid = FALSE
 		)
@@ -58,7 +58,7 @@ func (s *SQLiteStorage) CleanupInactiveUsers(ctx context.Context, inactivityPeri
 	_, err = tx.ExecContext(ctx, `
 		DELETE FROM tokens
 		WHERE user_id IN (
-			SELECT gmail_user_id
+			SELECT id
 			FROM users
 			WHERE updated_at < datetime('now', ?)
 		)`,
@@ -88,6 +88,41 @@ func (s *SQLiteStorage) CleanupInactiveUsers(ctx context.Context, inactivityPeri
 	return deleted, nil
 }
 
+// CleanupExpiredOAuthState removes OAuth state and PKCE verifier rows older than the ttl
+func (s *SQLiteStorage) CleanupExpiredOAuthState(ctx context.Context, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	cutoff := fmt.Sprintf("-%d seconds", int64(ttl.Seconds()))
+	var deleted int64
+	for _, table := range []string{"oauth_state", "pkce_verifier"} {
+		result, err := tx.ExecContext(ctx,
+			fmt.Sprintf("DELETE FROM %s WHERE created_at < datetime('now', ?)", table),
+			cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("failed to cleanup %s: %w", table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		deleted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deleted, nil
+}
+
 // Transaction cleanup methods
 
 // CleanupProcessedEmails removes processed email records older than the retention period within a transaction
@@ -121,7 +156,7 @@ func (t *Transaction) CleanupInvalidTokens() (int64, error) {
 	query := `
 		DELETE FROM tokens
 		WHERE user_id IN (
-			SELECT gmail_user_id
+			SELECT id
 			FROM users
 			WHERE google_token_valid = FALSE
 		)
@@ -148,7 +183,7 @@ func (t *Transaction) CleanupInactiveUsers(inactivityPeriod time.Duration) (int6
 	_, err := t.tx.Exec(`
 		DELETE FROM tokens
 		WHERE user_id IN (
-			SELECT gmail_user_id
+			SELECT id
 			FROM users
 			WHERE updated_at < datetime('now', ?)
 		)`,
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -85,7 +86,7 @@ func TestSQLiteStorage_CleanupInvalidTokens(t *testing.T) {
 		require.NoError(t, err)
 
 		if !u.tokenValid {
-			_, err = db.Exec("UPDATE users SET google_token_valid = ? WHERE telegram_id = ?", false, u.telegramID)
+			_, err = db.Exec("UPDATE users SET google_token_valid = ? WHERE telegram_user_id = ?", false, u.telegramID)
 			require.NoError(t, err)
 		}
 	}
@@ -136,7 +137,7 @@ func TestSQLiteStorage_CleanupInactiveUsers(t *testing.T) {
 			_, err = db.Exec(`
 				UPDATE users 
 				SET updated_at = datetime('now', ?)
-				WHERE telegram_id = ?`,
+				WHERE telegram_user_id = ?`,
 				u.lastActive, u.telegramID)
 			require.NoError(t, err)
 		}
@@ -159,7 +160,9 @@ func TestSQLiteStorage_CleanupInactiveUsers(t *testing.T) {
 }
 
 func TestSQLiteStorage_CleanupWithTransaction(t *testing.T) {
-	db, err := sql.Open("sqlite3", ":memory:")
+	// The transaction and the reads outside it use separate connections, which
+	// must share one database
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
 	require.NoError(t, err)
 	defer db.Close()
 
@@ -245,4 +248,38 @@ func TestSQLiteStorage_CleanupWithRollback(t *testing.T) {
 	processed, err := storage.IsEmailProcessed(ctx, "msg1", userID)
 	require.NoError(t, err)
 	assert.True(t, processed)
-} 
\ No newline at end of file
+} 
+func TestSQLiteStorage_CleanupMatchesUserIDs(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+
+	// Users and tokens as written by the current schema, keyed by users.id
+	for _, id := range []string{"revoked", "active", "inactive"} {
+		_, err := db.Exec(`INSERT INTO users (id, email) VALUES (?, ?)`, id, id+"@example.com")
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO tokens (user_id, encrypted_token, nonce) VALUES (?, 'token', 'nonce')`, id)
+		require.NoError(t, err)
+	}
+	require.NoError(t, storage.SetTokenValid(ctx, "revoked", false))
+	_, err = db.Exec(`UPDATE users SET updated_at = datetime('now', '-400 days') WHERE id = 'inactive'`)
+	require.NoError(t, err)
+
+	deleted, err := storage.CleanupInvalidTokens(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = storage.CleanupInactiveUsers(ctx, 365*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var tokens, users int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM tokens`).Scan(&tokens))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users))
+	assert.Equal(t, 1, tokens)
+	assert.Equal(t, 2, users)
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Vacuum rebuilds the database file to reclaim the space left behind by
+// deleted rows, refreshes the query planner statistics and truncates the
+// write-ahead log.
+//
+// VACUUM cannot run inside a transaction, so Vacuum takes a connection of its
+// own from the pool instead of joining one that a Transaction may hold. It
+// waits for the busy timeout while other connections are writing.
+func (s *SQLiteStorage) Vacuum(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for vacuum: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA optimize"); err != nil {
+		return fmt.Errorf("failed to optimize database: %w", err)
+	}
+
+	// Outside WAL mode the checkpoint is a no-op that reports no log
+	var busy, logFrames, checkpointed int
+	if err := conn.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("failed to checkpoint write-ahead log: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("failed to checkpoint write-ahead log: database is busy")
+	}
+
+	return nil
+}
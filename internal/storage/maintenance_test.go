@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStorage_Vacuum(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	cfg := DefaultConfig()
+	cfg.Path = dbPath
+	storage, err := OpenDatabase(cfg)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	ctx := context.Background()
+	_, err = storage.db.ExecContext(ctx, `CREATE TABLE churn (id INTEGER PRIMARY KEY, body TEXT NOT NULL)`)
+	require.NoError(t, err)
+
+	body := strings.Repeat("x", 4096)
+	tx, err := storage.db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	for i := 0; i < 2000; i++ {
+		_, err := tx.ExecContext(ctx, `INSERT INTO churn (body) VALUES (?)`, body)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+	_, err = storage.db.ExecContext(ctx, `DELETE FROM churn`)
+	require.NoError(t, err)
+
+	// Deleting rows leaves the file, and its write-ahead log, at full size
+	before := databaseSize(t, dbPath)
+	require.Greater(t, before, int64(2000*4096))
+
+	require.NoError(t, storage.Vacuum(ctx))
+
+	after := databaseSize(t, dbPath)
+	assert.Less(t, after, before/10)
+
+	// The write-ahead log was truncated
+	info, err := os.Stat(dbPath + "-wal")
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+// databaseSize returns the size of the database file plus its write-ahead log
+func databaseSize(t *testing.T, path string) int64 {
+	var size int64
+	for _, name := range []string{path, path + "-wal"} {
+		info, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		require.NoError(t, err)
+		size += info.Size()
+	}
+	return size
+}
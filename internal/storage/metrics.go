@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"time"
 )
@@ -13,18 +14,44 @@ type Metrics struct {
 	ProcessedEmails int64     // Total number of processed emails
 	ValidTokens     int64     // Number of valid tokens
 	CollectedAt     time.Time // When these metrics were collected
+	PeriodStart     time.Time // Start of the bucket counted, for a metrics series
 }
 
 // UserMetrics represents user-specific metrics
 type UserMetrics struct {
-	TelegramID      int64     // User's Telegram ID
-	GmailUserID     string    // User's Gmail ID
-	ProcessedEmails int64     // Number of processed emails
-	HasValidToken   bool      // Whether the user has a valid token
-	LastActive      time.Time // Last activity timestamp
-	DigestInterval  time.Duration // User's digest interval
+	TelegramID          int64         // User's Telegram ID
+	GmailUserID         string        // User's ID, which processed emails are recorded under
+	ProcessedEmails     int64         // Number of processed emails
+	EmailsLast24h       int64         // Number of emails processed in the last 24 hours
+	EmailsLast7d        int64         // Number of emails processed in the last 7 days
+	HasValidToken       bool          // Whether the user has a valid token
+	LastActive          time.Time     // Last activity timestamp
+	TimeSinceLastDigest time.Duration // Time since the last digest was sent; zero if none has been
 }
 
+// userMetricsQuery looks a user up by Telegram ID
+const userMetricsQuery = `
+	SELECT
+		id,
+		google_token_valid,
+		last_digest_sent,
+		updated_at
+	FROM users
+	WHERE telegram_user_id = ?
+`
+
+// userEmailVolumeQuery counts a user's processed emails in total and within
+// the last day and week. julianday compares CURRENT_TIMESTAMP text and Go
+// timestamps alike.
+const userEmailVolumeQuery = `
+	SELECT
+		COUNT(*),
+		COUNT(CASE WHEN julianday(processed_at) >= julianday('now', '-1 day') THEN 1 END),
+		COUNT(CASE WHEN julianday(processed_at) >= julianday('now', '-7 days') THEN 1 END)
+	FROM processed_emails
+	WHERE user_id = ?
+`
+
 // GetMetrics retrieves system-wide metrics
 func (s *SQLiteStorage) GetMetrics(ctx context.Context) (*Metrics, error) {
 	metrics := &Metrics{
@@ -55,7 +82,7 @@ func (s *SQLiteStorage) GetMetrics(ctx context.Context) (*Metrics, error) {
 	err = s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*)
 		FROM tokens t
-		JOIN users u ON t.user_id = u.gmail_user_id
+		JOIN users u ON t.user_id = u.id
 		WHERE u.google_token_valid = TRUE
 	`).Scan(&metrics.ValidTokens)
 	if err != nil {
@@ -101,7 +128,7 @@ func (s *SQLiteStorage) GetMetricsWithinTimeRange(ctx context.Context, start, en
 	err = s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*)
 		FROM tokens t
-		JOIN users u ON t.user_id = u.gmail_user_id
+		JOIN users u ON t.user_id = u.id
 		WHERE u.google_token_valid = TRUE
 		AND t.created_at <= ?
 		AND (t.updated_at >= ? OR t.updated_at >= ?)
@@ -113,6 +140,56 @@ func (s *SQLiteStorage) GetMetricsWithinTimeRange(ctx context.Context, start, en
 	return metrics, nil
 }
 
+// GetMetricsSeries counts the emails processed in each bucket-long interval
+// from start up to end, oldest first. Buckets without emails are included
+// with a zero count, so the series can be charted directly.
+func (s *SQLiteStorage) GetMetricsSeries(ctx context.Context, start, end time.Time, bucket time.Duration) ([]Metrics, error) {
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: end time cannot be before start time", ErrInvalidInput)
+	}
+	bucketSecs := int64(bucket / time.Second)
+	if bucketSecs <= 0 {
+		return nil, fmt.Errorf("%w: bucket must be at least one second", ErrInvalidInput)
+	}
+
+	collectedAt := time.Now()
+	startUnix, endUnix := start.Unix(), end.Unix()
+	series := make([]Metrics, (endUnix-startUnix+bucketSecs-1)/bucketSecs)
+	for i := range series {
+		series[i] = Metrics{
+			CollectedAt: collectedAt,
+			PeriodStart: time.Unix(startUnix+int64(i)*bucketSecs, 0).In(start.Location()),
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			(CAST(strftime('%s', processed_at) AS INTEGER) - ?) / ? AS bucket,
+			COUNT(*)
+		FROM processed_emails
+		WHERE CAST(strftime('%s', processed_at) AS INTEGER) >= ?
+		AND CAST(strftime('%s', processed_at) AS INTEGER) < ?
+		GROUP BY bucket
+	`, startUnix, bucketSecs, startUnix, endUnix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get processed emails series: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index, count int64
+		if err := rows.Scan(&index, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan processed emails series: %w", err)
+		}
+		series[index].ProcessedEmails = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get processed emails series: %w", err)
+	}
+
+	return series, nil
+}
+
 // GetUserMetrics retrieves metrics for a specific user
 func (s *SQLiteStorage) GetUserMetrics(ctx context.Context, telegramID int64) (*UserMetrics, error) {
 	if telegramID <= 0 {
@@ -124,33 +201,27 @@ func (s *SQLiteStorage) GetUserMetrics(ctx context.Context, telegramID int64) (*
 	}
 
 	// Get user information
-	var digestIntervalSecs int64
-	err := s.db.QueryRowContext(ctx, `
-		SELECT 
-			gmail_user_id,
-			google_token_valid,
-			digest_interval,
-			updated_at
-		FROM users
-		WHERE telegram_id = ?
-	`, telegramID).Scan(
+	var lastDigestSent sql.NullTime
+	err := s.db.QueryRowContext(ctx, userMetricsQuery, telegramID).Scan(
 		&metrics.GmailUserID,
 		&metrics.HasValidToken,
-		&digestIntervalSecs,
+		&lastDigestSent,
 		&metrics.LastActive,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user information: %w", err)
 	}
 
-	metrics.DigestInterval = time.Duration(digestIntervalSecs) * time.Second
+	if lastDigestSent.Valid {
+		metrics.TimeSinceLastDigest = time.Since(lastDigestSent.Time)
+	}
 
-	// Get processed emails count
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*)
-		FROM processed_emails
-		WHERE user_id = ?
-	`, metrics.GmailUserID).Scan(&metrics.ProcessedEmails)
+	// Get processed emails counts
+	err = s.db.QueryRowContext(ctx, userEmailVolumeQuery, metrics.GmailUserID).Scan(
+		&metrics.ProcessedEmails,
+		&metrics.EmailsLast24h,
+		&metrics.EmailsLast7d,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get processed emails count: %w", err)
 	}
@@ -194,7 +265,7 @@ func (t *Transaction) GetMetrics() (*Metrics, error) {
 	err = t.tx.QueryRow(`
 		SELECT COUNT(*)
 		FROM tokens t
-		JOIN users u ON t.user_id = u.gmail_user_id
+		JOIN users u ON t.user_id = u.id
 		WHERE u.google_token_valid = TRUE
 	`).Scan(&metrics.ValidTokens)
 	if err != nil {
@@ -219,33 +290,27 @@ func (t *Transaction) GetUserMetrics(telegramID int64) (*UserMetrics, error) {
 	}
 
 	// Get user information
-	var digestIntervalSecs int64
-	err := t.tx.QueryRow(`
-		SELECT 
-			gmail_user_id,
-			google_token_valid,
-			digest_interval,
-			updated_at
-		FROM users
-		WHERE telegram_id = ?
-	`, telegramID).Scan(
+	var lastDigestSent sql.NullTime
+	err := t.tx.QueryRow(userMetricsQuery, telegramID).Scan(
 		&metrics.GmailUserID,
 		&metrics.HasValidToken,
-		&digestIntervalSecs,
+		&lastDigestSent,
 		&metrics.LastActive,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user information: %w", err)
 	}
 
-	metrics.DigestInterval = time.Duration(digestIntervalSecs) * time.Second
+	if lastDigestSent.Valid {
+		metrics.TimeSinceLastDigest = time.Since(lastDigestSent.Time)
+	}
 
-	// Get processed emails count
-	err = t.tx.QueryRow(`
-		SELECT COUNT(*)
-		FROM processed_emails
-		WHERE user_id = ?
-	`, metrics.GmailUserID).Scan(&metrics.ProcessedEmails)
+	// Get processed emails counts
+	err = t.tx.QueryRow(userEmailVolumeQuery, metrics.GmailUserID).Scan(
+		&metrics.ProcessedEmails,
+		&metrics.EmailsLast24h,
+		&metrics.EmailsLast7d,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get processed emails count: %w", err)
 	}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"testing"
 	"time"
 
@@ -39,14 +40,17 @@ func TestSQLiteStorage_GetMetrics(t *testing.T) {
 		if u.tokenValid {
 			err = storage.StoreToken(ctx, u.gmailUserID, []byte("token"), []byte("nonce"))
 			require.NoError(t, err)
+		} else {
+			err = storage.SetTokenValid(ctx, u.gmailUserID, false)
+			require.NoError(t, err)
 		}
 	}
 
 	// Mark some emails as processed
 	for i := 0; i < 5; i++ {
-		err = storage.MarkEmailProcessed(ctx, "msg1", users[0].gmailUserID)
+		err = storage.MarkEmailProcessed(ctx, fmt.Sprintf("msg%d", i), users[0].gmailUserID)
 		require.NoError(t, err)
-		err = storage.MarkEmailProcessed(ctx, "msg2", users[2].gmailUserID)
+		err = storage.MarkEmailProcessed(ctx, fmt.Sprintf("msg%d", i), users[2].gmailUserID)
 		require.NoError(t, err)
 	}
 
@@ -84,7 +88,7 @@ func TestSQLiteStorage_GetUserMetrics(t *testing.T) {
 
 	// Mark some emails as processed
 	for i := 0; i < 3; i++ {
-		err = storage.MarkEmailProcessed(ctx, "msg1", gmailUserID)
+		err = storage.MarkEmailProcessed(ctx, fmt.Sprintf("msg%d", i), gmailUserID)
 		require.NoError(t, err)
 	}
 
@@ -100,6 +104,59 @@ func TestSQLiteStorage_GetUserMetrics(t *testing.T) {
 	assert.NotZero(t, metrics.LastActive)
 }
 
+func TestSQLiteStorage_GetUserMetrics_EmailVolume(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = db.Exec(`INSERT INTO users (id, email, telegram_user_id) VALUES ('user1', 'user1@example.com', 42)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO users (id, email, telegram_user_id) VALUES ('user2', 'user2@example.com', 43)`)
+	require.NoError(t, err)
+
+	// No digest has been sent yet
+	metrics, err := storage.GetUserMetrics(ctx, 42)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", metrics.GmailUserID)
+	assert.Zero(t, metrics.ProcessedEmails)
+	assert.Zero(t, metrics.TimeSinceLastDigest)
+
+	now := time.Now()
+	processed := map[string]time.Time{
+		"recent":      now.Add(-time.Hour),
+		"yesterday":   now.Add(-23 * time.Hour),
+		"two-days":    now.Add(-48 * time.Hour),
+		"six-days":    now.Add(-6 * 24 * time.Hour),
+		"last-month":  now.Add(-30 * 24 * time.Hour),
+		"older-month": now.Add(-60 * 24 * time.Hour),
+	}
+	for id, at := range processed {
+		_, err = db.Exec(`INSERT INTO processed_emails (message_id, user_id, processed_at) VALUES (?, 'user1', ?)`, id, at)
+		require.NoError(t, err)
+	}
+	// Timestamps written by CURRENT_TIMESTAMP count the same way
+	_, err = db.Exec(`INSERT INTO processed_emails (message_id, user_id, processed_at) VALUES ('text', 'user1', datetime('now', '-3 days'))`)
+	require.NoError(t, err)
+	// Another user's emails are not counted
+	_, err = db.Exec(`INSERT INTO processed_emails (message_id, user_id) VALUES ('other', 'user2')`)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.UpdateLastDigestSent(ctx, "user1", now.Add(-90*time.Minute)))
+
+	metrics, err = storage.GetUserMetrics(ctx, 42)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), metrics.ProcessedEmails)
+	assert.Equal(t, int64(2), metrics.EmailsLast24h)
+	assert.Equal(t, int64(5), metrics.EmailsLast7d)
+	assert.GreaterOrEqual(t, metrics.TimeSinceLastDigest, 90*time.Minute)
+	assert.Less(t, metrics.TimeSinceLastDigest, 2*time.Hour)
+}
+
 func TestSQLiteStorage_GetUserMetrics_NonExistentUser(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
@@ -133,16 +190,15 @@ func TestSQLiteStorage_GetMetricsWithinTimeRange(t *testing.T) {
 
 	// Mark some emails as processed
 	for i := 0; i < 5; i++ {
-		err = storage.MarkEmailProcessed(ctx, "msg1", gmailUserID)
+		err = storage.MarkEmailProcessed(ctx, fmt.Sprintf("msg%d", i), gmailUserID)
 		require.NoError(t, err)
 	}
 
 	// Update some timestamps to be older
 	_, err = db.Exec(`
-		UPDATE processed_emails 
+		UPDATE processed_emails
 		SET processed_at = datetime('now', '-2 days')
-		WHERE message_id = 'msg1'
-		LIMIT 2
+		WHERE message_id IN ('msg0', 'msg1')
 	`)
 	require.NoError(t, err)
 
@@ -196,4 +252,58 @@ func TestSQLiteStorage_GetMetricsInTransaction(t *testing.T) {
 
 	// Should see the committed changes
 	assert.Equal(t, int64(1), metrics.ProcessedEmails)
-} 
\ No newline at end of file
+} 
+func TestSQLiteStorage_GetMetricsSeries(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = db.Exec(`INSERT INTO users (id, email) VALUES ('user1', 'user1@example.com')`)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	processed := []time.Time{
+		start.Add(10 * time.Minute),
+		start.Add(2*time.Hour + 30*time.Minute),
+		start.Add(2*time.Hour + 31*time.Minute),
+		start.Add(3*time.Hour + 59*time.Minute),
+		// Outside the range
+		start.Add(-time.Minute),
+		start.Add(4 * time.Hour),
+	}
+	for i, at := range processed {
+		_, err = db.Exec(`INSERT INTO processed_emails (message_id, user_id, processed_at) VALUES (?, 'user1', ?)`,
+			fmt.Sprintf("msg%d", i), at)
+		require.NoError(t, err)
+	}
+	// Timestamps written by CURRENT_TIMESTAMP have no fractional seconds or zone
+	_, err = db.Exec(`INSERT INTO processed_emails (message_id, user_id, processed_at) VALUES ('text', 'user1', '2024-03-01 00:30:00')`)
+	require.NoError(t, err)
+
+	series, err := storage.GetMetricsSeries(ctx, start, start.Add(4*time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, series, 4)
+
+	var counts []int64
+	for i, bucket := range series {
+		assert.True(t, start.Add(time.Duration(i)*time.Hour).Equal(bucket.PeriodStart))
+		counts = append(counts, bucket.ProcessedEmails)
+	}
+	assert.Equal(t, []int64{2, 0, 2, 1}, counts)
+
+	// A partial last bucket still gets its own entry
+	series, err = storage.GetMetricsSeries(ctx, start, start.Add(90*time.Minute), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	assert.Equal(t, int64(2), series[0].ProcessedEmails)
+
+	_, err = storage.GetMetricsSeries(ctx, start, start.Add(-time.Hour), time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = storage.GetMetricsSeries(ctx, start, start.Add(time.Hour), 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
@@ -2,13 +2,13 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"sync"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
@@ -91,26 +91,28 @@ var migrations = []Migration{
 	},
 }
 
-// Migrate applies all pending database migrations
-func (s *SQLiteStorage) Migrate() error {
-	sourceInstance, err := iofs.New(migrationsFS, "migrations")
-	if err != nil {
-		return fmt.Errorf("failed to create migration source: %w", err)
+// withMigrator runs fn with a golang-migrate instance over the embedded migrations
+func (s *SQLiteStorage) withMigrator(ctx context.Context, fn func(m *migrate.Migrate) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	// Re-open a connection for the migration tool, as the driver needs it.
-	db, err := sql.Open("sqlite3", s.path)
+	migrationLock.Lock()
+	defer migrationLock.Unlock()
+
+	sourceInstance, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
-		return fmt.Errorf("failed to open db for migration: %w", err)
+		return fmt.Errorf("failed to create migration source: %w", err)
 	}
-	defer db.Close()
 
-	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	// The migrate instance is deliberately never closed, as closing the
+	// sqlite3 driver would close the storage's own connection pool.
+	driver, err := sqlite3.WithInstance(s.db, &sqlite3.Config{})
 	if err != nil {
 		return fmt.Errorf("failed to create migration driver: %w", err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
+	m, err := migrate.NewWithInstance(
 		"iofs",
 		sourceInstance,
 		"sqlite3", // The name of the database driver
@@ -120,12 +122,100 @@ func (s *SQLiteStorage) Migrate() error {
 		return fmt.Errorf("failed to create migrate instance: %w", err)
 	}
 
-	err = m.Up()
-	if err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("failed to apply migrations: %w", err)
+	return fn(m)
+}
+
+// latestMigrationVersion returns the newest version among the embedded migrations
+func latestMigrationVersion() (int64, error) {
+	source, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create migration source: %w", err)
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return int64(version), nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		version = next
+	}
+}
+
+// Migrate applies all pending database migrations
+func (s *SQLiteStorage) Migrate(ctx context.Context) error {
+	return s.withMigrator(ctx, func(m *migrate.Migrate) error {
+		err := m.Up()
+		if err != nil && err != migrate.ErrNoChange {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls the schema back to targetVersion by applying down migrations.
+// A targetVersion of 0 reverts every migration.
+func (s *SQLiteStorage) MigrateDown(ctx context.Context, targetVersion int64) error {
+	if targetVersion < 0 {
+		return fmt.Errorf("%w: target version must not be negative", ErrInvalidInput)
 	}
 
-	return nil
+	return s.withMigrator(ctx, func(m *migrate.Migrate) error {
+		current, dirty, err := m.Version()
+		if err == migrate.ErrNilVersion {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read migration version: %w", err)
+		}
+		if dirty {
+			return fmt.Errorf("database is dirty at version %d; fix it manually before rolling back", current)
+		}
+		if uint(targetVersion) > current {
+			return fmt.Errorf("%w: target version %d is newer than current version %d", ErrInvalidInput, targetVersion, current)
+		}
+
+		if targetVersion == 0 {
+			err = m.Down()
+		} else {
+			err = m.Migrate(uint(targetVersion))
+		}
+		if err != nil && err != migrate.ErrNoChange {
+			return fmt.Errorf("failed to roll back migrations: %w", err)
+		}
+		return nil
+	})
+}
+
+// CurrentVersion returns the applied migration version and whether the last
+// migration failed part way (dirty). The version is 0 if nothing is applied.
+func (s *SQLiteStorage) CurrentVersion(ctx context.Context) (int64, bool, error) {
+	var (
+		version uint
+		dirty   bool
+	)
+	err := s.withMigrator(ctx, func(m *migrate.Migrate) error {
+		var err error
+		version, dirty, err = m.Version()
+		if err == migrate.ErrNilVersion {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read migration version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return int64(version), dirty, nil
 }
 
 // GetMigrationStatus returns the current migration status
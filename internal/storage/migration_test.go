@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -90,7 +91,7 @@ func TestSQLiteStorage_TableSchema(t *testing.T) {
 	assert.Equal(t, telegramID, user.TelegramID)
 	assert.Equal(t, gmailUserID, user.GmailUserID)
 	assert.Equal(t, digestInterval, user.DigestInterval)
-	assert.False(t, user.TokenValid)
+	assert.True(t, user.TokenValid, "new users start with a valid token")
 	assert.NotZero(t, user.CreatedAt)
 	assert.NotZero(t, user.UpdatedAt)
 
@@ -175,4 +176,57 @@ func TestSQLiteStorage_MigrationTimeout(t *testing.T) {
 	// Migration should fail due to timeout
 	err = storage.Migrate(ctx)
 	assert.Error(t, err)
-} 
\ No newline at end of file
+} 
+func TestSQLiteStorage_MigrateDown(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+
+	ctx := context.Background()
+
+	version, dirty, err := storage.CurrentVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+	assert.False(t, dirty)
+
+	require.NoError(t, storage.Migrate(ctx))
+	latest, dirty, err := storage.CurrentVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), latest)
+	assert.False(t, dirty)
+
+	// Roll back a single migration
+	require.NoError(t, storage.MigrateDown(ctx, latest-1))
+	version, _, err = storage.CurrentVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest-1, version)
+
+	assert.ErrorIs(t, storage.MigrateDown(ctx, latest), ErrInvalidInput)
+	assert.ErrorIs(t, storage.MigrateDown(ctx, -1), ErrInvalidInput)
+
+	// Rolling everything back leaves only golang-migrate's version table
+	require.NoError(t, storage.MigrateDown(ctx, 0))
+	version, _, err = storage.CurrentVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	var objects []string
+	rows, err := storage.db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE tbl_name != 'schema_migrations' AND name NOT LIKE 'sqlite_%'`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		objects = append(objects, name)
+	}
+	require.NoError(t, rows.Err())
+	assert.Empty(t, objects)
+
+	// And the schema can be rebuilt afterwards
+	require.NoError(t, storage.Migrate(ctx))
+	version, _, err = storage.CurrentVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+}
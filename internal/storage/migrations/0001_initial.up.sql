@@ -1,4 +1,3 @@
--- +migrate Up
 CREATE TABLE users (
     id TEXT PRIMARY KEY,
     email TEXT UNIQUE NOT NULL,
@@ -14,7 +13,3 @@ CREATE TABLE tokens (
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
-
--- +migrate Down
-DROP TABLE tokens;
-DROP TABLE users; 
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX idx_users_telegram_user_id;
+ALTER TABLE users DROP COLUMN telegram_chat_id;
+ALTER TABLE users DROP COLUMN telegram_user_id;
@@ -0,0 +1,4 @@
+-- SQLite cannot add a UNIQUE column, so uniqueness is enforced by an index
+ALTER TABLE users ADD COLUMN telegram_user_id INTEGER;
+ALTER TABLE users ADD COLUMN telegram_chat_id INTEGER;
+CREATE UNIQUE INDEX idx_users_telegram_user_id ON users(telegram_user_id);
@@ -0,0 +1,4 @@
+DROP INDEX idx_pkce_verifier_created_at;
+DROP INDEX idx_oauth_state_created_at;
+DROP TABLE pkce_verifier;
+DROP TABLE oauth_state;
@@ -0,0 +1,14 @@
+CREATE TABLE oauth_state (
+    user_id TEXT PRIMARY KEY,
+    state TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE pkce_verifier (
+    state TEXT PRIMARY KEY,
+    verifier TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_state_created_at ON oauth_state(created_at);
+CREATE INDEX idx_pkce_verifier_created_at ON pkce_verifier(created_at);
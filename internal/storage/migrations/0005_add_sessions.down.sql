@@ -0,0 +1,2 @@
+DROP INDEX idx_sessions_expires_at;
+DROP TABLE sessions;
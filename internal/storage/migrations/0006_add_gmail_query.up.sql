@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN gmail_query TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE tokens DROP COLUMN last_refresh_error;
+ALTER TABLE tokens DROP COLUMN refresh_failures;
+ALTER TABLE tokens DROP COLUMN last_refreshed_at;
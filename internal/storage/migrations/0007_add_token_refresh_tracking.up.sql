@@ -0,0 +1,3 @@
+ALTER TABLE tokens ADD COLUMN last_refreshed_at TIMESTAMP;
+ALTER TABLE tokens ADD COLUMN refresh_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tokens ADD COLUMN last_refresh_error TEXT NOT NULL DEFAULT '';
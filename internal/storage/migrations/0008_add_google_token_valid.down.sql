@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN google_token_valid;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN google_token_valid BOOLEAN NOT NULL DEFAULT TRUE;
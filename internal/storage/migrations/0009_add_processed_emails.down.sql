@@ -0,0 +1,3 @@
+DROP INDEX idx_processed_emails_processed_at;
+DROP INDEX idx_processed_emails_user_id;
+DROP TABLE processed_emails;
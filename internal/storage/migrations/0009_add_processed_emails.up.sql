@@ -0,0 +1,9 @@
+CREATE TABLE processed_emails (
+    message_id TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX idx_processed_emails_user_id ON processed_emails(user_id);
+CREATE INDEX idx_processed_emails_processed_at ON processed_emails(processed_at);
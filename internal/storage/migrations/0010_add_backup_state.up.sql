@@ -0,0 +1,4 @@
+CREATE TABLE backup_state (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    last_backup_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN delivery_channel TEXT NOT NULL DEFAULT 'telegram';
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN digest_format TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Seconds between a user's digests; new users get one an hour
+ALTER TABLE users ADD COLUMN digest_interval INTEGER NOT NULL DEFAULT 3600;
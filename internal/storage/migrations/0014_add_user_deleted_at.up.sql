@@ -0,0 +1,2 @@
+-- Set when a user stops their digests; such users are skipped until they sign in again
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
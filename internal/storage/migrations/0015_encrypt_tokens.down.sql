@@ -0,0 +1,12 @@
+DROP TABLE tokens;
+CREATE TABLE tokens (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT NOT NULL,
+    expiry TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_refreshed_at TIMESTAMP,
+    refresh_failures INTEGER NOT NULL DEFAULT 0,
+    last_refresh_error TEXT NOT NULL DEFAULT ''
+);
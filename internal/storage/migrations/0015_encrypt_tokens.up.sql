@@ -0,0 +1,13 @@
+-- Tokens are stored encrypted by the TokenStore. Plaintext tokens cannot be
+-- encrypted here, so they are dropped and their users sign in again.
+DROP TABLE tokens;
+CREATE TABLE tokens (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    encrypted_token BLOB NOT NULL,
+    nonce BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_refreshed_at TIMESTAMP,
+    refresh_failures INTEGER NOT NULL DEFAULT 0,
+    last_refresh_error TEXT NOT NULL DEFAULT ''
+);
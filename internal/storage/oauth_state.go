@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StoreOAuthState stores or replaces the pending OAuth state for a user
+func (s *SQLiteStorage) StoreOAuthState(ctx context.Context, userID, state string) error {
+	if userID == "" || state == "" {
+		return fmt.Errorf("%w: user ID and state cannot be empty", ErrInvalidInput)
+	}
+
+	query := `INSERT OR REPLACE INTO oauth_state (user_id, state) VALUES (?, ?)`
+	if _, err := s.db.ExecContext(ctx, query, userID, state); err != nil {
+		return fmt.Errorf("failed to store oauth state: %w", err)
+	}
+	return nil
+}
+
+// GetOAuthState retrieves the pending OAuth state for a user and when it was created
+func (s *SQLiteStorage) GetOAuthState(ctx context.Context, userID string) (string, time.Time, error) {
+	var state string
+	var createdAt time.Time
+	err := s.db.QueryRowContext(ctx,
+		"SELECT state, created_at FROM oauth_state WHERE user_id = ?",
+		userID).Scan(&state, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", time.Time{}, fmt.Errorf("%w: oauth state not found for user %s", ErrNotFound, userID)
+		}
+		return "", time.Time{}, fmt.Errorf("failed to get oauth state: %w", err)
+	}
+	return state, createdAt, nil
+}
+
+// DeleteOAuthState removes the pending OAuth state for a user
+func (s *SQLiteStorage) DeleteOAuthState(ctx context.Context, userID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM oauth_state WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete oauth state: %w", err)
+	}
+	return nil
+}
+
+// StorePKCEVerifier stores or replaces the PKCE code verifier for an OAuth state
+func (s *SQLiteStorage) StorePKCEVerifier(ctx context.Context, state, verifier string) error {
+	if state == "" || verifier == "" {
+		return fmt.Errorf("%w: state and verifier cannot be empty", ErrInvalidInput)
+	}
+
+	query := `INSERT OR REPLACE INTO pkce_verifier (state, verifier) VALUES (?, ?)`
+	if _, err := s.db.ExecContext(ctx, query, state, verifier); err != nil {
+		return fmt.Errorf("failed to store pkce verifier: %w", err)
+	}
+	return nil
+}
+
+// GetPKCEVerifier retrieves the PKCE code verifier for an OAuth state and when it was created
+func (s *SQLiteStorage) GetPKCEVerifier(ctx context.Context, state string) (string, time.Time, error) {
+	var verifier string
+	var createdAt time.Time
+	err := s.db.QueryRowContext(ctx,
+		"SELECT verifier, created_at FROM pkce_verifier WHERE state = ?",
+		state).Scan(&verifier, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", time.Time{}, fmt.Errorf("%w: pkce verifier not found for state %s", ErrNotFound, state)
+		}
+		return "", time.Time{}, fmt.Errorf("failed to get pkce verifier: %w", err)
+	}
+	return verifier, createdAt, nil
+}
+
+// DeletePKCEVerifier removes the PKCE code verifier for an OAuth state
+func (s *SQLiteStorage) DeletePKCEVerifier(ctx context.Context, state string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM pkce_verifier WHERE state = ?`, state); err != nil {
+		return fmt.Errorf("failed to delete pkce verifier: %w", err)
+	}
+	return nil
+}
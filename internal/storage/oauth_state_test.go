@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStorage_OAuthState(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, _, err = storage.GetOAuthState(ctx, "user1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, storage.StoreOAuthState(ctx, "user1", "state-1"))
+	require.NoError(t, storage.StoreOAuthState(ctx, "user1", "state-2"))
+
+	state, createdAt, err := storage.GetOAuthState(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "state-2", state)
+	assert.WithinDuration(t, time.Now(), createdAt, time.Minute)
+
+	require.NoError(t, storage.DeleteOAuthState(ctx, "user1"))
+	_, _, err = storage.GetOAuthState(ctx, "user1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ErrorIs(t, storage.StoreOAuthState(ctx, "", "state"), ErrInvalidInput)
+}
+
+func TestSQLiteStorage_PKCEVerifier(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	require.NoError(t, storage.StorePKCEVerifier(ctx, "state-1", "verifier-1"))
+	verifier, _, err := storage.GetPKCEVerifier(ctx, "state-1")
+	require.NoError(t, err)
+	assert.Equal(t, "verifier-1", verifier)
+
+	require.NoError(t, storage.DeletePKCEVerifier(ctx, "state-1"))
+	_, _, err = storage.GetPKCEVerifier(ctx, "state-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSQLiteStorage_CleanupExpiredOAuthState(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	require.NoError(t, storage.StoreOAuthState(ctx, "old-user", "old-state"))
+	require.NoError(t, storage.StoreOAuthState(ctx, "new-user", "new-state"))
+	require.NoError(t, storage.StorePKCEVerifier(ctx, "old-state", "old-verifier"))
+	require.NoError(t, storage.StorePKCEVerifier(ctx, "new-state", "new-verifier"))
+
+	// Age the old entries past the ttl
+	_, err = db.Exec(`UPDATE oauth_state SET created_at = datetime('now', '-1 hour') WHERE user_id = 'old-user'`)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE pkce_verifier SET created_at = datetime('now', '-1 hour') WHERE state = 'old-state'`)
+	require.NoError(t, err)
+
+	deleted, err := storage.CleanupExpiredOAuthState(ctx, 10*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	_, _, err = storage.GetOAuthState(ctx, "old-user")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = storage.GetOAuthState(ctx, "new-user")
+	assert.NoError(t, err)
+	_, _, err = storage.GetPKCEVerifier(ctx, "old-state")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = storage.GetPKCEVerifier(ctx, "new-state")
+	assert.NoError(t, err)
+
+	_, err = storage.CleanupExpiredOAuthState(ctx, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -66,19 +67,29 @@ func (c Config) Validate() error {
 	return nil
 }
 
+// buildDSN appends the busy timeout and other pragmas to the database path,
+// preserving any query parameters already present. The driver applies them
+// each time it opens a connection, so every connection in the pool enforces
+// foreign keys (SQLite leaves them off by default) and uses the write-ahead log.
+func buildDSN(cfg Config) string {
+	separator := "?"
+	if strings.Contains(cfg.Path, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s_busy_timeout=%d&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=on",
+		cfg.Path,
+		separator,
+		int(cfg.BusyTimeout.Milliseconds()))
+}
+
 // OpenDatabase opens a SQLite database with the given configuration
 func OpenDatabase(cfg Config) (*SQLiteStorage, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	// Build DSN with busy timeout and other pragmas
-	dsn := fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=WAL&_synchronous=NORMAL",
-		cfg.Path,
-		int(cfg.BusyTimeout.Milliseconds()))
-
 	// Open database connection
-	db, err := sql.Open("sqlite3", dsn)
+	db, err := sql.Open("sqlite3", buildDSN(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -112,4 +123,9 @@ func OpenDatabase(cfg Config) (*SQLiteStorage, error) {
 // Close closes the database connection
 func (s *SQLiteStorage) Close() error {
 	return s.db.Close()
-} 
\ No newline at end of file
+} 
+// DB returns the underlying database handle, for packages such as the
+// scheduler that keep their own tables in the same database
+func (s *SQLiteStorage) DB() *sql.DB {
+	return s.db
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -86,12 +87,12 @@ func TestOpenDatabase_CustomConfig(t *testing.T) {
 	errs := make(chan error, 3)
 
 	// Start 3 goroutines to test connection pool limits
-	for i := 0; i < 3; i++ {
+	for i := 1; i <= 3; i++ {
 		go func(id int64) {
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 			defer cancel()
 
-			err := storage.CreateUser(ctx, id, "test@example.com", time.Hour)
+			err := storage.CreateUser(ctx, id, fmt.Sprintf("user%d@example.com", id), time.Hour)
 			if err != nil {
 				errs <- err
 				return
@@ -148,4 +149,86 @@ func TestOpenDatabase_Reconnect(t *testing.T) {
 	user, err := storage2.GetUser(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "test@example.com", user.GmailUserID)
-} 
\ No newline at end of file
+} 
+func TestOpenDatabase_AppliesPoolConfig(t *testing.T) {
+	cfg := Config{
+		Path:            filepath.Join(t.TempDir(), "test.db"),
+		MaxOpenConns:    3,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Minute,
+		ConnMaxIdleTime: 30 * time.Second,
+		BusyTimeout:     2 * time.Second,
+	}
+
+	storage, err := OpenDatabase(cfg)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	assert.Equal(t, 3, storage.db.Stats().MaxOpenConnections)
+
+	var busyTimeout int
+	require.NoError(t, storage.db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.Equal(t, 2000, busyTimeout)
+}
+
+func TestOpenDatabase_ConnectionPragmas(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Path = filepath.Join(t.TempDir(), "test.db")
+	storage, err := OpenDatabase(cfg)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	// Hold several connections at once so each is a separate pooled connection
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		conn, err := storage.db.Conn(ctx)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var foreignKeys, synchronous int
+		var journalMode string
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys))
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode))
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA synchronous").Scan(&synchronous))
+		assert.Equal(t, 1, foreignKeys, "connection %d", i)
+		assert.Equal(t, "wal", journalMode, "connection %d", i)
+		assert.Equal(t, 1, synchronous, "connection %d: synchronous should be NORMAL", i)
+	}
+}
+
+func TestOpenDatabase_CascadeDelete(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Path = filepath.Join(t.TempDir(), "test.db")
+	storage, err := OpenDatabase(cfg)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	ctx := context.Background()
+	_, err = storage.db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES ('user1', 'user1@example.com')`)
+	require.NoError(t, err)
+	_, err = storage.db.ExecContext(ctx,
+		`INSERT INTO tokens (user_id, encrypted_token, nonce) VALUES ('user1', 'token', 'nonce')`)
+	require.NoError(t, err)
+	require.NoError(t, storage.MarkEmailProcessed(ctx, "msg1", "user1"))
+
+	// Child rows must belong to an existing user
+	assert.Error(t, storage.MarkEmailProcessed(ctx, "msg1", "missing"))
+
+	_, err = storage.db.ExecContext(ctx, `DELETE FROM users WHERE id = 'user1'`)
+	require.NoError(t, err)
+
+	var tokens, processed int
+	require.NoError(t, storage.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tokens`).Scan(&tokens))
+	require.NoError(t, storage.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM processed_emails`).Scan(&processed))
+	assert.Zero(t, tokens)
+	assert.Zero(t, processed)
+}
+
+func TestBuildDSN(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Path = "test.db"
+	assert.Equal(t, "test.db?_busy_timeout=5000&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=on", buildDSN(cfg))
+
+	cfg.Path = "file:test.db?cache=shared"
+	assert.Equal(t, "file:test.db?cache=shared&_busy_timeout=5000&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=on", buildDSN(cfg))
+}
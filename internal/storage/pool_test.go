@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"testing"
 	"time"
 
@@ -32,10 +33,10 @@ func TestSQLiteStorage_ConnectionPool(t *testing.T) {
 	errs := make(chan error, 10)
 
 	// Start 10 goroutines to test concurrent access
-	for i := 0; i < 10; i++ {
+	for i := 1; i <= 10; i++ {
 		go func(id int64) {
 			// Create user
-			err := storage.CreateUser(ctx, id, "test@example.com", time.Hour)
+			err := storage.CreateUser(ctx, id, fmt.Sprintf("user%d@example.com", id), time.Hour)
 			if err != nil {
 				errs <- err
 				return
@@ -72,7 +73,7 @@ func TestSQLiteStorage_ConnectionPool(t *testing.T) {
 	}
 
 	// Verify all users were created
-	for i := 0; i < 10; i++ {
+	for i := 1; i <= 10; i++ {
 		user, err := storage.GetUser(ctx, int64(i))
 		require.NoError(t, err)
 		assert.Equal(t, time.Hour*2, user.DigestInterval)
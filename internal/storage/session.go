@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CreateSession stores a login session for a user that is valid until expiresAt
+func (s *SQLiteStorage) CreateSession(ctx context.Context, id, userID string, expiresAt time.Time) error {
+	if id == "" || userID == "" {
+		return fmt.Errorf("%w: session ID and user ID cannot be empty", ErrInvalidInput)
+	}
+
+	query := `INSERT INTO sessions (id, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)`
+	if _, err := s.db.ExecContext(ctx, query, id, userID, expiresAt.UTC(), time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves the user ID of a session, when it was created and when
+// it expires. Expired sessions are returned as well; enforcing expiry is up to
+// the caller.
+func (s *SQLiteStorage) GetSession(ctx context.Context, id string) (string, time.Time, time.Time, error) {
+	var userID string
+	var createdAt, expiresAt time.Time
+	err := s.db.QueryRowContext(ctx,
+		"SELECT user_id, created_at, expires_at FROM sessions WHERE id = ?",
+		id).Scan(&userID, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("%w: session %s", ErrNotFound, id)
+		}
+		return "", time.Time{}, time.Time{}, fmt.Errorf("failed to get session: %w", err)
+	}
+	return userID, createdAt, expiresAt, nil
+}
+
+// ExtendSession moves the expiry of a session
+func (s *SQLiteStorage) ExtendSession(ctx context.Context, id string, expiresAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE sessions SET expires_at = ? WHERE id = ?`, expiresAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: session %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// DeleteSession removes a session
+func (s *SQLiteStorage) DeleteSession(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// CleanupExpiredSessions removes sessions whose expiry has passed
+func (s *SQLiteStorage) CleanupExpiredSessions(ctx context.Context) (int64, error) {
+	// julianday compares the stored times regardless of their UTC offset
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE julianday(expires_at) <= julianday(?)`,
+		time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to cleanup sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStorage_Sessions(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, _, _, err = storage.GetSession(ctx, "session-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, storage.CreateSession(ctx, "session-1", "user1", expiresAt))
+	assert.Error(t, storage.CreateSession(ctx, "session-1", "user2", expiresAt), "session IDs are unique")
+
+	userID, createdAt, gotExpiry, err := storage.GetSession(ctx, "session-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", userID)
+	assert.WithinDuration(t, time.Now(), createdAt, time.Minute)
+	assert.WithinDuration(t, expiresAt, gotExpiry, time.Millisecond)
+
+	extended := expiresAt.Add(time.Hour)
+	require.NoError(t, storage.ExtendSession(ctx, "session-1", extended))
+	_, _, gotExpiry, err = storage.GetSession(ctx, "session-1")
+	require.NoError(t, err)
+	assert.WithinDuration(t, extended, gotExpiry, time.Millisecond)
+
+	require.NoError(t, storage.DeleteSession(ctx, "session-1"))
+	_, _, _, err = storage.GetSession(ctx, "session-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ErrorIs(t, storage.ExtendSession(ctx, "session-1", extended), ErrNotFound)
+	assert.ErrorIs(t, storage.CreateSession(ctx, "", "user1", expiresAt), ErrInvalidInput)
+}
+
+func TestSQLiteStorage_CleanupExpiredSessions(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	require.NoError(t, storage.CreateSession(ctx, "expired", "user1", time.Now().Add(-time.Minute)))
+	require.NoError(t, storage.CreateSession(ctx, "active", "user1", time.Now().Add(time.Hour)))
+
+	deleted, err := storage.CleanupExpiredSessions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	_, _, _, err = storage.GetSession(ctx, "expired")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, _, err = storage.GetSession(ctx, "active")
+	assert.NoError(t, err)
+}
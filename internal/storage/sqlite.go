@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"gmaildigest-go/internal/digest"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -15,33 +18,15 @@ var (
 	ErrNotFound     = errors.New("not found")
 )
 
-// User represents a user in the system
-type User struct {
-	TelegramID     int64
-	GmailUserID    string
-	DigestInterval time.Duration
-	LastDigestSent *time.Time
-	TokenValid     bool
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-}
-
 // SQLiteStorage handles all database operations
 type SQLiteStorage struct {
-	db   *sql.DB
-	path string
+	db *sql.DB
 }
 
-// NewSQLiteStorage creates a new SQLiteStorage instance
-func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
-	db, err := sql.Open("sqlite3", path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
-	}
-	return &SQLiteStorage{db: db, path: path}, nil
+// NewSQLiteStorage creates a new SQLiteStorage instance over an open database handle.
+// Use OpenDatabase to open a database file with connection pool settings applied.
+func NewSQLiteStorage(db *sql.DB) *SQLiteStorage {
+	return &SQLiteStorage{db: db}
 }
 
 // validateInput checks if the input parameters are valid
@@ -120,7 +105,8 @@ func (s *SQLiteStorage) GetToken(ctx context.Context, userID string) ([]byte, []
 	return token, nonce, nil
 }
 
-// CreateUser creates a new user
+// CreateUser creates a user linked to a Telegram user. The Gmail user ID is
+// used as both the user's ID and email, as sign-in does.
 func (s *SQLiteStorage) CreateUser(ctx context.Context, telegramID int64, gmailUserID string, digestInterval time.Duration) error {
 	if err := validateInput(telegramID, gmailUserID, digestInterval); err != nil {
 		return err
@@ -128,10 +114,26 @@ func (s *SQLiteStorage) CreateUser(ctx context.Context, telegramID int64, gmailU
 
 	query := `
 		INSERT INTO users (
-			telegram_id, gmail_user_id, digest_interval
-		) VALUES (?, ?, ?)
+			id, email, telegram_user_id, digest_interval
+		) VALUES (?, ?, ?, ?)
 	`
-	_, err := s.db.ExecContext(ctx, query, telegramID, gmailUserID, int64(digestInterval.Seconds()))
+	_, err := s.db.ExecContext(ctx, query, gmailUserID, gmailUserID, telegramID, int64(digestInterval.Seconds()))
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// EnsureUser creates the user with the given ID and email. A user with that
+// ID who already exists is left as it is, except that one who was soft
+// deleted is restored.
+func (s *SQLiteStorage) EnsureUser(ctx context.Context, id, email string) error {
+	if id == "" || email == "" {
+		return fmt.Errorf("%w: user ID and email cannot be empty", ErrInvalidInput)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (id, email) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET deleted_at = NULL WHERE users.deleted_at IS NOT NULL`, id, email)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -144,38 +146,14 @@ func (s *SQLiteStorage) GetUser(ctx context.Context, telegramID int64) (*User, e
 		return nil, fmt.Errorf("%w: telegram ID must be positive", ErrInvalidInput)
 	}
 
-	user := &User{}
-	var digestIntervalSecs int64
-	var lastDigestSent sql.NullTime
-
-	err := s.db.QueryRowContext(ctx, `
-		SELECT 
-			telegram_id, gmail_user_id, digest_interval,
-			last_digest_sent, google_token_valid,
-			created_at, updated_at
-		FROM users 
-		WHERE telegram_id = ?`,
-		telegramID).Scan(
-		&user.TelegramID,
-		&user.GmailUserID,
-		&digestIntervalSecs,
-		&lastDigestSent,
-		&user.TokenValid,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE telegram_user_id = ?`, telegramID)
+	user, err := scanLegacyUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("%w: user not found with ID %d", ErrNotFound, telegramID)
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-
-	user.DigestInterval = time.Duration(digestIntervalSecs) * time.Second
-	if lastDigestSent.Valid {
-		user.LastDigestSent = &lastDigestSent.Time
-	}
-
 	return user, nil
 }
 
@@ -191,7 +169,7 @@ func (s *SQLiteStorage) UpdateUser(ctx context.Context, telegramID int64, digest
 	query := `
 		UPDATE users 
 		SET digest_interval = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE telegram_id = ?
+		WHERE telegram_user_id = ?
 	`
 	result, err := s.db.ExecContext(ctx, query, int64(digestInterval.Seconds()), telegramID)
 	if err != nil {
@@ -227,6 +205,23 @@ func (s *SQLiteStorage) MarkEmailProcessed(ctx context.Context, messageID, userI
 	return nil
 }
 
+// MarkEmailsProcessed marks a batch of emails as processed for a user in a
+// single transaction. Emails already marked are left as they are.
+func (s *SQLiteStorage) MarkEmailsProcessed(ctx context.Context, userID string, messageIDs []string) error {
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	if err := tx.MarkEmailsProcessed(userID, messageIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit processed emails: %w", err)
+	}
+	return nil
+}
+
 // IsEmailProcessed checks if an email has been processed
 func (s *SQLiteStorage) IsEmailProcessed(ctx context.Context, messageID, userID string) (bool, error) {
 	if err := validateEmailInput(messageID, userID); err != nil {
@@ -246,7 +241,63 @@ func (s *SQLiteStorage) IsEmailProcessed(ctx context.Context, messageID, userID
 	return exists, nil
 }
 
+// FilterUnprocessed returns the message IDs, in their original order, that
+// have not been processed for the user. All IDs are checked in one query.
+func (s *SQLiteStorage) FilterUnprocessed(ctx context.Context, userID string, messageIDs []string) ([]string, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: user ID cannot be empty", ErrInvalidInput)
+	}
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, 0, len(messageIDs)+1)
+	args = append(args, userID)
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(messageIDs)), ", ")
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT message_id FROM processed_emails
+		WHERE user_id = ? AND message_id IN (`+placeholders+`)`,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check processed emails: %w", err)
+	}
+	defer rows.Close()
+
+	processed := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan processed email: %w", err)
+		}
+		processed[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check processed emails: %w", err)
+	}
+
+	var unprocessed []string
+	for _, id := range messageIDs {
+		if !processed[id] {
+			unprocessed = append(unprocessed, id)
+		}
+	}
+	return unprocessed, nil
+}
+
+// UpdateUserTelegramDetails links a user, keyed by users.id, to the Telegram
+// user and chat their digests are sent to
 func (s *SQLiteStorage) UpdateUserTelegramDetails(ctx context.Context, userID string, telegramUserID, telegramChatID int64) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidInput)
+	}
+	if telegramUserID <= 0 {
+		return fmt.Errorf("%w: telegram user ID must be positive", ErrInvalidInput)
+	}
+
 	query := `UPDATE users SET telegram_user_id = ?, telegram_chat_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
 	result, err := s.db.ExecContext(ctx, query, telegramUserID, telegramChatID, userID)
 	if err != nil {
@@ -264,25 +315,314 @@ func (s *SQLiteStorage) UpdateUserTelegramDetails(ctx context.Context, userID st
 	return nil
 }
 
-func (s *SQLiteStorage) GetUserByID(ctx context.Context, id string) (*User, error) {
-	query := `SELECT id, email, telegram_user_id, telegram_chat_id, created_at, updated_at FROM users WHERE id = ?`
-	row := s.db.QueryRowContext(ctx, query, id)
+// UpdateLastDigestSent records when the last digest was sent to a user
+func (s *SQLiteStorage) UpdateLastDigestSent(ctx context.Context, userID string, sentAt time.Time) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidInput)
+	}
+
+	query := `UPDATE users SET last_digest_sent = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	result, err := s.db.ExecContext(ctx, query, sentAt.UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last digest sent: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MaxGmailQueryLength is the longest Gmail search query a user may save
+const MaxGmailQueryLength = 500
+
+// UpdateGmailQuery sets the Gmail search query used for a user's digests.
+// An empty query restores the default of unread emails.
+func (s *SQLiteStorage) UpdateGmailQuery(ctx context.Context, userID, query string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidInput)
+	}
+	if len(query) > MaxGmailQueryLength {
+		return fmt.Errorf("%w: gmail query is longer than %d characters", ErrInvalidInput, MaxGmailQueryLength)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE users SET gmail_query = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update gmail query: %w", err)
+	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateDigestInterval sets how often a user's digests are sent
+func (s *SQLiteStorage) UpdateDigestInterval(ctx context.Context, userID string, interval time.Duration) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidInput)
+	}
+	if interval < time.Second {
+		return fmt.Errorf("%w: digest interval must be at least a second", ErrInvalidInput)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE users SET digest_interval = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, int64(interval.Seconds()), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update digest interval: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Digest delivery channels a user can choose
+const (
+	DeliveryChannelTelegram = "telegram"
+	DeliveryChannelEmail    = "email"
+)
+
+// UpdateDeliveryChannel sets how a user's digests are delivered
+func (s *SQLiteStorage) UpdateDeliveryChannel(ctx context.Context, userID, channel string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidInput)
+	}
+	switch channel {
+	case DeliveryChannelTelegram, DeliveryChannelEmail:
+	default:
+		return fmt.Errorf("%w: unknown delivery channel %q", ErrInvalidInput, channel)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE users SET delivery_channel = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, channel, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery channel: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateDigestFormat sets the format a user's digests are rendered in, one
+// of the digest.DigestFormat values. An empty format sends the summary as written.
+func (s *SQLiteStorage) UpdateDigestFormat(ctx context.Context, userID, format string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidInput)
+	}
+	if format != "" {
+		if _, err := digest.ParseFormat(format); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE users SET digest_format = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, format, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update digest format: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// userColumns are the users columns read by scanUser
+const userColumns = `users.id, users.email, users.telegram_user_id, users.telegram_chat_id, users.digest_interval, users.last_digest_sent, users.gmail_query, users.delivery_channel, users.digest_format, users.google_token_valid, users.created_at, users.updated_at, users.deleted_at`
+
+// scanUser scans a row of userColumns into a User
+func scanUser(row interface{ Scan(dest ...any) error }) (*User, error) {
 	var u User
+	var digestIntervalSecs int64
+	var lastDigestSent, deletedAt sql.NullTime
 	err := row.Scan(
 		&u.ID,
 		&u.Email,
 		&u.TelegramUserID,
 		&u.TelegramChatID,
+		&digestIntervalSecs,
+		&lastDigestSent,
+		&u.GmailQuery,
+		&u.DeliveryChannel,
+		&u.DigestFormat,
+		&u.TokenValid,
 		&u.CreatedAt,
 		&u.UpdatedAt,
+		&deletedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	u.DigestInterval = time.Duration(digestIntervalSecs) * time.Second
+	if lastDigestSent.Valid {
+		u.LastDigestSent = &lastDigestSent.Time
+	}
+	if deletedAt.Valid {
+		u.DeletedAt = &deletedAt.Time
+	}
+	return &u, nil
+}
+
+// scanLegacyUser scans a row of userColumns into a User and fills in the
+// TelegramID and GmailUserID fields read by the Telegram ID based API
+func scanLegacyUser(row interface{ Scan(dest ...any) error }) (*User, error) {
+	u, err := scanUser(row)
+	if err != nil {
+		return nil, err
+	}
+	u.TelegramID = u.TelegramUserID.Int64
+	u.GmailUserID = u.ID
+	return u, nil
+}
+
+func (s *SQLiteStorage) GetUserByID(ctx context.Context, id string) (*User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	u, err := scanUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to scan user: %w", err)
 	}
+	return u, nil
+}
 
-	return &u, nil
+// GetUserByTelegramID returns the user linked to a Telegram user. A soft
+// deleted user is not found.
+func (s *SQLiteStorage) GetUserByTelegramID(ctx context.Context, telegramUserID int64) (*User, error) {
+	if telegramUserID <= 0 {
+		return nil, fmt.Errorf("%w: telegram user ID must be positive", ErrInvalidInput)
+	}
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE telegram_user_id = ? AND deleted_at IS NULL`, telegramUserID)
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to scan user: %w", err)
+	}
+	return u, nil
+}
+
+// SoftDeleteUser marks a user as deleted, keeping their data. They no longer
+// get digests or token refreshes until EnsureUser restores them when they
+// sign in again.
+func (s *SQLiteStorage) SoftDeleteUser(ctx context.Context, userID string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidInput)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE users SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListUsersWithValidTokens returns up to limit users, not soft deleted, with
+// a stored, valid token whose ID sorts after afterID, in ID order. Pass the
+// last ID of one page as afterID to get the next; an empty afterID starts at
+// the first user.
+func (s *SQLiteStorage) ListUsersWithValidTokens(ctx context.Context, afterID string, limit int) ([]*User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		JOIN tokens ON tokens.user_id = users.id
+		WHERE users.google_token_valid AND users.deleted_at IS NULL AND users.id > ?
+		ORDER BY users.id
+		LIMIT ?`,
+		afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users with valid tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users with valid tokens: %w", err)
+	}
+	return users, nil
+}
+
+// ListUsersDueForDigest returns the users, not soft deleted, with a valid
+// token whose digest is due at now: those never sent a digest and those whose
+// last digest was sent at least their digest interval ago.
+func (s *SQLiteStorage) ListUsersDueForDigest(ctx context.Context, now time.Time) ([]*User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		JOIN tokens ON tokens.user_id = users.id
+		WHERE users.google_token_valid
+		AND users.deleted_at IS NULL
+		AND (
+			users.last_digest_sent IS NULL
+			OR CAST(strftime('%s', users.last_digest_sent) AS INTEGER) + users.digest_interval <= ?
+		)
+		ORDER BY users.id`,
+		now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users due for digest: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users due for digest: %w", err)
+	}
+	return users, nil
 } 
\ No newline at end of file
@@ -3,13 +3,68 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// countingConnector opens SQLite connections that count the queries and
+// statements run through them
+type countingConnector struct {
+	driver  sqlite3.SQLiteDriver
+	dsn     string
+	queries atomic.Int32
+	execs   atomic.Int32
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, counter: c}, nil
+}
+
+func (c *countingConnector) Driver() driver.Driver {
+	return &c.driver
+}
+
+type countingConn struct {
+	driver.Conn
+	counter *countingConnector
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.counter.queries.Add(1)
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.counter.execs.Add(1)
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+// newCountingStorage returns a migrated in-memory storage whose queries and
+// statements are counted by the returned connector
+func newCountingStorage(t *testing.T) (*SQLiteStorage, *countingConnector) {
+	t.Helper()
+	connector := &countingConnector{dsn: ":memory:"}
+	db := sql.OpenDB(connector)
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	storage := NewSQLiteStorage(db)
+	require.NoError(t, storage.Migrate(context.Background()))
+	return storage, connector
+}
+
 func TestSQLiteStorage_Migrate(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
@@ -128,9 +183,9 @@ func TestSQLiteStorage_CreateUser(t *testing.T) {
 	var storedGmailUserID string
 	var storedDigestInterval int64
 	err = db.QueryRow(`
-		SELECT gmail_user_id, digest_interval 
-		FROM users 
-		WHERE telegram_id = ?`, telegramID).
+		SELECT id, digest_interval
+		FROM users
+		WHERE telegram_user_id = ?`, telegramID).
 		Scan(&storedGmailUserID, &storedDigestInterval)
 	require.NoError(t, err)
 	assert.Equal(t, gmailUserID, storedGmailUserID)
@@ -253,4 +308,292 @@ func TestSQLiteStorage_IsEmailProcessed(t *testing.T) {
 	processed, err = storage.IsEmailProcessed(ctx, messageID, userID)
 	require.NoError(t, err)
 	assert.True(t, processed)
-} 
\ No newline at end of file
+} 
+
+func TestSQLiteStorage_FilterUnprocessed(t *testing.T) {
+	storage, counter := newCountingStorage(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"user1", "user2"} {
+		_, err := storage.db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, id, id+"@example.com")
+		require.NoError(t, err)
+	}
+	require.NoError(t, storage.MarkEmailProcessed(ctx, "m1", "user1"))
+	require.NoError(t, storage.MarkEmailProcessed(ctx, "m3", "user1"))
+	require.NoError(t, storage.MarkEmailProcessed(ctx, "m2", "user2"))
+
+	counter.queries.Store(0)
+	unprocessed, err := storage.FilterUnprocessed(ctx, "user1", []string{"m1", "m2", "m3", "m4"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m2", "m4"}, unprocessed)
+	assert.Equal(t, int32(1), counter.queries.Load(), "all IDs are checked in a single query")
+
+	unprocessed, err = storage.FilterUnprocessed(ctx, "user1", nil)
+	require.NoError(t, err)
+	assert.Empty(t, unprocessed)
+
+	_, err = storage.FilterUnprocessed(ctx, "", []string{"m1"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSQLiteStorage_MarkEmailsProcessed(t *testing.T) {
+	storage, counter := newCountingStorage(t)
+	ctx := context.Background()
+
+	_, err := storage.db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
+	require.NoError(t, err)
+	require.NoError(t, storage.MarkEmailProcessed(ctx, "m0", "user1"))
+
+	// The batch repeats m0, already processed, and m1
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("m%d", i)
+	}
+	ids = append(ids, "m1")
+
+	counter.execs.Store(0)
+	require.NoError(t, storage.MarkEmailsProcessed(ctx, "user1", ids))
+	assert.Equal(t, int32(1), counter.execs.Load(), "all rows are inserted by a single statement")
+
+	var count int
+	require.NoError(t, storage.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM processed_emails WHERE user_id = ?`, "user1").Scan(&count))
+	assert.Equal(t, 100, count)
+	unprocessed, err := storage.FilterUnprocessed(ctx, "user1", ids)
+	require.NoError(t, err)
+	assert.Empty(t, unprocessed)
+
+	assert.NoError(t, storage.MarkEmailsProcessed(ctx, "user1", nil))
+	assert.ErrorIs(t, storage.MarkEmailsProcessed(ctx, "", ids), ErrInvalidInput)
+	assert.ErrorIs(t, storage.MarkEmailsProcessed(ctx, "user1", []string{"m200", ""}), ErrInvalidInput)
+}
+
+func TestSQLiteStorage_ListUsersDueForDigest(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sentAt := func(ago time.Duration) *time.Time {
+		t := now.Add(-ago)
+		return &t
+	}
+	users := []struct {
+		id         string
+		interval   time.Duration
+		lastSent   *time.Time
+		token      bool
+		tokenValid bool
+	}{
+		{"never-sent", time.Hour, nil, true, true},
+		{"elapsed", 2 * time.Hour, sentAt(3 * time.Hour), true, true},
+		{"exactly-elapsed", time.Hour, sentAt(time.Hour), true, true},
+		{"not-elapsed", 4 * time.Hour, sentAt(3 * time.Hour), true, true},
+		{"no-token", time.Hour, nil, false, true},
+		{"revoked-token", time.Hour, nil, true, false},
+	}
+	for _, u := range users {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO users (id, email, digest_interval, google_token_valid) VALUES (?, ?, ?, ?)`,
+			u.id, u.id+"@example.com", int64(u.interval.Seconds()), u.tokenValid)
+		require.NoError(t, err)
+		if u.lastSent != nil {
+			require.NoError(t, storage.UpdateLastDigestSent(ctx, u.id, *u.lastSent))
+		}
+		if u.token {
+			require.NoError(t, storage.StoreToken(ctx, u.id, []byte("token"), []byte("nonce")))
+		}
+	}
+
+	due, err := storage.ListUsersDueForDigest(ctx, now)
+	require.NoError(t, err)
+	var ids []string
+	for _, u := range due {
+		ids = append(ids, u.ID)
+	}
+	assert.Equal(t, []string{"elapsed", "exactly-elapsed", "never-sent"}, ids)
+	assert.Equal(t, 2*time.Hour, due[0].DigestInterval)
+
+	// New users get the default interval
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "new", "new@example.com")
+	require.NoError(t, err)
+	user, err := storage.GetUserByID(ctx, "new")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, user.DigestInterval)
+}
+
+func TestSQLiteStorage_EnsureUser(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+
+	require.NoError(t, storage.EnsureUser(ctx, "user@example.com", "user@example.com"))
+	require.NoError(t, storage.UpdateGmailQuery(ctx, "user@example.com", "label:news"))
+
+	// An existing user is left as it is
+	require.NoError(t, storage.EnsureUser(ctx, "user@example.com", "user@example.com"))
+	user, err := storage.GetUserByID(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", user.Email)
+	assert.Equal(t, "label:news", user.GmailQuery)
+
+	assert.ErrorIs(t, storage.EnsureUser(ctx, "", "user@example.com"), ErrInvalidInput)
+}
+
+func TestSQLiteStorage_ListUsersWithValidTokens(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+
+	users := []struct {
+		id         string
+		token      bool
+		tokenValid bool
+	}{
+		{"a", true, true},
+		{"b", false, true},
+		{"c", true, false},
+		{"d", true, true},
+		{"e", true, true},
+	}
+	for _, u := range users {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO users (id, email, google_token_valid) VALUES (?, ?, ?)`,
+			u.id, u.id+"@example.com", u.tokenValid)
+		require.NoError(t, err)
+		if u.token {
+			require.NoError(t, storage.StoreToken(ctx, u.id, []byte("token"), []byte("nonce")))
+		}
+	}
+
+	ids := func(users []*User) []string {
+		var ids []string
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+
+	// Pages pick up after the last ID of the previous one
+	page, err := storage.ListUsersWithValidTokens(ctx, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "d"}, ids(page))
+
+	page, err = storage.ListUsersWithValidTokens(ctx, "d", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e"}, ids(page))
+
+	page, err = storage.ListUsersWithValidTokens(ctx, "e", 2)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+}
+
+func TestSQLiteStorage_UpdateDigestInterval(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, storage.UpdateDigestInterval(ctx, "user1", 30*time.Minute))
+	user, err := storage.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, user.DigestInterval)
+
+	assert.ErrorIs(t, storage.UpdateDigestInterval(ctx, "missing", time.Hour), ErrNotFound)
+	assert.ErrorIs(t, storage.UpdateDigestInterval(ctx, "", time.Hour), ErrInvalidInput)
+	assert.ErrorIs(t, storage.UpdateDigestInterval(ctx, "user1", 0), ErrInvalidInput)
+}
+
+func TestSQLiteStorage_UpdateUserTelegramDetails(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+
+	require.NoError(t, storage.EnsureUser(ctx, "user@example.com", "user@example.com"))
+	user, err := storage.GetUserByID(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.False(t, user.TelegramUserID.Valid)
+	assert.False(t, user.TelegramChatID.Valid)
+
+	require.NoError(t, storage.UpdateUserTelegramDetails(ctx, "user@example.com", 42, 4242))
+	user, err = storage.GetUserByID(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, sql.NullInt64{Int64: 42, Valid: true}, user.TelegramUserID)
+	assert.Equal(t, sql.NullInt64{Int64: 4242, Valid: true}, user.TelegramChatID)
+
+	assert.ErrorIs(t, storage.UpdateUserTelegramDetails(ctx, "missing@example.com", 43, 43), ErrNotFound)
+	assert.ErrorIs(t, storage.UpdateUserTelegramDetails(ctx, "", 42, 4242), ErrInvalidInput)
+	assert.ErrorIs(t, storage.UpdateUserTelegramDetails(ctx, "user@example.com", 0, 4242), ErrInvalidInput)
+}
+
+func TestSQLiteStorage_SoftDeleteUser(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+
+	require.NoError(t, storage.EnsureUser(ctx, "user@example.com", "user@example.com"))
+	require.NoError(t, storage.UpdateUserTelegramDetails(ctx, "user@example.com", 42, 4242))
+	require.NoError(t, storage.StoreToken(ctx, "user@example.com", []byte("token"), []byte("nonce")))
+
+	user, err := storage.GetUserByTelegramID(ctx, 42)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", user.ID)
+	assert.Nil(t, user.DeletedAt)
+
+	require.NoError(t, storage.SoftDeleteUser(ctx, "user@example.com"))
+	assert.ErrorIs(t, storage.SoftDeleteUser(ctx, "user@example.com"), ErrNotFound)
+
+	// The user is kept but no longer found by Telegram ID or listed
+	user, err = storage.GetUserByID(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.NotNil(t, user.DeletedAt)
+	_, err = storage.GetUserByTelegramID(ctx, 42)
+	assert.ErrorIs(t, err, ErrNotFound)
+	users, err := storage.ListUsersWithValidTokens(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+	users, err = storage.ListUsersDueForDigest(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	// Signing in again restores them
+	require.NoError(t, storage.EnsureUser(ctx, "user@example.com", "user@example.com"))
+	user, err = storage.GetUserByTelegramID(ctx, 42)
+	require.NoError(t, err)
+	assert.Nil(t, user.DeletedAt)
+
+	assert.ErrorIs(t, storage.SoftDeleteUser(ctx, ""), ErrInvalidInput)
+	_, err = storage.GetUserByTelegramID(ctx, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 )
 
 // Storage defines the interface for low-level database operations
@@ -10,7 +11,11 @@ type Storage interface {
 	GetToken(ctx context.Context, userID string) ([]byte, []byte, error)
 	StoreToken(ctx context.Context, userID string, token, nonce []byte) error
 	DeleteToken(ctx context.Context, userID string) error
-	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserByID(ctx context.Context, id string) (*User, error)
+	GetUserByTelegramID(ctx context.Context, telegramUserID int64) (*User, error)
+	GetUserMetrics(ctx context.Context, telegramID int64) (*UserMetrics, error)
+	SoftDeleteUser(ctx context.Context, userID string) error
 	UpdateUserTelegramDetails(ctx context.Context, userID string, telegramUserID, telegramChatID int64) error
+	UpdateGmailQuery(ctx context.Context, userID, query string) error
+	UpdateDigestInterval(ctx context.Context, userID string, interval time.Duration) error
 } 
\ No newline at end of file
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TokenRefreshStatus describes the refresh history of a user's token
+type TokenRefreshStatus struct {
+	UserID           string
+	Email            string
+	LastRefreshedAt  *time.Time
+	RefreshFailures  int
+	LastRefreshError string
+}
+
+// RecordTokenRefresh marks a user's token as refreshed at the given time
+// and resets its failure count.
+func (s *SQLiteStorage) RecordTokenRefresh(ctx context.Context, userID string, refreshedAt time.Time) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID cannot be empty", ErrInvalidInput)
+	}
+
+	return s.updateTokenRefresh(ctx, `
+		UPDATE tokens
+		SET last_refreshed_at = ?, refresh_failures = 0, last_refresh_error = '', updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ?
+	`, refreshedAt.UTC(), userID)
+}
+
+// RecordTokenRefreshFailure counts a failed refresh of a user's token and
+// keeps its error message.
+func (s *SQLiteStorage) RecordTokenRefreshFailure(ctx context.Context, userID, message string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID cannot be empty", ErrInvalidInput)
+	}
+
+	return s.updateTokenRefresh(ctx, `
+		UPDATE tokens
+		SET refresh_failures = refresh_failures + 1, last_refresh_error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ?
+	`, message, userID)
+}
+
+func (s *SQLiteStorage) updateTokenRefresh(ctx context.Context, query string, args ...interface{}) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to record token refresh: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetTokenValid marks whether a user's Google grant can still be used, such
+// as after Google rejects its refresh token.
+func (s *SQLiteStorage) SetTokenValid(ctx context.Context, userID string, valid bool) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID cannot be empty", ErrInvalidInput)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE users SET google_token_valid = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, valid, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update token validity: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListUsersWithFailingTokens returns the users whose token refresh has failed
+// at least minFailures times in a row, most failures first. These accounts
+// usually need to grant consent again.
+func (s *SQLiteStorage) ListUsersWithFailingTokens(ctx context.Context, minFailures int) ([]TokenRefreshStatus, error) {
+	if minFailures < 1 {
+		return nil, fmt.Errorf("%w: minimum failures must be at least 1", ErrInvalidInput)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.user_id, COALESCE(u.email, ''), t.last_refreshed_at, t.refresh_failures, t.last_refresh_error
+		FROM tokens t
+		LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.refresh_failures >= ?
+		ORDER BY t.refresh_failures DESC, t.user_id
+	`, minFailures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failing tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var statuses []TokenRefreshStatus
+	for rows.Next() {
+		var status TokenRefreshStatus
+		var lastRefreshed sql.NullTime
+		if err := rows.Scan(&status.UserID, &status.Email, &lastRefreshed, &status.RefreshFailures, &status.LastRefreshError); err != nil {
+			return nil, fmt.Errorf("failed to scan token refresh status: %w", err)
+		}
+		if lastRefreshed.Valid {
+			status.LastRefreshedAt = &lastRefreshed.Time
+		}
+		statuses = append(statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list failing tokens: %w", err)
+	}
+	return statuses, nil
+}
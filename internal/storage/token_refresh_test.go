@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStorage_TokenRefreshTracking(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for _, id := range []string{"user1", "user2"} {
+		_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, id, id+"@example.com")
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO tokens (user_id, encrypted_token, nonce) VALUES (?, 'token', 'nonce')`, id)
+		require.NoError(t, err)
+	}
+
+	// Each failed refresh increments the counter
+	require.NoError(t, storage.RecordTokenRefreshFailure(ctx, "user1", "oauth2: invalid_grant"))
+	require.NoError(t, storage.RecordTokenRefreshFailure(ctx, "user1", "oauth2: invalid_grant"))
+	require.NoError(t, storage.RecordTokenRefreshFailure(ctx, "user2", "connection refused"))
+
+	failing, err := storage.ListUsersWithFailingTokens(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, failing, 2)
+	assert.Equal(t, "user1", failing[0].UserID)
+	assert.Equal(t, "user1@example.com", failing[0].Email)
+	assert.Equal(t, 2, failing[0].RefreshFailures)
+	assert.Equal(t, "oauth2: invalid_grant", failing[0].LastRefreshError)
+	assert.Nil(t, failing[0].LastRefreshedAt)
+
+	failing, err = storage.ListUsersWithFailingTokens(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, failing, 1)
+	assert.Equal(t, "user1", failing[0].UserID)
+
+	// A successful refresh resets the counter
+	refreshedAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	require.NoError(t, storage.RecordTokenRefresh(ctx, "user1", refreshedAt))
+
+	failing, err = storage.ListUsersWithFailingTokens(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, failing, 1)
+	assert.Equal(t, "user2", failing[0].UserID)
+
+	var failures int
+	var lastError string
+	var lastRefreshed time.Time
+	err = db.QueryRowContext(ctx,
+		`SELECT refresh_failures, last_refresh_error, last_refreshed_at FROM tokens WHERE user_id = ?`, "user1").
+		Scan(&failures, &lastError, &lastRefreshed)
+	require.NoError(t, err)
+	assert.Zero(t, failures)
+	assert.Empty(t, lastError)
+	assert.True(t, refreshedAt.Equal(lastRefreshed))
+
+	assert.ErrorIs(t, storage.RecordTokenRefresh(ctx, "missing", refreshedAt), ErrNotFound)
+	assert.ErrorIs(t, storage.RecordTokenRefreshFailure(ctx, "", "boom"), ErrInvalidInput)
+	_, err = storage.ListUsersWithFailingTokens(ctx, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSQLiteStorage_SetTokenValid(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storage := NewSQLiteStorage(db)
+	err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
+	require.NoError(t, err)
+
+	// New users start with a usable grant
+	user, err := storage.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.True(t, user.TokenValid)
+
+	require.NoError(t, storage.SetTokenValid(ctx, "user1", false))
+	user, err = storage.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.False(t, user.TokenValid)
+
+	assert.ErrorIs(t, storage.SetTokenValid(ctx, "missing", false), ErrNotFound)
+	assert.ErrorIs(t, storage.SetTokenValid(ctx, "", false), ErrInvalidInput)
+}
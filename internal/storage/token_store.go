@@ -2,26 +2,27 @@ package storage
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+
 	"golang.org/x/oauth2"
-	"io"
 )
 
 // TokenStore handles the logic for storing and retrieving OAuth2 tokens,
-// including encryption and decryption.
+// including encryption and decryption. It adapts the encrypted byte storage
+// to the token interfaces of the auth and scheduler packages.
 type TokenStore struct {
-	db          Storage
+	db            Storage
 	encryptionKey []byte
 }
 
-// NewTokenStore creates a new TokenStore.
-func NewTokenStore(db Storage, key []byte) *TokenStore {
-	return &TokenStore{db: db, encryptionKey: key}
+// NewTokenStore creates a new TokenStore. The key must be 32 bytes (AES-256).
+func NewTokenStore(db Storage, key []byte) (*TokenStore, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKeySize
+	}
+	return &TokenStore{db: db, encryptionKey: key}, nil
 }
 
 // GetToken retrieves a decrypted oauth2.Token for a user.
@@ -31,17 +32,7 @@ func (ts *TokenStore) GetToken(ctx context.Context, userID string) (*oauth2.Toke
 		return nil, fmt.Errorf("failed to get encrypted token from db: %w", err)
 	}
 
-	block, err := aes.NewCipher(ts.encryptionKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gcm: %w", err)
-	}
-
-	decryptedData, err := aesgcm.Open(nil, nonce, encryptedToken, nil)
+	decryptedData, err := DecryptToken(ts.encryptionKey, encryptedToken, nonce)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt token: %w", err)
 	}
@@ -55,6 +46,7 @@ func (ts *TokenStore) GetToken(ctx context.Context, userID string) (*oauth2.Toke
 }
 
 // StoreToken encrypts and stores an oauth2.Token for a user.
+// A fresh nonce is generated for every write.
 func (ts *TokenStore) StoreToken(ctx context.Context, userID string, token *oauth2.Token) error {
 	if token == nil {
 		return errors.New("token cannot be nil")
@@ -65,27 +57,15 @@ func (ts *TokenStore) StoreToken(ctx context.Context, userID string, token *oaut
 		return fmt.Errorf("failed to marshal token: %w", err)
 	}
 
-	block, err := aes.NewCipher(ts.encryptionKey)
+	encryptedToken, nonce, err := EncryptToken(ts.encryptionKey, tokenBytes)
 	if err != nil {
-		return fmt.Errorf("failed to create cipher: %w", err)
+		return fmt.Errorf("failed to encrypt token: %w", err)
 	}
 
-	nonce := make([]byte, 12)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return fmt.Errorf("failed to create gcm: %w", err)
-	}
-
-	encryptedToken := aesgcm.Seal(nil, nonce, tokenBytes, nil)
-
 	return ts.db.StoreToken(ctx, userID, encryptedToken, nonce)
 }
 
 // DeleteToken removes a token for a user.
 func (ts *TokenStore) DeleteToken(ctx context.Context, userID string) error {
 	return ts.db.DeleteToken(ctx, userID)
-} 
\ No newline at end of file
+}
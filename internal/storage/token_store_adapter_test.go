@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"gmaildigest-go/internal/auth"
+	"gmaildigest-go/internal/scheduler"
+	"gmaildigest-go/internal/storage"
+)
+
+// TokenStore is the adapter both packages expect for token persistence
+var (
+	_ auth.Storage      = (*storage.TokenStore)(nil)
+	_ scheduler.Storage = (*storage.TokenStore)(nil)
+)
+
+// encryptedTokenDB keeps encrypted tokens in memory
+type encryptedTokenDB struct {
+	storage.Storage
+	tokens map[string][2][]byte
+}
+
+func (d *encryptedTokenDB) StoreToken(ctx context.Context, userID string, token, nonce []byte) error {
+	d.tokens[userID] = [2][]byte{token, nonce}
+	return nil
+}
+
+func (d *encryptedTokenDB) GetToken(ctx context.Context, userID string) ([]byte, []byte, error) {
+	stored, ok := d.tokens[userID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: token not found for user %s", storage.ErrNotFound, userID)
+	}
+	return stored[0], stored[1], nil
+}
+
+func (d *encryptedTokenDB) DeleteToken(ctx context.Context, userID string) error {
+	delete(d.tokens, userID)
+	return nil
+}
+
+func newAdapterTokenStore(t *testing.T) *storage.TokenStore {
+	db := &encryptedTokenDB{tokens: make(map[string][2][]byte)}
+	store, err := storage.NewTokenStore(db, []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	return store
+}
+
+func TestTokenStore_AuthStorage(t *testing.T) {
+	var store auth.Storage = newAdapterTokenStore(t)
+	ctx := context.Background()
+
+	token := &oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token"}
+	require.NoError(t, store.StoreToken(ctx, "user1", token))
+
+	got, err := store.GetToken(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", got.AccessToken)
+	assert.Equal(t, "refresh-token", got.RefreshToken)
+
+	require.NoError(t, store.DeleteToken(ctx, "user1"))
+	_, err = store.GetToken(ctx, "user1")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestTokenStore_SchedulerStorage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"access_token": "new-access-token", "refresh_token": "new-refresh-token", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	store := newAdapterTokenStore(t)
+	ctx := context.Background()
+	expired := &oauth2.Token{
+		AccessToken:  "old-access-token",
+		RefreshToken: "old-refresh-token",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	require.NoError(t, store.StoreToken(ctx, "user1", expired))
+
+	service := &scheduler.TokenRefreshService{
+		Storage: store,
+		Config:  &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: server.URL}},
+	}
+	service.SetClient(server.Client())
+
+	payload, err := json.Marshal(scheduler.TokenRefreshPayload{UserID: "user1"})
+	require.NoError(t, err)
+	job := &scheduler.Job{ID: "job1", Type: "token_refresh", UserID: "user1", Payload: payload}
+	require.NoError(t, service.HandleTokenRefresh(ctx, job))
+
+	// The refreshed token was encrypted on the way in and decoded on the way out
+	got, err := store.GetToken(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "new-access-token", got.AccessToken)
+	assert.Equal(t, "new-refresh-token", got.RefreshToken)
+	assert.True(t, got.Valid())
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+var testTokenKey = []byte("0123456789abcdef0123456789abcdef")
+
+// memoryTokenDB is an in-memory Storage that records encrypted tokens and nonces
+type memoryTokenDB struct {
+	Storage
+	tokens map[string][]byte
+	nonces map[string][]byte
+}
+
+func newMemoryTokenDB() *memoryTokenDB {
+	return &memoryTokenDB{
+		tokens: make(map[string][]byte),
+		nonces: make(map[string][]byte),
+	}
+}
+
+func (m *memoryTokenDB) StoreToken(ctx context.Context, userID string, token, nonce []byte) error {
+	m.tokens[userID] = token
+	m.nonces[userID] = nonce
+	return nil
+}
+
+func (m *memoryTokenDB) GetToken(ctx context.Context, userID string) ([]byte, []byte, error) {
+	token, ok := m.tokens[userID]
+	if !ok {
+		return nil, nil, errors.New("token not found")
+	}
+	return token, m.nonces[userID], nil
+}
+
+func (m *memoryTokenDB) DeleteToken(ctx context.Context, userID string) error {
+	delete(m.tokens, userID)
+	delete(m.nonces, userID)
+	return nil
+}
+
+func TestNewTokenStore_InvalidKey(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("too-short"), append(testTokenKey, 'x')} {
+		_, err := NewTokenStore(newMemoryTokenDB(), key)
+		assert.ErrorIs(t, err, ErrInvalidKeySize)
+	}
+}
+
+func TestTokenStore_RoundTrip(t *testing.T) {
+	db := newMemoryTokenDB()
+	store, err := NewTokenStore(db, testTokenKey)
+	require.NoError(t, err)
+
+	token := &oauth2.Token{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+		TokenType:    "Bearer",
+		Expiry:       time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, store.StoreToken(context.Background(), "user1", token))
+
+	// The persisted bytes must not contain the plaintext token
+	assert.NotContains(t, string(db.tokens["user1"]), "access-token")
+	assert.Len(t, db.nonces["user1"], NonceSize)
+
+	got, err := store.GetToken(context.Background(), "user1")
+	require.NoError(t, err)
+	assert.Equal(t, token.AccessToken, got.AccessToken)
+	assert.Equal(t, token.RefreshToken, got.RefreshToken)
+	assert.Equal(t, token.TokenType, got.TokenType)
+	assert.True(t, token.Expiry.Equal(got.Expiry))
+}
+
+func TestTokenStore_FreshNoncePerWrite(t *testing.T) {
+	db := newMemoryTokenDB()
+	store, err := NewTokenStore(db, testTokenKey)
+	require.NoError(t, err)
+
+	token := &oauth2.Token{AccessToken: "access-token"}
+	require.NoError(t, store.StoreToken(context.Background(), "user1", token))
+	firstNonce, firstCiphertext := db.nonces["user1"], db.tokens["user1"]
+
+	require.NoError(t, store.StoreToken(context.Background(), "user1", token))
+	assert.NotEqual(t, firstNonce, db.nonces["user1"])
+	assert.NotEqual(t, firstCiphertext, db.tokens["user1"])
+}
+
+func TestTokenStore_TamperedCiphertext(t *testing.T) {
+	db := newMemoryTokenDB()
+	store, err := NewTokenStore(db, testTokenKey)
+	require.NoError(t, err)
+
+	require.NoError(t, store.StoreToken(context.Background(), "user1", &oauth2.Token{AccessToken: "access-token"}))
+
+	db.tokens["user1"][0] ^= 0xff
+	_, err = store.GetToken(context.Background(), "user1")
+	assert.Error(t, err)
+}
+
+func TestTokenStore_WrongKey(t *testing.T) {
+	db := newMemoryTokenDB()
+	store, err := NewTokenStore(db, testTokenKey)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreToken(context.Background(), "user1", &oauth2.Token{AccessToken: "access-token"}))
+
+	other, err := NewTokenStore(db, []byte("fedcba9876543210fedcba9876543210"))
+	require.NoError(t, err)
+	_, err = other.GetToken(context.Background(), "user1")
+	assert.Error(t, err)
+}
+
+// TestTokenStore_OnMigratedDatabase signs a user in the way the OAuth
+// callback does, on a database file built by the migrations alone
+func TestTokenStore_OnMigratedDatabase(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Path = filepath.Join(t.TempDir(), "app.db")
+	db, err := OpenDatabase(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewTokenStore(db, []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	token := &oauth2.Token{
+		AccessToken:  "access-token",
+		TokenType:    "Bearer",
+		RefreshToken: "refresh-token",
+		Expiry:       time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	require.NoError(t, db.EnsureUser(ctx, "user@example.com", "user@example.com"))
+	require.NoError(t, store.StoreToken(ctx, "user@example.com", token))
+
+	got, err := store.GetToken(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, token.AccessToken, got.AccessToken)
+	assert.Equal(t, token.RefreshToken, got.RefreshToken)
+	assert.True(t, token.Expiry.Equal(got.Expiry))
+
+	// The token is stored encrypted
+	var stored []byte
+	require.NoError(t, db.DB().QueryRowContext(ctx,
+		`SELECT encrypted_token FROM tokens WHERE user_id = ?`, "user@example.com").Scan(&stored))
+	assert.NotContains(t, string(stored), "access-token")
+
+	// A user who signs in again replaces their token
+	token.AccessToken = "new-access-token"
+	require.NoError(t, db.EnsureUser(ctx, "user@example.com", "user@example.com"))
+	require.NoError(t, store.StoreToken(ctx, "user@example.com", token))
+	got, err = store.GetToken(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "new-access-token", got.AccessToken)
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -49,10 +50,10 @@ func (t *Transaction) Rollback() error {
 func (t *Transaction) CreateUser(telegramID int64, gmailUserID string, digestInterval time.Duration) error {
 	query := `
 		INSERT INTO users (
-			telegram_id, gmail_user_id, digest_interval
-		) VALUES (?, ?, ?)
+			id, email, telegram_user_id, digest_interval
+		) VALUES (?, ?, ?, ?)
 	`
-	_, err := t.tx.Exec(query, telegramID, gmailUserID, int64(digestInterval.Seconds()))
+	_, err := t.tx.Exec(query, gmailUserID, gmailUserID, telegramID, int64(digestInterval.Seconds()))
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -61,38 +62,14 @@ func (t *Transaction) CreateUser(telegramID int64, gmailUserID string, digestInt
 
 // GetUser retrieves a user by their Telegram ID within the transaction
 func (t *Transaction) GetUser(telegramID int64) (*User, error) {
-	user := &User{}
-	var digestIntervalSecs int64
-	var lastDigestSent sql.NullTime
-
-	err := t.tx.QueryRow(`
-		SELECT 
-			telegram_id, gmail_user_id, digest_interval,
-			last_digest_sent, google_token_valid,
-			created_at, updated_at
-		FROM users 
-		WHERE telegram_id = ?`,
-		telegramID).Scan(
-		&user.TelegramID,
-		&user.GmailUserID,
-		&digestIntervalSecs,
-		&lastDigestSent,
-		&user.TokenValid,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	row := t.tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE telegram_user_id = ?`, telegramID)
+	user, err := scanLegacyUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("user not found: %d", telegramID)
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-
-	user.DigestInterval = time.Duration(digestIntervalSecs) * time.Second
-	if lastDigestSent.Valid {
-		user.LastDigestSent = &lastDigestSent.Time
-	}
-
 	return user, nil
 }
 
@@ -101,7 +78,7 @@ func (t *Transaction) UpdateUser(telegramID int64, digestInterval time.Duration)
 	query := `
 		UPDATE users 
 		SET digest_interval = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE telegram_id = ?
+		WHERE telegram_user_id = ?
 	`
 	result, err := t.tx.Exec(query, int64(digestInterval.Seconds()), telegramID)
 	if err != nil {
@@ -165,6 +142,39 @@ func (t *Transaction) MarkEmailProcessed(messageID, userID string) error {
 	return nil
 }
 
+// maxProcessedEmailRows caps the rows inserted by one statement, keeping
+// MarkEmailsProcessed well under SQLite's limit on bound parameters
+const maxProcessedEmailRows = 500
+
+// MarkEmailsProcessed marks a batch of emails as processed within the
+// transaction, inserting them with one multi-row statement. Emails already
+// marked are left as they are.
+func (t *Transaction) MarkEmailsProcessed(userID string, messageIDs []string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user ID cannot be empty", ErrInvalidInput)
+	}
+	for _, id := range messageIDs {
+		if id == "" {
+			return fmt.Errorf("%w: message ID cannot be empty", ErrInvalidInput)
+		}
+	}
+
+	for start := 0; start < len(messageIDs); start += maxProcessedEmailRows {
+		batch := messageIDs[start:min(start+maxProcessedEmailRows, len(messageIDs))]
+		args := make([]interface{}, 0, 2*len(batch))
+		for _, id := range batch {
+			args = append(args, id, userID)
+		}
+		values := strings.TrimSuffix(strings.Repeat("(?, ?), ", len(batch)), ", ")
+
+		query := `INSERT OR IGNORE INTO processed_emails (message_id, user_id) VALUES ` + values
+		if _, err := t.tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to mark emails as processed: %w", err)
+		}
+	}
+	return nil
+}
+
 // IsEmailProcessed checks if an email has been processed within the transaction
 func (t *Transaction) IsEmailProcessed(messageID, userID string) (bool, error) {
 	var exists bool
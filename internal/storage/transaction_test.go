@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -79,7 +80,9 @@ func TestSQLiteStorage_TransactionCommit(t *testing.T) {
 }
 
 func TestSQLiteStorage_TransactionIsolation(t *testing.T) {
-	db, err := sql.Open("sqlite3", ":memory:")
+	// Each transaction has its own connection, so they need a shared file
+	// database in WAL mode, where readers see a snapshot while a write is open
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_journal_mode=WAL")
 	require.NoError(t, err)
 	defer db.Close()
 
@@ -112,13 +115,17 @@ func TestSQLiteStorage_TransactionIsolation(t *testing.T) {
 	err = tx1.Commit()
 	require.NoError(t, err)
 
-	// Now user should be visible in second transaction
-	user, err := tx2.GetUser(telegramID)
-	require.NoError(t, err)
-	assert.Equal(t, telegramID, user.TelegramID)
+	// The second transaction keeps reading the snapshot it started with
+	_, err = tx2.GetUser(telegramID)
+	assert.Error(t, err)
 
 	err = tx2.Rollback()
 	require.NoError(t, err)
+
+	// Now user should be visible
+	user, err := storage.GetUser(ctx, telegramID)
+	require.NoError(t, err)
+	assert.Equal(t, telegramID, user.TelegramID)
 }
 
 func TestSQLiteStorage_TransactionDoubleCommit(t *testing.T) {
@@ -167,4 +174,34 @@ func TestSQLiteStorage_TransactionDoubleRollback(t *testing.T) {
 	// Second rollback should fail
 	err = tx.Rollback()
 	assert.Error(t, err)
-} 
\ No newline at end of file
+} 
+
+func TestTransaction_MarkEmailsProcessed(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
+	require.NoError(t, err)
+
+	// Rolled back emails are not processed
+	tx, err := storage.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.MarkEmailsProcessed("user1", []string{"m1", "m2"}))
+	require.NoError(t, tx.Rollback())
+	processed, err := storage.IsEmailProcessed(ctx, "m1", "user1")
+	require.NoError(t, err)
+	assert.False(t, processed)
+
+	tx, err = storage.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.MarkEmailsProcessed("user1", []string{"m1", "m2"}))
+	require.NoError(t, tx.Commit())
+	unprocessed, err := storage.FilterUnprocessed(ctx, "user1", []string{"m1", "m2", "m3"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m3"}, unprocessed)
+}
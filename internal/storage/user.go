@@ -11,6 +11,20 @@ type User struct {
 	Email          string
 	TelegramUserID sql.NullInt64
 	TelegramChatID sql.NullInt64
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-} 
\ No newline at end of file
+	TelegramID     int64
+	GmailUserID    string
+	DigestInterval time.Duration
+	LastDigestSent *time.Time
+	GmailQuery     string
+	// DeliveryChannel is how the user's digests are delivered, one of
+	// DeliveryChannelTelegram or DeliveryChannelEmail
+	DeliveryChannel string
+	// DigestFormat is the digest.DigestFormat the user's digests are
+	// rendered in; empty sends the summary as written
+	DigestFormat string
+	TokenValid   bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	// DeletedAt is when the user stopped their digests, or nil if they have not
+	DeletedAt *time.Time
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,36 +11,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestSQLiteStorage_CreateUser(t *testing.T) {
-	db, err := sql.Open("sqlite3", ":memory:")
-	require.NoError(t, err)
-	defer db.Close()
-
-	storage := NewSQLiteStorage(db)
-	err = storage.Migrate(context.Background())
-	require.NoError(t, err)
-
-	ctx := context.Background()
-	telegramID := int64(123456)
-	gmailUserID := "test@example.com"
-	digestInterval := time.Hour * 2
-
-	// Create user
-	err = storage.CreateUser(ctx, telegramID, gmailUserID, digestInterval)
-	require.NoError(t, err)
-
-	// Verify user exists
-	user, err := storage.GetUser(ctx, telegramID)
-	require.NoError(t, err)
-	assert.Equal(t, telegramID, user.TelegramID)
-	assert.Equal(t, gmailUserID, user.GmailUserID)
-	assert.Equal(t, digestInterval, user.DigestInterval)
-	assert.False(t, user.TokenValid)
-	assert.Nil(t, user.LastDigestSent)
-	assert.NotZero(t, user.CreatedAt)
-	assert.NotZero(t, user.UpdatedAt)
-}
-
 func TestSQLiteStorage_CreateDuplicateUser(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
@@ -67,7 +38,7 @@ func TestSQLiteStorage_CreateDuplicateUser(t *testing.T) {
 	assert.Error(t, err)
 }
 
-func TestSQLiteStorage_UpdateUser(t *testing.T) {
+func TestSQLiteStorage_UserOperationsInTransaction(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
@@ -81,27 +52,34 @@ func TestSQLiteStorage_UpdateUser(t *testing.T) {
 	gmailUserID := "test@example.com"
 	digestInterval := time.Hour * 2
 
-	// Create user
-	err = storage.CreateUser(ctx, telegramID, gmailUserID, digestInterval)
+	// Start transaction
+	tx, err := storage.BeginTx(ctx)
 	require.NoError(t, err)
 
-	// Update user
-	newDigestInterval := time.Hour * 4
-	lastDigestSent := time.Now().UTC().Truncate(time.Second)
-	err = storage.UpdateUser(ctx, telegramID, newDigestInterval, &lastDigestSent, true)
+	// Create user in transaction
+	err = tx.CreateUser(telegramID, gmailUserID, digestInterval)
 	require.NoError(t, err)
 
-	// Verify updates
-	user, err := storage.GetUser(ctx, telegramID)
+	// Verify user exists in transaction
+	user, err := tx.GetUser(telegramID)
+	require.NoError(t, err)
+	assert.Equal(t, telegramID, user.TelegramID)
+
+	// Verify user doesn't exist outside transaction
+	_, err = storage.GetUser(ctx, telegramID)
+	assert.Error(t, err)
+
+	// Commit transaction
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// Verify user exists after commit
+	user, err = storage.GetUser(ctx, telegramID)
 	require.NoError(t, err)
 	assert.Equal(t, telegramID, user.TelegramID)
-	assert.Equal(t, gmailUserID, user.GmailUserID)
-	assert.Equal(t, newDigestInterval, user.DigestInterval)
-	assert.True(t, user.TokenValid)
-	assert.Equal(t, lastDigestSent, *user.LastDigestSent)
 }
 
-func TestSQLiteStorage_DeleteUser(t *testing.T) {
+func TestSQLiteStorage_UserOperationsWithRollback(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
@@ -115,37 +93,24 @@ func TestSQLiteStorage_DeleteUser(t *testing.T) {
 	gmailUserID := "test@example.com"
 	digestInterval := time.Hour * 2
 
-	// Create user
-	err = storage.CreateUser(ctx, telegramID, gmailUserID, digestInterval)
-	require.NoError(t, err)
-
-	// Store token
-	err = storage.StoreToken(ctx, gmailUserID, []byte("token"), []byte("nonce"))
+	// Start transaction
+	tx, err := storage.BeginTx(ctx)
 	require.NoError(t, err)
 
-	// Mark email as processed
-	err = storage.MarkEmailProcessed(ctx, "msg1", gmailUserID)
+	// Create user in transaction
+	err = tx.CreateUser(telegramID, gmailUserID, digestInterval)
 	require.NoError(t, err)
 
-	// Delete user
-	err = storage.DeleteUser(ctx, telegramID)
+	// Rollback transaction
+	err = tx.Rollback()
 	require.NoError(t, err)
 
-	// Verify user is deleted
+	// Verify user doesn't exist after rollback
 	_, err = storage.GetUser(ctx, telegramID)
 	assert.Error(t, err)
-
-	// Verify token is deleted (due to foreign key cascade)
-	_, _, err = storage.GetToken(ctx, gmailUserID)
-	assert.Error(t, err)
-
-	// Verify processed emails are deleted (due to foreign key cascade)
-	processed, err := storage.IsEmailProcessed(ctx, "msg1", gmailUserID)
-	require.NoError(t, err)
-	assert.False(t, processed)
 }
 
-func TestSQLiteStorage_ListUsers(t *testing.T) {
+func TestSQLiteStorage_UpdateLastDigestSent(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
@@ -155,46 +120,23 @@ func TestSQLiteStorage_ListUsers(t *testing.T) {
 	require.NoError(t, err)
 
 	ctx := context.Background()
-
-	// Create test users
-	users := []struct {
-		telegramID  int64
-		gmailUserID string
-		tokenValid  bool
-	}{
-		{1, "user1@example.com", true},
-		{2, "user2@example.com", false},
-		{3, "user3@example.com", true},
-	}
-
-	for _, u := range users {
-		err = storage.CreateUser(ctx, u.telegramID, u.gmailUserID, time.Hour)
-		require.NoError(t, err)
-
-		if u.tokenValid {
-			err = storage.StoreToken(ctx, u.gmailUserID, []byte("token"), []byte("nonce"))
-			require.NoError(t, err)
-		}
-	}
-
-	// List all users
-	allUsers, err := storage.ListUsers(ctx)
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
 	require.NoError(t, err)
-	assert.Len(t, allUsers, len(users))
 
-	// List users with valid tokens
-	validUsers, err := storage.ListUsersWithValidTokens(ctx)
+	sentAt := time.Now().UTC().Truncate(time.Second)
+	err = storage.UpdateLastDigestSent(ctx, "user1", sentAt)
 	require.NoError(t, err)
-	assert.Len(t, validUsers, 2)
 
-	// List users due for digest
-	now := time.Now().UTC()
-	dueUsers, err := storage.ListUsersDueForDigest(ctx, now)
+	user, err := storage.GetUserByID(ctx, "user1")
 	require.NoError(t, err)
-	assert.Len(t, dueUsers, 2) // Only users with valid tokens should be due
+	require.NotNil(t, user.LastDigestSent)
+	assert.True(t, sentAt.Equal(*user.LastDigestSent))
+
+	assert.ErrorIs(t, storage.UpdateLastDigestSent(ctx, "missing", sentAt), ErrNotFound)
+	assert.ErrorIs(t, storage.UpdateLastDigestSent(ctx, "", sentAt), ErrInvalidInput)
 }
 
-func TestSQLiteStorage_UserOperationsInTransaction(t *testing.T) {
+func TestSQLiteStorage_UpdateGmailQuery(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
@@ -204,64 +146,79 @@ func TestSQLiteStorage_UserOperationsInTransaction(t *testing.T) {
 	require.NoError(t, err)
 
 	ctx := context.Background()
-	telegramID := int64(123456)
-	gmailUserID := "test@example.com"
-	digestInterval := time.Hour * 2
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
+	require.NoError(t, err)
 
-	// Start transaction
-	tx, err := storage.BeginTx(ctx)
+	// New users have no custom query
+	user, err := storage.GetUserByID(ctx, "user1")
 	require.NoError(t, err)
+	assert.Empty(t, user.GmailQuery)
 
-	// Create user in transaction
-	err = tx.CreateUser(telegramID, gmailUserID, digestInterval)
+	require.NoError(t, storage.UpdateGmailQuery(ctx, "user1", "label:newsletters"))
+	user, err = storage.GetUserByID(ctx, "user1")
 	require.NoError(t, err)
+	assert.Equal(t, "label:newsletters", user.GmailQuery)
 
-	// Verify user exists in transaction
-	user, err := tx.GetUser(telegramID)
+	assert.ErrorIs(t, storage.UpdateGmailQuery(ctx, "missing", "is:starred"), ErrNotFound)
+	assert.ErrorIs(t, storage.UpdateGmailQuery(ctx, "", "is:starred"), ErrInvalidInput)
+	tooLong := strings.Repeat("a", MaxGmailQueryLength+1)
+	assert.ErrorIs(t, storage.UpdateGmailQuery(ctx, "user1", tooLong), ErrInvalidInput)
+}
+
+func TestSQLiteStorage_UpdateDeliveryChannel(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
-	assert.Equal(t, telegramID, user.TelegramID)
+	defer db.Close()
 
-	// Verify user doesn't exist outside transaction
-	_, err = storage.GetUser(ctx, telegramID)
-	assert.Error(t, err)
+	storage := NewSQLiteStorage(db)
+	ctx := context.Background()
+	require.NoError(t, storage.Migrate(ctx))
 
-	// Commit transaction
-	err = tx.Commit()
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
 	require.NoError(t, err)
 
-	// Verify user exists after commit
-	user, err = storage.GetUser(ctx, telegramID)
+	// Digests go to Telegram unless the user chooses otherwise
+	user, err := storage.GetUserByID(ctx, "user1")
 	require.NoError(t, err)
-	assert.Equal(t, telegramID, user.TelegramID)
+	assert.Equal(t, DeliveryChannelTelegram, user.DeliveryChannel)
+
+	require.NoError(t, storage.UpdateDeliveryChannel(ctx, "user1", DeliveryChannelEmail))
+	user, err = storage.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryChannelEmail, user.DeliveryChannel)
+
+	assert.ErrorIs(t, storage.UpdateDeliveryChannel(ctx, "user1", "carrier-pigeon"), ErrInvalidInput)
+	assert.ErrorIs(t, storage.UpdateDeliveryChannel(ctx, "", DeliveryChannelEmail), ErrInvalidInput)
+	assert.ErrorIs(t, storage.UpdateDeliveryChannel(ctx, "missing", DeliveryChannelEmail), ErrNotFound)
 }
 
-func TestSQLiteStorage_UserOperationsWithRollback(t *testing.T) {
+func TestSQLiteStorage_UpdateDigestFormat(t *testing.T) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	require.NoError(t, err)
 	defer db.Close()
 
 	storage := NewSQLiteStorage(db)
-	err = storage.Migrate(context.Background())
-	require.NoError(t, err)
-
 	ctx := context.Background()
-	telegramID := int64(123456)
-	gmailUserID := "test@example.com"
-	digestInterval := time.Hour * 2
+	require.NoError(t, storage.Migrate(ctx))
 
-	// Start transaction
-	tx, err := storage.BeginTx(ctx)
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email) VALUES (?, ?)`, "user1", "user1@example.com")
 	require.NoError(t, err)
 
-	// Create user in transaction
-	err = tx.CreateUser(telegramID, gmailUserID, digestInterval)
+	user, err := storage.GetUserByID(ctx, "user1")
 	require.NoError(t, err)
+	assert.Empty(t, user.DigestFormat)
 
-	// Rollback transaction
-	err = tx.Rollback()
+	require.NoError(t, storage.UpdateDigestFormat(ctx, "user1", "html"))
+	user, err = storage.GetUserByID(ctx, "user1")
 	require.NoError(t, err)
+	assert.Equal(t, "html", user.DigestFormat)
 
-	// Verify user doesn't exist after rollback
-	_, err = storage.GetUser(ctx, telegramID)
-	assert.Error(t, err)
-} 
\ No newline at end of file
+	require.NoError(t, storage.UpdateDigestFormat(ctx, "user1", ""))
+	user, err = storage.GetUserByID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Empty(t, user.DigestFormat)
+
+	assert.ErrorIs(t, storage.UpdateDigestFormat(ctx, "user1", "pdf"), ErrInvalidInput)
+	assert.ErrorIs(t, storage.UpdateDigestFormat(ctx, "", "html"), ErrInvalidInput)
+	assert.ErrorIs(t, storage.UpdateDigestFormat(ctx, "missing", "html"), ErrNotFound)
+}
@@ -0,0 +1,140 @@
+package summary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gmaildigest-go/pkg/models"
+)
+
+const (
+	// DefaultAnthropicBaseURL is the Anthropic API host
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	// DefaultAnthropicModel is the model used for digests
+	DefaultAnthropicModel = "claude-3-5-haiku-latest"
+	// anthropicVersion is the Messages API version header value
+	anthropicVersion = "2023-06-01"
+	// anthropicMaxTokens caps the length of a generated digest
+	anthropicMaxTokens = 1024
+)
+
+// AnthropicSummarizer summarizes emails with the Anthropic Messages API.
+type AnthropicSummarizer struct {
+	apiKey     string
+	model      string
+	baseURL    string
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// NewAnthropicSummarizer creates a new AnthropicSummarizer. A zero timeout means no limit
+// beyond the caller's context.
+func NewAnthropicSummarizer(apiKey string, timeout time.Duration) *AnthropicSummarizer {
+	return &AnthropicSummarizer{
+		apiKey:     apiKey,
+		model:      DefaultAnthropicModel,
+		baseURL:    DefaultAnthropicBaseURL,
+		timeout:    timeout,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// SetBaseURL overrides the API host, primarily for testing.
+func (s *AnthropicSummarizer) SetBaseURL(baseURL string) {
+	s.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	Messages  []anthropicMessage `json:"messages"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Summarize creates a summary of a list of emails using the Anthropic API.
+func (s *AnthropicSummarizer) Summarize(ctx context.Context, emails []models.Email) (string, error) {
+	if len(emails) == 0 {
+		return noEmailsSummary, nil
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(anthropicRequest{
+		Model:     s.model,
+		MaxTokens: anthropicMaxTokens,
+		Messages: []anthropicMessage{
+			{Role: "user", Content: buildPrompt(emails)},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call Anthropic API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Anthropic response: %w", err)
+	}
+
+	var result anthropicResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse Anthropic response (status %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != nil {
+			return "", fmt.Errorf("anthropic API error (status %d): %s: %s", resp.StatusCode, result.Error.Type, result.Error.Message)
+		}
+		return "", fmt.Errorf("anthropic API error (status %d)", resp.StatusCode)
+	}
+
+	var summary strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			summary.WriteString(block.Text)
+		}
+	}
+	if summary.Len() == 0 {
+		return "", fmt.Errorf("no summary returned from Anthropic")
+	}
+
+	return summary.String(), nil
+}
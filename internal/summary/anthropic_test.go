@@ -0,0 +1,113 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gmaildigest-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEmails = []models.Email{
+	{From: "alice@example.com", Subject: "Lunch on Friday", Body: "Are you free?"},
+	{From: "bob@example.com", Subject: "Invoice #42", Body: "Please find the invoice attached."},
+}
+
+func TestAnthropicSummarizer_Summarize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+
+		var req anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, DefaultAnthropicModel, req.Model)
+		require.Len(t, req.Messages, 1)
+		assert.Contains(t, req.Messages[0].Content, "Subject: Lunch on Friday")
+		assert.Contains(t, req.Messages[0].Content, "Subject: Invoice #42")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"content":[{"type":"text","text":"Two emails: lunch and an invoice."}]}`))
+	}))
+	defer server.Close()
+
+	summarizer := NewAnthropicSummarizer("test-key", time.Second)
+	summarizer.SetBaseURL(server.URL)
+
+	digest, err := summarizer.Summarize(context.Background(), testEmails)
+	require.NoError(t, err)
+	assert.Equal(t, "Two emails: lunch and an invoice.", digest)
+}
+
+func TestAnthropicSummarizer_NoEmails(t *testing.T) {
+	summarizer := NewAnthropicSummarizer("test-key", time.Second)
+	summarizer.SetBaseURL("http://127.0.0.1:0") // must not be called
+
+	digest, err := summarizer.Summarize(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, noEmailsSummary, digest)
+}
+
+func TestAnthropicSummarizer_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	summarizer := NewAnthropicSummarizer("bad-key", time.Second)
+	summarizer.SetBaseURL(server.URL)
+
+	_, err := summarizer.Summarize(context.Background(), testEmails)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+	assert.Contains(t, err.Error(), "invalid x-api-key")
+}
+
+func TestAnthropicSummarizer_ContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	summarizer := NewAnthropicSummarizer("test-key", 0)
+	summarizer.SetBaseURL(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := summarizer.Summarize(ctx, testEmails)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestAnthropicSummarizer_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	summarizer := NewAnthropicSummarizer("test-key", 50*time.Millisecond)
+	summarizer.SetBaseURL(server.URL)
+
+	_, err := summarizer.Summarize(context.Background(), testEmails)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,72 @@
+package summary
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gmaildigest-go/pkg/models"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAISummarizer summarizes emails with the OpenAI chat completions API.
+type OpenAISummarizer struct {
+	apiKey  string
+	timeout time.Duration
+	client  *openai.Client
+}
+
+// NewOpenAISummarizer creates a new OpenAISummarizer. A zero timeout means no limit
+// beyond the caller's context.
+func NewOpenAISummarizer(apiKey string, timeout time.Duration) *OpenAISummarizer {
+	return &OpenAISummarizer{
+		apiKey:  apiKey,
+		timeout: timeout,
+		client:  openai.NewClient(apiKey),
+	}
+}
+
+// SetBaseURL overrides the API base URL, primarily for testing.
+func (s *OpenAISummarizer) SetBaseURL(baseURL string) {
+	clientConfig := openai.DefaultConfig(s.apiKey)
+	clientConfig.BaseURL = baseURL
+	s.client = openai.NewClientWithConfig(clientConfig)
+}
+
+// Summarize creates a summary of a list of emails using the OpenAI API.
+func (s *OpenAISummarizer) Summarize(ctx context.Context, emails []models.Email) (string, error) {
+	if len(emails) == 0 {
+		return noEmailsSummary, nil
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	// Call the OpenAI API
+	resp, err := s.client.CreateChatCompletion(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model: openai.GPT4o,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: buildPrompt(emails),
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to create chat completion: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no summary returned from OpenAI")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,57 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAISummarizer_Summarize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var req openai.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Messages, 1)
+		assert.Contains(t, req.Messages[0].Content, "Subject: Lunch on Friday")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Lunch and an invoice."}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	summarizer := NewOpenAISummarizer("test-key", time.Second)
+	summarizer.SetBaseURL(server.URL)
+
+	digest, err := summarizer.Summarize(context.Background(), testEmails)
+	require.NoError(t, err)
+	assert.Equal(t, "Lunch and an invoice.", digest)
+}
+
+func TestOpenAISummarizer_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`))
+	}))
+	defer server.Close()
+
+	summarizer := NewOpenAISummarizer("bad-key", time.Second)
+	summarizer.SetBaseURL(server.URL)
+
+	_, err := summarizer.Summarize(context.Background(), testEmails)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Incorrect API key provided")
+}
@@ -0,0 +1,51 @@
+package summary
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gmaildigest-go/internal/config"
+	"gmaildigest-go/pkg/models"
+)
+
+// noEmailsSummary is returned when there is nothing to summarize.
+const noEmailsSummary = "No new emails to summarize."
+
+// DefaultTimeout bounds each summary request when the config sets no timeout.
+const DefaultTimeout = 30 * time.Second
+
+// Summarizer turns a batch of emails into a short digest.
+type Summarizer interface {
+	Summarize(ctx context.Context, emails []models.Email) (string, error)
+}
+
+// NewSummarizer creates the Summarizer selected by the configuration: Anthropic if
+// an Anthropic key is set, otherwise OpenAI. A zero timeout uses DefaultTimeout.
+func NewSummarizer(cfg config.Summary) (Summarizer, error) {
+	timeout := cfg.Timeout.Duration
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	switch {
+	case cfg.AnthropicAPIKey != "":
+		return NewAnthropicSummarizer(cfg.AnthropicAPIKey, timeout), nil
+	case cfg.OpenAIAPIKey != "":
+		return NewOpenAISummarizer(cfg.OpenAIAPIKey, timeout), nil
+	default:
+		return nil, fmt.Errorf("no summary provider configured: set summary.anthropic_api_key or summary.openai_api_key")
+	}
+}
+
+// buildPrompt batches email senders, subjects and bodies into a single prompt.
+func buildPrompt(emails []models.Email) string {
+	var contentBuilder strings.Builder
+	contentBuilder.WriteString("Please provide a concise summary of the following emails:\n\n")
+	for _, email := range emails {
+		contentBuilder.WriteString(fmt.Sprintf("From: %s\n", email.From))
+		contentBuilder.WriteString(fmt.Sprintf("Subject: %s\n", email.Subject))
+		contentBuilder.WriteString(fmt.Sprintf("Body: %s\n\n", email.Body))
+	}
+	return contentBuilder.String()
+}
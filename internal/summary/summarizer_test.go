@@ -0,0 +1,68 @@
+package summary
+
+import (
+	"testing"
+	"time"
+
+	"gmaildigest-go/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSummarizer(t *testing.T) {
+	timeout := config.Duration{Duration: 10 * time.Second}
+
+	tests := []struct {
+		name    string
+		cfg     config.Summary
+		want    Summarizer
+		wantErr bool
+	}{
+		{
+			name: "anthropic preferred",
+			cfg:  config.Summary{AnthropicAPIKey: "a-key", OpenAIAPIKey: "o-key", Timeout: timeout},
+			want: &AnthropicSummarizer{},
+		},
+		{
+			name: "openai fallback",
+			cfg:  config.Summary{OpenAIAPIKey: "o-key", Timeout: timeout},
+			want: &OpenAISummarizer{},
+		},
+		{
+			name:    "nothing configured",
+			cfg:     config.Summary{Timeout: timeout},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSummarizer(tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.IsType(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewSummarizer_Timeout(t *testing.T) {
+	timeout := config.Duration{Duration: 7 * time.Second}
+
+	anthropic, err := NewSummarizer(config.Summary{AnthropicAPIKey: "a-key", Timeout: timeout})
+	require.NoError(t, err)
+	assert.Equal(t, 7*time.Second, anthropic.(*AnthropicSummarizer).timeout)
+
+	openAI, err := NewSummarizer(config.Summary{OpenAIAPIKey: "o-key", Timeout: timeout})
+	require.NoError(t, err)
+	assert.Equal(t, 7*time.Second, openAI.(*OpenAISummarizer).timeout)
+}
+
+func TestNewSummarizer_DefaultTimeout(t *testing.T) {
+	s, err := NewSummarizer(config.Summary{AnthropicAPIKey: "a-key"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTimeout, s.(*AnthropicSummarizer).timeout)
+}
@@ -0,0 +1,133 @@
+package telegram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLinkTTL is how long a link token stays valid after it is issued
+const DefaultLinkTTL = 15 * time.Minute
+
+// linkMACSize is how many bytes of the HMAC a token keeps. Telegram limits
+// the start parameter of a deep link to 64 characters.
+const linkMACSize = 16
+
+var (
+	// ErrInvalidLinkToken is returned for a link token that is malformed or
+	// whose signature does not match
+	ErrInvalidLinkToken = errors.New("invalid link token")
+	// ErrLinkTokenExpired is returned for a link token past its expiry
+	ErrLinkTokenExpired = errors.New("link token expired")
+)
+
+// LinkSigner signs and verifies the tokens that link a Telegram chat to a
+// user. Linking takes two hops:
+//
+//  1. The signed-in user is sent to the bot through a t.me deep link whose
+//     start token is tied to their user ID and expires after the TTL.
+//  2. The bot answers /start with a connect URL carrying the start token and
+//     the Telegram user and chat it came from, signed so they cannot be
+//     changed on the way back.
+//
+// VerifyConnect checks both signatures and the expiry against the user the
+// connect URL is opened by.
+type LinkSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewLinkSigner creates a LinkSigner whose tokens last ttl. The signing key
+// is derived from secret, so secret may be a key used for something else.
+func NewLinkSigner(secret []byte, ttl time.Duration) *LinkSigner {
+	if ttl <= 0 {
+		ttl = DefaultLinkTTL
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("telegram link"))
+	return &LinkSigner{key: mac.Sum(nil), ttl: ttl, now: time.Now}
+}
+
+// SetNow sets the function tokens are issued and checked against, for tests
+func (s *LinkSigner) SetNow(now func() time.Time) {
+	s.now = now
+}
+
+// StartToken returns a start token for userID, made of the expiry in base 36
+// and the signature, using only characters Telegram allows in a deep link
+func (s *LinkSigner) StartToken(userID string) string {
+	expiry := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 36)
+	return expiry + "_" + s.sign("start", userID, expiry)
+}
+
+// DeepLink returns the t.me link that opens bot with the start token
+func DeepLink(bot, token string) string {
+	return "https://t.me/" + bot + "?start=" + url.QueryEscape(token)
+}
+
+// ConnectQuery returns the query of the connect URL for a start token
+// received from the given Telegram user and chat
+func (s *LinkSigner) ConnectQuery(token string, telegramUserID, chatID int64) url.Values {
+	tgUser := strconv.FormatInt(telegramUserID, 10)
+	chat := strconv.FormatInt(chatID, 10)
+	return url.Values{
+		"token": {token},
+		"tg":    {tgUser},
+		"chat":  {chat},
+		"sig":   {s.sign("connect", token, tgUser, chat)},
+	}
+}
+
+// VerifyConnect checks a connect URL query opened by userID and returns the
+// Telegram user and chat to link. It returns ErrInvalidLinkToken if either
+// signature does not match and ErrLinkTokenExpired if the start token has
+// expired.
+func (s *LinkSigner) VerifyConnect(query url.Values, userID string) (telegramUserID, chatID int64, err error) {
+	token, tgUser, chat := query.Get("token"), query.Get("tg"), query.Get("chat")
+	if !s.verify(query.Get("sig"), "connect", token, tgUser, chat) {
+		return 0, 0, ErrInvalidLinkToken
+	}
+
+	expiry, mac, ok := strings.Cut(token, "_")
+	if !ok || !s.verify(mac, "start", userID, expiry) {
+		return 0, 0, ErrInvalidLinkToken
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 36, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidLinkToken
+	}
+	if !s.now().Before(time.Unix(expiresAt, 0)) {
+		return 0, 0, ErrLinkTokenExpired
+	}
+
+	if telegramUserID, err = strconv.ParseInt(tgUser, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("%w: telegram user: %v", ErrInvalidLinkToken, err)
+	}
+	if chatID, err = strconv.ParseInt(chat, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("%w: chat: %v", ErrInvalidLinkToken, err)
+	}
+	return telegramUserID, chatID, nil
+}
+
+// sign returns the truncated base64url HMAC of the purpose and fields
+func (s *LinkSigner) sign(purpose string, fields ...string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(purpose))
+	for _, field := range fields {
+		// Length-prefix each field so they cannot run into each other
+		fmt.Fprintf(mac, "|%d:%s", len(field), field)
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:linkMACSize])
+}
+
+// verify reports whether sig is the signature of the purpose and fields
+func (s *LinkSigner) verify(sig, purpose string, fields ...string) bool {
+	return hmac.Equal([]byte(sig), []byte(s.sign(purpose, fields...)))
+}
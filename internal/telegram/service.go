@@ -3,25 +3,26 @@ package telegram
 import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"fmt"
-	"log"
+	"log/slog"
 )
 
 // Service provides methods for interacting with the Telegram Bot API.
 type Service struct {
-	logger   *log.Logger
+	logger   *slog.Logger
 	bot      *tgbotapi.BotAPI
 	httpPort int
+	links    *LinkSigner
 }
 
 // NewService creates a new Telegram Service.
-func NewService(botToken string, httpPort int, logger *log.Logger) (*Service, error) {
+func NewService(botToken string, httpPort int, logger *slog.Logger) (*Service, error) {
 	bot, err := tgbotapi.NewBotAPI(botToken)
 	if err != nil {
 		return nil, err
 	}
 	bot.Debug = true // Enable debug mode for development
 
-	logger.Printf("Authorized on account %s", bot.Self.UserName)
+	logger.Info("Authorized on account", "account", bot.Self.UserName)
 
 	return &Service{
 		logger:   logger,
@@ -30,6 +31,17 @@ func NewService(botToken string, httpPort int, logger *log.Logger) (*Service, er
 	}, nil
 }
 
+// SetLinkSigner sets the signer of the connect links handed out by /start.
+// Without one the bot cannot link accounts.
+func (s *Service) SetLinkSigner(links *LinkSigner) {
+	s.links = links
+}
+
+// BotName returns the username of the bot, as used in t.me links
+func (s *Service) BotName() string {
+	return s.bot.Self.UserName
+}
+
 // SendMessage sends a text message to a given chat ID.
 func (s *Service) SendMessage(chatID int64, text string) error {
 	msg := tgbotapi.NewMessage(chatID, text)
@@ -37,6 +49,15 @@ func (s *Service) SendMessage(chatID int64, text string) error {
 	return err
 }
 
+// SendFormattedMessage sends a text message rendered with a Telegram parse
+// mode, such as tgbotapi.ModeMarkdown. An empty parse mode sends plain text.
+func (s *Service) SendFormattedMessage(chatID int64, text, parseMode string) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = parseMode
+	_, err := s.bot.Send(msg)
+	return err
+}
+
 // StartPolling starts a long-polling loop to receive updates from Telegram.
 // It should be run in a separate goroutine.
 func (s *Service) StartPolling() {
@@ -61,16 +82,27 @@ func (s *Service) StartPolling() {
 	}
 }
 
+// handleStartCommand answers /start with StartReply
 func (s *Service) handleStartCommand(message *tgbotapi.Message) {
-	s.logger.Printf("Received /start command from user %d in chat %d", message.From.ID, message.Chat.ID)
+	s.logger.Info("Received /start command", "telegram_user", message.From.ID, "chat", message.Chat.ID)
 
-	// Generate a unique link for the user to connect their account.
-	token := message.From.ID
-	connectURL := fmt.Sprintf("http://localhost:%d/telegram/connect?token=%d", s.httpPort, token)
-
-	responseText := fmt.Sprintf("Welcome! To connect your account and receive email digests, please click this link:\n\n%s", connectURL)
+	if err := s.SendMessage(message.Chat.ID, s.StartReply(message)); err != nil {
+		s.logger.Error("Failed to send connect message", "telegram_user", message.From.ID, "error", err)
+	}
+}
 
-	if err := s.SendMessage(message.Chat.ID, responseText); err != nil {
-		s.logger.Printf("Failed to send connect message to user %d: %v", message.From.ID, err)
+// StartReply returns the answer to a /start message. A start token from a
+// deep link gets a signed link back to the web app that connects this chat
+// to the user the token was issued to; without one the user is pointed at
+// the page that issues it.
+func (s *Service) StartReply(message *tgbotapi.Message) string {
+	token := message.CommandArguments()
+	if token == "" || s.links == nil {
+		linkURL := fmt.Sprintf("http://localhost:%d/telegram/link", s.httpPort)
+		return fmt.Sprintf("Welcome! To connect your account and receive email digests, sign in and open this link:\n\n%s", linkURL)
 	}
-} 
\ No newline at end of file
+
+	query := s.links.ConnectQuery(token, message.From.ID, message.Chat.ID)
+	connectURL := fmt.Sprintf("http://localhost:%d/telegram/connect?%s", s.httpPort, query.Encode())
+	return fmt.Sprintf("Welcome! To connect your account and receive email digests, please click this link:\n\n%s", connectURL)
+}
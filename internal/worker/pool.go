@@ -1,11 +1,24 @@
 package worker
 
 import (
+	"container/heap"
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrStopTimeout is returned by StopWithTimeout when tasks are still running at the deadline
+var ErrStopTimeout = errors.New("worker pool stop timed out")
+
+// ErrPoolStopped is returned by SubmitWait when the pool is stopped
+var ErrPoolStopped = errors.New("worker pool is stopped")
+
+// ErrTaskPanicked is passed to OnFailure when a task's Execute panics
+var ErrTaskPanicked = errors.New("task panicked")
+
 // Task represents a unit of work to be executed by the worker pool
 type Task interface {
 	Execute(ctx context.Context) error
@@ -16,16 +29,26 @@ type Task interface {
 // WorkerPool manages a pool of workers for executing tasks
 type WorkerPool struct {
 	workers    int
-	tasks     chan Task
+	queue     taskQueue // waiting tasks, highest priority first
+	queueSize int
+	nextSeq   uint64
+	ready     *sync.Cond // signalled when a task is queued or the pool stops
+	space     *sync.Cond // signalled when a task leaves the queue or the pool stops
 	wg        sync.WaitGroup
 	ctx       context.Context
 	cancel    context.CancelFunc
 	metrics   *Metrics
 	isStopped bool
+	started   bool
+	retiring  int          // workers asked to exit by Resize that have not yet done so
+	busy      atomic.Int32 // workers currently executing a task
+	completed atomic.Int64 // tasks that finished without error
+	failed    atomic.Int64 // tasks that returned an error
 	mu        sync.RWMutex
 }
 
-// Metrics tracks worker pool statistics
+// Metrics tracks worker pool statistics. GetMetrics returns a snapshot
+// whose values are read through its accessor methods.
 type Metrics struct {
 	mu               sync.RWMutex
 	activeWorkers    int
@@ -37,129 +60,330 @@ type Metrics struct {
 }
 
 // NewWorkerPool creates a new worker pool with the specified number of workers
+// and a queue twice that size
 func NewWorkerPool(workers int) *WorkerPool {
+	return NewWorkerPoolWithConfig(workers, 0)
+}
+
+// NewWorkerPoolWithConfig creates a new worker pool with the specified number
+// of workers and room for queueSize waiting tasks. Submit fails once the queue
+// is full. A queueSize of 0 or less uses twice the number of workers.
+func NewWorkerPoolWithConfig(workers, queueSize int) *WorkerPool {
 	if workers <= 0 {
 		workers = 1
 	}
+	if queueSize <= 0 {
+		queueSize = workers * 2
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	return &WorkerPool{
-		workers: workers,
-		tasks:   make(chan Task, workers*2), // Buffer size = 2x number of workers
-		ctx:     ctx,
-		cancel:  cancel,
-		metrics: &Metrics{},
+	p := &WorkerPool{
+		workers:   workers,
+		queueSize: queueSize,
+		ctx:       ctx,
+		cancel:    cancel,
+		metrics:   &Metrics{},
 	}
+	p.ready = sync.NewCond(&p.mu)
+	p.space = sync.NewCond(&p.mu)
+	return p
 }
 
 // Start initializes and starts the worker pool
 func (p *WorkerPool) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = true
 	for i := 0; i < p.workers; i++ {
 		p.wg.Add(1)
 		go p.worker()
 	}
 }
 
+// Resize changes the number of workers. Extra workers start straight away;
+// when shrinking, surplus workers exit once they finish their current task.
+// Values below 1 are treated as 1.
+func (p *WorkerPool) Resize(workers int) {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.isStopped || workers == p.workers {
+		return
+	}
+
+	if p.started {
+		if workers > p.workers {
+			grow := workers - p.workers
+			// Keep workers that are about to retire rather than starting new ones
+			keep := min(grow, p.retiring)
+			p.retiring -= keep
+			for i := keep; i < grow; i++ {
+				p.wg.Add(1)
+				go p.worker()
+			}
+		} else {
+			p.retiring += p.workers - workers
+			p.ready.Broadcast()
+		}
+	}
+	p.workers = workers
+}
+
+// Size returns the number of workers the pool is configured to run
+func (p *WorkerPool) Size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.workers
+}
+
 // worker processes tasks from the task queue
 func (p *WorkerPool) worker() {
 	defer p.wg.Done()
 
 	for {
-		select {
-		case <-p.ctx.Done():
+		task, ok := p.dequeue()
+		if !ok {
 			return
-		case task, ok := <-p.tasks:
-			if !ok {
-				return
-			}
-			if task == nil {
-				continue
-			}
+		}
 
-			p.metrics.mu.Lock()
-			p.metrics.activeWorkers++
-			p.metrics.queuedTasks--
-			p.metrics.mu.Unlock()
-
-			start := time.Now()
-			err := task.Execute(p.ctx)
-			duration := time.Since(start)
-
-			p.metrics.mu.Lock()
-			p.metrics.activeWorkers--
-			p.metrics.processingTime += duration
-			p.metrics.lastProcessed = time.Now()
-			if err != nil {
-				p.metrics.failedTasks++
-				task.OnFailure(err)
-			} else {
-				p.metrics.completedTasks++
-				task.OnSuccess()
-			}
-			p.metrics.mu.Unlock()
+		p.busy.Add(1)
+		start := time.Now()
+		err := p.execute(task)
+		duration := time.Since(start)
+		p.busy.Add(-1)
+
+		if err != nil {
+			p.failed.Add(1)
+		} else {
+			p.completed.Add(1)
+		}
+		p.metrics.mu.Lock()
+		p.metrics.processingTime += duration
+		p.metrics.lastProcessed = time.Now()
+		p.metrics.mu.Unlock()
+
+		// Callbacks run without holding the metrics lock, since they may
+		// submit tasks or take locks of their own
+		if err != nil {
+			task.OnFailure(err)
+		} else {
+			task.OnSuccess()
 		}
 	}
 }
 
-// Submit adds a task to the worker pool queue
+// execute runs a task, turning a panic into an error wrapping ErrTaskPanicked
+// so the worker survives and the task's OnFailure is called
+func (p *WorkerPool) execute(task Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrTaskPanicked, r)
+		}
+	}()
+	return task.Execute(p.ctx)
+}
+
+// dequeue blocks until a task is waiting and returns the one with the highest
+// priority. It returns false once the pool is stopped, or when Resize has
+// asked this worker to exit; queued tasks that have not started by the time
+// the pool stops are dropped.
+func (p *WorkerPool) dequeue() (Task, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) == 0 && !p.isStopped && p.retiring == 0 {
+		p.ready.Wait()
+	}
+	if p.isStopped {
+		return nil, false
+	}
+	if p.retiring > 0 {
+		p.retiring--
+		return nil, false
+	}
+	item := heap.Pop(&p.queue).(*queuedTask)
+	p.space.Broadcast()
+	return item.task, true
+}
+
+// Submit adds a task to the worker pool queue. Tasks implementing Prioritized
+// are dequeued ahead of lower-priority tasks. It returns false if the queue is
+// full or the pool is stopped.
 func (p *WorkerPool) Submit(task Task) bool {
 	if task == nil {
 		return false
 	}
 
-	p.mu.RLock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if p.isStopped {
-		p.mu.RUnlock()
 		return false
 	}
-	p.mu.RUnlock()
-
-	select {
-	case p.tasks <- task:
-		p.metrics.mu.Lock()
-		p.metrics.queuedTasks++
-		p.metrics.mu.Unlock()
-		return true
-	default:
+	if len(p.queue) >= p.queueSize {
 		// Queue is full
 		return false
 	}
+
+	p.enqueue(task)
+	return true
 }
 
-// Stop gracefully shuts down the worker pool
+// SubmitWait adds a task to the worker pool queue like Submit, but waits for
+// room when the queue is full instead of failing. It returns ctx.Err() if
+// ctx is done before the task is queued, or ErrPoolStopped if the pool stops.
+func (p *WorkerPool) SubmitWait(ctx context.Context, task Task) error {
+	if task == nil {
+		return errors.New("task cannot be nil")
+	}
+
+	// Wake the wait below when ctx is done
+	stopWake := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.space.Broadcast()
+	})
+	defer stopWake()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.isStopped && len(p.queue) >= p.queueSize && ctx.Err() == nil {
+		p.space.Wait()
+	}
+	if p.isStopped {
+		return ErrPoolStopped
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.enqueue(task)
+	return nil
+}
+
+// enqueue queues a task and wakes a worker. The caller holds mu and has
+// checked there is room.
+func (p *WorkerPool) enqueue(task Task) {
+	heap.Push(&p.queue, &queuedTask{task: task, priority: priorityOf(task), seq: p.nextSeq})
+	p.nextSeq++
+	p.ready.Signal()
+}
+
+// Stop gracefully shuts down the worker pool, waiting for running tasks however long they take
 func (p *WorkerPool) Stop() {
+	p.StopWithTimeout(0)
+}
+
+// StopWithTimeout shuts down the worker pool and waits up to d for running
+// tasks to finish. If they do not, it returns an error wrapping ErrStopTimeout
+// with the number of tasks still running. A d of 0 or less waits indefinitely.
+func (p *WorkerPool) StopWithTimeout(d time.Duration) error {
 	p.mu.Lock()
-	p.isStopped = true
+	if !p.isStopped {
+		p.isStopped = true
+		p.cancel()
+		p.ready.Broadcast()
+		p.space.Broadcast()
+		// Queued tasks are dropped; tell anyone awaiting their result
+		for _, item := range p.queue {
+			if rt, ok := item.task.(*resultTask); ok {
+				rt.deliver(ErrPoolStopped)
+			}
+		}
+	}
 	p.mu.Unlock()
 
-	p.cancel()
-	close(p.tasks)
-	p.wg.Wait()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	if d <= 0 {
+		<-done
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: %d tasks still running after %s", ErrStopTimeout, p.ActiveWorkers(), d)
+	}
+}
+
+// QueueDepth returns the number of tasks waiting for a worker
+func (p *WorkerPool) QueueDepth() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.queue)
+}
+
+// ActiveWorkers returns the number of workers currently executing a task
+func (p *WorkerPool) ActiveWorkers() int {
+	return int(p.busy.Load())
 }
 
-// GetMetrics returns a copy of the current metrics
+// GetMetrics returns a copy of the current metrics, including the queue
+// depth and active workers at the time of the call
 func (p *WorkerPool) GetMetrics() Metrics {
+	queued := p.QueueDepth()
+	active := p.ActiveWorkers()
+
 	p.metrics.mu.RLock()
 	defer p.metrics.mu.RUnlock()
 
 	return Metrics{
-		activeWorkers:    p.metrics.activeWorkers,
-		completedTasks:   p.metrics.completedTasks,
-		failedTasks:      p.metrics.failedTasks,
-		queuedTasks:      p.metrics.queuedTasks,
+		activeWorkers:    active,
+		completedTasks:   p.completed.Load(),
+		failedTasks:      p.failed.Load(),
+		queuedTasks:      int64(queued),
 		processingTime:   p.metrics.processingTime,
 		lastProcessed:    p.metrics.lastProcessed,
 	}
 }
 
-// ResetMetrics resets all metrics to their initial values
+// ActiveWorkers returns the number of workers currently executing a task
+func (m *Metrics) ActiveWorkers() int {
+	return m.activeWorkers
+}
+
+// CompletedTasks returns the number of tasks that finished without error
+func (m *Metrics) CompletedTasks() int64 {
+	return m.completedTasks
+}
+
+// FailedTasks returns the number of tasks that returned an error
+func (m *Metrics) FailedTasks() int64 {
+	return m.failedTasks
+}
+
+// QueuedTasks returns the number of tasks waiting for a worker
+func (m *Metrics) QueuedTasks() int64 {
+	return m.queuedTasks
+}
+
+// ProcessingTime returns the total time workers have spent executing tasks
+func (m *Metrics) ProcessingTime() time.Duration {
+	return m.processingTime
+}
+
+// LastProcessed returns when a task last finished, or the zero time if none has
+func (m *Metrics) LastProcessed() time.Time {
+	return m.lastProcessed
+}
+
+// ResetMetrics resets the task counters and timings to their initial values.
+// The queue depth and active workers reflect the pool's state and are not reset.
 func (p *WorkerPool) ResetMetrics() {
+	p.completed.Store(0)
+	p.failed.Store(0)
+
 	p.metrics.mu.Lock()
 	defer p.metrics.mu.Unlock()
-
-	p.metrics.completedTasks = 0
-	p.metrics.failedTasks = 0
-	p.metrics.queuedTasks = 0
 	p.metrics.processingTime = 0
 	p.metrics.lastProcessed = time.Time{}
 } 
\ No newline at end of file
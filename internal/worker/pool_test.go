@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -101,11 +102,11 @@ func TestWorkerPool_Metrics(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	metrics := pool.GetMetrics()
-	if metrics.completedTasks != 1 {
-		t.Errorf("Expected 1 completed task, got %d", metrics.completedTasks)
+	if metrics.CompletedTasks() != 1 {
+		t.Errorf("Expected 1 completed task, got %d", metrics.CompletedTasks())
 	}
-	if metrics.failedTasks != 0 {
-		t.Errorf("Expected 0 failed tasks, got %d", metrics.failedTasks)
+	if metrics.FailedTasks() != 0 {
+		t.Errorf("Expected 0 failed tasks, got %d", metrics.FailedTasks())
 	}
 
 	// Submit failing task
@@ -115,11 +116,11 @@ func TestWorkerPool_Metrics(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	metrics = pool.GetMetrics()
-	if metrics.completedTasks != 1 {
-		t.Errorf("Expected 1 completed task, got %d", metrics.completedTasks)
+	if metrics.CompletedTasks() != 1 {
+		t.Errorf("Expected 1 completed task, got %d", metrics.CompletedTasks())
 	}
-	if metrics.failedTasks != 1 {
-		t.Errorf("Expected 1 failed task, got %d", metrics.failedTasks)
+	if metrics.FailedTasks() != 1 {
+		t.Errorf("Expected 1 failed task, got %d", metrics.FailedTasks())
 	}
 }
 
@@ -146,6 +147,39 @@ func TestWorkerPool_QueueFull(t *testing.T) {
 	}
 }
 
+func TestWorkerPoolWithConfig_QueueSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		workers   int
+		queueSize int
+		capacity  int
+	}{
+		{"explicit queue size", 1, 4, 4},
+		{"default queue size", 2, 0, 4},
+		{"negative values", -1, -1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Not started, so nothing drains the queue
+			pool := NewWorkerPoolWithConfig(tt.workers, tt.queueSize)
+			defer pool.Stop()
+
+			for i := 0; i < tt.capacity; i++ {
+				if !pool.Submit(&mockTask{}) {
+					t.Fatalf("Failed to submit task %d of %d", i+1, tt.capacity)
+				}
+			}
+			if pool.Submit(&mockTask{}) {
+				t.Errorf("Task beyond queue size %d should not have been accepted", tt.capacity)
+			}
+			if got := pool.GetMetrics(); got.QueuedTasks() != int64(tt.capacity) {
+				t.Errorf("Expected %d queued tasks, got %d", tt.capacity, got.QueuedTasks())
+			}
+		})
+	}
+}
+
 func TestWorkerPool_Shutdown(t *testing.T) {
 	pool := NewWorkerPool(2)
 	pool.Start()
@@ -185,4 +219,309 @@ func TestWorkerPool_Shutdown(t *testing.T) {
 	if pool.Submit(task3) {
 		t.Error("Should not accept tasks after shutdown")
 	}
-} 
\ No newline at end of file
+} 
+func TestWorkerPool_StopWithTimeout(t *testing.T) {
+	pool := NewWorkerPool(2)
+	pool.Start()
+
+	slow := &mockTask{delay: 500 * time.Millisecond}
+	if !pool.Submit(slow) {
+		t.Fatal("Failed to submit slow task")
+	}
+
+	// Wait for the slow task to start executing
+	time.Sleep(25 * time.Millisecond)
+
+	start := time.Now()
+	err := pool.StopWithTimeout(50 * time.Millisecond)
+	if !errors.Is(err, ErrStopTimeout) {
+		t.Fatalf("Expected ErrStopTimeout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "1 tasks still running") {
+		t.Errorf("Expected running task count in error, got %q", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("StopWithTimeout waited %s, expected about 50ms", elapsed)
+	}
+
+	// Stopping again waits for the slow task to drain
+	if err := pool.StopWithTimeout(time.Second); err != nil {
+		t.Errorf("Expected pool to drain, got %v", err)
+	}
+	slow.mu.Lock()
+	if !slow.executed {
+		t.Error("Slow task was not executed")
+	}
+	slow.mu.Unlock()
+}
+
+func TestWorkerPool_StopWithTimeout_Drained(t *testing.T) {
+	pool := NewWorkerPool(1)
+	pool.Start()
+
+	task := &mockTask{delay: 10 * time.Millisecond}
+	if !pool.Submit(task) {
+		t.Fatal("Failed to submit task")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if err := pool.StopWithTimeout(time.Second); err != nil {
+		t.Errorf("Expected clean stop, got %v", err)
+	}
+	if pool.Submit(&mockTask{}) {
+		t.Error("Should not accept tasks after shutdown")
+	}
+}
+
+// blockingTask runs until release is closed
+type blockingTask struct {
+	mockTask
+	release chan struct{}
+}
+
+func (t *blockingTask) Execute(ctx context.Context) error {
+	<-t.release
+	return nil
+}
+
+// waitForActive polls until the pool has want active workers
+func waitForActive(t *testing.T, pool *WorkerPool, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		metrics := pool.GetMetrics()
+		if metrics.ActiveWorkers() == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d active workers, got %d", want, metrics.ActiveWorkers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWorkerPool_Resize(t *testing.T) {
+	pool := NewWorkerPoolWithConfig(1, 10)
+	pool.Start()
+	defer pool.Stop()
+
+	// Growing lets more tasks run at once
+	release := make(chan struct{})
+	pool.Resize(3)
+	if pool.Size() != 3 {
+		t.Fatalf("Expected size 3, got %d", pool.Size())
+	}
+	for i := 0; i < 3; i++ {
+		if !pool.Submit(&blockingTask{release: release}) {
+			t.Fatal("Failed to submit task")
+		}
+	}
+	waitForActive(t, pool, 3)
+	close(release)
+	waitForActive(t, pool, 0)
+
+	// Shrinking retires idle workers, so only one task runs at a time
+	release = make(chan struct{})
+	pool.Resize(1)
+	for i := 0; i < 3; i++ {
+		if !pool.Submit(&blockingTask{release: release}) {
+			t.Fatal("Failed to submit task")
+		}
+	}
+	waitForActive(t, pool, 1)
+	time.Sleep(20 * time.Millisecond)
+	metrics := pool.GetMetrics()
+	if active := metrics.ActiveWorkers(); active != 1 {
+		t.Errorf("Expected 1 active worker after shrinking, got %d", active)
+	}
+	close(release)
+	waitForActive(t, pool, 0)
+}
+
+func TestWorkerPool_QueueDepthAndActiveWorkers(t *testing.T) {
+	pool := NewWorkerPoolWithConfig(2, 10)
+	pool.Start()
+	defer pool.Stop()
+
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		if !pool.Submit(&blockingTask{release: release}) {
+			t.Fatal("Failed to submit task")
+		}
+	}
+	waitForActive(t, pool, 2)
+	if active := pool.ActiveWorkers(); active != 2 {
+		t.Errorf("Expected 2 active workers, got %d", active)
+	}
+	if depth := pool.QueueDepth(); depth != 3 {
+		t.Errorf("Expected queue depth 3, got %d", depth)
+	}
+
+	// Resetting the counters leaves the queue depth alone
+	pool.ResetMetrics()
+	metrics := pool.GetMetrics()
+	if metrics.QueuedTasks() != 3 || metrics.ActiveWorkers() != 2 {
+		t.Errorf("Expected 3 queued and 2 active in metrics, got %d and %d", metrics.QueuedTasks(), metrics.ActiveWorkers())
+	}
+
+	close(release)
+	waitForActive(t, pool, 0)
+	if depth := pool.QueueDepth(); depth != 0 {
+		t.Errorf("Expected empty queue, got %d", depth)
+	}
+}
+
+// countingTask signals done from its callback, failing when fail is set
+type countingTask struct {
+	fail bool
+	done *sync.WaitGroup
+}
+
+func (t *countingTask) Execute(ctx context.Context) error {
+	if t.fail {
+		return errors.New("task failed")
+	}
+	return nil
+}
+
+func (t *countingTask) OnSuccess()          { t.done.Done() }
+func (t *countingTask) OnFailure(err error) { t.done.Done() }
+
+// Run with -race: metrics are read while workers update them
+func TestWorkerPool_MetricsConcurrentReads(t *testing.T) {
+	pool := NewWorkerPoolWithConfig(4, 200)
+	pool.Start()
+	defer pool.Stop()
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				m := pool.GetMetrics()
+				_ = m.CompletedTasks() + m.FailedTasks() + m.QueuedTasks()
+				_ = m.ActiveWorkers()
+				_ = m.ProcessingTime()
+				_ = m.LastProcessed()
+			}
+		}()
+	}
+
+	var done sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		done.Add(1)
+		if !pool.Submit(&countingTask{fail: i%4 == 0, done: &done}) {
+			t.Fatal("Failed to submit task")
+		}
+	}
+	done.Wait()
+	close(stop)
+	readers.Wait()
+
+	metrics := pool.GetMetrics()
+	if metrics.CompletedTasks() != 75 || metrics.FailedTasks() != 25 {
+		t.Errorf("Expected 75 completed and 25 failed, got %d and %d", metrics.CompletedTasks(), metrics.FailedTasks())
+	}
+	if metrics.LastProcessed().IsZero() {
+		t.Error("Expected a last processed time")
+	}
+}
+
+// fillPool starts a pool with one worker and a one-task queue, and fills both
+// with tasks that block until release is closed
+func fillPool(t *testing.T, release chan struct{}) *WorkerPool {
+	t.Helper()
+	pool := NewWorkerPoolWithConfig(1, 1)
+	pool.Start()
+	if !pool.Submit(&blockingTask{release: release}) {
+		t.Fatal("Failed to submit task")
+	}
+	waitForActive(t, pool, 1)
+	if !pool.Submit(&blockingTask{release: release}) {
+		t.Fatal("Failed to submit task")
+	}
+	if pool.Submit(&mockTask{}) {
+		t.Fatal("Expected the queue to be full")
+	}
+	return pool
+}
+
+func TestWorkerPool_SubmitWait(t *testing.T) {
+	release := make(chan struct{})
+	pool := fillPool(t, release)
+	defer pool.Stop()
+
+	task := &mockTask{}
+	result := make(chan error, 1)
+	go func() { result <- pool.SubmitWait(context.Background(), task) }()
+
+	select {
+	case err := <-result:
+		t.Fatalf("SubmitWait returned %v while the queue was full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Freeing a slot lets the waiting task in
+	close(release)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("Expected SubmitWait to succeed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubmitWait did not return once a slot freed up")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		task.mu.Lock()
+		executed := task.executed
+		task.mu.Unlock()
+		if executed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Task submitted with SubmitWait was not executed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWorkerPool_SubmitWaitCancelled(t *testing.T) {
+	release := make(chan struct{})
+	pool := fillPool(t, release)
+	defer pool.Stop()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- pool.SubmitWait(ctx, &mockTask{}) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubmitWait did not return after its context was cancelled")
+	}
+	if depth := pool.QueueDepth(); depth != 1 {
+		t.Errorf("Expected the cancelled task not to be queued, got depth %d", depth)
+	}
+
+	// A stopped pool refuses tasks straight away
+	stopped := NewWorkerPool(1)
+	stopped.Stop()
+	if err := stopped.SubmitWait(context.Background(), &mockTask{}); !errors.Is(err, ErrPoolStopped) {
+		t.Errorf("Expected ErrPoolStopped, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package worker
+
+import "container/heap"
+
+// DefaultPriority is the priority of tasks that do not implement Prioritized
+const DefaultPriority = 0
+
+// Prioritized is implemented by tasks that should be dequeued before others.
+// Higher values run first; tasks with equal priority run in submission order.
+type Prioritized interface {
+	Priority() int
+}
+
+// prioritizedTask adapts a Task to Prioritized
+type prioritizedTask struct {
+	Task
+	priority int
+}
+
+// Priority implements Prioritized
+func (t *prioritizedTask) Priority() int {
+	return t.priority
+}
+
+// WithPriority wraps a task so it is queued with the given priority
+func WithPriority(task Task, priority int) Task {
+	return &prioritizedTask{Task: task, priority: priority}
+}
+
+// priorityOf returns the queue priority of a task
+func priorityOf(task Task) int {
+	if p, ok := task.(Prioritized); ok {
+		return p.Priority()
+	}
+	return DefaultPriority
+}
+
+// queuedTask is an entry in taskQueue
+type queuedTask struct {
+	task     Task
+	priority int
+	seq      uint64
+}
+
+// taskQueue is a heap of waiting tasks ordered by priority, then submission order
+type taskQueue []*queuedTask
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue) Push(x interface{}) {
+	*q = append(*q, x.(*queuedTask))
+}
+
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
+
+var _ heap.Interface = (*taskQueue)(nil)
@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orderTask records the order in which tasks execute
+type orderTask struct {
+	name  string
+	mu    *sync.Mutex
+	order *[]string
+}
+
+func (t *orderTask) Execute(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*t.order = append(*t.order, t.name)
+	return nil
+}
+
+func (t *orderTask) OnSuccess()          {}
+func (t *orderTask) OnFailure(err error) {}
+
+// urgentTask implements Prioritized directly
+type urgentTask struct {
+	orderTask
+}
+
+func (t *urgentTask) Priority() int { return 100 }
+
+func TestWorkerPool_PriorityOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	newTask := func(name string) *orderTask {
+		return &orderTask{name: name, mu: &mu, order: &order}
+	}
+
+	// A single worker that is not started yet, so every task is waiting
+	pool := NewWorkerPoolWithConfig(1, 10)
+	submit := []Task{
+		newTask("default-1"),
+		WithPriority(newTask("low"), -5),
+		WithPriority(newTask("high-1"), 10),
+		newTask("default-2"),
+		&urgentTask{*newTask("urgent")},
+		WithPriority(newTask("high-2"), 10),
+	}
+	for _, task := range submit {
+		if !pool.Submit(task) {
+			t.Fatal("Failed to submit task")
+		}
+	}
+
+	pool.Start()
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		done := len(order) == len(submit)
+		mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	pool.Stop()
+
+	want := []string{"urgent", "high-1", "high-2", "default-1", "default-2", "low"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != len(want) {
+		t.Fatalf("Expected %d tasks to run, got %v", len(want), order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected execution order %v, got %v", want, order)
+		}
+	}
+}
+
+func TestWithPriority(t *testing.T) {
+	task := &mockTask{}
+	if got := priorityOf(task); got != DefaultPriority {
+		t.Errorf("Expected default priority %d, got %d", DefaultPriority, got)
+	}
+
+	wrapped := WithPriority(task, 7)
+	if got := priorityOf(wrapped); got != 7 {
+		t.Errorf("Expected priority 7, got %d", got)
+	}
+
+	// The adapter still runs the wrapped task
+	if err := wrapped.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	wrapped.OnSuccess()
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	if !task.executed || !task.successCalled {
+		t.Error("Wrapped task was not executed")
+	}
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is delivered by SubmitWithResult when the queue has no room
+var ErrQueueFull = errors.New("worker pool queue is full")
+
+// resultTask adapts a Task to report its outcome on a channel once its
+// OnSuccess or OnFailure callback has run
+type resultTask struct {
+	Task
+	result chan error
+	once   sync.Once
+}
+
+// Priority implements Prioritized, keeping the priority of the wrapped task
+func (t *resultTask) Priority() int {
+	return priorityOf(t.Task)
+}
+
+// OnSuccess implements Task
+func (t *resultTask) OnSuccess() {
+	defer t.deliver(nil)
+	t.Task.OnSuccess()
+}
+
+// OnFailure implements Task
+func (t *resultTask) OnFailure(err error) {
+	defer t.deliver(err)
+	t.Task.OnFailure(err)
+}
+
+// deliver sends the task's outcome and closes the channel; later calls do nothing
+func (t *resultTask) deliver(err error) {
+	t.once.Do(func() {
+		t.result <- err
+		close(t.result)
+	})
+}
+
+// SubmitWithResult adds a task to the worker pool queue like Submit and
+// returns a channel that receives the task's execution error, or nil, once
+// its OnSuccess or OnFailure callback has run, and is then closed. A panic
+// in Execute is delivered as an error wrapping ErrTaskPanicked. If the task
+// cannot be queued the channel receives ErrQueueFull or ErrPoolStopped, and
+// a task still queued when the pool stops receives ErrPoolStopped.
+func (p *WorkerPool) SubmitWithResult(task Task) <-chan error {
+	rt := &resultTask{Task: task, result: make(chan error, 1)}
+	if task == nil {
+		rt.deliver(errors.New("task cannot be nil"))
+		return rt.result
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.isStopped:
+		rt.deliver(ErrPoolStopped)
+	case len(p.queue) >= p.queueSize:
+		rt.deliver(ErrQueueFull)
+	default:
+		p.enqueue(rt)
+	}
+	return rt.result
+}
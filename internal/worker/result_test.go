@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// panicTask panics when executed
+type panicTask struct {
+	mockTask
+}
+
+func (t *panicTask) Execute(ctx context.Context) error {
+	panic("boom")
+}
+
+// awaitResult waits for a task's result, failing the test if none arrives
+func awaitResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err, ok := <-result:
+		if !ok {
+			t.Fatal("Result channel closed without a result")
+		}
+		if _, open := <-result; open {
+			t.Error("Expected the result channel to be closed after the result")
+		}
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("No result was delivered")
+		return nil
+	}
+}
+
+func TestWorkerPool_SubmitWithResult(t *testing.T) {
+	pool := NewWorkerPool(1)
+	pool.Start()
+	defer pool.Stop()
+
+	t.Run("success", func(t *testing.T) {
+		task := &mockTask{}
+		if err := awaitResult(t, pool.SubmitWithResult(task)); err != nil {
+			t.Errorf("Expected nil, got %v", err)
+		}
+		task.mu.Lock()
+		defer task.mu.Unlock()
+		if !task.successCalled {
+			t.Error("Expected OnSuccess to run before the result was delivered")
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		task := &mockTask{shouldFail: true}
+		err := awaitResult(t, pool.SubmitWithResult(task))
+		if err == nil || err.Error() != "task failed" {
+			t.Errorf("Expected the task's error, got %v", err)
+		}
+		task.mu.Lock()
+		defer task.mu.Unlock()
+		if !task.failureCalled {
+			t.Error("Expected OnFailure to run before the result was delivered")
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		task := &panicTask{}
+		err := awaitResult(t, pool.SubmitWithResult(task))
+		if !errors.Is(err, ErrTaskPanicked) {
+			t.Errorf("Expected ErrTaskPanicked, got %v", err)
+		}
+		task.mu.Lock()
+		failureCalled := task.failureCalled
+		task.mu.Unlock()
+		if !failureCalled {
+			t.Error("Expected OnFailure to run for a panicking task")
+		}
+
+		// The worker survives the panic
+		if err := awaitResult(t, pool.SubmitWithResult(&mockTask{})); err != nil {
+			t.Errorf("Expected the pool to keep working, got %v", err)
+		}
+	})
+}
+
+func TestWorkerPool_SubmitWithResultNotRun(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewWorkerPoolWithConfig(1, 1)
+	pool.Start()
+	if !pool.Submit(&blockingTask{release: release}) {
+		t.Fatal("Failed to submit task")
+	}
+	waitForActive(t, pool, 1)
+	queued := pool.SubmitWithResult(&mockTask{})
+
+	if err := awaitResult(t, pool.SubmitWithResult(&mockTask{})); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	// The queued task is dropped when the pool stops
+	stopped := make(chan struct{})
+	go func() {
+		pool.Stop()
+		close(stopped)
+	}()
+	if err := awaitResult(t, queued); !errors.Is(err, ErrPoolStopped) {
+		t.Errorf("Expected ErrPoolStopped for the dropped task, got %v", err)
+	}
+	close(release)
+	<-stopped
+
+	if err := awaitResult(t, pool.SubmitWithResult(&mockTask{})); !errors.Is(err, ErrPoolStopped) {
+		t.Errorf("Expected ErrPoolStopped, got %v", err)
+	}
+}
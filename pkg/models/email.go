@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultMaxBodyChars is the body length, in characters, kept by Truncate
+// when no limit is configured
+const DefaultMaxBodyChars = 8000
+
+// Email represents an email message fetched from Gmail.
+type Email struct {
+	ID       string
+	ThreadID string
+	From     string
+	To       []string // recipient addresses, without display names
+	Cc       []string
+	Subject  string
+	Date     time.Time
+	Snippet  string
+	Body     string
+	// Important is set when Gmail labelled the message IMPORTANT
+	Important bool
+
+	Attachments []Attachment
+}
+
+// Truncate strips control characters other than newlines and tabs from the
+// body and shortens it to at most maxChars characters, cutting at the last
+// word boundary and appending an ellipsis. A maxChars of zero or less uses
+// DefaultMaxBodyChars.
+func (e *Email) Truncate(maxChars int) {
+	if maxChars <= 0 {
+		maxChars = DefaultMaxBodyChars
+	}
+
+	body := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, e.Body)
+
+	runes := []rune(body)
+	if len(runes) <= maxChars {
+		e.Body = body
+		return
+	}
+
+	// Leave room for the ellipsis and cut at the last space that fits
+	cut := maxChars - 1
+	for i := cut; i > 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	e.Body = strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
+
+// Attachment describes a file attached to an email. Only metadata is kept;
+// attachment bodies are never downloaded.
+type Attachment struct {
+	Filename  string
+	MimeType  string
+	SizeBytes int64
+	PartID    string
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmail_Truncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		maxChars int
+		want     string
+	}{
+		{
+			name:     "short body is kept",
+			body:     "Lunch at noon?",
+			maxChars: 20,
+			want:     "Lunch at noon?",
+		},
+		{
+			name:     "cuts at a word boundary",
+			body:     "The quarterly report is attached for review",
+			maxChars: 20,
+			want:     "The quarterly…",
+		},
+		{
+			name:     "cuts a single long word",
+			body:     "Supercalifragilisticexpialidocious",
+			maxChars: 10,
+			want:     "Supercali…",
+		},
+		{
+			name:     "counts characters rather than bytes",
+			body:     "Grüße aus München und Köln",
+			maxChars: 18,
+			want:     "Grüße aus München…",
+		},
+		{
+			name:     "strips control characters",
+			body:     "Hello\x00 wor\x1bld\r\n\tBye\x7f",
+			maxChars: 100,
+			want:     "Hello world\n\tBye",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := Email{Body: tt.body}
+			email.Truncate(tt.maxChars)
+			assert.Equal(t, tt.want, email.Body)
+			assert.LessOrEqual(t, utf8.RuneCountInString(email.Body), tt.maxChars)
+		})
+	}
+}
+
+func TestEmail_TruncateDefault(t *testing.T) {
+	email := Email{Body: strings.Repeat("word ", 2*DefaultMaxBodyChars)}
+	email.Truncate(0)
+	assert.Equal(t, DefaultMaxBodyChars, utf8.RuneCountInString(email.Body))
+	assert.True(t, strings.HasSuffix(email.Body, "word…"))
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Thread is a conversation: the emails sharing a Gmail thread ID.
+type Thread struct {
+	ID string
+	// Subject is the subject of the latest email
+	Subject string
+	// Snippet joins the emails' snippets, oldest first
+	Snippet string
+	// Emails are ordered oldest first
+	Emails []Email
+}
+
+// GroupByThread collapses emails into threads by ThreadID. Threads are
+// returned in the order their first email appears; an email without a
+// thread ID forms a thread of its own.
+func GroupByThread(emails []Email) []Thread {
+	var threads []Thread
+	index := make(map[string]int)
+	for _, email := range emails {
+		id := email.ThreadID
+		if id == "" {
+			id = email.ID
+		}
+		i, ok := index[id]
+		if !ok {
+			i = len(threads)
+			index[id] = i
+			threads = append(threads, Thread{ID: id})
+		}
+		threads[i].Emails = append(threads[i].Emails, email)
+	}
+
+	for i := range threads {
+		thread := &threads[i]
+		sort.SliceStable(thread.Emails, func(a, b int) bool {
+			return thread.Emails[a].Date.Before(thread.Emails[b].Date)
+		})
+
+		var snippets []string
+		for _, email := range thread.Emails {
+			if email.Snippet != "" {
+				snippets = append(snippets, email.Snippet)
+			}
+		}
+		thread.Snippet = strings.Join(snippets, "\n")
+		thread.Subject = thread.Emails[len(thread.Emails)-1].Subject
+	}
+	return threads
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupByThread(t *testing.T) {
+	base := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	emails := []Email{
+		{ID: "m3", ThreadID: "t1", Subject: "Re: Launch plan", Snippet: "Sounds good", Date: base.Add(2 * time.Hour)},
+		{ID: "m2", ThreadID: "t2", Subject: "Invoice", Snippet: "Your invoice is ready", Date: base.Add(time.Hour)},
+		{ID: "m1", ThreadID: "t1", Subject: "Launch plan", Snippet: "Here is the plan", Date: base},
+	}
+
+	threads := GroupByThread(emails)
+	require.Len(t, threads, 2)
+
+	launch := threads[0]
+	assert.Equal(t, "t1", launch.ID)
+	assert.Equal(t, "Re: Launch plan", launch.Subject)
+	assert.Equal(t, "Here is the plan\nSounds good", launch.Snippet)
+	require.Len(t, launch.Emails, 2)
+	assert.Equal(t, "m1", launch.Emails[0].ID)
+	assert.Equal(t, "m3", launch.Emails[1].ID)
+
+	invoice := threads[1]
+	assert.Equal(t, "t2", invoice.ID)
+	assert.Equal(t, "Invoice", invoice.Subject)
+	assert.Equal(t, "Your invoice is ready", invoice.Snippet)
+	assert.Len(t, invoice.Emails, 1)
+}
+
+func TestGroupByThread_MissingThreadID(t *testing.T) {
+	threads := GroupByThread([]Email{{ID: "m1"}, {ID: "m2"}})
+	require.Len(t, threads, 2)
+	assert.Equal(t, "m1", threads[0].ID)
+	assert.Equal(t, "m2", threads[1].ID)
+
+	assert.Empty(t, GroupByThread(nil))
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"gmaildigest-go/internal/scheduler"
 	"gmaildigest-go/internal/storage"
 	"gmaildigest-go/internal/worker"
@@ -70,11 +71,10 @@ func TestSchedulerIntegration(t *testing.T) {
 		t.Fatalf("Failed to schedule job: %v", err)
 	}
 
-	// Manually set the job's next run time to the past to force immediate execution
-	sched.JobMu.Lock()
-	job.NextRun = time.Now().Add(-1 * time.Minute)
-	sched.Jobs[job.ID] = job
-	sched.JobMu.Unlock()
+	// Make the job due now to force immediate execution
+	if _, err := sched.RunJobNow(context.Background(), job.ID); err != nil {
+		t.Fatalf("Failed to make job due: %v", err)
+	}
 
 	// Force the scheduler to check for jobs now
 	sched.ForceCheck()
@@ -133,7 +133,10 @@ func TestTokenRefreshService_HandleTokenRefresh_Integration(t *testing.T) {
 
 	// Setup: Storage
 	sqliteStorage := storage.NewSQLiteStorage(db)
-	tokenStore := storage.NewTokenStore(sqliteStorage)
+	tokenStore, err := storage.NewTokenStore(sqliteStorage, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to create token store: %v", err)
+	}
 	userID := "test-user-123"
 	initialToken := &oauth2.Token{
 		AccessToken:  "initial-access-token",
@@ -160,7 +163,7 @@ func TestTokenRefreshService_HandleTokenRefresh_Integration(t *testing.T) {
 		Payload: json.RawMessage(jobPayload),
 	}
 
-	err := tokenRefreshService.HandleTokenRefresh(context.Background(), job)
+	err = tokenRefreshService.HandleTokenRefresh(context.Background(), job)
 	if err != nil {
 		t.Fatalf("HandleTokenRefresh failed: %v", err)
 	}
@@ -177,4 +180,78 @@ func TestTokenRefreshService_HandleTokenRefresh_Integration(t *testing.T) {
 	if refreshedToken.AccessToken != "new-test-access-token" {
 		t.Errorf("Expected new access token to be 'new-test-access-token', got '%s'", refreshedToken.AccessToken)
 	}
-} 
\ No newline at end of file
+} 
+func TestMaintenanceIntegration(t *testing.T) {
+	// Setup: Database
+	db, cleanupDB := setupTestDB(t)
+	defer cleanupDB()
+	// The scheduler loop and workers share the one :memory: database
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	sqliteStorage := storage.NewSQLiteStorage(db)
+	for _, messageID := range []string{"old-message", "new-message"} {
+		if err := sqliteStorage.MarkEmailProcessed(ctx, messageID, "test-user"); err != nil {
+			t.Fatalf("Failed to mark email processed: %v", err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE processed_emails SET processed_at = datetime('now', '-60 days') WHERE message_id = 'old-message'`); err != nil {
+		t.Fatalf("Failed to age processed email: %v", err)
+	}
+
+	// Setup: WorkerPool and Scheduler
+	pool := worker.NewWorkerPool(1)
+	defer pool.Stop()
+	sched, err := scheduler.NewScheduler(ctx, db, pool)
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	defer sched.Stop()
+
+	maintenanceJob := scheduler.NewMaintenanceJob(slog.New(slog.DiscardHandler), sqliteStorage, scheduler.MaintenanceConfig{
+		ProcessedEmailRetention: 30 * 24 * time.Hour,
+	})
+	sched.RegisterHandler(scheduler.MaintenanceJobType, maintenanceJob.HandleMaintenance)
+	if err := sched.ScheduleMaintenance(ctx, scheduler.DefaultMaintenanceSchedule); err != nil {
+		t.Fatalf("Failed to schedule maintenance: %v", err)
+	}
+
+	pool.Start()
+	sched.Start()
+
+	// Action: Force the maintenance job to run now
+	jobs, err := sched.ListJobs(ctx, &scheduler.ListJobsOptions{Type: scheduler.MaintenanceJobType})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected 1 maintenance job, found %d (%v)", len(jobs), err)
+	}
+	if _, err := sched.RunJobNow(ctx, jobs[0].ID); err != nil {
+		t.Fatalf("Failed to make job due: %v", err)
+	}
+	sched.ForceCheck()
+
+	// Verification: the run completes and only the old record is gone
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, err := sched.GetJob(ctx, jobs[0].ID)
+		if err != nil {
+			t.Fatalf("Failed to get maintenance job: %v", err)
+		}
+		if job.Status == scheduler.JobStatusCompleted {
+			break
+		}
+		if job.Status == scheduler.JobStatusFailed || time.Now().After(deadline) {
+			t.Fatalf("Maintenance job did not complete: status %s, error %q", job.Status, job.LastError)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for messageID, want := range map[string]bool{"old-message": false, "new-message": true} {
+		processed, err := sqliteStorage.IsEmailProcessed(ctx, messageID, "test-user")
+		if err != nil {
+			t.Fatalf("Failed to check processed email: %v", err)
+		}
+		if processed != want {
+			t.Errorf("Expected %s processed to be %v, got %v", messageID, want, processed)
+		}
+	}
+}